@@ -1,13 +1,16 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
 	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/lib/pq"
 )
@@ -23,11 +26,24 @@ func (server *Server) createAccount(ctx *gin.Context) {
 		return
 	}
 
+	serial, err := server.store.NextAccountNumberSerial(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	accountNumber, err := utils.NewAccountNumber(request.Currency, server.config.AccountBranchCode, serial)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
 	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
 	response, err := server.store.CreateAccount(ctx, db.CreateAccountParams{
-		Owner:    authPayload.Username,
-		Balance:  0,
-		Currency: request.Currency,
+		Owner:         authPayload.Username,
+		Balance:       0,
+		Currency:      request.Currency,
+		AccountNumber: accountNumber,
 	})
 
 	if err != nil {
@@ -46,8 +62,27 @@ func (server *Server) createAccount(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, response)
 }
 
+type accountResponse struct {
+	db.Account
+	AvailableBalance int64          `json:"available_balance"`
+	Holds            []holdResponse `json:"holds"`
+}
+
+// newAccountResponse reports the account along with its active holds, which are not available for transfers
+func newAccountResponse(account db.Account, activeHolds []db.Hold) accountResponse {
+	rsp := accountResponse{
+		Account:          account,
+		AvailableBalance: account.Balance,
+		Holds:            newHoldsResponse(activeHolds),
+	}
+	for _, hold := range activeHolds {
+		rsp.AvailableBalance -= hold.Amount
+	}
+	return rsp
+}
+
 type GetAccountRequest struct {
-	Id int64 `uri:"id" binding:"required"`
+	ID string `uri:"id" binding:"required,account_id"`
 }
 
 func (server *Server) getAccount(ctx *gin.Context) {
@@ -57,7 +92,8 @@ func (server *Server) getAccount(ctx *gin.Context) {
 		return
 	}
 
-	response, err := server.store.GetAccount(ctx, request.Id)
+	accountID, accountNumber := parseAccountRef(request.ID)
+	response, err := server.getAccountByRef(ctx, accountID, accountNumber)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			ctx.JSON(http.StatusNotFound, errorResponse(err))
@@ -68,18 +104,25 @@ func (server *Server) getAccount(ctx *gin.Context) {
 	}
 
 	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
-	if authPayload.Username != response.Owner {
+	if authPayload.Username != response.Owner && !utils.IsStaffRole(authPayload.Role) {
 		err := errors.New("account doesn't belong to the authenticated user")
 		ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
 		return
 	}
 
-	ctx.JSON(http.StatusOK, response)
+	holds, err := server.store.ListActiveHolds(ctx, response.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newAccountResponse(response, holds))
 }
 
 type ListAccountRequest struct {
-	PageId   int64 `form:"page_id" binding:"required,min=1"`
-	PageSize int64 `form:"page_size" binding:"required,min=5,max=10"`
+	Owner    string `form:"owner" binding:"omitempty,alphanum"`
+	PageId   int64  `form:"page_id" binding:"required,min=1"`
+	PageSize int64  `form:"page_size" binding:"required,min=5,max=10"`
 }
 
 func (server *Server) listAccounts(ctx *gin.Context) {
@@ -89,9 +132,20 @@ func (server *Server) listAccounts(ctx *gin.Context) {
 		return
 	}
 
+	// staff may list the accounts of any owner, depositors only their own
 	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	owner := authPayload.Username
+	if request.Owner != "" && request.Owner != authPayload.Username {
+		if !utils.IsStaffRole(authPayload.Role) {
+			err := errors.New("cannot list accounts of another user")
+			ctx.JSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+		owner = request.Owner
+	}
+
 	response, err := server.store.ListAccounts(ctx, db.ListAccountsParams{
-		Owner:  authPayload.Username,
+		Owner:  owner,
 		Limit:  int32(request.PageSize),
 		Offset: int32(request.PageId-1) * int32(request.PageSize),
 	})
@@ -106,3 +160,19 @@ func (server *Server) listAccounts(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, response)
 }
+
+// parseAccountRef splits an account reference into a numeric ID or an account number
+func parseAccountRef(ref string) (accountID int64, accountNumber string) {
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return id, ""
+	}
+	return 0, ref
+}
+
+// getAccountByRef looks an account up by its ID, or by its account number when no ID is given
+func (server *Server) getAccountByRef(ctx context.Context, accountID int64, accountNumber string) (db.Account, error) {
+	if accountID > 0 {
+		return server.store.GetAccount(ctx, accountID)
+	}
+	return server.store.GetAccountByNumber(ctx, utils.NormalizeAccountNumber(accountNumber))
+}
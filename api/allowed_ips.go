@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/andreanpradanaa/simple-bank-app/audit"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errClientIPNotAllowed       = errors.New("requests from this ip address are not allowed for this user")
+	errClientIPNotAllowedForKey = errors.New("requests from this ip address are not allowed for this api key")
+)
+
+// normalizeCIDRs returns the CIDR ranges in canonical form, without duplicates.
+// It never returns nil, the empty list allows any address.
+func normalizeCIDRs(cidrs []string) ([]string, error) {
+	normalized := make([]string, 0, len(cidrs))
+	seen := make(map[string]bool, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR range %q", cidr)
+		}
+
+		if !seen[network.String()] {
+			seen[network.String()] = true
+			normalized = append(normalized, network.String())
+		}
+	}
+	return normalized, nil
+}
+
+// ipAllowed returns true if the client ip is in one of the CIDR ranges, or if there are none
+func ipAllowed(cidrs []string, clientIP string) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type updateAllowedIPsRequest struct {
+	AllowedIPs []string `json:"allowed_ips" binding:"max=50,dive,cidr"`
+}
+
+// updateAllowedIPs replaces the CIDR ranges the user may call the api from, an
+// empty list allows any address. The list has to allow the address of the request,
+// so that the user does not lock themselves out.
+//
+// The new list applies at once on this instance. The other instances keep the list
+// they cached until it expires, so access tokens are held to a narrowed list
+// everywhere only after AuthCacheDuration. Renewing an access token always checks
+// the stored list, so a stolen refresh token is of no use outside the ranges.
+func (server *Server) updateAllowedIPs(ctx *gin.Context) {
+	var req updateAllowedIPsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	allowedIPs, err := normalizeCIDRs(req.AllowedIPs)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	if !ipAllowed(allowedIPs, ctx.ClientIP()) {
+		err := fmt.Errorf("the allowed ip ranges must include the address of this request, %s", ctx.ClientIP())
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	user, err := server.store.UpdateUserAllowedIPs(ctx, db.UpdateUserAllowedIPsParams{
+		AllowedIps: allowedIPs,
+		Username:   authPayload.Username,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	// only the cache of this instance, the others see the change once their entry expires
+	server.authInfo.Forget(user.Username)
+
+	details := "any address"
+	if len(allowedIPs) > 0 {
+		details = strings.Join(allowedIPs, " ")
+	}
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventAllowedIPsChanged,
+		Actor:   user.Username,
+		Outcome: audit.OutcomeSuccess,
+		Details: details,
+	})
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
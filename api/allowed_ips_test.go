@@ -0,0 +1,313 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/audit"
+	mockaudit "github.com/andreanpradanaa/simple-bank-app/audit/mock"
+	mockdb "github.com/andreanpradanaa/simple-bank-app/db/mock"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPAllowed(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cidrs    []string
+		clientIP string
+		allowed  bool
+	}{
+		{name: "NoAllowlist", cidrs: nil, clientIP: "198.51.100.7", allowed: true},
+		{name: "InRange", cidrs: []string{"203.0.113.0/24"}, clientIP: "203.0.113.7", allowed: true},
+		{name: "InSecondRange", cidrs: []string{"192.0.2.0/24", "203.0.113.0/24"}, clientIP: "203.0.113.7", allowed: true},
+		{name: "OutOfRange", cidrs: []string{"203.0.113.0/24"}, clientIP: "198.51.100.7", allowed: false},
+		{name: "IPv6", cidrs: []string{"2001:db8::/32"}, clientIP: "2001:db8:1::1", allowed: true},
+		{name: "IPv6OutOfRange", cidrs: []string{"2001:db8::/32"}, clientIP: "2001:db9::1", allowed: false},
+		{name: "UnknownClientIP", cidrs: []string{"203.0.113.0/24"}, clientIP: "", allowed: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.allowed, ipAllowed(tc.cidrs, tc.clientIP))
+		})
+	}
+}
+
+func TestNormalizeCIDRs(t *testing.T) {
+	normalized, err := normalizeCIDRs(nil)
+	require.NoError(t, err)
+	require.NotNil(t, normalized)
+	require.Empty(t, normalized)
+
+	normalized, err = normalizeCIDRs([]string{"203.0.113.7/24", "203.0.113.0/24", "2001:DB8::1/32"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"203.0.113.0/24", "2001:db8::/32"}, normalized)
+
+	_, err = normalizeCIDRs([]string{"203.0.113.7"})
+	require.Error(t, err)
+}
+
+func TestUpdateAllowedIPsAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"allowed_ips": []string{"203.0.113.7/24", "198.51.100.0/24"}},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.UpdateUserAllowedIPsParams{
+					AllowedIps: []string{"203.0.113.0/24", "198.51.100.0/24"},
+					Username:   user.Username,
+				}
+				updated := user
+				updated.AllowedIps = arg.AllowedIps
+				store.EXPECT().
+					UpdateUserAllowedIPs(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(updated, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp userResponse
+				err := json.NewDecoder(recorder.Body).Decode(&rsp)
+				require.NoError(t, err)
+				require.Equal(t, []string{"203.0.113.0/24", "198.51.100.0/24"}, rsp.AllowedIPs)
+			},
+		},
+		{
+			name: "AnyAddress",
+			body: gin.H{"allowed_ips": []string{}},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UpdateUserAllowedIPs(gomock.Any(), gomock.Eq(db.UpdateUserAllowedIPsParams{
+						AllowedIps: []string{},
+						Username:   user.Username,
+					})).
+					Times(1).
+					Return(user, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "ExcludesRequestAddress",
+			body: gin.H{"allowed_ips": []string{"198.51.100.0/24"}},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UpdateUserAllowedIPs(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidCIDR",
+			body: gin.H{"allowed_ips": []string{"203.0.113.7"}},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UpdateUserAllowedIPs(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InternalError",
+			body: gin.H{"allowed_ips": []string{"203.0.113.0/24"}},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UpdateUserAllowedIPs(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+			store.EXPECT().TouchSession(gomock.Any(), gomock.Any()).AnyTimes()
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPut, "/users/me/allowed-ips", bytes.NewReader(data))
+			require.NoError(t, err)
+			request.RemoteAddr = "203.0.113.7:54321"
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, utils.DepositorRole, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestAllowedIPsAreEnforced(t *testing.T) {
+	username := utils.RandomOwner()
+	key, apiKey := randomAPIKey(t, username)
+	apiKey.AllowedIps = []string{"192.0.2.0/24"}
+
+	testCases := []struct {
+		name           string
+		userAllowedIPs []string
+		remoteAddr     string
+		forwardedFor   string
+		trustedProxies []string
+		useAPIKey      bool
+		expectedCode   int
+	}{
+		{
+			name:           "NoAllowlist",
+			userAllowedIPs: []string{},
+			remoteAddr:     "198.51.100.7:4321",
+			expectedCode:   http.StatusOK,
+		},
+		{
+			name:           "Allowed",
+			userAllowedIPs: []string{"203.0.113.0/24"},
+			remoteAddr:     "203.0.113.7:4321",
+			expectedCode:   http.StatusOK,
+		},
+		{
+			name:           "NotAllowed",
+			userAllowedIPs: []string{"203.0.113.0/24"},
+			remoteAddr:     "198.51.100.7:4321",
+			expectedCode:   http.StatusForbidden,
+		},
+		{
+			name:           "ForwardedForFromUntrustedPeer",
+			userAllowedIPs: []string{"203.0.113.0/24"},
+			remoteAddr:     "198.51.100.7:4321",
+			forwardedFor:   "203.0.113.7",
+			expectedCode:   http.StatusForbidden,
+		},
+		{
+			name:           "ForwardedForFromTrustedProxy",
+			userAllowedIPs: []string{"203.0.113.0/24"},
+			remoteAddr:     "10.0.0.2:4321",
+			forwardedFor:   "203.0.113.7",
+			trustedProxies: []string{"10.0.0.0/8"},
+			expectedCode:   http.StatusOK,
+		},
+		{
+			name:           "APIKeyAllowed",
+			userAllowedIPs: []string{},
+			remoteAddr:     "192.0.2.10:4321",
+			useAPIKey:      true,
+			expectedCode:   http.StatusOK,
+		},
+		{
+			name:           "APIKeyNotAllowed",
+			userAllowedIPs: []string{},
+			remoteAddr:     "203.0.113.7:4321",
+			useAPIKey:      true,
+			expectedCode:   http.StatusForbidden,
+		},
+		{
+			name:           "APIKeyNotAllowedForUser",
+			userAllowedIPs: []string{"203.0.113.0/24"},
+			remoteAddr:     "192.0.2.10:4321",
+			useAPIKey:      true,
+			expectedCode:   http.StatusForbidden,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			store.EXPECT().
+				GetUserAuthInfo(gomock.Any(), gomock.Eq(username)).
+				AnyTimes().
+				Return(db.GetUserAuthInfoRow{Username: username, AllowedIps: tc.userAllowedIPs}, nil)
+			store.EXPECT().
+				GetAPIKeyByPrefix(gomock.Any(), gomock.Any()).
+				AnyTimes().
+				Return(db.GetAPIKeyByPrefixRow{ApiKey: apiKey, Role: utils.DepositorRole}, nil)
+			store.EXPECT().TouchAPIKey(gomock.Any(), gomock.Any()).AnyTimes()
+
+			auditor := mockaudit.NewMockAuditor(ctrl)
+			if tc.expectedCode == http.StatusForbidden {
+				auditor.EXPECT().
+					Record(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, event audit.Event) error {
+						require.Equal(t, audit.EventAuthRejected, event.Type)
+						require.Equal(t, username, event.Actor)
+						require.Equal(t, audit.OutcomeFailure, event.Outcome)
+						require.NotEmpty(t, event.ClientIP)
+						return nil
+					})
+			} else {
+				auditor.EXPECT().Record(gomock.Any(), gomock.Any()).Times(0)
+			}
+
+			server := newTestServer(t, store)
+			server.auditor = auditor
+			if tc.trustedProxies != nil {
+				require.NoError(t, server.router.SetTrustedProxies(tc.trustedProxies))
+			}
+
+			authPath := "/auth"
+			server.router.GET(
+				authPath,
+				server.authMiddleware(),
+				func(ctx *gin.Context) {
+					ctx.JSON(http.StatusOK, gin.H{})
+				},
+			)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, authPath, nil)
+			require.NoError(t, err)
+			request.RemoteAddr = tc.remoteAddr
+			if tc.forwardedFor != "" {
+				request.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+
+			if tc.useAPIKey {
+				addAPIKeyAuthorization(request, key)
+			} else {
+				addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, username, utils.DepositorRole, time.Minute)
+			}
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, tc.expectedCode, recorder.Code)
+		})
+	}
+}
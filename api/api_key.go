@@ -0,0 +1,242 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/audit"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var errInvalidAPIKey = errors.New("api key is invalid")
+
+type apiKeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	AllowedIPs []string   `json:"allowed_ips"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func newAPIKeyResponse(apiKey db.ApiKey) apiKeyResponse {
+	rsp := apiKeyResponse{
+		ID:         apiKey.ID,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     apiKey.Scopes,
+		AllowedIPs: apiKey.AllowedIps,
+		ExpiresAt:  apiKey.ExpiresAt,
+		CreatedAt:  apiKey.CreatedAt,
+	}
+	if apiKey.LastUsedAt.Valid {
+		rsp.LastUsedAt = &apiKey.LastUsedAt.Time
+	}
+	return rsp
+}
+
+type createAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=64"`
+	Scopes []string `json:"scopes" binding:"required,min=1,dive,scope"`
+	// AllowedIPs are the CIDR ranges the key may be used from, on top of the ones of the user
+	AllowedIPs    []string `json:"allowed_ips" binding:"max=50,dive,cidr"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"required,min=1,max=365"`
+}
+
+type createAPIKeyResponse struct {
+	Key    string         `json:"key"`
+	APIKey apiKeyResponse `json:"api_key"`
+}
+
+// createAPIKey issues a new api key for the logged in user. The key is only
+// ever shown here, and like any token it stops working after a password change.
+func (server *Server) createAPIKey(ctx *gin.Context) {
+	var req createAPIKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	allowedIPs, err := normalizeCIDRs(req.AllowedIPs)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	// a key cannot do more than the session that creates it
+	for _, scope := range req.Scopes {
+		if !authPayload.HasScope(scope) {
+			err := fmt.Errorf("cannot grant the %s scope, the token is missing it", scope)
+			ctx.JSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	key, prefix, secretHash, err := utils.NewAPIKey()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	apiKey, err := server.store.CreateAPIKey(ctx, db.CreateAPIKeyParams{
+		ID:         id,
+		Username:   authPayload.Username,
+		Name:       req.Name,
+		Prefix:     prefix,
+		SecretHash: secretHash,
+		Scopes:     req.Scopes,
+		AllowedIps: allowedIPs,
+		ExpiresAt:  time.Now().AddDate(0, 0, req.ExpiresInDays),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventAPIKeyCreated,
+		Actor:   authPayload.Username,
+		Target:  apiKey.ID.String(),
+		Outcome: audit.OutcomeSuccess,
+		Details: strings.Join(apiKey.Scopes, " "),
+	})
+
+	ctx.JSON(http.StatusOK, createAPIKeyResponse{
+		Key:    key,
+		APIKey: newAPIKeyResponse(apiKey),
+	})
+}
+
+func (server *Server) listAPIKeys(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	apiKeys, err := server.store.ListAPIKeys(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := make([]apiKeyResponse, len(apiKeys))
+	for i, apiKey := range apiKeys {
+		rsp[i] = newAPIKeyResponse(apiKey)
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type revokeAPIKeyRequest struct {
+	ID string `uri:"id" binding:"required,uuid"`
+}
+
+func (server *Server) revokeAPIKey(ctx *gin.Context) {
+	var req revokeAPIKeyRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	apiKey, err := server.store.RevokeAPIKey(ctx, db.RevokeAPIKeyParams{
+		ID:       uuid.MustParse(req.ID),
+		Username: authPayload.Username,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = errors.New("api key not found")
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventAPIKeyRevoked,
+		Actor:   authPayload.Username,
+		Target:  apiKey.Prefix,
+		Outcome: audit.OutcomeSuccess,
+		Details: apiKey.Name,
+	})
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// authenticateAPIKey returns a payload standing for the api key, the same way
+// an access token would, or aborts the request if the key is not valid
+func (server *Server) authenticateAPIKey(ctx *gin.Context, key string) (*token.Payload, bool) {
+	prefix, secret, ok := utils.ParseAPIKey(key)
+	if !ok {
+		server.rejectAuth(ctx, "", errInvalidAPIKey)
+		return nil, false
+	}
+
+	row, err := server.store.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			server.rejectAuth(ctx, "", errInvalidAPIKey)
+			return nil, false
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+		return nil, false
+	}
+	apiKey := row.ApiKey
+
+	if subtle.ConstantTimeCompare([]byte(utils.HashSecretToken(secret)), []byte(apiKey.SecretHash)) != 1 {
+		server.rejectAuth(ctx, apiKey.Username, errInvalidAPIKey)
+		return nil, false
+	}
+
+	if apiKey.RevokedAt.Valid {
+		err := errors.New("api key has been revoked")
+		server.rejectAuth(ctx, apiKey.Username, err)
+		return nil, false
+	}
+
+	if time.Now().After(apiKey.ExpiresAt) {
+		err := errors.New("api key has expired")
+		server.rejectAuth(ctx, apiKey.Username, err)
+		return nil, false
+	}
+
+	if !ipAllowed(apiKey.AllowedIps, ctx.ClientIP()) {
+		server.forbidAuth(ctx, apiKey.Username, errClientIPNotAllowedForKey)
+		return nil, false
+	}
+
+	// Recording the last use is bookkeeping; a failed write must not turn
+	// an otherwise valid request away.
+	err = server.store.TouchAPIKey(ctx, apiKey.ID)
+	if err != nil {
+		log.Println("cannot record api key use:", err)
+	}
+
+	return &token.Payload{
+		ID:        apiKey.ID,
+		Type:      token.TokenTypeAPIKey,
+		Username:  apiKey.Username,
+		Role:      row.Role,
+		Scopes:    apiKey.Scopes,
+		IssuedAt:  apiKey.CreatedAt,
+		ExpiredAt: apiKey.ExpiresAt,
+	}, true
+}
@@ -0,0 +1,654 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mockdb "github.com/andreanpradanaa/simple-bank-app/db/mock"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func randomAPIKey(t *testing.T, username string) (key string, apiKey db.ApiKey) {
+	key, prefix, secretHash, err := utils.NewAPIKey()
+	require.NoError(t, err)
+
+	apiKey = db.ApiKey{
+		ID:         uuid.New(),
+		Username:   username,
+		Name:       utils.RandomString(8),
+		Prefix:     prefix,
+		SecretHash: secretHash,
+		Scopes:     []string{utils.ScopeAccountsRead},
+		ExpiresAt:  time.Now().Add(24 * time.Hour),
+		CreatedAt:  time.Now().Add(-time.Minute),
+	}
+	return
+}
+
+func addAPIKeyAuthorization(request *http.Request, key string) {
+	request.Header.Set(authorizationHeaderKey, fmt.Sprintf("%s %s", "ApiKey", key))
+}
+
+func TestCreateAPIKeyAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"name":            "reporting",
+				"scopes":          []string{utils.ScopeAccountsRead},
+				"expires_in_days": 30,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateAPIKeyParams) (db.ApiKey, error) {
+						require.Equal(t, user.Username, arg.Username)
+						require.Equal(t, "reporting", arg.Name)
+						require.Equal(t, []string{utils.ScopeAccountsRead}, arg.Scopes)
+						require.WithinDuration(t, time.Now().AddDate(0, 0, 30), arg.ExpiresAt, time.Second)
+						require.NotNil(t, arg.AllowedIps)
+						require.Empty(t, arg.AllowedIps)
+						return db.ApiKey{
+							ID:         arg.ID,
+							Username:   arg.Username,
+							Name:       arg.Name,
+							Prefix:     arg.Prefix,
+							SecretHash: arg.SecretHash,
+							Scopes:     arg.Scopes,
+							ExpiresAt:  arg.ExpiresAt,
+						}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp createAPIKeyResponse
+				err := json.NewDecoder(recorder.Body).Decode(&rsp)
+				require.NoError(t, err)
+
+				prefix, _, ok := utils.ParseAPIKey(rsp.Key)
+				require.True(t, ok)
+				require.Equal(t, prefix, rsp.APIKey.Prefix)
+				require.Nil(t, rsp.APIKey.LastUsedAt)
+			},
+		},
+		{
+			name: "AllowedIPs",
+			body: gin.H{
+				"name":            "office",
+				"scopes":          []string{utils.ScopeAccountsRead},
+				"allowed_ips":     []string{"203.0.113.7/24"},
+				"expires_in_days": 30,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateAPIKeyParams) (db.ApiKey, error) {
+						require.Equal(t, []string{"203.0.113.0/24"}, arg.AllowedIps)
+						return db.ApiKey{
+							ID:         arg.ID,
+							Username:   arg.Username,
+							Name:       arg.Name,
+							Prefix:     arg.Prefix,
+							Scopes:     arg.Scopes,
+							AllowedIps: arg.AllowedIps,
+							ExpiresAt:  arg.ExpiresAt,
+						}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp createAPIKeyResponse
+				err := json.NewDecoder(recorder.Body).Decode(&rsp)
+				require.NoError(t, err)
+				require.Equal(t, []string{"203.0.113.0/24"}, rsp.APIKey.AllowedIPs)
+			},
+		},
+		{
+			name: "InvalidAllowedIPs",
+			body: gin.H{
+				"name":            "office",
+				"scopes":          []string{utils.ScopeAccountsRead},
+				"allowed_ips":     []string{"not-a-network"},
+				"expires_in_days": 30,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "UnsupportedScope",
+			body: gin.H{
+				"name":            "reporting",
+				"scopes":          []string{"admin:everything"},
+				"expires_in_days": 30,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "NoScopes",
+			body: gin.H{
+				"name":            "reporting",
+				"scopes":          []string{},
+				"expires_in_days": 30,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "ExpiryTooLong",
+			body: gin.H{
+				"name":            "reporting",
+				"scopes":          []string{utils.ScopeAccountsRead},
+				"expires_in_days": 1000,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InternalError",
+			body: gin.H{
+				"name":            "reporting",
+				"scopes":          []string{utils.ScopeAccountsRead},
+				"expires_in_days": 30,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.ApiKey{}, sql.ErrConnDone)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			url := "/users/me/api_keys"
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, utils.DepositorRole, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestCreateAPIKeyCannotEscalateScopes(t *testing.T) {
+	username := utils.RandomOwner()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		CreateAPIKey(gomock.Any(), gomock.Any()).
+		Times(0)
+	stubAuthInfo(store)
+
+	server := newTestServer(t, store)
+
+	accessToken, _, err := server.tokenMaker.CreateToken(username, time.Minute, token.WithScopes([]string{utils.ScopeAccountsRead}))
+	require.NoError(t, err)
+
+	data, err := json.Marshal(gin.H{
+		"name":            "payments",
+		"scopes":          []string{utils.ScopeAccountsRead, utils.ScopeTransfersWrite},
+		"expires_in_days": 30,
+	})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, "/users/me/api_keys", bytes.NewReader(data))
+	require.NoError(t, err)
+
+	request.Header.Set(authorizationHeaderKey, fmt.Sprintf("%s %s", authorizationTypeBearer, accessToken))
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestListAPIKeysAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	_, apiKey1 := randomAPIKey(t, user.Username)
+	_, apiKey2 := randomAPIKey(t, user.Username)
+	apiKey2.LastUsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		ListAPIKeys(gomock.Any(), gomock.Eq(user.Username)).
+		Times(1).
+		Return([]db.ApiKey{apiKey1, apiKey2}, nil)
+	stubAuthInfo(store)
+
+	server := newTestServer(t, store)
+	recorder := httptest.NewRecorder()
+
+	request, err := http.NewRequest(http.MethodGet, "/users/me/api_keys", nil)
+	require.NoError(t, err)
+
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, utils.DepositorRole, time.Minute)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var rsp []apiKeyResponse
+	err = json.NewDecoder(recorder.Body).Decode(&rsp)
+	require.NoError(t, err)
+	require.Len(t, rsp, 2)
+	require.Equal(t, apiKey1.ID, rsp[0].ID)
+	require.Nil(t, rsp[0].LastUsedAt)
+	require.NotNil(t, rsp[1].LastUsedAt)
+	require.NotContains(t, recorder.Body.String(), apiKey1.SecretHash)
+}
+
+func TestRevokeAPIKeyAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	_, apiKey := randomAPIKey(t, user.Username)
+
+	testCases := []struct {
+		name          string
+		id            string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			id:   apiKey.ID.String(),
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.RevokeAPIKeyParams{
+					ID:       apiKey.ID,
+					Username: user.Username,
+				}
+				store.EXPECT().
+					RevokeAPIKey(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(apiKey, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name: "NotFound",
+			id:   uuid.New().String(),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					RevokeAPIKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.ApiKey{}, sql.ErrNoRows)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidID",
+			id:   "not-a-uuid",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					RevokeAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/users/me/api_keys/%s", tc.id)
+			request, err := http.NewRequest(http.MethodDelete, url, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, utils.DepositorRole, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	username := utils.RandomOwner()
+	key, apiKey := randomAPIKey(t, username)
+
+	revokedKey := apiKey
+	revokedKey.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	expiredKey := apiKey
+	expiredKey.ExpiresAt = time.Now().Add(-time.Minute)
+
+	otherKey, _ := randomAPIKey(t, username)
+	_, wrongSecret, ok := utils.ParseAPIKey(otherKey)
+	require.True(t, ok)
+
+	testCases := []struct {
+		name          string
+		key           string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Eq(apiKey.Prefix)).
+					Times(1).
+					Return(db.GetAPIKeyByPrefixRow{ApiKey: apiKey, Role: utils.BankerRole}, nil)
+				store.EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Eq(apiKey.ID)).
+					Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var payload token.Payload
+				err := json.NewDecoder(recorder.Body).Decode(&payload)
+				require.NoError(t, err)
+				require.Equal(t, apiKey.ID, payload.ID)
+				require.Equal(t, token.TokenTypeAPIKey, payload.Type)
+				require.Equal(t, username, payload.Username)
+				require.Equal(t, utils.BankerRole, payload.Role)
+				require.Equal(t, apiKey.Scopes, payload.Scopes)
+			},
+		},
+		{
+			name: "TouchError",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Eq(apiKey.Prefix)).
+					Times(1).
+					Return(db.GetAPIKeyByPrefixRow{ApiKey: apiKey, Role: utils.BankerRole}, nil)
+				store.EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Eq(apiKey.ID)).
+					Times(1).
+					Return(sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "MalformedKey",
+			key:  "sbk_invalid",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "UnknownKey",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Eq(apiKey.Prefix)).
+					Times(1).
+					Return(db.GetAPIKeyByPrefixRow{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "WrongSecret",
+			key:  "sbk_" + apiKey.Prefix + "_" + wrongSecret,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Eq(apiKey.Prefix)).
+					Times(1).
+					Return(db.GetAPIKeyByPrefixRow{ApiKey: apiKey, Role: utils.DepositorRole}, nil)
+				store.EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "RevokedKey",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Eq(apiKey.Prefix)).
+					Times(1).
+					Return(db.GetAPIKeyByPrefixRow{ApiKey: revokedKey, Role: utils.DepositorRole}, nil)
+				store.EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "ExpiredKey",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Eq(apiKey.Prefix)).
+					Times(1).
+					Return(db.GetAPIKeyByPrefixRow{ApiKey: expiredKey, Role: utils.DepositorRole}, nil)
+				store.EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "InternalError",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.GetAPIKeyByPrefixRow{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+			authPath := "/auth"
+			server.router.GET(
+				authPath,
+				server.authMiddleware(),
+				func(ctx *gin.Context) {
+					ctx.JSON(http.StatusOK, ctx.MustGet(authorizationPayloadKey))
+				},
+			)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, authPath, nil)
+			require.NoError(t, err)
+
+			addAPIKeyAuthorization(request, tc.key)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestAPIKeyCannotManageAPIKeys(t *testing.T) {
+	username := utils.RandomOwner()
+	key, apiKey := randomAPIKey(t, username)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetAPIKeyByPrefix(gomock.Any(), gomock.Eq(apiKey.Prefix)).
+		Times(1).
+		Return(db.GetAPIKeyByPrefixRow{ApiKey: apiKey, Role: utils.DepositorRole}, nil)
+	store.EXPECT().
+		TouchAPIKey(gomock.Any(), gomock.Any()).
+		Times(1)
+	store.EXPECT().
+		CreateAPIKey(gomock.Any(), gomock.Any()).
+		Times(0)
+	stubAuthInfo(store)
+
+	server := newTestServer(t, store)
+	recorder := httptest.NewRecorder()
+
+	data, err := json.Marshal(gin.H{
+		"name":            "escalation",
+		"scopes":          []string{utils.ScopeTransfersWrite},
+		"expires_in_days": 365,
+	})
+	require.NoError(t, err)
+
+	request, err := http.NewRequest(http.MethodPost, "/users/me/api_keys", bytes.NewReader(data))
+	require.NoError(t, err)
+
+	addAPIKeyAuthorization(request, key)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestAPIKeyRequiresLogin(t *testing.T) {
+	username := utils.RandomOwner()
+	key, apiKey := randomAPIKey(t, username)
+
+	testCases := []struct {
+		method string
+		url    string
+	}{
+		{method: http.MethodPost, url: "/users/logout"},
+		{method: http.MethodPost, url: "/users/verify-email/resend"},
+		{method: http.MethodGet, url: "/users/me/api_keys"},
+		{method: http.MethodGet, url: "/users/me/identities"},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.method+" "+tc.url, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// only the api key lookup may reach the store, the handler must not run
+			store := mockdb.NewMockStore(ctrl)
+			store.EXPECT().
+				GetAPIKeyByPrefix(gomock.Any(), gomock.Eq(apiKey.Prefix)).
+				Times(1).
+				Return(db.GetAPIKeyByPrefixRow{ApiKey: apiKey, Role: utils.DepositorRole}, nil)
+			store.EXPECT().
+				TouchAPIKey(gomock.Any(), gomock.Any()).
+				Times(1)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(tc.method, tc.url, nil)
+			require.NoError(t, err)
+
+			addAPIKeyAuthorization(request, key)
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusForbidden, recorder.Code)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/audit"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeaderKey = "X-Request-ID"
+	requestIDKey       = "request_id"
+)
+
+// requestIDPattern limits the request ids accepted from clients to what is safe to log and echo back
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// requestIDMiddleware gives every request an id, the one sent by the client in
+// X-Request-ID if it is well formed, and echoes it in the response
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader(requestIDHeaderKey)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+
+		ctx.Set(requestIDKey, requestID)
+		ctx.Header(requestIDHeaderKey, requestID)
+		ctx.Next()
+	}
+}
+
+// audit records the event along with the client of the request. Failing to record
+// it is only logged, so that the audit log going down does not lock everyone out.
+func (server *Server) audit(ctx *gin.Context, event audit.Event) {
+	event.ClientIP = ctx.ClientIP()
+	event.UserAgent = ctx.Request.UserAgent()
+	event.RequestID = ctx.GetString(requestIDKey)
+
+	err := server.auditor.Record(ctx, event)
+	if err != nil {
+		log.Println("cannot record audit event:", err)
+	}
+}
+
+// outcome is the audit outcome of a check that passed or not
+func outcome(ok bool) string {
+	if ok {
+		return audit.OutcomeSuccess
+	}
+	return audit.OutcomeFailure
+}
+
+type listAuditEventsRequest struct {
+	Actor     string    `form:"actor" binding:"omitempty,alphanum"`
+	EventType string    `form:"event_type"`
+	Outcome   string    `form:"outcome" binding:"omitempty,oneof=success failure"`
+	ClientIP  string    `form:"client_ip" binding:"omitempty,ip"`
+	RequestID string    `form:"request_id"`
+	Since     time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until     time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	PageID    int32     `form:"page_id" binding:"required,min=1"`
+	PageSize  int32     `form:"page_size" binding:"required,min=5,max=100"`
+}
+
+// listAuditEvents lets admins search the audit log, newest events first
+func (server *Server) listAuditEvents(ctx *gin.Context) {
+	var req listAuditEventsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	events, err := server.store.ListAuditEvents(ctx, db.ListAuditEventsParams{
+		Actor:     sql.NullString{String: req.Actor, Valid: req.Actor != ""},
+		EventType: sql.NullString{String: req.EventType, Valid: req.EventType != ""},
+		Outcome:   sql.NullString{String: req.Outcome, Valid: req.Outcome != ""},
+		ClientIp:  sql.NullString{String: req.ClientIP, Valid: req.ClientIP != ""},
+		RequestID: sql.NullString{String: req.RequestID, Valid: req.RequestID != ""},
+		Since:     sql.NullTime{Time: req.Since, Valid: !req.Since.IsZero()},
+		Until:     sql.NullTime{Time: req.Until, Valid: !req.Until.IsZero()},
+		Limit:     req.PageSize,
+		Offset:    (req.PageID - 1) * req.PageSize,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, events)
+}
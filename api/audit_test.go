@@ -0,0 +1,563 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/audit"
+	mockaudit "github.com/andreanpradanaa/simple-bank-app/audit/mock"
+	mockdb "github.com/andreanpradanaa/simple-bank-app/db/mock"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	mockmail "github.com/andreanpradanaa/simple-bank-app/mail/mock"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	testCases := []struct {
+		name      string
+		requestID string
+		echoed    bool
+	}{
+		{name: "FromClient", requestID: "req-123.abc_DEF", echoed: true},
+		{name: "Missing", requestID: "", echoed: false},
+		{name: "Invalid", requestID: "bad id\r\nX-Injected: 1", echoed: false},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			server := newTestServer(t, mockdb.NewMockStore(ctrl))
+
+			var seen string
+			server.router.GET("/request_id", func(ctx *gin.Context) {
+				seen = ctx.GetString(requestIDKey)
+				ctx.Status(http.StatusNoContent)
+			})
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, "/request_id", nil)
+			require.NoError(t, err)
+			request.Header.Set(requestIDHeaderKey, tc.requestID)
+
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusNoContent, recorder.Code)
+
+			echoed := recorder.Header().Get(requestIDHeaderKey)
+			require.Equal(t, seen, echoed)
+			require.Regexp(t, requestIDPattern, echoed)
+			if tc.echoed {
+				require.Equal(t, tc.requestID, echoed)
+			} else {
+				require.NotEqual(t, tc.requestID, echoed)
+			}
+		})
+	}
+}
+
+func TestLoginIsAudited(t *testing.T) {
+	user, password := randomUser(t)
+	requestID := "login-request-1"
+
+	testCases := []struct {
+		name       string
+		password   string
+		buildStubs func(store *mockdb.MockStore)
+		events     []audit.Event
+	}{
+		{
+			name:     "Success",
+			password: password,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(2).Return(db.LoginThrottle{FailedCount: 1}, nil)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+				store.EXPECT().DeleteLoginThrottle(gomock.Any(), gomock.Any()).Times(1).Return(int64(0), nil)
+				store.EXPECT().RefundLoginAttempt(gomock.Any(), gomock.Any()).Times(1)
+				store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Any()).Times(1).Return(db.UserTotp{}, sql.ErrNoRows)
+				store.EXPECT().
+					TouchKnownDevice(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(1), nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateSessionParams) (db.Session, error) {
+						return db.Session{ID: arg.ID, Username: arg.Username, ExpiresAt: arg.ExpiresAt}, nil
+					})
+			},
+			events: []audit.Event{
+				{Type: audit.EventLogin, Actor: user.Username, Outcome: audit.OutcomeSuccess},
+				{Type: audit.EventTokenIssued, Actor: user.Username, Outcome: audit.OutcomeSuccess},
+			},
+		},
+		{
+			name:     "IncorrectPassword",
+			password: "wrong-password",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(2).Return(db.LoginThrottle{FailedCount: 1}, nil)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+			},
+			events: []audit.Event{
+				{Type: audit.EventLogin, Actor: user.Username, Outcome: audit.OutcomeFailure, Details: errIncorrectCredentials.Error()},
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			var recorded []audit.Event
+			auditor := mockaudit.NewMockAuditor(ctrl)
+			auditor.EXPECT().
+				Record(gomock.Any(), gomock.Any()).
+				Times(len(tc.events)).
+				DoAndReturn(func(_ context.Context, event audit.Event) error {
+					recorded = append(recorded, event)
+					return nil
+				})
+
+			server := newTestServer(t, store)
+			server.auditor = auditor
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(gin.H{"username": user.Username, "password": tc.password})
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/users/login", bytes.NewReader(data))
+			require.NoError(t, err)
+			request.Header.Set("User-Agent", "audit-test")
+			request.Header.Set(requestIDHeaderKey, requestID)
+			request.RemoteAddr = "203.0.113.7:4321"
+
+			server.router.ServeHTTP(recorder, request)
+
+			require.Len(t, recorded, len(tc.events))
+			for i, event := range recorded {
+				require.Equal(t, tc.events[i].Type, event.Type)
+				require.Equal(t, tc.events[i].Actor, event.Actor)
+				require.Equal(t, tc.events[i].Outcome, event.Outcome)
+				if tc.events[i].Details != "" {
+					require.Equal(t, tc.events[i].Details, event.Details)
+				}
+				require.Equal(t, "203.0.113.7", event.ClientIP)
+				require.Equal(t, "audit-test", event.UserAgent)
+				require.Equal(t, requestID, event.RequestID)
+			}
+		})
+	}
+}
+
+func TestAuthRejectionIsAudited(t *testing.T) {
+	username := utils.RandomOwner()
+
+	testCases := []struct {
+		name          string
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		expectedActor string
+		audited       bool
+	}{
+		{
+			name: "ExpiredToken",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, username, utils.DepositorRole, -time.Minute)
+			},
+			expectedActor: "",
+			audited:       true,
+		},
+		{
+			name: "RefreshToken",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				refreshToken, _, err := tokenMaker.CreateToken(username, time.Minute, token.WithType(token.TokenTypeRefresh))
+				require.NoError(t, err)
+				request.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+refreshToken)
+			},
+			expectedActor: username,
+			audited:       true,
+		},
+		{
+			name: "NoAuthorization",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+			},
+			audited: false,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			stubAuthInfo(store)
+
+			auditor := mockaudit.NewMockAuditor(ctrl)
+			if tc.audited {
+				auditor.EXPECT().
+					Record(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, event audit.Event) error {
+						require.Equal(t, audit.EventAuthRejected, event.Type)
+						require.Equal(t, tc.expectedActor, event.Actor)
+						require.Equal(t, audit.OutcomeFailure, event.Outcome)
+						require.NotEmpty(t, event.Details)
+						require.NotEmpty(t, event.RequestID)
+						return nil
+					})
+			} else {
+				auditor.EXPECT().Record(gomock.Any(), gomock.Any()).Times(0)
+			}
+
+			server := newTestServer(t, store)
+			server.auditor = auditor
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, "/users/me", nil)
+			require.NoError(t, err)
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusUnauthorized, recorder.Code)
+		})
+	}
+}
+
+func TestAccountChangesAreAudited(t *testing.T) {
+	user, _ := randomUser(t)
+	_, apiKey := randomAPIKey(t, user.Username)
+
+	testCases := []struct {
+		name          string
+		method        string
+		url           string
+		body          gin.H
+		stepUpBinding string
+		buildStubs    func(store *mockdb.MockStore)
+		event         audit.Event
+	}{
+		{
+			name:   "Logout",
+			method: http.MethodPost,
+			url:    "/users/logout",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RevokeToken(gomock.Any(), gomock.Any()).Times(1)
+			},
+			event: audit.Event{Type: audit.EventLogout, Actor: user.Username, Target: user.Username, Outcome: audit.OutcomeSuccess},
+		},
+		{
+			name:   "RevokeAPIKey",
+			method: http.MethodDelete,
+			url:    "/users/me/api_keys/" + apiKey.ID.String(),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RevokeAPIKey(gomock.Any(), gomock.Any()).Times(1).Return(apiKey, nil)
+			},
+			event: audit.Event{Type: audit.EventAPIKeyRevoked, Actor: user.Username, Target: apiKey.Prefix, Outcome: audit.OutcomeSuccess},
+		},
+		{
+			name:   "ChangePasswordIncorrect",
+			method: http.MethodPut,
+			url:    "/users/me/password",
+			body:   gin.H{"current_password": "wrong-password", "new_password": utils.RandomString(12)},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(1).Return(db.LoginThrottle{FailedCount: 1}, nil)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+				store.EXPECT().UpdateUserPassword(gomock.Any(), gomock.Any()).Times(0)
+			},
+			event: audit.Event{Type: audit.EventPasswordChanged, Actor: user.Username, Target: user.Username, Outcome: audit.OutcomeFailure},
+		},
+		{
+			name:   "PasswordReset",
+			method: http.MethodPost,
+			url:    "/users/password-reset/confirm",
+			body:   gin.H{"token": "reset-token", "new_password": utils.RandomString(12)},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ResetPasswordTx(gomock.Any(), gomock.Any()).Times(1).Return(user, nil)
+				store.EXPECT().BlockUserSessions(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(nil, nil)
+			},
+			event: audit.Event{Type: audit.EventPasswordReset, Actor: user.Username, Target: user.Username, Outcome: audit.OutcomeSuccess},
+		},
+		{
+			name:          "DeleteMe",
+			method:        http.MethodDelete,
+			url:           "/users/me",
+			stepUpBinding: deleteAccountBinding,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().DeleteUserTx(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+				store.EXPECT().DeleteLoginThrottle(gomock.Any(), gomock.Any()).Times(1).Return(int64(0), nil)
+			},
+			event: audit.Event{Type: audit.EventUserDeleted, Actor: user.Username, Target: user.Username, Outcome: audit.OutcomeSuccess},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+
+			auditor := mockaudit.NewMockAuditor(ctrl)
+			auditor.EXPECT().
+				Record(gomock.Any(), gomock.Any()).
+				Times(1).
+				DoAndReturn(func(_ context.Context, event audit.Event) error {
+					require.Equal(t, tc.event.Type, event.Type)
+					require.Equal(t, tc.event.Actor, event.Actor)
+					require.Equal(t, tc.event.Target, event.Target)
+					require.Equal(t, tc.event.Outcome, event.Outcome)
+					return nil
+				})
+
+			server := newTestServer(t, store)
+			server.auditor = auditor
+			recorder := httptest.NewRecorder()
+
+			if tc.stepUpBinding != "" {
+				tc.body = gin.H{"step_up_token": createStepUpToken(t, server, user.Username, tc.stepUpBinding)}
+			}
+
+			var body bytes.Buffer
+			if tc.body != nil {
+				err := json.NewEncoder(&body).Encode(tc.body)
+				require.NoError(t, err)
+			}
+
+			request, err := http.NewRequest(tc.method, tc.url, &body)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, utils.DepositorRole, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+		})
+	}
+}
+
+func TestEmailChangeAuditOmitsAddresses(t *testing.T) {
+	user, _ := randomUser(t)
+	newEmail := utils.RandomEmail()
+
+	updatedUser := user
+	updatedUser.Email = newEmail
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+	store.EXPECT().GetLatestEmailVerificationToken(gomock.Any(), gomock.Any()).Times(1).Return(db.EmailVerificationToken{}, sql.ErrNoRows)
+	store.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Times(1).Return(updatedUser, nil)
+	store.EXPECT().CreateEmailVerificationToken(gomock.Any(), gomock.Any()).Times(1).Return(db.EmailVerificationToken{}, nil)
+	stubAuthInfo(store)
+
+	mailer := mockmail.NewMockMailer(ctrl)
+	mailer.EXPECT().SendEmail(gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+
+	auditor := mockaudit.NewMockAuditor(ctrl)
+	auditor.EXPECT().
+		Record(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, event audit.Event) error {
+			require.Equal(t, audit.EventEmailChanged, event.Type)
+			require.Equal(t, user.Username, event.Target)
+			require.NotContains(t, event.Details, user.Email)
+			require.NotContains(t, event.Details, newEmail)
+			return nil
+		})
+
+	server := newTestServer(t, store)
+	server.mailer = mailer
+	server.auditor = auditor
+	recorder := httptest.NewRecorder()
+
+	data, err := json.Marshal(gin.H{"email": newEmail})
+	require.NoError(t, err)
+
+	request, err := http.NewRequest(http.MethodPatch, "/users/me", bytes.NewReader(data))
+	require.NoError(t, err)
+
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, utils.DepositorRole, time.Minute)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestAuditFailureDoesNotBlockLogin(t *testing.T) {
+	user, password := randomUser(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(2).Return(db.LoginThrottle{FailedCount: 1}, nil)
+	store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+	store.EXPECT().DeleteLoginThrottle(gomock.Any(), gomock.Any()).Times(1).Return(int64(0), nil)
+	store.EXPECT().RefundLoginAttempt(gomock.Any(), gomock.Any()).Times(1)
+	store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Any()).Times(1).Return(db.UserTotp{}, sql.ErrNoRows)
+	store.EXPECT().
+		TouchKnownDevice(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(int64(1), nil)
+	store.EXPECT().
+		CreateSession(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, arg db.CreateSessionParams) (db.Session, error) {
+			return db.Session{ID: arg.ID, Username: arg.Username, ExpiresAt: arg.ExpiresAt}, nil
+		})
+
+	auditor := mockaudit.NewMockAuditor(ctrl)
+	auditor.EXPECT().Record(gomock.Any(), gomock.Any()).AnyTimes().Return(sql.ErrConnDone)
+
+	server := newTestServer(t, store)
+	server.auditor = auditor
+	recorder := httptest.NewRecorder()
+
+	data, err := json.Marshal(gin.H{"username": user.Username, "password": password})
+	require.NoError(t, err)
+
+	request, err := http.NewRequest(http.MethodPost, "/users/login", bytes.NewReader(data))
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestListAuditEventsAPI(t *testing.T) {
+	events := []db.AuditEvent{
+		{ID: 2, EventType: audit.EventLogin, Actor: "alice", Outcome: audit.OutcomeFailure, CreatedAt: time.Now()},
+		{ID: 1, EventType: audit.EventLogin, Actor: "alice", Outcome: audit.OutcomeSuccess, CreatedAt: time.Now()},
+	}
+
+	testCases := []struct {
+		name          string
+		query         string
+		role          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "OK",
+			query: "?actor=alice&event_type=user.login&since=2024-01-01T00:00:00Z&page_id=2&page_size=5",
+			role:  utils.AdminRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ListAuditEvents(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.ListAuditEventsParams) ([]db.AuditEvent, error) {
+						require.Equal(t, sql.NullString{String: "alice", Valid: true}, arg.Actor)
+						require.Equal(t, sql.NullString{String: audit.EventLogin, Valid: true}, arg.EventType)
+						require.False(t, arg.Outcome.Valid)
+						require.False(t, arg.ClientIp.Valid)
+						require.True(t, arg.Since.Valid)
+						require.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), arg.Since.Time.UTC())
+						require.False(t, arg.Until.Valid)
+						require.Equal(t, int32(5), arg.Limit)
+						require.Equal(t, int32(5), arg.Offset)
+						return events, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got []db.AuditEvent
+				err := json.NewDecoder(recorder.Body).Decode(&got)
+				require.NoError(t, err)
+				require.Len(t, got, 2)
+				require.Equal(t, int64(2), got[0].ID)
+			},
+		},
+		{
+			name:  "NotAdmin",
+			query: "?page_id=1&page_size=5",
+			role:  utils.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAuditEvents(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:  "InvalidOutcome",
+			query: "?outcome=maybe&page_id=1&page_size=5",
+			role:  utils.AdminRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAuditEvents(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "InvalidSince",
+			query: "?since=yesterday&page_id=1&page_size=5",
+			role:  utils.AdminRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAuditEvents(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "InternalError",
+			query: "?page_id=1&page_size=5",
+			role:  utils.AdminRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ListAuditEvents(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/admin/audit_events"+tc.query, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, "admin", tc.role, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
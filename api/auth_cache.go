@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+)
+
+// authInfoCache remembers the per-user state authMiddleware checks on every
+// request for a short while, so that each request does not hit the database.
+// Changes made through another instance are seen once the entry expires.
+type authInfoCache struct {
+	store    db.Store
+	duration time.Duration
+
+	mu      sync.Mutex
+	entries map[string]authInfoEntry
+}
+
+type authInfoEntry struct {
+	info      db.GetUserAuthInfoRow
+	fetchedAt time.Time
+}
+
+func newAuthInfoCache(store db.Store, duration time.Duration) *authInfoCache {
+	return &authInfoCache{
+		store:    store,
+		duration: duration,
+		entries:  make(map[string]authInfoEntry),
+	}
+}
+
+// Get returns the auth info of the user, from the cache if it is fresh enough
+func (cache *authInfoCache) Get(ctx context.Context, username string) (db.GetUserAuthInfoRow, error) {
+	cache.mu.Lock()
+	entry, ok := cache.entries[username]
+	cache.mu.Unlock()
+
+	if ok && time.Since(entry.fetchedAt) < cache.duration {
+		return entry.info, nil
+	}
+
+	info, err := cache.store.GetUserAuthInfo(ctx, username)
+	if err != nil {
+		return info, err
+	}
+
+	cache.mu.Lock()
+	cache.entries[username] = authInfoEntry{info: info, fetchedAt: time.Now()}
+	cache.mu.Unlock()
+	return info, nil
+}
+
+// Forget drops the cached auth info of the user, so the next lookup reads it again
+func (cache *authInfoCache) Forget(username string) {
+	cache.mu.Lock()
+	delete(cache.entries, username)
+	cache.mu.Unlock()
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const backgroundTaskTimeout = time.Minute
+
+// shutdownTimeout leaves a task started by the last request the time it is allowed to run
+const shutdownTimeout = backgroundTaskTimeout + 5*time.Second
+
+// runInBackground runs the task once the handler returns, so that the response
+// does not wait for it. The task gets a context of its own, the one of the request
+// is canceled as soon as the response is sent. Errors can only be logged.
+func (server *Server) runInBackground(name string, task func(ctx context.Context) error) {
+	server.background.Add(1)
+	go func() {
+		defer server.background.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundTaskTimeout)
+		defer cancel()
+
+		if err := task(ctx); err != nil {
+			log.Printf("cannot %s: %v", name, err)
+		}
+	}()
+}
+
+// waitForBackground waits for the tasks started by runInBackground to finish,
+// or returns an error once the context is done
+func (server *Server) waitForBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		server.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("background tasks still running: %w", ctx.Err())
+	}
+}
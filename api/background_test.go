@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mockdb "github.com/andreanpradanaa/simple-bank-app/db/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartWaitsForBackgroundTasks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().ListRevokedTokens(gomock.Any(), gomock.Any()).Times(1)
+
+	server := newTestServer(t, store)
+
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	server.runInBackground("send test email", func(ctx context.Context) error {
+		<-release
+		close(finished)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.Start(ctx, "127.0.0.1:0")
+	}()
+	cancel()
+
+	// the server does not stop while the task is still running
+	select {
+	case err := <-stopped:
+		t.Fatalf("server stopped before the background task finished: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-stopped)
+	<-finished
+}
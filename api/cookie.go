@@ -0,0 +1,118 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Browser clients can log in with cookies instead of bearer tokens, so that the
+// tokens are out of reach of scripts. The csrf cookie is the one they can read,
+// to send it back in the csrf header of state-changing requests.
+const (
+	accessTokenCookie  = "access_token"
+	refreshTokenCookie = "refresh_token"
+	csrfTokenCookie    = "csrf_token"
+	csrfHeaderKey      = "X-CSRF-Token"
+	// the refresh token is only sent to where it is used
+	refreshTokenCookiePath = "/tokens/renew_access"
+)
+
+var errInvalidCSRFToken = errors.New("csrf token is missing or does not match the csrf cookie")
+
+var cookieSameSiteModes = map[string]http.SameSite{
+	"strict": http.SameSiteStrictMode,
+	"lax":    http.SameSiteLaxMode,
+	"none":   http.SameSiteNoneMode,
+}
+
+// respondWithSession answers a successful login with the tokens of the new session,
+// or, for cookie logins, sets them as cookies along with a new csrf token
+func (server *Server) respondWithSession(ctx *gin.Context, rsp loginUserResponse, useCookies bool) {
+	if useCookies {
+		err := server.setCSRFCookie(ctx, rsp.RefreshTokenExpiresAt)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		server.setCookie(ctx, accessTokenCookie, rsp.AccessToken, "/", rsp.AccessTokenExpiresAt, true)
+		server.setCookie(ctx, refreshTokenCookie, rsp.RefreshToken, refreshTokenCookiePath, rsp.RefreshTokenExpiresAt, true)
+
+		rsp.AccessToken = ""
+		rsp.RefreshToken = ""
+	}
+
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// setCSRFCookie sets a new csrf token, at login and each time the access token is
+// renewed, so that a token that leaked is not good for the whole session
+func (server *Server) setCSRFCookie(ctx *gin.Context, expiresAt time.Time) error {
+	csrfToken, _, err := utils.NewSecretToken()
+	if err != nil {
+		return err
+	}
+
+	server.setCookie(ctx, csrfTokenCookie, csrfToken, "/", expiresAt, false)
+	return nil
+}
+
+// clearAuthCookies removes the cookies of a cookie login, if there are any
+func (server *Server) clearAuthCookies(ctx *gin.Context) {
+	server.setCookie(ctx, accessTokenCookie, "", "/", time.Unix(0, 0), true)
+	server.setCookie(ctx, refreshTokenCookie, "", refreshTokenCookiePath, time.Unix(0, 0), true)
+	server.setCookie(ctx, csrfTokenCookie, "", "/", time.Unix(0, 0), false)
+}
+
+// clearSessionCookies removes the cookies of a cookie login if they belong to the
+// session, for requests that sign a session out without being logged in to it
+func (server *Server) clearSessionCookies(ctx *gin.Context, sessionID uuid.UUID) {
+	accessToken, err := ctx.Cookie(accessTokenCookie)
+	if err != nil || accessToken == "" {
+		return
+	}
+
+	payload, err := server.tokenMaker.VerifyToken(accessToken)
+	if err != nil || payload.SessionID != sessionID {
+		return
+	}
+	server.clearAuthCookies(ctx)
+}
+
+// setCookie sets a cookie with the configured domain and SameSite mode, that is only
+// sent over https unless AuthCookieSecure is turned off for local development.
+// The csrf cookie is the only one that is not HttpOnly.
+func (server *Server) setCookie(ctx *gin.Context, name string, value string, path string, expiresAt time.Time, httpOnly bool) {
+	http.SetCookie(ctx.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   server.config.AuthCookieDomain,
+		Expires:  expiresAt,
+		Secure:   server.config.AuthCookieSecure,
+		HttpOnly: httpOnly,
+		SameSite: cookieSameSiteModes[server.config.AuthCookieSameSite],
+	})
+}
+
+// checkCSRF is the double-submit check of the requests authenticated with cookies.
+// A state-changing request has to repeat the csrf cookie in the csrf header, which
+// another site can make the browser send the cookies with, but cannot read them to copy.
+func checkCSRF(ctx *gin.Context) bool {
+	switch ctx.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	csrfToken, err := ctx.Cookie(csrfTokenCookie)
+	if err != nil || csrfToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(csrfToken), []byte(ctx.GetHeader(csrfHeaderKey))) == 1
+}
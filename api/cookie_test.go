@@ -0,0 +1,527 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/audit"
+	mockaudit "github.com/andreanpradanaa/simple-bank-app/audit/mock"
+	mockdb "github.com/andreanpradanaa/simple-bank-app/db/mock"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// responseCookies returns the cookies set by the response, by name
+func responseCookies(recorder *httptest.ResponseRecorder) map[string]*http.Cookie {
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range recorder.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	return cookies
+}
+
+func TestCookieLoginAPI(t *testing.T) {
+	user, password := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		useCookies    bool
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker)
+	}{
+		{
+			name:       "Cookies",
+			useCookies: true,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp map[string]any
+				err := json.NewDecoder(recorder.Body).Decode(&rsp)
+				require.NoError(t, err)
+				require.NotContains(t, rsp, "access_token")
+				require.NotContains(t, rsp, "refresh_token")
+				require.NotEmpty(t, rsp["session_id"])
+
+				cookies := responseCookies(recorder)
+
+				accessCookie := cookies[accessTokenCookie]
+				require.NotNil(t, accessCookie)
+				require.True(t, accessCookie.HttpOnly)
+				require.True(t, accessCookie.Secure)
+				require.Equal(t, http.SameSiteStrictMode, accessCookie.SameSite)
+				require.Equal(t, "/", accessCookie.Path)
+
+				payload, err := tokenMaker.VerifyToken(accessCookie.Value)
+				require.NoError(t, err)
+				require.Equal(t, token.TokenTypeAccess, payload.Type)
+				require.Equal(t, user.Username, payload.Username)
+
+				refreshCookie := cookies[refreshTokenCookie]
+				require.NotNil(t, refreshCookie)
+				require.True(t, refreshCookie.HttpOnly)
+				require.True(t, refreshCookie.Secure)
+				require.Equal(t, refreshTokenCookiePath, refreshCookie.Path)
+
+				csrfCookie := cookies[csrfTokenCookie]
+				require.NotNil(t, csrfCookie)
+				require.NotEmpty(t, csrfCookie.Value)
+				require.False(t, csrfCookie.HttpOnly)
+				require.True(t, csrfCookie.Secure)
+			},
+		},
+		{
+			name:       "BearerTokens",
+			useCookies: false,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Empty(t, recorder.Result().Cookies())
+
+				var rsp loginUserResponse
+				err := json.NewDecoder(recorder.Body).Decode(&rsp)
+				require.NoError(t, err)
+				require.NotEmpty(t, rsp.AccessToken)
+				require.NotEmpty(t, rsp.RefreshToken)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			store.EXPECT().
+				RecordLoginAttempt(gomock.Any(), gomock.Any()).
+				Times(2).
+				Return(db.LoginThrottle{FailedCount: 1}, nil)
+			store.EXPECT().
+				GetUser(gomock.Any(), gomock.Eq(user.Username)).
+				Times(1).
+				Return(user, nil)
+			store.EXPECT().
+				DeleteLoginThrottle(gomock.Any(), gomock.Any()).
+				Times(1).
+				Return(int64(1), nil)
+			store.EXPECT().
+				RefundLoginAttempt(gomock.Any(), gomock.Any()).
+				Times(1)
+			store.EXPECT().
+				GetUserTOTP(gomock.Any(), gomock.Eq(user.Username)).
+				Times(1).
+				Return(db.UserTotp{}, sql.ErrNoRows)
+			store.EXPECT().
+				TouchKnownDevice(gomock.Any(), gomock.Any()).
+				Times(1).
+				Return(int64(1), nil)
+			store.EXPECT().
+				CreateSession(gomock.Any(), gomock.Any()).
+				Times(1).
+				DoAndReturn(func(_ context.Context, arg db.CreateSessionParams) (db.Session, error) {
+					return db.Session{ID: arg.ID, Username: arg.Username, ExpiresAt: arg.ExpiresAt}, nil
+				})
+
+			server := newTestServer(t, store)
+			recorder := sendJSON(t, server, http.MethodPost, "/users/login", gin.H{
+				"username":    user.Username,
+				"password":    password,
+				"use_cookies": tc.useCookies,
+			}, "")
+			tc.checkResponse(t, recorder, server.tokenMaker)
+		})
+	}
+}
+
+func TestCookieAuthMiddleware(t *testing.T) {
+	username := utils.RandomOwner()
+	csrfToken := utils.RandomString(32)
+
+	testCases := []struct {
+		name         string
+		method       string
+		setupAuth    func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		audited      bool
+		expectedCode int
+	}{
+		{
+			name:   "ReadWithoutCSRFToken",
+			method: http.MethodGet,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAccessTokenCookie(t, request, tokenMaker, username)
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:   "WriteWithCSRFToken",
+			method: http.MethodPost,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAccessTokenCookie(t, request, tokenMaker, username)
+				request.AddCookie(&http.Cookie{Name: csrfTokenCookie, Value: csrfToken})
+				request.Header.Set(csrfHeaderKey, csrfToken)
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:   "WriteWithoutCSRFToken",
+			method: http.MethodPost,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAccessTokenCookie(t, request, tokenMaker, username)
+				request.AddCookie(&http.Cookie{Name: csrfTokenCookie, Value: csrfToken})
+			},
+			audited:      true,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:   "WriteWithWrongCSRFToken",
+			method: http.MethodDelete,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAccessTokenCookie(t, request, tokenMaker, username)
+				request.AddCookie(&http.Cookie{Name: csrfTokenCookie, Value: csrfToken})
+				request.Header.Set(csrfHeaderKey, utils.RandomString(32))
+			},
+			audited:      true,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:   "WriteWithoutCSRFCookie",
+			method: http.MethodPut,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAccessTokenCookie(t, request, tokenMaker, username)
+				request.Header.Set(csrfHeaderKey, "")
+			},
+			audited:      true,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:   "AuthorizationHeaderTakesPrecedence",
+			method: http.MethodPost,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				request.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: "invalid"})
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, username, utils.DepositorRole, time.Minute)
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:   "InvalidCookie",
+			method: http.MethodGet,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				request.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: "invalid"})
+			},
+			audited:      true,
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			stubAuthInfo(store)
+
+			auditor := mockaudit.NewMockAuditor(ctrl)
+			if tc.audited {
+				auditor.EXPECT().
+					Record(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, event audit.Event) error {
+						require.Equal(t, audit.EventAuthRejected, event.Type)
+						require.Equal(t, audit.OutcomeFailure, event.Outcome)
+						return nil
+					})
+			} else {
+				auditor.EXPECT().Record(gomock.Any(), gomock.Any()).Times(0)
+			}
+
+			server := newTestServer(t, store)
+			server.auditor = auditor
+
+			authPath := "/auth"
+			server.router.Handle(
+				tc.method,
+				authPath,
+				server.authMiddleware(),
+				func(ctx *gin.Context) {
+					ctx.JSON(http.StatusOK, gin.H{})
+				},
+			)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(tc.method, authPath, nil)
+			require.NoError(t, err)
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, tc.expectedCode, recorder.Code)
+		})
+	}
+}
+
+func TestRenewAccessTokenWithCookie(t *testing.T) {
+	username := utils.RandomOwner()
+	csrfToken := utils.RandomString(32)
+
+	testCases := []struct {
+		name          string
+		csrfHeader    string
+		buildStubs    func(store *mockdb.MockStore, payload *token.Payload)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:       "OK",
+			csrfHeader: csrfToken,
+			buildStubs: func(store *mockdb.MockStore, payload *token.Payload) {
+				store.EXPECT().
+					GetSession(gomock.Any(), gomock.Eq(payload.ID)).
+					Times(1).
+					Return(randomSession(payload), nil)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(payload.Username)).
+					Times(1).
+					Return(db.User{Username: payload.Username, Role: utils.DepositorRole}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp renewAccessTokenResponse
+				err := json.NewDecoder(recorder.Body).Decode(&rsp)
+				require.NoError(t, err)
+				require.Empty(t, rsp.AccessToken)
+				require.NotZero(t, rsp.AccessTokenExpiresAt)
+
+				cookies := responseCookies(recorder)
+
+				accessCookie := cookies[accessTokenCookie]
+				require.NotNil(t, accessCookie)
+				require.NotEmpty(t, accessCookie.Value)
+				require.True(t, accessCookie.HttpOnly)
+
+				// the csrf token is rotated along with the access token
+				csrfCookie := cookies[csrfTokenCookie]
+				require.NotNil(t, csrfCookie)
+				require.NotEmpty(t, csrfCookie.Value)
+				require.NotEqual(t, csrfToken, csrfCookie.Value)
+				require.False(t, csrfCookie.HttpOnly)
+			},
+		},
+		{
+			name:       "MissingCSRFToken",
+			csrfHeader: "",
+			buildStubs: func(store *mockdb.MockStore, payload *token.Payload) {
+				store.EXPECT().
+					GetSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				require.Empty(t, recorder.Result().Cookies())
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			refreshToken, payload, err := server.tokenMaker.CreateToken(username, time.Hour, token.WithType(token.TokenTypeRefresh))
+			require.NoError(t, err)
+			tc.buildStubs(store, payload)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodPost, "/tokens/renew_access", bytes.NewReader(nil))
+			require.NoError(t, err)
+			request.AddCookie(&http.Cookie{Name: refreshTokenCookie, Value: refreshToken})
+			request.AddCookie(&http.Cookie{Name: csrfTokenCookie, Value: csrfToken})
+			if tc.csrfHeader != "" {
+				request.Header.Set(csrfHeaderKey, tc.csrfHeader)
+			}
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func addAccessTokenCookie(t *testing.T, request *http.Request, tokenMaker token.Maker, username string) {
+	accessToken, _, err := tokenMaker.CreateToken(username, time.Minute, token.WithRole(utils.DepositorRole))
+	require.NoError(t, err)
+	request.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: accessToken})
+}
+
+func TestAuthCookieSecureConfig(t *testing.T) {
+	for _, secure := range []bool{true, false} {
+		ctrl := gomock.NewController(t)
+		server := newTestServer(t, mockdb.NewMockStore(ctrl))
+		server.config.AuthCookieSecure = secure
+
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		err := server.setCSRFCookie(ctx, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+
+		server.setOIDCStateCookie(ctx, "state", time.Now().Add(time.Minute))
+
+		cookies := responseCookies(recorder)
+		require.NotNil(t, cookies[csrfTokenCookie])
+		require.Equal(t, secure, cookies[csrfTokenCookie].Secure)
+		require.NotNil(t, cookies[oidcStateCookieName])
+		require.Equal(t, secure, cookies[oidcStateCookieName].Secure)
+		ctrl.Finish()
+	}
+}
+
+func TestSignOutClearsAuthCookies(t *testing.T) {
+	username := utils.RandomOwner()
+	current := db.Session{ID: uuid.New(), Username: username, ExpiresAt: time.Now().Add(time.Hour)}
+	other := db.Session{ID: uuid.New(), Username: username, ExpiresAt: time.Now().Add(time.Hour)}
+
+	revokeByToken := func(t *testing.T, server *Server, sessionID uuid.UUID) *http.Request {
+		form := url.Values{"token": {createSessionRevokeToken(t, server.tokenMaker, username, sessionID)}}
+		request, err := http.NewRequest(http.MethodPost, "/users/sessions/revoke", strings.NewReader(form.Encode()))
+		require.NoError(t, err)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return request
+	}
+
+	testCases := []struct {
+		name         string
+		buildRequest func(t *testing.T, server *Server) *http.Request
+		buildStubs   func(store *mockdb.MockStore)
+		code         int
+		cleared      bool
+	}{
+		{
+			name: "RevokeCurrentSession",
+			buildRequest: func(t *testing.T, server *Server) *http.Request {
+				request, err := http.NewRequest(http.MethodDelete, "/users/me/sessions/"+current.ID.String(), nil)
+				require.NoError(t, err)
+				return request
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().BlockUserSession(gomock.Any(), gomock.Any()).Times(1).Return(current, nil)
+				store.EXPECT().RevokeToken(gomock.Any(), gomock.Any()).Times(1)
+			},
+			code:    http.StatusNoContent,
+			cleared: true,
+		},
+		{
+			name: "RevokeOtherSession",
+			buildRequest: func(t *testing.T, server *Server) *http.Request {
+				request, err := http.NewRequest(http.MethodDelete, "/users/me/sessions/"+other.ID.String(), nil)
+				require.NoError(t, err)
+				return request
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().BlockUserSession(gomock.Any(), gomock.Any()).Times(1).Return(other, nil)
+				store.EXPECT().RevokeToken(gomock.Any(), gomock.Any()).Times(1)
+			},
+			code:    http.StatusNoContent,
+			cleared: false,
+		},
+		{
+			name: "RevokeByTokenOnSignedOutDevice",
+			buildRequest: func(t *testing.T, server *Server) *http.Request {
+				return revokeByToken(t, server, current.ID)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().BlockUserSession(gomock.Any(), gomock.Any()).Times(1).Return(current, nil)
+				store.EXPECT().RevokeToken(gomock.Any(), gomock.Any()).Times(1)
+			},
+			code:    http.StatusNoContent,
+			cleared: true,
+		},
+		{
+			name: "RevokeByTokenOnAnotherDevice",
+			buildRequest: func(t *testing.T, server *Server) *http.Request {
+				return revokeByToken(t, server, other.ID)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().BlockUserSession(gomock.Any(), gomock.Any()).Times(1).Return(other, nil)
+				store.EXPECT().RevokeToken(gomock.Any(), gomock.Any()).Times(1)
+			},
+			code:    http.StatusNoContent,
+			cleared: false,
+		},
+		{
+			name: "LogoutFailure",
+			buildRequest: func(t *testing.T, server *Server) *http.Request {
+				request, err := http.NewRequest(http.MethodPost, "/users/logout", nil)
+				require.NoError(t, err)
+				return request
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().BlockSession(gomock.Any(), gomock.Any()).Times(1).Return(db.Session{}, sql.ErrConnDone)
+			},
+			code:    http.StatusInternalServerError,
+			cleared: true,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			store.EXPECT().TouchSession(gomock.Any(), gomock.Any()).AnyTimes()
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+
+			// the browser is logged in to the current session with cookies
+			accessToken, _, err := server.tokenMaker.CreateToken(username, time.Minute,
+				token.WithSessionID(current.ID), token.WithRole(utils.DepositorRole))
+			require.NoError(t, err)
+			csrfToken := utils.RandomString(32)
+
+			request := tc.buildRequest(t, server)
+			request.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: accessToken})
+			request.AddCookie(&http.Cookie{Name: csrfTokenCookie, Value: csrfToken})
+			request.Header.Set(csrfHeaderKey, csrfToken)
+
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, tc.code, recorder.Code)
+
+			if !tc.cleared {
+				require.Empty(t, recorder.Result().Cookies())
+				return
+			}
+
+			cookies := responseCookies(recorder)
+			for _, name := range []string{accessTokenCookie, refreshTokenCookie, csrfTokenCookie} {
+				require.NotNil(t, cookies[name])
+				require.Empty(t, cookies[name].Value)
+				require.True(t, cookies[name].Expires.Before(time.Now()))
+			}
+		})
+	}
+}
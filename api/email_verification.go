@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+)
+
+var errVerificationEmailSentRecently = errors.New("a verification email was sent recently, please wait before asking for another one")
+
+// sendVerificationEmail emails the user a one-time link to verify their current email
+func (server *Server) sendVerificationEmail(ctx context.Context, user db.User) error {
+	verificationToken, tokenHash, err := utils.NewSecretToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = server.store.CreateEmailVerificationToken(ctx, db.CreateEmailVerificationTokenParams{
+		Username:  user.Username,
+		Email:     user.Email,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(server.config.EmailVerificationDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := server.config.EmailVerificationURL + "?token=" + url.QueryEscape(verificationToken)
+	content := fmt.Sprintf(`Hello %s,
+
+Please verify your email by opening the link below within %s:
+
+%s
+`, user.FullName, server.config.EmailVerificationDuration, link)
+
+	return server.mailer.SendEmail([]string{user.Email}, "Verify your Simple Bank email", content)
+}
+
+type verifyEmailRequest struct {
+	Token string `form:"token" binding:"required"`
+}
+
+func (server *Server) verifyEmail(ctx *gin.Context) {
+	var req verifyEmailRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	user, err := server.store.VerifyEmailTx(ctx, utils.HashSecretToken(req.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = errors.New("invalid or expired email verification token")
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.authInfo.Forget(user.Username)
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+type resendVerificationEmailResponse struct {
+	Message string `json:"message"`
+}
+
+// resendVerificationEmail sends a new verification link, at most once every
+// EmailVerificationResendInterval per user
+func (server *Server) resendVerificationEmail(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if user.IsEmailVerified {
+		err := errors.New("email is already verified")
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	retryAfter, err := server.verificationEmailRetryAfter(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if retryAfter > 0 {
+		ctx.Header("Retry-After", fmt.Sprint(int(retryAfter.Seconds())+1))
+		ctx.JSON(http.StatusTooManyRequests, errorResponse(errVerificationEmailSentRecently))
+		return
+	}
+
+	err = server.sendVerificationEmail(ctx, user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, resendVerificationEmailResponse{
+		Message: "a verification email has been sent to " + user.Email,
+	})
+}
+
+// verificationEmailRetryAfter returns how long the user has to wait before another
+// verification email can be sent to them, 0 if one can be sent now
+func (server *Server) verificationEmailRetryAfter(ctx context.Context, username string) (time.Duration, error) {
+	latest, err := server.store.GetLatestEmailVerificationToken(ctx, username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if wait := server.config.EmailVerificationResendInterval - time.Since(latest.CreatedAt); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
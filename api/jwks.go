@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/gin-gonic/gin"
+)
+
+// getJWKS publishes the public keys tokens are signed with. The set is empty
+// when tokens are signed with a symmetric key, which is never published.
+func (server *Server) getJWKS(ctx *gin.Context) {
+	set := token.JSONWebKeySet{Keys: []token.JSONWebKey{}}
+	if maker, ok := server.tokenMaker.(token.PublicKeyMaker); ok {
+		set = maker.Keyring().JSONWebKeySet()
+	}
+
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, set)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mockdb "github.com/andreanpradanaa/simple-bank-app/db/mock"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetJWKSAPI(t *testing.T) {
+	_, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	keyring, err := token.NewKeyring("2024-01", signingKey)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		tokenMaker    func(t *testing.T) token.Maker
+		checkResponse func(t *testing.T, set token.JSONWebKeySet)
+	}{
+		{
+			name: "PublicKeys",
+			tokenMaker: func(t *testing.T) token.Maker {
+				maker, err := token.NewPasetoPublicMaker(keyring)
+				require.NoError(t, err)
+				return maker
+			},
+			checkResponse: func(t *testing.T, set token.JSONWebKeySet) {
+				require.Len(t, set.Keys, 1)
+				require.Equal(t, "2024-01", set.Keys[0].KeyID)
+				require.Equal(t, token.AlgorithmEdDSA, set.Keys[0].Algorithm)
+			},
+		},
+		{
+			name: "SymmetricKey",
+			tokenMaker: func(t *testing.T) token.Maker {
+				maker, err := token.NewPasetoMaker(utils.RandomString(32))
+				require.NoError(t, err)
+				return maker
+			},
+			checkResponse: func(t *testing.T, set token.JSONWebKeySet) {
+				require.Empty(t, set.Keys)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+			server.tokenMaker = tc.tokenMaker(t)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusOK, recorder.Code)
+
+			var set token.JSONWebKeySet
+			err = json.NewDecoder(recorder.Body).Decode(&set)
+			require.NoError(t, err)
+			require.NotNil(t, set.Keys)
+			tc.checkResponse(t, set)
+		})
+	}
+}
+
+func TestAuthMiddlewareWithPublicKeyTokens(t *testing.T) {
+	_, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	keyring, err := token.NewKeyring("2024-01", signingKey)
+	require.NoError(t, err)
+
+	maker, err := token.NewJWTPublicMaker(keyring, token.AlgorithmEdDSA)
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		ListAccounts(gomock.Any(), gomock.Any()).
+		Times(1)
+	stubAuthInfo(store)
+
+	server := newTestServer(t, store)
+	server.tokenMaker = maker
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/accounts?page_id=1&page_size=5", nil)
+	require.NoError(t, err)
+
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, utils.RandomOwner(), utils.DepositorRole, time.Minute)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/audit"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/notify"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/gin-gonic/gin"
+)
+
+// Devices are fingerprinted with the network they are in rather than their address,
+// so that a device stays known when its provider gives it another address
+const (
+	deviceIPv4PrefixLength = 24
+	deviceIPv6PrefixLength = 48
+)
+
+var errInvalidSessionRevokeToken = errors.New("invalid or expired session revoke token")
+
+// deviceIPRange returns the network of the client ip, in CIDR notation
+func deviceIPRange(clientIP string) string {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return clientIP
+	}
+
+	mask := net.CIDRMask(deviceIPv6PrefixLength, 8*net.IPv6len)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		mask = net.CIDRMask(deviceIPv4PrefixLength, 8*net.IPv4len)
+	}
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+}
+
+// deviceFingerprint identifies a device by its user agent and ip range
+func deviceFingerprint(userAgent string, ipRange string) string {
+	digest := sha256.Sum256([]byte(userAgent + "\n" + ipRange))
+	return hex.EncodeToString(digest[:])
+}
+
+// checkLoginDevice remembers the device the session was created from. When the user
+// has logged in before, but never from this device, they are notified with a link
+// to sign the new session out.
+func (server *Server) checkLoginDevice(ctx *gin.Context, user db.User, session db.Session) error {
+	userAgent := ctx.Request.UserAgent()
+	clientIP := ctx.ClientIP()
+	ipRange := deviceIPRange(clientIP)
+	fingerprint := deviceFingerprint(userAgent, ipRange)
+
+	touched, err := server.store.TouchKnownDevice(ctx, db.TouchKnownDeviceParams{
+		Username:    user.Username,
+		Fingerprint: fingerprint,
+	})
+	if err != nil {
+		return err
+	}
+	if touched > 0 {
+		return nil
+	}
+
+	knownDevices, err := server.store.CountKnownDevices(ctx, user.Username)
+	if err != nil {
+		return err
+	}
+
+	_, err = server.store.CreateKnownDevice(ctx, db.CreateKnownDeviceParams{
+		Username:    user.Username,
+		Fingerprint: fingerprint,
+		UserAgent:   userAgent,
+		IpRange:     ipRange,
+	})
+	if err != nil {
+		// another login from the same device has just added it
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	// the first device of the user is not news to them
+	if knownDevices == 0 {
+		return nil
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventNewDeviceLogin,
+		Actor:   user.Username,
+		Target:  session.ID.String(),
+		Outcome: audit.OutcomeSuccess,
+		Details: "from " + ipRange,
+	})
+
+	revokeToken, _, err := server.tokenMaker.CreateToken(
+		user.Username,
+		server.config.RefreshTokenDuration,
+		token.WithType(token.TokenTypeSessionRevoke),
+		token.WithSessionID(session.ID),
+		token.WithRole(user.Role),
+	)
+	if err != nil {
+		return err
+	}
+
+	// the login does not wait for the delivery, and a failure is only logged
+	login := notify.NewDeviceLogin{
+		Username:   user.Username,
+		FullName:   user.FullName,
+		Email:      user.Email,
+		UserAgent:  userAgent,
+		ClientIP:   clientIP,
+		LoggedInAt: time.Now(),
+		RevokeURL:  server.config.SessionRevokeURL + "?token=" + url.QueryEscape(revokeToken),
+	}
+	server.runInBackground("send new device login notification", func(ctx context.Context) error {
+		return server.notifier.NotifyNewDeviceLogin(ctx, login)
+	})
+	return nil
+}
+
+type revokeSessionByTokenRequest struct {
+	Token string `form:"token" binding:"required"`
+}
+
+// sessionRevokeConfirmation asks the user to confirm before the session is signed out,
+// so that a mail scanner following the link does not sign it out on its own
+var sessionRevokeConfirmation = template.Must(template.New("session_revoke").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign out the new session</title></head>
+<body>
+<p>Sign out the session started from the new device? Only do this if it was not you.</p>
+<form method="post">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Sign out the session</button>
+</form>
+</body>
+</html>
+`))
+
+// confirmRevokeSessionByToken serves the page the link of a new device login alert
+// opens. It does not change anything, the form on it posts to revokeSessionByToken.
+func (server *Server) confirmRevokeSessionByToken(ctx *gin.Context) {
+	var req revokeSessionByTokenRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := server.tokenMaker.VerifyToken(req.Token)
+	if err != nil || payload.Type != token.TokenTypeSessionRevoke {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidSessionRevokeToken))
+		return
+	}
+
+	var page bytes.Buffer
+	err = sessionRevokeConfirmation.Execute(&page, req.Token)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// the token is in the page, it must not be cached or leak through the referrer
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Referrer-Policy", "no-referrer")
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+// revokeSessionByToken signs out the session of a new device login alert. It takes the
+// token from the alert instead of a login, the user may no longer be able to log in.
+// The token can only be used once.
+func (server *Server) revokeSessionByToken(ctx *gin.Context) {
+	var req revokeSessionByTokenRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := server.tokenMaker.VerifyToken(req.Token)
+	if err != nil || payload.Type != token.TokenTypeSessionRevoke {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidSessionRevokeToken))
+		return
+	}
+
+	consumed, err := server.revocations.Consume(ctx, payload.ID, payload.Username, payload.ExpiredAt)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !consumed {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidSessionRevokeToken))
+		return
+	}
+
+	session, err := server.store.BlockUserSession(ctx, db.BlockUserSessionParams{
+		ID:       payload.SessionID,
+		Username: payload.Username,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = errors.New("session not found or already signed out")
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = server.revocations.Revoke(ctx, session.ID, session.Username, session.ExpiresAt)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	// the alert may be opened on the device that was signed out
+	server.clearSessionCookies(ctx, session.ID)
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventSessionRevoked,
+		Actor:   payload.Username,
+		Target:  session.ID.String(),
+		Outcome: audit.OutcomeSuccess,
+		Details: "from new device login alert",
+	})
+
+	ctx.Status(http.StatusNoContent)
+}
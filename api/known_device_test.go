@@ -0,0 +1,453 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	mockdb "github.com/andreanpradanaa/simple-bank-app/db/mock"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/notify"
+	mocknotify "github.com/andreanpradanaa/simple-bank-app/notify/mock"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceIPRange(t *testing.T) {
+	testCases := []struct {
+		clientIP string
+		ipRange  string
+	}{
+		{clientIP: "203.0.113.7", ipRange: "203.0.113.0/24"},
+		{clientIP: "::ffff:203.0.113.7", ipRange: "203.0.113.0/24"},
+		{clientIP: "2001:db8:1234:5678::1", ipRange: "2001:db8:1234::/48"},
+		{clientIP: "", ipRange: ""},
+		{clientIP: "unknown", ipRange: "unknown"},
+	}
+
+	for _, tc := range testCases {
+		require.Equal(t, tc.ipRange, deviceIPRange(tc.clientIP), tc.clientIP)
+	}
+}
+
+func TestDeviceFingerprint(t *testing.T) {
+	userAgent := "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0"
+
+	fingerprint := deviceFingerprint(userAgent, deviceIPRange("203.0.113.7"))
+	require.Len(t, fingerprint, 64)
+	require.Equal(t, fingerprint, deviceFingerprint(userAgent, deviceIPRange("203.0.113.200")))
+	require.NotEqual(t, fingerprint, deviceFingerprint(userAgent, deviceIPRange("198.51.100.7")))
+	require.NotEqual(t, fingerprint, deviceFingerprint("curl/8.0", deviceIPRange("203.0.113.7")))
+}
+
+func TestLoginNewDeviceAPI(t *testing.T) {
+	user, password := randomUser(t)
+	userAgent := "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0"
+	fingerprint := deviceFingerprint(userAgent, "203.0.113.0/24")
+
+	touchDevice := db.TouchKnownDeviceParams{Username: user.Username, Fingerprint: fingerprint}
+	createDevice := db.CreateKnownDeviceParams{
+		Username:    user.Username,
+		Fingerprint: fingerprint,
+		UserAgent:   userAgent,
+		IpRange:     "203.0.113.0/24",
+	}
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(store *mockdb.MockStore, notifier *mocknotify.MockNotifier)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "KnownDevice",
+			buildStubs: func(store *mockdb.MockStore, notifier *mocknotify.MockNotifier) {
+				store.EXPECT().
+					TouchKnownDevice(gomock.Any(), gomock.Eq(touchDevice)).
+					Times(1).
+					Return(int64(1), nil)
+				store.EXPECT().
+					CreateKnownDevice(gomock.Any(), gomock.Any()).
+					Times(0)
+				notifier.EXPECT().
+					NotifyNewDeviceLogin(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "FirstDevice",
+			buildStubs: func(store *mockdb.MockStore, notifier *mocknotify.MockNotifier) {
+				store.EXPECT().
+					TouchKnownDevice(gomock.Any(), gomock.Eq(touchDevice)).
+					Times(1).
+					Return(int64(0), nil)
+				store.EXPECT().
+					CountKnownDevices(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(int64(0), nil)
+				store.EXPECT().
+					CreateKnownDevice(gomock.Any(), gomock.Eq(createDevice)).
+					Times(1).
+					Return(db.KnownDevice{Username: user.Username, Fingerprint: fingerprint}, nil)
+				notifier.EXPECT().
+					NotifyNewDeviceLogin(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "NewDevice",
+			buildStubs: func(store *mockdb.MockStore, notifier *mocknotify.MockNotifier) {
+				store.EXPECT().
+					TouchKnownDevice(gomock.Any(), gomock.Eq(touchDevice)).
+					Times(1).
+					Return(int64(0), nil)
+				store.EXPECT().
+					CountKnownDevices(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(int64(2), nil)
+				store.EXPECT().
+					CreateKnownDevice(gomock.Any(), gomock.Eq(createDevice)).
+					Times(1).
+					Return(db.KnownDevice{Username: user.Username, Fingerprint: fingerprint}, nil)
+				notifier.EXPECT().
+					NotifyNewDeviceLogin(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, login notify.NewDeviceLogin) error {
+						require.Equal(t, user.Username, login.Username)
+						require.Equal(t, user.Email, login.Email)
+						require.Equal(t, userAgent, login.UserAgent)
+						require.Equal(t, "203.0.113.7", login.ClientIP)
+						require.True(t, strings.HasPrefix(login.RevokeURL, "http://localhost:8080/users/sessions/revoke?token="))
+						return nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "AddedByConcurrentLogin",
+			buildStubs: func(store *mockdb.MockStore, notifier *mocknotify.MockNotifier) {
+				store.EXPECT().
+					TouchKnownDevice(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(0), nil)
+				store.EXPECT().
+					CountKnownDevices(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(1), nil)
+				store.EXPECT().
+					CreateKnownDevice(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.KnownDevice{}, sql.ErrNoRows)
+				notifier.EXPECT().
+					NotifyNewDeviceLogin(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "NotificationFailed",
+			buildStubs: func(store *mockdb.MockStore, notifier *mocknotify.MockNotifier) {
+				store.EXPECT().
+					TouchKnownDevice(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(0), nil)
+				store.EXPECT().
+					CountKnownDevices(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(1), nil)
+				store.EXPECT().
+					CreateKnownDevice(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.KnownDevice{Username: user.Username, Fingerprint: fingerprint}, nil)
+				notifier.EXPECT().
+					NotifyNewDeviceLogin(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(errors.New("connection refused"))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "InternalError",
+			buildStubs: func(store *mockdb.MockStore, notifier *mocknotify.MockNotifier) {
+				store.EXPECT().
+					TouchKnownDevice(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(0), sql.ErrConnDone)
+				notifier.EXPECT().
+					NotifyNewDeviceLogin(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			store.EXPECT().
+				RecordLoginAttempt(gomock.Any(), gomock.Any()).
+				Times(2).
+				Return(db.LoginThrottle{FailedCount: 1}, nil)
+			store.EXPECT().
+				GetUser(gomock.Any(), gomock.Eq(user.Username)).
+				Times(1).
+				Return(user, nil)
+			store.EXPECT().
+				DeleteLoginThrottle(gomock.Any(), gomock.Any()).
+				Times(1).
+				Return(int64(1), nil)
+			store.EXPECT().
+				RefundLoginAttempt(gomock.Any(), gomock.Any()).
+				Times(1)
+			store.EXPECT().
+				GetUserTOTP(gomock.Any(), gomock.Eq(user.Username)).
+				Times(1).
+				Return(db.UserTotp{}, sql.ErrNoRows)
+			store.EXPECT().
+				CreateSession(gomock.Any(), gomock.Any()).
+				Times(1).
+				DoAndReturn(func(_ context.Context, arg db.CreateSessionParams) (db.Session, error) {
+					return db.Session{ID: arg.ID, Username: arg.Username, ExpiresAt: arg.ExpiresAt}, nil
+				})
+
+			notifier := mocknotify.NewMockNotifier(ctrl)
+			tc.buildStubs(store, notifier)
+
+			server := newTestServer(t, store)
+			server.notifier = notifier
+
+			data, err := json.Marshal(gin.H{
+				"username": user.Username,
+				"password": password,
+			})
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/users/login", bytes.NewReader(data))
+			require.NoError(t, err)
+			request.RemoteAddr = "203.0.113.7:54321"
+			request.Header.Set("User-Agent", userAgent)
+
+			recorder := httptest.NewRecorder()
+			server.router.ServeHTTP(recorder, request)
+			server.background.Wait()
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestConfirmRevokeSessionByTokenAPI(t *testing.T) {
+	username := utils.RandomOwner()
+	sessionID := uuid.New()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// opening the link alone must not sign anything out
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(0)
+	store.EXPECT().BlockUserSession(gomock.Any(), gomock.Any()).Times(0)
+
+	server := newTestServer(t, store)
+	revokeToken := createSessionRevokeToken(t, server.tokenMaker, username, sessionID)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/users/sessions/revoke?token="+url.QueryEscape(revokeToken), nil)
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+	require.Contains(t, recorder.Body.String(), `<form method="post">`)
+	require.Contains(t, recorder.Body.String(), `value="`+revokeToken+`"`)
+
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest(http.MethodGet, "/users/sessions/revoke?token=invalid", nil)
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestRevokeSessionByTokenAPI(t *testing.T) {
+	username := utils.RandomOwner()
+	session := db.Session{ID: uuid.New(), Username: username, ExpiresAt: time.Now().Add(time.Hour)}
+
+	testCases := []struct {
+		name          string
+		buildToken    func(t *testing.T, tokenMaker token.Maker) string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server)
+	}{
+		{
+			name: "OK",
+			buildToken: func(t *testing.T, tokenMaker token.Maker) string {
+				return createSessionRevokeToken(t, tokenMaker, username, session.ID)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ConsumeToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(1), nil)
+				store.EXPECT().
+					BlockUserSession(gomock.Any(), gomock.Eq(db.BlockUserSessionParams{ID: session.ID, Username: username})).
+					Times(1).
+					Return(session, nil)
+				store.EXPECT().
+					RevokeToken(gomock.Any(), gomock.Eq(db.RevokeTokenParams{ID: session.ID, Username: username, ExpiresAt: session.ExpiresAt})).
+					Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+				require.True(t, server.revocations.IsRevoked(session.ID))
+			},
+		},
+		{
+			name: "AlreadySignedOut",
+			buildToken: func(t *testing.T, tokenMaker token.Maker) string {
+				return createSessionRevokeToken(t, tokenMaker, username, session.ID)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ConsumeToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(1), nil)
+				store.EXPECT().
+					BlockUserSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Session{}, sql.ErrNoRows)
+				store.EXPECT().
+					RevokeToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "AlreadyUsed",
+			buildToken: func(t *testing.T, tokenMaker token.Maker) string {
+				return createSessionRevokeToken(t, tokenMaker, username, session.ID)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ConsumeToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(0), nil)
+				store.EXPECT().
+					BlockUserSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "AccessToken",
+			buildToken: func(t *testing.T, tokenMaker token.Maker) string {
+				accessToken, _, err := tokenMaker.CreateToken(username, time.Minute, token.WithSessionID(session.ID))
+				require.NoError(t, err)
+				return accessToken
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					BlockUserSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidToken",
+			buildToken: func(t *testing.T, tokenMaker token.Maker) string {
+				return "invalid"
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					BlockUserSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "MissingToken",
+			buildToken: func(t *testing.T, tokenMaker token.Maker) string {
+				return ""
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					BlockUserSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			form := url.Values{"token": {tc.buildToken(t, server.tokenMaker)}}
+			request, err := http.NewRequest(http.MethodPost, "/users/sessions/revoke", strings.NewReader(form.Encode()))
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder, server)
+		})
+	}
+}
+
+func createSessionRevokeToken(t *testing.T, tokenMaker token.Maker, username string, sessionID uuid.UUID) string {
+	revokeToken, _, err := tokenMaker.CreateToken(
+		username,
+		time.Hour,
+		token.WithType(token.TokenTypeSessionRevoke),
+		token.WithSessionID(sessionID),
+	)
+	require.NoError(t, err)
+	return revokeToken
+}
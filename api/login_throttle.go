@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+)
+
+// loginThrottle slows down password guessing. Every failed login delays the next
+// attempt for the same username and for the same client IP exponentially, and
+// locks them out for a while once too many attempts have failed in a row.
+// Attempts are counted before the password is checked, and taken back once it
+// turns out to be right.
+type loginThrottle struct {
+	store           db.Store
+	backoffBase     time.Duration
+	lockoutDuration time.Duration
+	userThreshold   int32
+	ipThreshold     int32
+}
+
+func newLoginThrottle(store db.Store, config utils.Config) *loginThrottle {
+	return &loginThrottle{
+		store:           store,
+		backoffBase:     config.LoginBackoffBase,
+		lockoutDuration: config.LoginLockoutDuration,
+		userThreshold:   int32(config.LoginLockoutThreshold),
+		ipThreshold:     int32(config.LoginIPLockoutThreshold),
+	}
+}
+
+type loginThrottleKey struct {
+	key       string
+	threshold int32
+}
+
+func (throttle *loginThrottle) usernameKey(username string) loginThrottleKey {
+	return loginThrottleKey{key: "username:" + username, threshold: throttle.userThreshold}
+}
+
+// mfaKey counts wrong two-factor codes, apart from the passwords of the username
+func (throttle *loginThrottle) mfaKey(username string) loginThrottleKey {
+	return loginThrottleKey{key: "mfa:" + username, threshold: throttle.userThreshold}
+}
+
+func (throttle *loginThrottle) ipKey(clientIP string) loginThrottleKey {
+	return loginThrottleKey{key: "ip:" + clientIP, threshold: throttle.ipThreshold}
+}
+
+// passwordResetEmailKey and passwordResetIPKey limit how often a password reset can
+// be requested for an email and from a client IP. Every request counts, whether the
+// email is registered or not, and none is taken back.
+func (throttle *loginThrottle) passwordResetEmailKey(email string) loginThrottleKey {
+	return loginThrottleKey{key: "password_reset:" + strings.ToLower(email), threshold: throttle.userThreshold}
+}
+
+func (throttle *loginThrottle) passwordResetIPKey(clientIP string) loginThrottleKey {
+	return loginThrottleKey{key: "password_reset_ip:" + clientIP, threshold: throttle.ipThreshold}
+}
+
+// RetryAfter returns how long the caller has to wait before trying to log in again, 0 if it may try now
+func (throttle *loginThrottle) RetryAfter(ctx context.Context, keys ...loginThrottleKey) (time.Duration, error) {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = key.key
+	}
+
+	throttles, err := throttle.store.GetLoginThrottles(ctx, names)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	var wait time.Duration
+	for _, t := range throttles {
+		if d := throttle.retryAfter(t, now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// retryAfter follows the same rules as the RecordLoginAttempt query
+func (throttle *loginThrottle) retryAfter(t db.LoginThrottle, now time.Time) time.Duration {
+	if t.LockedUntil.Valid && now.Before(t.LockedUntil.Time) {
+		return t.LockedUntil.Time.Sub(now)
+	}
+
+	// failures older than the lockout duration are forgotten
+	if t.FailedCount == 0 || now.Sub(t.LastFailedAt) > throttle.lockoutDuration {
+		return 0
+	}
+
+	delay := throttle.backoffBase
+	for i := int32(1); i < t.FailedCount && delay < throttle.lockoutDuration; i++ {
+		delay *= 2
+	}
+	if delay > throttle.lockoutDuration {
+		delay = throttle.lockoutDuration
+	}
+
+	if next := t.LastFailedAt.Add(delay); now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// Attempt counts a login attempt against every key before the password is checked,
+// so concurrent guesses cannot all get in before the first failure is recorded.
+// It returns how long the caller has to wait if a key is throttled, in which case
+// no attempt is counted. A failed attempt needs nothing more, a successful one is
+// followed by Succeed.
+func (throttle *loginThrottle) Attempt(ctx context.Context, keys ...loginThrottleKey) (time.Duration, error) {
+	now := time.Now()
+	for i, key := range keys {
+		_, err := throttle.store.RecordLoginAttempt(ctx, db.RecordLoginAttemptParams{
+			Key:         key.key,
+			Threshold:   key.threshold,
+			LockedUntil: now.Add(throttle.lockoutDuration),
+			ResetBefore: now.Add(-throttle.lockoutDuration),
+			BackoffBase: throttle.backoffBase.Seconds(),
+			MaxBackoff:  throttle.lockoutDuration.Seconds(),
+		})
+		if err == nil {
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return 0, err
+		}
+
+		// the attempt is rejected, so it must not count against the keys before
+		for _, counted := range keys[:i] {
+			err = throttle.refund(ctx, counted)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		wait, err := throttle.RetryAfter(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		// the throttle can run out in between, the caller still has to try again
+		if wait <= 0 {
+			wait = time.Second
+		}
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// Succeed forgets the failed logins of the username, and takes the attempt back
+// from the other keys, a shared client IP keeps the failures of other users
+func (throttle *loginThrottle) Succeed(ctx context.Context, username loginThrottleKey, others ...loginThrottleKey) error {
+	_, err := throttle.Reset(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range others {
+		err = throttle.refund(ctx, key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (throttle *loginThrottle) refund(ctx context.Context, key loginThrottleKey) error {
+	return throttle.store.RefundLoginAttempt(ctx, db.RefundLoginAttemptParams{
+		Key:       key.key,
+		Threshold: key.threshold,
+	})
+}
+
+// Reset forgets the failed logins of the key, it returns false if there were none
+func (throttle *loginThrottle) Reset(ctx context.Context, key loginThrottleKey) (bool, error) {
+	deleted, err := throttle.store.DeleteLoginThrottle(ctx, key.key)
+	return deleted > 0, err
+}
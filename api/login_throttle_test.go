@@ -0,0 +1,81 @@
+package api
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginThrottleRetryAfter(t *testing.T) {
+	throttle := &loginThrottle{
+		backoffBase:     time.Second,
+		lockoutDuration: 15 * time.Minute,
+	}
+	now := time.Now()
+
+	testCases := []struct {
+		name     string
+		throttle db.LoginThrottle
+		expected time.Duration
+	}{
+		{
+			name:     "FirstFailure",
+			throttle: db.LoginThrottle{FailedCount: 1, LastFailedAt: now},
+			expected: time.Second,
+		},
+		{
+			name:     "Backoff",
+			throttle: db.LoginThrottle{FailedCount: 4, LastFailedAt: now.Add(-3 * time.Second)},
+			expected: 5 * time.Second,
+		},
+		{
+			name:     "BackoffElapsed",
+			throttle: db.LoginThrottle{FailedCount: 2, LastFailedAt: now.Add(-3 * time.Second)},
+			expected: 0,
+		},
+		{
+			name:     "BackoffCapped",
+			throttle: db.LoginThrottle{FailedCount: 30, LastFailedAt: now.Add(-5 * time.Minute)},
+			expected: 10 * time.Minute,
+		},
+		{
+			name:     "AttemptsTakenBack",
+			throttle: db.LoginThrottle{FailedCount: 0, LastFailedAt: now},
+			expected: 0,
+		},
+		{
+			name:     "FailuresForgotten",
+			throttle: db.LoginThrottle{FailedCount: 30, LastFailedAt: now.Add(-time.Hour)},
+			expected: 0,
+		},
+		{
+			name: "Locked",
+			throttle: db.LoginThrottle{
+				FailedCount:  5,
+				LastFailedAt: now.Add(-time.Hour),
+				LockedUntil:  sql.NullTime{Time: now.Add(time.Minute), Valid: true},
+			},
+			expected: time.Minute,
+		},
+		{
+			name: "LockExpired",
+			throttle: db.LoginThrottle{
+				FailedCount:  5,
+				LastFailedAt: now.Add(-time.Hour),
+				LockedUntil:  sql.NullTime{Time: now.Add(-time.Minute), Valid: true},
+			},
+			expected: 0,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, throttle.retryAfter(tc.throttle, now))
+		})
+	}
+}
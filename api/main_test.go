@@ -4,18 +4,56 @@ import (
 	"testing"
 	"time"
 
+	mockaudit "github.com/andreanpradanaa/simple-bank-app/audit/mock"
 	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/mail"
+	mocknotify "github.com/andreanpradanaa/simple-bank-app/notify/mock"
 	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 )
 
 func newTestServer(t *testing.T, store db.Store) *Server {
 	config := utils.Config{
-		TokenSymmetricKey:   utils.RandomString(32),
-		AccessTokenDuration: time.Minute,
+		AuthCookieSecure:                true,
+		TokenSymmetricKey:               utils.RandomString(32),
+		AccessTokenDuration:             time.Minute,
+		RefreshTokenDuration:            time.Hour,
+		AuthCacheDuration:               time.Minute,
+		AccountBranchCode:               "0001",
+		PasswordResetDuration:           30 * time.Minute,
+		PasswordResetURL:                "http://localhost:8080/reset-password",
+		EmailVerificationPolicy:         utils.VerifyEmailOptional,
+		EmailVerificationDuration:       24 * time.Hour,
+		EmailVerificationResendInterval: time.Minute,
+		EmailVerificationURL:            "http://localhost:8080/users/verify-email",
+		SessionRevokeURL:                "http://localhost:8080/users/sessions/revoke",
+		TOTPIssuer:                      "Simple Bank",
+		TOTPEncryptionKey:               utils.RandomString(utils.EncryptionKeySize),
+		MFAChallengeDuration:            5 * time.Minute,
+		LoginBackoffBase:                time.Second,
+		LoginLockoutThreshold:           5,
+		LoginIPLockoutThreshold:         20,
+		LoginLockoutDuration:            15 * time.Minute,
+		WebAuthnRPID:                    "localhost",
+		WebAuthnRPDisplayName:           "Simple Bank",
+		WebAuthnRPOrigins:               []string{"http://localhost:8080"},
+		StepUpThresholds:                map[string]int64{utils.USD: 1000},
+		StepUpDuration:                  time.Minute,
 	}
 
-	server, err := NewServer(config, store)
+	mailer, err := mail.NewOutboxMailer(t.TempDir(), "no-reply@simplebank.local")
+	require.NoError(t, err)
+
+	// tests that check the audit log replace server.auditor with a strict mock
+	auditor := mockaudit.NewMockAuditor(gomock.NewController(t))
+	auditor.EXPECT().Record(gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
+
+	// tests that check the notifications replace server.notifier with a strict mock
+	notifier := mocknotify.NewMockNotifier(gomock.NewController(t))
+	notifier.EXPECT().NotifyNewDeviceLogin(gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
+
+	server, err := NewServer(config, store, mailer, auditor, notifier)
 	require.NoError(t, err)
 
 	return server
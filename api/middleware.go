@@ -1,52 +1,240 @@
 package api
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/andreanpradanaa/simple-bank-app/audit"
 	"github.com/andreanpradanaa/simple-bank-app/token"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 const (
 	authorizationHeaderKey  = "authorization"
 	authorizationTypeBearer = "bearer"
+	authorizationTypeAPIKey = "apikey"
 	authorizationPayloadKey = "authorization_payload"
 )
 
-func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
+func (server *Server) authMiddleware() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		var payload *token.Payload
+		var ok bool
+
 		authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
-		if len(authorizationHeader) == 0 {
+		cookieAccessToken, _ := ctx.Cookie(accessTokenCookie)
+		switch {
+		case len(authorizationHeader) > 0:
+			payload, ok = server.authenticateHeader(ctx, authorizationHeader)
+		case len(cookieAccessToken) > 0:
+			payload, ok = server.authenticateCookie(ctx, cookieAccessToken)
+		default:
+			// requests without credentials are not audited, they are no attempt to authenticate
 			err := errors.New("authorization header is not provided")
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
 			return
 		}
-
-		fields := strings.Fields(authorizationHeader)
-		if len(fields) < 2 {
-			err := errors.New("invalid authorization header format")
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+		if !ok {
 			return
 		}
 
-		authorizationType := strings.ToLower(fields[0])
-		if authorizationType != authorizationTypeBearer {
-			err := fmt.Errorf("unsupported authorization type %s", authorizationType)
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+		if server.revocations.IsRevoked(payload.ID, payload.SessionID) {
+			err := errors.New("token has been revoked")
+			server.rejectAuth(ctx, payload.Username, err)
 			return
 		}
 
-		accessToken := fields[1]
-		payload, err := tokenMaker.VerifyToken(accessToken)
+		authInfo, err := server.authInfo.Get(ctx, payload.Username)
 		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			if err == sql.ErrNoRows {
+				server.rejectAuth(ctx, payload.Username, err)
+				return
+			}
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		if payload.IssuedAt.Before(authInfo.PasswordChangedAt) {
+			err := errors.New("token was issued before the last password change")
+			server.rejectAuth(ctx, payload.Username, err)
+			return
+		}
+
+		if !ipAllowed(authInfo.AllowedIps, ctx.ClientIP()) {
+			server.forbidAuth(ctx, payload.Username, errClientIPNotAllowed)
 			return
 		}
 
+		if payload.SessionID != uuid.Nil {
+			server.sessionActivity.Touch(ctx, payload.SessionID, ctx.ClientIP())
+		}
+
 		ctx.Set(authorizationPayloadKey, payload)
 		ctx.Next()
 	}
 }
+
+// authenticateHeader returns the payload of the bearer token or api key of the
+// authorization header, or aborts the request if it is not valid
+func (server *Server) authenticateHeader(ctx *gin.Context, authorizationHeader string) (*token.Payload, bool) {
+	fields := strings.Fields(authorizationHeader)
+	if len(fields) < 2 {
+		err := errors.New("invalid authorization header format")
+		server.rejectAuth(ctx, "", err)
+		return nil, false
+	}
+
+	authorizationType := strings.ToLower(fields[0])
+	switch authorizationType {
+	case authorizationTypeBearer:
+		return server.authenticateAccessToken(ctx, fields[1])
+	case authorizationTypeAPIKey:
+		return server.authenticateAPIKey(ctx, fields[1])
+	default:
+		err := fmt.Errorf("unsupported authorization type %s", authorizationType)
+		server.rejectAuth(ctx, "", err)
+		return nil, false
+	}
+}
+
+// authenticateCookie returns the payload of the access token cookie of a cookie login,
+// or aborts the request if it is not valid. The browser sends the cookie along with
+// the requests any site makes, so state-changing requests have to pass the csrf check.
+func (server *Server) authenticateCookie(ctx *gin.Context, accessToken string) (*token.Payload, bool) {
+	payload, ok := server.authenticateAccessToken(ctx, accessToken)
+	if !ok {
+		return nil, false
+	}
+
+	if !checkCSRF(ctx) {
+		server.forbidAuth(ctx, payload.Username, errInvalidCSRFToken)
+		return nil, false
+	}
+
+	return payload, true
+}
+
+// authenticateAccessToken returns the payload of the access token, or aborts the request if it is not valid
+func (server *Server) authenticateAccessToken(ctx *gin.Context, accessToken string) (*token.Payload, bool) {
+	payload, err := server.tokenMaker.VerifyToken(accessToken)
+	if err != nil {
+		server.rejectAuth(ctx, "", err)
+		return nil, false
+	}
+
+	if payload.Type != token.TokenTypeAccess {
+		err := errors.New("token is not an access token")
+		server.rejectAuth(ctx, payload.Username, err)
+		return nil, false
+	}
+
+	return payload, true
+}
+
+// rejectAuth aborts the request as unauthorized and records it in the audit log,
+// along with the username the credentials were for when it is known
+func (server *Server) rejectAuth(ctx *gin.Context, username string, err error) {
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventAuthRejected,
+		Actor:   username,
+		Outcome: audit.OutcomeFailure,
+		Details: err.Error(),
+	})
+	ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+}
+
+// forbidAuth aborts the request as forbidden and records it in the audit log,
+// the credentials are valid but may not be used for this request
+func (server *Server) forbidAuth(ctx *gin.Context, username string, err error) {
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventAuthRejected,
+		Actor:   username,
+		Outcome: audit.OutcomeFailure,
+		Details: err.Error(),
+	})
+	ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(err))
+}
+
+// requireLogin rejects requests authenticated with an api key, for the actions
+// only the user themselves may take. It must run after authMiddleware.
+func requireLogin() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+		if authPayload.Type == token.TokenTypeAPIKey {
+			err := errors.New("this action is not allowed with an api key")
+			ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// requireRole only lets through users with one of the given roles, it must run after authMiddleware
+func requireRole(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+		for _, role := range roles {
+			if authPayload.Role == role {
+				ctx.Next()
+				return
+			}
+		}
+
+		err := fmt.Errorf("role %s is not allowed to access this resource", authPayload.Role)
+		ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(err))
+	}
+}
+
+// requireScopes only lets through tokens granted all the given scopes, it must run after authMiddleware
+func requireScopes(scopes ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+		for _, scope := range scopes {
+			if !authPayload.HasScope(scope) {
+				err := fmt.Errorf("token is missing the %s scope", scope)
+				ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(err))
+				return
+			}
+		}
+
+		ctx.Next()
+	}
+}
+
+// requireVerifiedEmail rejects users who have not verified their email yet, when the
+// configured email verification policy is one of the given ones. It must run after authMiddleware.
+func (server *Server) requireVerifiedEmail(policies ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		enforced := false
+		for _, policy := range policies {
+			if server.config.EmailVerificationPolicy == policy {
+				enforced = true
+				break
+			}
+		}
+		if !enforced {
+			ctx.Next()
+			return
+		}
+
+		authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+		authInfo, err := server.authInfo.Get(ctx, authPayload.Username)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		if !authInfo.IsEmailVerified {
+			err := errors.New("email must be verified first")
+			ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,526 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/audit"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcStateCookieName            = "oidc_state"
+	oidcStateCookiePath            = "/oidc"
+	defaultOIDCAuthRequestDuration = 10 * time.Minute
+)
+
+var (
+	errUnknownOIDCProvider = errors.New("unknown oidc provider")
+	errInvalidOIDCState    = errors.New("oidc state is invalid or has expired")
+	errIdentityNotLinked   = errors.New("no user is linked to this identity")
+)
+
+// oidcRelyingParty talks to one provider, once its discovery document has been loaded
+type oidcRelyingParty struct {
+	config   utils.OIDCProviderConfig
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// oidcProviders discovers the configured providers the first time they are used,
+// so that a provider being down does not keep the server from starting
+type oidcProviders struct {
+	configs map[string]utils.OIDCProviderConfig
+
+	mu      sync.Mutex
+	parties map[string]*oidcRelyingParty
+}
+
+func newOIDCProviders(configs []utils.OIDCProviderConfig) (*oidcProviders, error) {
+	providers := &oidcProviders{
+		configs: make(map[string]utils.OIDCProviderConfig),
+		parties: make(map[string]*oidcRelyingParty),
+	}
+
+	for _, config := range configs {
+		if config.Name == "" || config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+			return nil, fmt.Errorf("oidc provider %q must have a name, an issuer, a client id and a redirect url", config.Name)
+		}
+		if _, ok := providers.configs[config.Name]; ok {
+			return nil, fmt.Errorf("oidc provider %q is configured twice", config.Name)
+		}
+		providers.configs[config.Name] = config
+	}
+
+	return providers, nil
+}
+
+// Get returns the relying party for the provider, discovering it on first use
+func (providers *oidcProviders) Get(ctx context.Context, name string) (*oidcRelyingParty, error) {
+	config, ok := providers.configs[name]
+	if !ok {
+		return nil, errUnknownOIDCProvider
+	}
+
+	providers.mu.Lock()
+	defer providers.mu.Unlock()
+
+	if party, ok := providers.parties[name]; ok {
+		return party, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("cannot discover oidc provider %s: %w", name, err)
+	}
+
+	scopes := []string{oidc.ScopeOpenID, "email"}
+	if len(config.Scopes) > 0 {
+		scopes = append([]string{oidc.ScopeOpenID}, config.Scopes...)
+	}
+
+	party := &oidcRelyingParty{
+		config: config,
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  config.RedirectURL,
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+	}
+	providers.parties[name] = party
+	return party, nil
+}
+
+// oidcClaims are the claims of the id token the bank relies on
+type oidcClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// exchange trades the authorization code for the tokens of the user, and returns
+// the claims of the id token once its signature, audience and nonce are checked
+func (party *oidcRelyingParty) exchange(ctx context.Context, code string, authRequest db.OidcAuthRequest) (oidcClaims, error) {
+	var claims oidcClaims
+
+	oauth2Token, err := party.oauth2.Exchange(ctx, code, oauth2.VerifierOption(authRequest.CodeVerifier))
+	if err != nil {
+		return claims, fmt.Errorf("cannot exchange authorization code: %w", err)
+	}
+
+	rawIDToken, ok := oauth2Token.Extra("id_token").(string)
+	if !ok {
+		return claims, errors.New("token response has no id token")
+	}
+
+	idToken, err := party.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return claims, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(authRequest.Nonce)) != 1 {
+		return claims, errors.New("id token nonce does not match")
+	}
+
+	err = idToken.Claims(&claims)
+	return claims, err
+}
+
+type oidcProviderRequest struct {
+	Provider string `uri:"provider" binding:"required"`
+}
+
+// startOIDCLogin sends the browser to the provider to log in
+func (server *Server) startOIDCLogin(ctx *gin.Context) {
+	var req oidcProviderRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authorizationURL, err := server.newOIDCAuthRequest(ctx, req.Provider, "")
+	if err != nil {
+		if err == errUnknownOIDCProvider {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.Redirect(http.StatusFound, authorizationURL)
+}
+
+type linkOIDCIdentityRequest struct {
+	// StepUpToken proves the user authenticated again to link an identity
+	StepUpToken string `json:"step_up_token"`
+}
+
+type linkOIDCIdentityResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// linkOIDCIdentity starts linking an identity at the provider to the logged in user.
+// The client sends the browser to the returned url and the callback does the linking.
+// A linked identity logs in without the password, so it takes a step-up first.
+func (server *Server) linkOIDCIdentity(ctx *gin.Context) {
+	var req oidcProviderRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	// the body is optional, the step-up challenge tells the client what to send
+	var body linkOIDCIdentityRequest
+	if err := ctx.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	if !server.checkStepUp(ctx, body.StepUpToken, identityLinkBinding(req.Provider)) {
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	authorizationURL, err := server.newOIDCAuthRequest(ctx, req.Provider, authPayload.Username)
+	if err != nil {
+		if err == errUnknownOIDCProvider {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, linkOIDCIdentityResponse{AuthorizationURL: authorizationURL})
+}
+
+// identityLinkBinding is the step-up binding of linking an identity at the provider
+func identityLinkBinding(provider string) string {
+	return accountActionBinding("identity_link:" + provider)
+}
+
+// newOIDCAuthRequest records the state, nonce and pkce verifier of a new authorization
+// request and returns the url to send the browser to. The state is also set in a
+// cookie, so that the callback only completes in the browser that started the flow.
+func (server *Server) newOIDCAuthRequest(ctx *gin.Context, providerName string, linkUsername string) (string, error) {
+	party, err := server.oidcProviders.Get(ctx, providerName)
+	if err != nil {
+		return "", err
+	}
+
+	state, stateHash, err := utils.NewSecretToken()
+	if err != nil {
+		return "", err
+	}
+
+	nonce, _, err := utils.NewSecretToken()
+	if err != nil {
+		return "", err
+	}
+
+	codeVerifier := oauth2.GenerateVerifier()
+
+	duration := server.config.OIDCAuthRequestDuration
+	if duration <= 0 {
+		duration = defaultOIDCAuthRequestDuration
+	}
+
+	_, err = server.store.CreateOIDCAuthRequest(ctx, db.CreateOIDCAuthRequestParams{
+		StateHash:    stateHash,
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		LinkUsername: linkUsername,
+		ExpiresAt:    time.Now().Add(duration),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	server.setOIDCStateCookie(ctx, state, time.Now().Add(duration))
+
+	return party.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier)), nil
+}
+
+// setOIDCStateCookie sets the state cookie with the configured domain and secure flag
+// like setCookie, but always lax, since the provider sends the browser back with a
+// top level navigation that a strict cookie would not be sent with
+func (server *Server) setOIDCStateCookie(ctx *gin.Context, state string, expiresAt time.Time) {
+	http.SetCookie(ctx.Writer, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    state,
+		Path:     oidcStateCookiePath,
+		Domain:   server.config.AuthCookieDomain,
+		Expires:  expiresAt,
+		Secure:   server.config.AuthCookieSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+type oidcCallbackRequest struct {
+	Code  string `form:"code"`
+	State string `form:"state" binding:"required"`
+	Error string `form:"error"`
+}
+
+// oidcCallback finishes the flow the provider redirected the browser back from. It
+// logs the user in with the identity, in a cookie session, or links the identity to
+// the user who started the flow with linkOIDCIdentity. The provider's redirect url
+// must point here.
+func (server *Server) oidcCallback(ctx *gin.Context) {
+	var uri oidcProviderRequest
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var req oidcCallbackRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	cookieState, err := ctx.Cookie(oidcStateCookieName)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookieState), []byte(req.State)) != 1 {
+		server.rejectOIDCLogin(ctx, uri.Provider, errInvalidOIDCState)
+		return
+	}
+	server.setOIDCStateCookie(ctx, "", time.Unix(0, 0))
+
+	// the request is used up whatever the outcome, so the state cannot be replayed
+	authRequest, err := server.store.UseOIDCAuthRequest(ctx, db.UseOIDCAuthRequestParams{
+		StateHash: utils.HashSecretToken(req.State),
+		Provider:  uri.Provider,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			server.rejectOIDCLogin(ctx, uri.Provider, errInvalidOIDCState)
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if req.Error != "" {
+		err := fmt.Errorf("oidc provider returned an error: %s", req.Error)
+		server.rejectOIDCLogin(ctx, uri.Provider, err)
+		return
+	}
+
+	if req.Code == "" {
+		err := errors.New("authorization code is missing")
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	party, err := server.oidcProviders.Get(ctx, uri.Provider)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	claims, err := party.exchange(ctx, req.Code, authRequest)
+	if err != nil {
+		server.rejectOIDCLogin(ctx, uri.Provider, err)
+		return
+	}
+
+	if authRequest.LinkUsername != "" {
+		server.linkIdentity(ctx, party.config, authRequest.LinkUsername, claims)
+		return
+	}
+
+	user, err := server.userForIdentity(ctx, party.config, claims)
+	if err != nil {
+		if err == errIdentityNotLinked {
+			server.rejectOIDCLogin(ctx, uri.Provider, err)
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// the browser lands here itself and cannot keep tokens from the body, so the
+	// session is always a cookie session
+	server.finishLogin(ctx, user, nil, "", "oidc "+uri.Provider, true)
+}
+
+// userForIdentity returns the user the identity is linked to. An identity seen for the
+// first time is linked to the user with the same verified email, if the provider is
+// trusted for it, and rejected otherwise.
+func (server *Server) userForIdentity(ctx *gin.Context, config utils.OIDCProviderConfig, claims oidcClaims) (db.User, error) {
+	identity, err := server.store.GetUserIdentity(ctx, db.GetUserIdentityParams{
+		Provider: config.Name,
+		Subject:  claims.Subject,
+	})
+	if err != nil && err != sql.ErrNoRows {
+		return db.User{}, err
+	}
+
+	username := identity.Username
+	if err == sql.ErrNoRows {
+		username, err = server.linkIdentityByEmail(ctx, config, claims)
+		if err != nil {
+			return db.User{}, err
+		}
+	}
+
+	user, err := server.store.GetUser(ctx, username)
+	if err != nil {
+		return db.User{}, err
+	}
+
+	if !user.DeletedAt.IsZero() {
+		return db.User{}, errIdentityNotLinked
+	}
+
+	err = server.store.TouchUserIdentity(ctx, db.TouchUserIdentityParams{
+		Provider: config.Name,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	return user, err
+}
+
+// linkIdentityByEmail links the identity to the user with the same email, when both
+// the provider and the bank have verified that email. It returns the username.
+func (server *Server) linkIdentityByEmail(ctx *gin.Context, config utils.OIDCProviderConfig, claims oidcClaims) (string, error) {
+	if !config.LinkByEmail || !claims.EmailVerified || claims.Email == "" {
+		return "", errIdentityNotLinked
+	}
+
+	user, err := server.store.GetUserByEmail(ctx, claims.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", errIdentityNotLinked
+		}
+		return "", err
+	}
+
+	if !user.IsEmailVerified {
+		return "", errIdentityNotLinked
+	}
+
+	identity, err := server.store.CreateUserIdentity(ctx, db.CreateUserIdentityParams{
+		Provider: config.Name,
+		Subject:  claims.Subject,
+		Username: user.Username,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		// the user is already linked to another identity at the provider
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return "", errIdentityNotLinked
+		}
+		return "", err
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventIdentityLinked,
+		Actor:   identity.Username,
+		Target:  config.Name,
+		Outcome: audit.OutcomeSuccess,
+		Details: "subject " + claims.Subject + ", linked by verified email",
+	})
+
+	return identity.Username, nil
+}
+
+// linkIdentity links the identity to the user who started the flow while logged in
+func (server *Server) linkIdentity(ctx *gin.Context, config utils.OIDCProviderConfig, username string, claims oidcClaims) {
+	identity, err := server.store.CreateUserIdentity(ctx, db.CreateUserIdentityParams{
+		Provider: config.Name,
+		Subject:  claims.Subject,
+		Username: username,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code.Name() {
+			case "unique_violation":
+				err := errors.New("the identity or the user is already linked at this provider")
+				ctx.JSON(http.StatusForbidden, errorResponse(err))
+				return
+			}
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventIdentityLinked,
+		Actor:   username,
+		Target:  config.Name,
+		Outcome: audit.OutcomeSuccess,
+		Details: "subject " + claims.Subject,
+	})
+
+	ctx.JSON(http.StatusOK, newUserIdentityResponse(identity))
+}
+
+// rejectOIDCLogin records the failed login and answers with unauthorized
+func (server *Server) rejectOIDCLogin(ctx *gin.Context, provider string, err error) {
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventLogin,
+		Outcome: audit.OutcomeFailure,
+		Details: fmt.Sprintf("oidc %s: %s", provider, err),
+	})
+	ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+}
+
+type userIdentityResponse struct {
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func newUserIdentityResponse(identity db.UserIdentity) userIdentityResponse {
+	rsp := userIdentityResponse{
+		Provider:  identity.Provider,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt,
+	}
+	if identity.LastLoginAt.Valid {
+		rsp.LastLoginAt = &identity.LastLoginAt.Time
+	}
+	return rsp
+}
+
+// listMyIdentities shows the identities at sso providers the logged in user can log in with
+func (server *Server) listMyIdentities(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	identities, err := server.store.ListUserIdentities(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := make([]userIdentityResponse, len(identities))
+	for i, identity := range identities {
+		rsp[i] = newUserIdentityResponse(identity)
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
@@ -0,0 +1,590 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	mockdb "github.com/andreanpradanaa/simple-bank-app/db/mock"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/golang/mock/gomock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	fakeOIDCClientID     = "simplebank"
+	fakeOIDCClientSecret = "secret"
+	fakeOIDCKeyID        = "test-key"
+)
+
+// fakeOIDCProvider is an in-process identity provider, with discovery, a jwks
+// endpoint and a token endpoint that checks the pkce verifier
+type fakeOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]fakeOIDCAuthorization
+}
+
+type fakeOIDCAuthorization struct {
+	codeChallenge string
+	claims        jwt.MapClaims
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	provider := &fakeOIDCProvider{
+		key:   key,
+		codes: make(map[string]fakeOIDCAuthorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := provider.server.URL
+		writeJSON(w, map[string]any{
+			"issuer":                                issuer,
+			"authorization_endpoint":                issuer + "/authorize",
+			"token_endpoint":                        issuer + "/token",
+			"jwks_uri":                              issuer + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": fakeOIDCKeyID,
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", provider.handleToken)
+
+	provider.server = httptest.NewServer(mux)
+	t.Cleanup(provider.server.Close)
+	return provider
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (provider *fakeOIDCProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != fakeOIDCClientID || clientSecret != fakeOIDCClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSON(w, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	provider.mu.Lock()
+	authorization, ok := provider.codes[r.PostFormValue("code")]
+	delete(provider.codes, r.PostFormValue("code"))
+	provider.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != authorization.codeChallenge {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, authorization.claims)
+	idToken.Header["kid"] = fakeOIDCKeyID
+	rawIDToken, err := idToken.SignedString(provider.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"access_token": utils.RandomString(32),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     rawIDToken,
+	})
+}
+
+// authorize plays the user logging in at the provider: it takes the url the bank sent
+// the browser to, and returns the query the provider redirects back to the bank with
+func (provider *fakeOIDCProvider) authorize(t *testing.T, authorizationURL string, claims jwt.MapClaims) url.Values {
+	u, err := url.Parse(authorizationURL)
+	require.NoError(t, err)
+	require.Equal(t, provider.server.URL+"/authorize", fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, u.Path))
+
+	query := u.Query()
+	require.Equal(t, "code", query.Get("response_type"))
+	require.Equal(t, fakeOIDCClientID, query.Get("client_id"))
+	require.Equal(t, "S256", query.Get("code_challenge_method"))
+	require.Contains(t, query.Get("scope"), "openid")
+
+	idClaims := jwt.MapClaims{
+		"iss":   provider.server.URL,
+		"aud":   fakeOIDCClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for name, value := range claims {
+		idClaims[name] = value
+	}
+
+	code := utils.RandomString(16)
+	provider.mu.Lock()
+	provider.codes[code] = fakeOIDCAuthorization{
+		codeChallenge: query.Get("code_challenge"),
+		claims:        idClaims,
+	}
+	provider.mu.Unlock()
+
+	return url.Values{
+		"code":  {code},
+		"state": {query.Get("state")},
+	}
+}
+
+func newOIDCTestServer(t *testing.T, store db.Store, provider *fakeOIDCProvider, linkByEmail bool) *Server {
+	server := newTestServer(t, store)
+
+	var err error
+	server.oidcProviders, err = newOIDCProviders([]utils.OIDCProviderConfig{{
+		Name:         "corp",
+		Issuer:       provider.server.URL,
+		ClientID:     fakeOIDCClientID,
+		ClientSecret: fakeOIDCClientSecret,
+		RedirectURL:  "http://localhost:8080/oidc/corp/callback",
+		LinkByEmail:  linkByEmail,
+	}})
+	require.NoError(t, err)
+	return server
+}
+
+// stubOIDCAuthRequests keeps the authorization request the bank records, and hands
+// it back when the callback uses it up
+func stubOIDCAuthRequests(t *testing.T, store *mockdb.MockStore, linkUsername string, tamper func(*db.OidcAuthRequest)) {
+	var authRequest db.OidcAuthRequest
+
+	store.EXPECT().
+		CreateOIDCAuthRequest(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, arg db.CreateOIDCAuthRequestParams) (db.OidcAuthRequest, error) {
+			require.Equal(t, "corp", arg.Provider)
+			require.Equal(t, linkUsername, arg.LinkUsername)
+			require.NotEmpty(t, arg.Nonce)
+			require.NotEmpty(t, arg.CodeVerifier)
+
+			authRequest = db.OidcAuthRequest{
+				StateHash:    arg.StateHash,
+				Provider:     arg.Provider,
+				Nonce:        arg.Nonce,
+				CodeVerifier: arg.CodeVerifier,
+				LinkUsername: arg.LinkUsername,
+				ExpiresAt:    arg.ExpiresAt,
+			}
+			return authRequest, nil
+		})
+	store.EXPECT().
+		UseOIDCAuthRequest(gomock.Any(), gomock.Any()).
+		MaxTimes(1).
+		DoAndReturn(func(_ context.Context, arg db.UseOIDCAuthRequestParams) (db.OidcAuthRequest, error) {
+			if arg.StateHash != authRequest.StateHash {
+				return db.OidcAuthRequest{}, sql.ErrNoRows
+			}
+			if tamper != nil {
+				tamper(&authRequest)
+			}
+			return authRequest, nil
+		})
+}
+
+func oidcCallback(t *testing.T, server *Server, query url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	request, err := http.NewRequest(http.MethodGet, "/oidc/corp/callback?"+query.Encode(), nil)
+	require.NoError(t, err)
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestOIDCLoginAPI(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	user, _ := randomUser(t)
+	user.IsEmailVerified = true
+	subject := utils.RandomString(12)
+	identity := db.UserIdentity{Provider: "corp", Subject: subject, Username: user.Username, Email: user.Email}
+
+	stubLogin := func(store *mockdb.MockStore) {
+		store.EXPECT().
+			GetUser(gomock.Any(), gomock.Eq(user.Username)).
+			Times(1).
+			Return(user, nil)
+		store.EXPECT().
+			TouchUserIdentity(gomock.Any(), gomock.Eq(db.TouchUserIdentityParams{Provider: "corp", Subject: subject, Email: user.Email})).
+			Times(1)
+		store.EXPECT().
+			GetUserTOTP(gomock.Any(), gomock.Eq(user.Username)).
+			Times(1).
+			Return(db.UserTotp{}, sql.ErrNoRows)
+		store.EXPECT().
+			TouchKnownDevice(gomock.Any(), gomock.Any()).
+			Times(1).
+			Return(int64(1), nil)
+		store.EXPECT().
+			CreateSession(gomock.Any(), gomock.Any()).
+			Times(1).
+			DoAndReturn(func(_ context.Context, arg db.CreateSessionParams) (db.Session, error) {
+				return db.Session{ID: arg.ID, Username: arg.Username, ExpiresAt: arg.ExpiresAt}, nil
+			})
+	}
+
+	checkLoggedIn := func(t *testing.T, recorder *httptest.ResponseRecorder) {
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var rsp loginUserResponse
+		err := json.NewDecoder(recorder.Body).Decode(&rsp)
+		require.NoError(t, err)
+		require.Empty(t, rsp.AccessToken)
+		require.Empty(t, rsp.RefreshToken)
+		require.Equal(t, user.Username, rsp.User.Username)
+
+		cookies := responseCookies(recorder)
+		require.NotEmpty(t, cookies[accessTokenCookie].Value)
+		require.NotEmpty(t, cookies[refreshTokenCookie].Value)
+		require.NotEmpty(t, cookies[csrfTokenCookie].Value)
+	}
+
+	testCases := []struct {
+		name          string
+		linkByEmail   bool
+		claims        jwt.MapClaims
+		sendCookie    bool
+		tamper        func(authRequest *db.OidcAuthRequest)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:       "LinkedIdentity",
+			claims:     jwt.MapClaims{"sub": subject, "email": user.Email, "email_verified": true},
+			sendCookie: true,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Eq(db.GetUserIdentityParams{Provider: "corp", Subject: subject})).
+					Times(1).
+					Return(identity, nil)
+				stubLogin(store)
+			},
+			checkResponse: checkLoggedIn,
+		},
+		{
+			name:        "LinkByEmail",
+			linkByEmail: true,
+			claims:      jwt.MapClaims{"sub": subject, "email": user.Email, "email_verified": true},
+			sendCookie:  true,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UserIdentity{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetUserByEmail(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					CreateUserIdentity(gomock.Any(), gomock.Eq(db.CreateUserIdentityParams{
+						Provider: "corp",
+						Subject:  subject,
+						Username: user.Username,
+						Email:    user.Email,
+					})).
+					Times(1).
+					Return(identity, nil)
+				stubLogin(store)
+			},
+			checkResponse: checkLoggedIn,
+		},
+		{
+			name:        "LinkByEmailUnverified",
+			linkByEmail: true,
+			claims:      jwt.MapClaims{"sub": subject, "email": user.Email, "email_verified": false},
+			sendCookie:  true,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UserIdentity{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetUserByEmail(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:       "IdentityNotLinked",
+			claims:     jwt.MapClaims{"sub": subject, "email": user.Email, "email_verified": true},
+			sendCookie: true,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UserIdentity{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetUserByEmail(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:       "MissingStateCookie",
+			claims:     jwt.MapClaims{"sub": subject},
+			sendCookie: false,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:       "WrongNonce",
+			claims:     jwt.MapClaims{"sub": subject, "nonce": "replayed-nonce"},
+			sendCookie: true,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:       "WrongAudience",
+			claims:     jwt.MapClaims{"sub": subject, "aud": "another-client"},
+			sendCookie: true,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:       "WrongCodeVerifier",
+			claims:     jwt.MapClaims{"sub": subject},
+			sendCookie: true,
+			tamper: func(authRequest *db.OidcAuthRequest) {
+				authRequest.CodeVerifier = "stolen-code-without-its-verifier"
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			stubOIDCAuthRequests(t, store, "", tc.tamper)
+			tc.buildStubs(store)
+
+			server := newOIDCTestServer(t, store, provider, tc.linkByEmail)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, "/oidc/corp/login", nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusFound, recorder.Code)
+
+			cookies := recorder.Result().Cookies()
+			require.Len(t, cookies, 1)
+			require.Equal(t, oidcStateCookieName, cookies[0].Name)
+			require.True(t, cookies[0].HttpOnly)
+			require.True(t, cookies[0].Secure)
+			require.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+
+			query := provider.authorize(t, recorder.Header().Get("Location"), tc.claims)
+			require.Equal(t, cookies[0].Value, query.Get("state"))
+			if !tc.sendCookie {
+				cookies = nil
+			}
+
+			tc.checkResponse(t, oidcCallback(t, server, query, cookies))
+		})
+	}
+}
+
+func TestOIDCLoginUnknownProvider(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		CreateOIDCAuthRequest(gomock.Any(), gomock.Any()).
+		Times(0)
+
+	server := newOIDCTestServer(t, store, newFakeOIDCProvider(t), false)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/oidc/unknown/login", nil)
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestLinkOIDCIdentityAPI(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	user, _ := randomUser(t)
+	subject := utils.RandomString(12)
+	email := utils.RandomEmail()
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateUserIdentity(gomock.Any(), gomock.Eq(db.CreateUserIdentityParams{
+						Provider: "corp",
+						Subject:  subject,
+						Username: user.Username,
+						Email:    email,
+					})).
+					Times(1).
+					Return(db.UserIdentity{Provider: "corp", Subject: subject, Username: user.Username, Email: email}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp userIdentityResponse
+				err := json.NewDecoder(recorder.Body).Decode(&rsp)
+				require.NoError(t, err)
+				require.Equal(t, "corp", rsp.Provider)
+				require.Equal(t, subject, rsp.Subject)
+				require.Nil(t, rsp.LastLoginAt)
+			},
+		},
+		{
+			name: "AlreadyLinked",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateUserIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UserIdentity{}, &pq.Error{Code: "23505"})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+			stubOIDCAuthRequests(t, store, user.Username, nil)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+
+			server := newOIDCTestServer(t, store, provider, false)
+
+			recorder := postJSON(t, server, "/users/me/identities/corp", gin.H{
+				"step_up_token": createStepUpToken(t, server, user.Username, identityLinkBinding("corp")),
+			}, user.Username)
+			require.Equal(t, http.StatusOK, recorder.Code)
+
+			var rsp linkOIDCIdentityResponse
+			err := json.NewDecoder(recorder.Body).Decode(&rsp)
+			require.NoError(t, err)
+
+			query := provider.authorize(t, rsp.AuthorizationURL, jwt.MapClaims{"sub": subject, "email": email})
+			tc.checkResponse(t, oidcCallback(t, server, query, recorder.Result().Cookies()))
+		})
+	}
+}
+
+func TestLinkOIDCIdentityRequiresStepUp(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	user, _ := randomUser(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(db.UserTotp{}, sql.ErrNoRows)
+	store.EXPECT().CreateOIDCAuthRequest(gomock.Any(), gomock.Any()).Times(0)
+	stubAuthInfo(store)
+
+	server := newOIDCTestServer(t, store, provider, false)
+
+	// the request may come without a body at all
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, "/users/me/identities/corp", http.NoBody)
+	require.NoError(t, err)
+
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, utils.DepositorRole, time.Minute)
+	server.router.ServeHTTP(recorder, request)
+	requireStepUpChallenge(t, recorder, []string{stepUpMethodPassword})
+}
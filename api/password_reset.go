@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/audit"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const passwordResetRequestedMessage = "if the email belongs to an account, a password reset link has been sent to it"
+
+type requestPasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type passwordResetResponse struct {
+	Message string `json:"message"`
+}
+
+var errTooManyPasswordResets = errors.New("too many password reset requests, please try again later")
+
+// requestPasswordReset emails a one-time reset token to the owner of the email.
+// The response is the same whether the email is registered or not, and takes as
+// long, the lookup and the email happen in the background after it is sent.
+func (server *Server) requestPasswordReset(ctx *gin.Context) {
+	var req requestPasswordResetRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	retryAfter, err := server.loginThrottle.Attempt(ctx,
+		server.loginThrottle.passwordResetEmailKey(req.Email),
+		server.loginThrottle.passwordResetIPKey(ctx.ClientIP()),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if retryAfter > 0 {
+		ctx.Header("Retry-After", fmt.Sprint(int(retryAfter.Seconds())+1))
+		ctx.JSON(http.StatusTooManyRequests, errorResponse(errTooManyPasswordResets))
+		return
+	}
+
+	server.runInBackground("send password reset email", func(ctx context.Context) error {
+		return server.sendPasswordReset(ctx, req.Email)
+	})
+
+	ctx.JSON(http.StatusAccepted, passwordResetResponse{Message: passwordResetRequestedMessage})
+}
+
+// sendPasswordReset creates a reset token for the owner of the email, if there is one, and emails it
+func (server *Server) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := server.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	resetToken, tokenHash, err := utils.NewSecretToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = server.store.CreatePasswordResetToken(ctx, db.CreatePasswordResetTokenParams{
+		Username:  user.Username,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(server.config.PasswordResetDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	return server.mailer.SendEmail([]string{user.Email}, "Reset your Simple Bank password", passwordResetEmail(
+		user.FullName,
+		server.config.PasswordResetURL+"?token="+url.QueryEscape(resetToken),
+		server.config.PasswordResetDuration,
+	))
+}
+
+func passwordResetEmail(fullName string, link string, validFor time.Duration) string {
+	return fmt.Sprintf(`Hello %s,
+
+Someone asked to reset the password of your Simple Bank account.
+To choose a new password, open the link below within %s:
+
+%s
+
+If you did not ask for this, you can ignore this email, your password stays the same.
+`, fullName, validFor, link)
+}
+
+type confirmPasswordResetRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// confirmPasswordReset uses up the reset token and sets the new password.
+// Like a password change, it signs the user out everywhere, and it also
+// removes the passkeys and linked identities, which skip the password, and
+// the second factor, which whoever the reset locks out may have set up.
+func (server *Server) confirmPasswordReset(ctx *gin.Context) {
+	var req confirmPasswordResetRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	if err := server.passwordPolicy.Validate(req.NewPassword); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	hashedPassword, err := server.passwordHasher.HashPassword(req.NewPassword)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	user, err := server.store.ResetPasswordTx(ctx, db.ResetPasswordTxParams{
+		TokenHash:         utils.HashSecretToken(req.Token),
+		HashedPassword:    hashedPassword,
+		PasswordChangedAt: time.Now().Truncate(time.Microsecond),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = errors.New("invalid or expired password reset token")
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.authInfo.Forget(user.Username)
+
+	_, err = server.revokeSessions(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventPasswordReset,
+		Actor:   user.Username,
+		Target:  user.Username,
+		Outcome: audit.OutcomeSuccess,
+	})
+
+	ctx.Status(http.StatusNoContent)
+}
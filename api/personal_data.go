@@ -0,0 +1,198 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/audit"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	exportFormatJSON = "json"
+	exportFormatZIP  = "zip"
+)
+
+type exportUserDataRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=json zip"`
+}
+
+// userDataExport is everything the bank keeps about the user, for data subject access requests
+type userDataExport struct {
+	ExportedAt time.Time     `json:"exported_at"`
+	Profile    userResponse  `json:"profile"`
+	Accounts   []db.Account  `json:"accounts"`
+	Entries    []db.Entry    `json:"entries"`
+	Transfers  []db.Transfer `json:"transfers"`
+}
+
+// exportUserData sends the personal data of the logged in user, as a single JSON
+// document or as a ZIP archive with one JSON file per kind of record
+func (server *Server) exportUserData(ctx *gin.Context) {
+	var req exportUserDataRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	export, err := server.collectUserData(ctx, authPayload.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	filename := fmt.Sprintf("simplebank-%s-%s", authPayload.Username, export.ExportedAt.Format("20060102"))
+
+	if req.Format != exportFormatZIP {
+		ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+		ctx.JSON(http.StatusOK, export)
+		return
+	}
+
+	archive, err := newUserDataArchive(export)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+	ctx.Data(http.StatusOK, "application/zip", archive)
+}
+
+func (server *Server) collectUserData(ctx context.Context, username string) (userDataExport, error) {
+	export := userDataExport{ExportedAt: time.Now().UTC()}
+
+	user, err := server.store.GetUser(ctx, username)
+	if err != nil {
+		return export, err
+	}
+	export.Profile = newUserResponse(user)
+
+	export.Accounts, err = server.store.ListOwnerAccounts(ctx, username)
+	if err != nil {
+		return export, err
+	}
+
+	export.Entries, err = server.store.ListOwnerEntries(ctx, username)
+	if err != nil {
+		return export, err
+	}
+
+	export.Transfers, err = server.store.ListOwnerTransfers(ctx, username)
+	return export, err
+}
+
+// newUserDataArchive zips the export into profile.json, accounts.json, entries.json and transfers.json
+func newUserDataArchive(export userDataExport) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	files := []struct {
+		name    string
+		content any
+	}{
+		{name: "profile.json", content: export.Profile},
+		{name: "accounts.json", content: export.Accounts},
+		{name: "entries.json", content: export.Entries},
+		{name: "transfers.json", content: export.Transfers},
+	}
+
+	for _, file := range files {
+		w, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(file.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := archive.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type deleteMeRequest struct {
+	// StepUpToken proves the user authenticated again to delete their account
+	StepUpToken string `json:"step_up_token"`
+}
+
+// deleteAccountBinding is the step-up binding of deleting the account
+var deleteAccountBinding = accountActionBinding("delete_account")
+
+// deleteMe closes the accounts of the logged in user and erases their personal
+// data, after a step-up with any method they have: users who log in with a
+// passkey or a provider may not know a password. Entries and transfers are kept
+// for legal retention, under the username, which stays reserved.
+func (server *Server) deleteMe(ctx *gin.Context) {
+	// the body is optional, the step-up challenge tells the client what to send
+	var req deleteMeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	if !server.checkStepUp(ctx, req.StepUpToken, deleteAccountBinding) {
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	user, err := server.store.DeleteUserTx(ctx, authPayload.Username)
+	if err != nil {
+		if errors.Is(err, db.ErrAccountNotEmpty) {
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.authInfo.Forget(user.Username)
+	// the sessions were deleted along with the user
+	server.clearAuthCookies(ctx)
+
+	_, err = server.loginThrottle.Reset(ctx, server.loginThrottle.usernameKey(user.Username))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventUserDeleted,
+		Actor:   user.Username,
+		Target:  user.Username,
+		Outcome: audit.OutcomeSuccess,
+	})
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,271 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mockdb "github.com/andreanpradanaa/simple-bank-app/db/mock"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportUserDataAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	account := randomAccount(user.Username)
+	otherAccount := randomAccount(utils.RandomOwner())
+	entries := []db.Entry{{ID: 1, AccountID: account.ID, Amount: 10}}
+	transfers := []db.Transfer{{ID: 1, FromAccountID: otherAccount.ID, ToAccountID: account.ID, Amount: 10}}
+
+	buildFullStubs := func(store *mockdb.MockStore) {
+		store.EXPECT().
+			GetUser(gomock.Any(), gomock.Eq(user.Username)).
+			Times(1).
+			Return(user, nil)
+		store.EXPECT().
+			ListOwnerAccounts(gomock.Any(), gomock.Eq(user.Username)).
+			Times(1).
+			Return([]db.Account{account}, nil)
+		store.EXPECT().
+			ListOwnerEntries(gomock.Any(), gomock.Eq(user.Username)).
+			Times(1).
+			Return(entries, nil)
+		store.EXPECT().
+			ListOwnerTransfers(gomock.Any(), gomock.Eq(user.Username)).
+			Times(1).
+			Return(transfers, nil)
+	}
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:       "JSON",
+			query:      "",
+			buildStubs: buildFullStubs,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Header().Get("Content-Disposition"), ".json")
+
+				var export userDataExport
+				err := json.NewDecoder(recorder.Body).Decode(&export)
+				require.NoError(t, err)
+				require.Equal(t, user.Username, export.Profile.Username)
+				require.Equal(t, user.Email, export.Profile.Email)
+				require.Len(t, export.Accounts, 1)
+				require.Equal(t, account.AccountNumber, export.Accounts[0].AccountNumber)
+				require.Equal(t, entries, export.Entries)
+				require.Len(t, export.Transfers, 1)
+			},
+		},
+		{
+			name:       "ZIP",
+			query:      "?format=zip",
+			buildStubs: buildFullStubs,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "application/zip", recorder.Header().Get("Content-Type"))
+				require.Contains(t, recorder.Header().Get("Content-Disposition"), ".zip")
+
+				body := recorder.Body.Bytes()
+				archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+				require.NoError(t, err)
+
+				files := make(map[string][]byte)
+				for _, file := range archive.File {
+					r, err := file.Open()
+					require.NoError(t, err)
+					files[file.Name], err = io.ReadAll(r)
+					require.NoError(t, err)
+					r.Close()
+				}
+				require.Len(t, files, 4)
+
+				var profile userResponse
+				require.NoError(t, json.Unmarshal(files["profile.json"], &profile))
+				require.Equal(t, user.Username, profile.Username)
+
+				var gotTransfers []db.Transfer
+				require.NoError(t, json.Unmarshal(files["transfers.json"], &gotTransfers))
+				require.Equal(t, transfers, gotTransfers)
+
+				require.Contains(t, files, "accounts.json")
+				require.Contains(t, files, "entries.json")
+			},
+		},
+		{
+			name:  "UnsupportedFormat",
+			query: "?format=xml",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "InternalError",
+			query: "",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					ListOwnerAccounts(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/users/me/export"+tc.query, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, utils.DepositorRole, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestDeleteMeAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	validStepUp := func(t *testing.T, server *Server) string {
+		return createStepUpToken(t, server, user.Username, deleteAccountBinding)
+	}
+
+	testCases := []struct {
+		name          string
+		stepUpToken   func(t *testing.T, server *Server) string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:        "OK",
+			stepUpToken: validStepUp,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().
+					DeleteUserTx(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(db.User{Username: user.Username, DeletedAt: time.Now()}, nil)
+				store.EXPECT().
+					DeleteLoginThrottle(gomock.Any(), gomock.Eq("username:"+user.Username)).
+					Times(1).
+					Return(int64(0), nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name: "NoStepUpToken",
+			stepUpToken: func(t *testing.T, server *Server) string {
+				return ""
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(db.UserTotp{}, sql.ErrNoRows)
+				store.EXPECT().DeleteUserTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireStepUpChallenge(t, recorder, []string{stepUpMethodPassword})
+			},
+		},
+		{
+			name: "TokenForAnotherAction",
+			stepUpToken: func(t *testing.T, server *Server) string {
+				return createStepUpToken(t, server, user.Username, passkeyRegistrationBinding)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(db.UserTotp{}, sql.ErrNoRows)
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().DeleteUserTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireStepUpChallenge(t, recorder, []string{stepUpMethodPassword})
+			},
+		},
+		{
+			name:        "AccountNotEmpty",
+			stepUpToken: validStepUp,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().
+					DeleteUserTx(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(db.User{}, fmt.Errorf("account %s: %w", "0001", db.ErrAccountNotEmpty))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:        "InternalError",
+			stepUpToken: validStepUp,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().
+					DeleteUserTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.User{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+
+			recorder := sendJSON(t, server, http.MethodDelete, "/users/me", gin.H{
+				"step_up_token": tc.stepUpToken(t, server),
+			}, user.Username)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/google/uuid"
+)
+
+const defaultRevocationSyncInterval = time.Minute
+
+// revocationList keeps the ids of revoked tokens and sessions in memory, so that
+// authMiddleware does not have to hit the database on every request.
+// Revocations made by other instances are picked up by the periodic sync.
+type revocationList struct {
+	store    db.Store
+	interval time.Duration
+
+	mu      sync.RWMutex
+	revoked map[uuid.UUID]time.Time
+	latest  time.Time
+}
+
+func newRevocationList(store db.Store, interval time.Duration) *revocationList {
+	if interval <= 0 {
+		interval = defaultRevocationSyncInterval
+	}
+
+	return &revocationList{
+		store:    store,
+		interval: interval,
+		revoked:  make(map[uuid.UUID]time.Time),
+	}
+}
+
+// Revoke records the token or session id until expiresAt, after which the token is rejected anyway
+func (list *revocationList) Revoke(ctx context.Context, id uuid.UUID, username string, expiresAt time.Time) error {
+	err := list.store.RevokeToken(ctx, db.RevokeTokenParams{
+		ID:        id,
+		Username:  username,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	list.mu.Lock()
+	list.revoked[id] = expiresAt
+	list.mu.Unlock()
+	return nil
+}
+
+// Consume revokes a single-use token, and returns false if it was already used.
+// The insert decides, so two requests racing with the same token cannot both win.
+func (list *revocationList) Consume(ctx context.Context, id uuid.UUID, username string, expiresAt time.Time) (bool, error) {
+	if list.IsRevoked(id) {
+		return false, nil
+	}
+
+	inserted, err := list.store.ConsumeToken(ctx, db.ConsumeTokenParams{
+		ID:        id,
+		Username:  username,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	list.mu.Lock()
+	list.revoked[id] = expiresAt
+	list.mu.Unlock()
+	return inserted > 0, nil
+}
+
+// IsRevoked returns true if any of the ids has been revoked
+func (list *revocationList) IsRevoked(ids ...uuid.UUID) bool {
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+
+	for _, id := range ids {
+		if _, ok := list.revoked[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Sync loads the revocations recorded since the last sync. revoked_at is the start
+// of the revoking transaction, so a revocation can commit after a later one was
+// already synced: the sync goes back one interval before the latest it has seen.
+func (list *revocationList) Sync(ctx context.Context) error {
+	list.mu.RLock()
+	since := list.latest
+	list.mu.RUnlock()
+
+	if !since.IsZero() {
+		since = since.Add(-list.interval)
+	}
+
+	revokedTokens, err := list.store.ListRevokedTokens(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	for _, revokedToken := range revokedTokens {
+		list.revoked[revokedToken.ID] = revokedToken.ExpiresAt
+		if revokedToken.RevokedAt.After(list.latest) {
+			list.latest = revokedToken.RevokedAt
+		}
+	}
+	return nil
+}
+
+// Prune drops the revocations of tokens that have expired by now
+func (list *revocationList) Prune(ctx context.Context) error {
+	err := list.store.DeleteExpiredRevokedTokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	for id, expiresAt := range list.revoked {
+		if now.After(expiresAt) {
+			delete(list.revoked, id)
+		}
+	}
+	return nil
+}
+
+// Run syncs and prunes the list every interval until the context is done
+func (list *revocationList) Run(ctx context.Context) {
+	ticker := time.NewTicker(list.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := list.Sync(ctx); err != nil {
+				log.Println("cannot sync revoked tokens:", err)
+			}
+			if err := list.Prune(ctx); err != nil {
+				log.Println("cannot prune revoked tokens:", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mockdb "github.com/andreanpradanaa/simple-bank-app/db/mock"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevocationList(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	list := newRevocationList(store, time.Minute)
+
+	username := utils.RandomOwner()
+	revokedID := uuid.New()
+	expiredID := uuid.New()
+	syncedID := uuid.New()
+
+	store.EXPECT().RevokeToken(gomock.Any(), gomock.Any()).Times(2)
+	require.NoError(t, list.Revoke(context.Background(), revokedID, username, time.Now().Add(time.Minute)))
+	require.NoError(t, list.Revoke(context.Background(), expiredID, username, time.Now().Add(-time.Minute)))
+
+	require.True(t, list.IsRevoked(revokedID))
+	require.True(t, list.IsRevoked(uuid.New(), expiredID))
+	require.False(t, list.IsRevoked(uuid.New(), uuid.Nil))
+
+	// revocations made by other instances show up after a sync
+	store.EXPECT().
+		ListRevokedTokens(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return([]db.RevokedToken{{ID: syncedID, Username: username, ExpiresAt: time.Now().Add(time.Minute), RevokedAt: time.Now()}}, nil)
+	require.NoError(t, list.Sync(context.Background()))
+	require.True(t, list.IsRevoked(syncedID))
+
+	store.EXPECT().DeleteExpiredRevokedTokens(gomock.Any()).Times(1)
+	require.NoError(t, list.Prune(context.Background()))
+	require.False(t, list.IsRevoked(expiredID))
+	require.True(t, list.IsRevoked(revokedID))
+}
+
+func TestRevocationListConsume(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	list := newRevocationList(store, time.Minute)
+
+	username := utils.RandomOwner()
+	expiresAt := time.Now().Add(time.Minute)
+	firstID := uuid.New()
+	racedID := uuid.New()
+
+	store.EXPECT().
+		ConsumeToken(gomock.Any(), gomock.Eq(db.ConsumeTokenParams{ID: firstID, Username: username, ExpiresAt: expiresAt})).
+		Times(1).
+		Return(int64(1), nil)
+	consumed, err := list.Consume(context.Background(), firstID, username, expiresAt)
+	require.NoError(t, err)
+	require.True(t, consumed)
+
+	// a second use is rejected from memory
+	consumed, err = list.Consume(context.Background(), firstID, username, expiresAt)
+	require.NoError(t, err)
+	require.False(t, consumed)
+
+	// another instance used the token first, the insert finds it there
+	store.EXPECT().
+		ConsumeToken(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(int64(0), nil)
+	consumed, err = list.Consume(context.Background(), racedID, username, expiresAt)
+	require.NoError(t, err)
+	require.False(t, consumed)
+	require.True(t, list.IsRevoked(racedID))
+}
+
+func TestRevocationListSyncOverlap(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	list := newRevocationList(store, time.Minute)
+
+	username := utils.RandomOwner()
+	revokedAt := time.Now()
+	lateID := uuid.New()
+
+	gomock.InOrder(
+		store.EXPECT().
+			ListRevokedTokens(gomock.Any(), gomock.Eq(time.Time{})).
+			Times(1).
+			Return([]db.RevokedToken{{ID: uuid.New(), Username: username, ExpiresAt: revokedAt.Add(time.Hour), RevokedAt: revokedAt}}, nil),
+		// a revocation whose transaction started earlier but committed after the first sync
+		store.EXPECT().
+			ListRevokedTokens(gomock.Any(), gomock.Eq(revokedAt.Add(-time.Minute))).
+			Times(1).
+			Return([]db.RevokedToken{{ID: lateID, Username: username, ExpiresAt: revokedAt.Add(time.Hour), RevokedAt: revokedAt.Add(-time.Second)}}, nil),
+	)
+
+	require.NoError(t, list.Sync(context.Background()))
+	require.NoError(t, list.Sync(context.Background()))
+	require.True(t, list.IsRevoked(lateID))
+}
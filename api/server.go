@@ -1,62 +1,287 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
 
+	"github.com/andreanpradanaa/simple-bank-app/audit"
 	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/mail"
+	"github.com/andreanpradanaa/simple-bank-app/notify"
 	"github.com/andreanpradanaa/simple-bank-app/token"
 	"github.com/andreanpradanaa/simple-bank-app/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
+	"github.com/go-webauthn/webauthn/webauthn"
 )
 
 type Server struct {
-	config     utils.Config
-	store      db.Store
-	tokenMaker token.Maker
-	router     *gin.Engine
+	config         utils.Config
+	store          db.Store
+	tokenMaker     token.Maker
+	passwordHasher utils.PasswordHasher
+	passwordPolicy utils.PasswordPolicy
+	// dummyPasswordHash is checked against when the user does not exist
+	dummyPasswordHash string
+	revocations       *revocationList
+	authInfo          *authInfoCache
+	sessionActivity   *sessionActivity
+	mailer            mail.Mailer
+	auditor           audit.Auditor
+	notifier          notify.Notifier
+	loginThrottle     *loginThrottle
+	oidcProviders     *oidcProviders
+	webAuthn          *webauthn.WebAuthn
+	router            *gin.Engine
+	// background tracks the tasks started by runInBackground, Start waits for them on shutdown
+	background sync.WaitGroup
 }
 
-func NewServer(config utils.Config, store db.Store) (*Server, error) {
-	tokenMaker, err := token.NewPasetoMaker(config.TokenSymmetricKey)
-	// tokenMaker, err := token.NewJWTMaker(config.TokenSymmetricKey)
+func NewServer(config utils.Config, store db.Store, mailer mail.Mailer, auditor audit.Auditor, notifier notify.Notifier) (*Server, error) {
+	tokenMaker, err := token.NewMaker(config)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create token maker: %w", err)
 	}
 
+	if len(config.TOTPEncryptionKey) != utils.EncryptionKeySize {
+		return nil, fmt.Errorf("invalid totp encryption key size: must be exactly %d characters", utils.EncryptionKeySize)
+	}
+
+	// every account number is created with it, a bad one would only show at the first new account
+	if err := utils.ValidateBranchCode(config.AccountBranchCode); err != nil {
+		return nil, fmt.Errorf("invalid account branch code: %w", err)
+	}
+
+	if config.EmailVerificationPolicy == "" {
+		config.EmailVerificationPolicy = utils.VerifyEmailOptional
+	}
+	if !utils.IsSupportedEmailVerificationPolicy(config.EmailVerificationPolicy) {
+		return nil, fmt.Errorf("unsupported email verification policy %q", config.EmailVerificationPolicy)
+	}
+
+	passwordHasher, err := utils.NewPasswordHasher(config)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create password hasher: %w", err)
+	}
+
+	// hashed with the current settings, so that unknown users take as long to check as known ones
+	dummyPasswordHash, err := passwordHasher.HashPassword(utils.RandomString(32))
+	if err != nil {
+		return nil, fmt.Errorf("cannot hash dummy password: %w", err)
+	}
+
+	oidcProviders, err := newOIDCProviders(config.OIDCProviders)
+	if err != nil {
+		return nil, err
+	}
+
+	for currency := range config.StepUpThresholds {
+		if !utils.IsSupportedCurrency(currency) {
+			return nil, fmt.Errorf("unsupported currency %q in step-up thresholds", currency)
+		}
+	}
+	if config.StepUpDuration <= 0 {
+		config.StepUpDuration = defaultStepUpDuration
+	}
+
+	if config.TransactionPINMaxAttempts <= 0 {
+		config.TransactionPINMaxAttempts = defaultTransactionPINMaxAttempts
+	}
+	if config.TransactionPINLockoutDuration <= 0 {
+		config.TransactionPINLockoutDuration = defaultTransactionPINLockoutDuration
+	}
+
+	if config.AuthCookieSameSite == "" {
+		config.AuthCookieSameSite = "strict"
+	}
+	if _, ok := cookieSameSiteModes[config.AuthCookieSameSite]; !ok {
+		return nil, fmt.Errorf("unsupported auth cookie SameSite mode %q", config.AuthCookieSameSite)
+	}
+
+	if config.WebAuthnTimeout <= 0 {
+		config.WebAuthnTimeout = defaultWebAuthnTimeout
+	}
+
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          config.WebAuthnRPID,
+		RPDisplayName: config.WebAuthnRPDisplayName,
+		RPOrigins:     config.WebAuthnRPOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: config.WebAuthnTimeout},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: config.WebAuthnTimeout},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create webauthn relying party: %w", err)
+	}
+
 	server := &Server{
-		config:     config,
-		store:      store,
-		tokenMaker: tokenMaker,
+		config:            config,
+		store:             store,
+		tokenMaker:        tokenMaker,
+		passwordHasher:    passwordHasher,
+		passwordPolicy:    utils.NewPasswordPolicy(config),
+		dummyPasswordHash: dummyPasswordHash,
+		revocations:       newRevocationList(store, config.RevocationSyncInterval),
+		authInfo:          newAuthInfoCache(store, config.AuthCacheDuration),
+		sessionActivity:   newSessionActivity(store, sessionTouchInterval),
+		mailer:            mailer,
+		auditor:           auditor,
+		notifier:          notifier,
+		loginThrottle:     newLoginThrottle(store, config),
+		oidcProviders:     oidcProviders,
+		webAuthn:          webAuthn,
 	}
 
 	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
 		v.RegisterValidation("currency", validCurrency)
+		v.RegisterValidation("account_number", validAccountNumber)
+		v.RegisterValidation("account_id", validAccountID)
+		v.RegisterValidation("scope", validScope)
 	}
 
 	server.setupRouter()
+
+	// X-Forwarded-For only gives the client ip of requests coming from a trusted proxy
+	err = server.router.SetTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
 	return server, nil
 }
 
 func (server *Server) setupRouter() {
 	router := gin.Default()
+	router.Use(requestIDMiddleware())
 
 	router.POST("/users", server.createUser)
 	router.POST("/users/login", server.loginUser)
+	router.POST("/users/login/mfa", server.loginMFA)
+	router.POST("/users/password-reset", server.requestPasswordReset)
+	router.POST("/users/password-reset/confirm", server.confirmPasswordReset)
+	router.GET("/users/verify-email", server.verifyEmail)
+	router.GET("/users/sessions/revoke", server.confirmRevokeSessionByToken)
+	router.POST("/users/sessions/revoke", server.revokeSessionByToken)
+	router.POST("/tokens/renew_access", server.renewAccessToken)
+	router.GET("/.well-known/jwks.json", server.getJWKS)
+	router.GET("/oidc/:provider/login", server.startOIDCLogin)
+	router.GET("/oidc/:provider/callback", server.oidcCallback)
+	router.POST("/users/login/passkey/begin", server.beginPasskeyLogin)
+	router.POST("/users/login/passkey/finish", server.finishPasskeyLogin)
+
+	authRoutes := router.Group("/").Use(server.authMiddleware())
+	authRoutes.POST("/users/logout", requireLogin(), server.logoutUser)
+	// api keys may read the profile so an integration can tell whose key it holds
+	authRoutes.GET("/users/me", server.getMe)
+	authRoutes.PATCH("/users/me", requireLogin(), server.updateMe)
+	authRoutes.DELETE("/users/me", requireLogin(), server.deleteMe)
+	authRoutes.PUT("/users/me/password", requireLogin(), server.changePassword)
+	authRoutes.PUT("/users/me/allowed-ips", requireLogin(), server.updateAllowedIPs)
+	authRoutes.GET("/users/me/export", requireLogin(), server.exportUserData)
+	authRoutes.POST("/users/verify-email/resend", requireLogin(), server.resendVerificationEmail)
+	authRoutes.POST("/users/me/totp", requireLogin(), server.enrollTOTP)
+	authRoutes.POST("/users/me/totp/confirm", requireLogin(), server.confirmTOTP)
+	authRoutes.POST("/users/me/step-up", requireLogin(), server.stepUp)
+	authRoutes.POST("/users/me/step-up/passkey/begin", requireLogin(), server.beginPasskeyStepUp)
+	authRoutes.GET("/users/me/pin", requireLogin(), server.getTransactionPIN)
+	authRoutes.POST("/users/me/pin", requireLogin(), server.setTransactionPIN)
+	authRoutes.PUT("/users/me/pin", requireLogin(), server.changeTransactionPIN)
+	authRoutes.PUT("/users/me/pin/settings", requireLogin(), server.updateTransactionPINSettings)
+	authRoutes.POST("/users/me/pin/reset", requireLogin(), server.resetTransactionPIN)
+	authRoutes.POST("/users/me/api_keys", requireLogin(), server.createAPIKey)
+	authRoutes.GET("/users/me/api_keys", requireLogin(), server.listAPIKeys)
+	authRoutes.DELETE("/users/me/api_keys/:id", requireLogin(), server.revokeAPIKey)
+	authRoutes.GET("/users/me/sessions", requireLogin(), server.listMySessions)
+	authRoutes.GET("/users/me/identities", requireLogin(), server.listMyIdentities)
+	authRoutes.POST("/users/me/identities/:provider", requireLogin(), server.linkOIDCIdentity)
+	authRoutes.DELETE("/users/me/sessions/:id", requireLogin(), server.revokeMySession)
+	authRoutes.POST("/users/me/passkeys/register/begin", requireLogin(), server.beginPasskeyRegistration)
+	authRoutes.POST("/users/me/passkeys/register/finish", requireLogin(), server.finishPasskeyRegistration)
+	authRoutes.GET("/users/me/passkeys", requireLogin(), server.listPasskeys)
+	authRoutes.DELETE("/users/me/passkeys/:id", requireLogin(), server.deletePasskey)
+	authRoutes.POST("/accounts", requireScopes(utils.ScopeAccountsWrite), server.requireVerifiedEmail(utils.VerifyEmailForAccounts), server.createAccount)
+	authRoutes.GET("/accounts/:id", requireScopes(utils.ScopeAccountsRead), server.getAccount)
+	authRoutes.GET("/accounts", requireScopes(utils.ScopeAccountsRead), server.listAccounts)
 
-	authRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker))
-	authRoutes.POST("/accounts", server.createAccount)
-	authRoutes.GET("/accounts/:id", server.getAccount)
-	authRoutes.GET("/accounts", server.listAccounts)
+	authRoutes.POST("/transfers", requireScopes(utils.ScopeTransfersWrite), server.requireVerifiedEmail(utils.VerifyEmailForTransfers, utils.VerifyEmailForAccounts), server.createTransfer)
 
-	authRoutes.POST("/transfers", server.createTransfer)
+	adminRoutes := router.Group("/admin").Use(server.authMiddleware(), requireRole(utils.AdminRole))
+	adminRoutes.POST("/users/:username/revoke_sessions", server.revokeUserSessions)
+	adminRoutes.POST("/users/:username/unlock", server.unlockUser)
+	adminRoutes.GET("/audit_events", server.listAuditEvents)
+	adminRoutes.POST("/accounts/:id/holds", requireScopes(utils.ScopeAccountsWrite), server.placeHold)
+	adminRoutes.GET("/accounts/:id/holds", requireScopes(utils.ScopeAccountsRead), server.listHolds)
+	adminRoutes.POST("/holds/:id/release", requireScopes(utils.ScopeAccountsWrite), server.releaseHold)
 
 	server.router = router
 }
 
-func (server *Server) Start(address string) error {
-	return server.router.Run(address)
+// Start serves the api on the address until the context is done. It then stops
+// taking requests and waits for the requests and the background tasks in flight,
+// such as the emails they send, for at most shutdownTimeout.
+func (server *Server) Start(ctx context.Context, address string) error {
+	err := server.revocations.Sync(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot load revoked tokens: %w", err)
+	}
+	go server.revocations.Run(ctx)
+	go server.pruneAuthRequests(ctx, server.config.RevocationSyncInterval)
+
+	httpServer := &http.Server{
+		Addr:    address,
+		Handler: server.router.Handler(),
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err = httpServer.Shutdown(shutdownCtx)
+	if err != nil {
+		return fmt.Errorf("cannot shut down http server: %w", err)
+	}
+	return server.waitForBackground(shutdownCtx)
+}
+
+// pruneAuthRequests deletes the oidc authorization requests and webauthn ceremonies
+// that were never completed, every interval
+func (server *Server) pruneAuthRequests(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultRevocationSyncInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := server.store.DeleteExpiredOIDCAuthRequests(ctx); err != nil {
+				log.Println("cannot prune oidc auth requests:", err)
+			}
+			if err := server.store.DeleteExpiredWebAuthnCeremonies(ctx); err != nil {
+				log.Println("cannot prune webauthn ceremonies:", err)
+			}
+		}
+	}
 }
 
 func errorResponse(err error) gin.H {
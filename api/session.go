@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/audit"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type sessionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	ClientIP   string    `json:"client_ip"`
+	LastSeenIP string    `json:"last_seen_ip"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current is set on the session the request was made with
+	Current bool `json:"current"`
+}
+
+func newSessionResponse(session db.Session, currentSessionID uuid.UUID) sessionResponse {
+	return sessionResponse{
+		ID:         session.ID,
+		DeviceName: session.DeviceName,
+		UserAgent:  session.UserAgent,
+		ClientIP:   session.ClientIp,
+		LastSeenIP: session.LastSeenIp,
+		LastSeenAt: session.LastSeenAt,
+		CreatedAt:  session.CreatedAt,
+		ExpiresAt:  session.ExpiresAt,
+		Current:    session.ID == currentSessionID,
+	}
+}
+
+// listMySessions shows the logged in user where they are signed in, most recently used first
+func (server *Server) listMySessions(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	sessions, err := server.store.ListActiveUserSessions(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := make([]sessionResponse, len(sessions))
+	for i, session := range sessions {
+		rsp[i] = newSessionResponse(session, authPayload.SessionID)
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type revokeMySessionRequest struct {
+	ID string `uri:"id" binding:"required,uuid"`
+}
+
+// revokeMySession signs the user out of one of their sessions, its refresh token
+// and the access tokens issued for it are rejected from now on
+func (server *Server) revokeMySession(ctx *gin.Context) {
+	var req revokeMySessionRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	session, err := server.store.BlockUserSession(ctx, db.BlockUserSessionParams{
+		ID:       uuid.MustParse(req.ID),
+		Username: authPayload.Username,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = errors.New("session not found")
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = server.revocations.Revoke(ctx, session.ID, session.Username, session.ExpiresAt)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if session.ID == authPayload.SessionID {
+		server.clearAuthCookies(ctx)
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventSessionRevoked,
+		Actor:   authPayload.Username,
+		Target:  session.ID.String(),
+		Outcome: audit.OutcomeSuccess,
+	})
+
+	ctx.Status(http.StatusNoContent)
+}
+
+type revokeUserSessionsRequest struct {
+	Username string `uri:"username" binding:"required,alphanum"`
+}
+
+type revokeUserSessionsResponse struct {
+	RevokedSessions int `json:"revoked_sessions"`
+}
+
+// revokeUserSessions signs the user out everywhere, the access tokens issued
+// for the blocked sessions are rejected by authMiddleware from now on
+func (server *Server) revokeUserSessions(ctx *gin.Context) {
+	var req revokeUserSessionsRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	revoked, err := server.revokeSessions(ctx, req.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if authPayload.Username == req.Username {
+		server.clearAuthCookies(ctx)
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventSessionsRevoked,
+		Actor:   authPayload.Username,
+		Target:  req.Username,
+		Outcome: audit.OutcomeSuccess,
+		Details: fmt.Sprintf("%d sessions revoked", revoked),
+	})
+
+	ctx.JSON(http.StatusOK, revokeUserSessionsResponse{RevokedSessions: revoked})
+}
+
+// revokeSessions blocks all the active sessions of the user and revokes them,
+// it returns how many sessions were revoked
+func (server *Server) revokeSessions(ctx context.Context, username string) (int, error) {
+	sessions, err := server.store.BlockUserSessions(ctx, username)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, session := range sessions {
+		err = server.revocations.Revoke(ctx, session.ID, session.Username, session.ExpiresAt)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(sessions), nil
+}
+
+type unlockUserRequest struct {
+	Username string `uri:"username" binding:"required,alphanum"`
+}
+
+type unlockUserResponse struct {
+	Unlocked bool `json:"unlocked"`
+}
+
+// unlockUser lifts the login lockout and backoff of the user before they expire,
+// for wrong passwords and for wrong two-factor codes alike
+func (server *Server) unlockUser(ctx *gin.Context) {
+	var req unlockUserRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	unlocked := false
+	for _, key := range []loginThrottleKey{
+		server.loginThrottle.usernameKey(req.Username),
+		server.loginThrottle.mfaKey(req.Username),
+	} {
+		reset, err := server.loginThrottle.Reset(ctx, key)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		unlocked = unlocked || reset
+	}
+
+	event := audit.Event{
+		Type:    audit.EventUserUnlocked,
+		Actor:   ctx.MustGet(authorizationPayloadKey).(*token.Payload).Username,
+		Target:  req.Username,
+		Outcome: audit.OutcomeSuccess,
+	}
+	if !unlocked {
+		event.Details = "user was not locked"
+	}
+	server.audit(ctx, event)
+
+	ctx.JSON(http.StatusOK, unlockUserResponse{Unlocked: unlocked})
+}
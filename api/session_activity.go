@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/google/uuid"
+)
+
+// sessionTouchInterval is how stale the last seen time of a session may get
+// before a request from the same address records it again
+const sessionTouchInterval = time.Minute
+
+// sessionActivity records when sessions were last used. A session is written
+// at most once per interval from this instance, unless the client address
+// changes, so that each request does not hit the database.
+type sessionActivity struct {
+	store    db.Store
+	interval time.Duration
+
+	mu       sync.Mutex
+	touched  map[uuid.UUID]sessionTouch
+	prunedAt time.Time
+}
+
+type sessionTouch struct {
+	clientIP  string
+	touchedAt time.Time
+}
+
+func newSessionActivity(store db.Store, interval time.Duration) *sessionActivity {
+	return &sessionActivity{
+		store:    store,
+		interval: interval,
+		touched:  make(map[uuid.UUID]sessionTouch),
+		prunedAt: time.Now(),
+	}
+}
+
+// Touch records that the session was used from the client address. The last
+// seen time is only informational, so a failed write is logged and the
+// request goes on.
+func (activity *sessionActivity) Touch(ctx context.Context, sessionID uuid.UUID, clientIP string) {
+	now := time.Now()
+
+	activity.mu.Lock()
+	last, ok := activity.touched[sessionID]
+	activity.mu.Unlock()
+
+	if ok && last.clientIP == clientIP && now.Sub(last.touchedAt) < activity.interval {
+		return
+	}
+
+	err := activity.store.TouchSession(ctx, db.TouchSessionParams{
+		ID:       sessionID,
+		ClientIp: clientIP,
+	})
+	if err != nil {
+		log.Println("cannot record session activity:", err)
+		return
+	}
+
+	activity.mu.Lock()
+	activity.touched[sessionID] = sessionTouch{clientIP: clientIP, touchedAt: now}
+	activity.prune(now)
+	activity.mu.Unlock()
+}
+
+// prune drops the entries that are too old to skip a write anymore, at most
+// once per interval. It must be called with the lock held.
+func (activity *sessionActivity) prune(now time.Time) {
+	if now.Sub(activity.prunedAt) < activity.interval {
+		return
+	}
+
+	for id, touch := range activity.touched {
+		if now.Sub(touch.touchedAt) >= activity.interval {
+			delete(activity.touched, id)
+		}
+	}
+	activity.prunedAt = now
+}
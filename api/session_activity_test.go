@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	mockdb "github.com/andreanpradanaa/simple-bank-app/db/mock"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+)
+
+func TestSessionActivity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	activity := newSessionActivity(store, time.Minute)
+
+	sessionID := uuid.New()
+	failingID := uuid.New()
+
+	// the same client within the interval is written once
+	store.EXPECT().
+		TouchSession(gomock.Any(), gomock.Eq(db.TouchSessionParams{ID: sessionID, ClientIp: "203.0.113.7"})).
+		Times(1)
+	activity.Touch(context.Background(), sessionID, "203.0.113.7")
+	activity.Touch(context.Background(), sessionID, "203.0.113.7")
+
+	// a new address is recorded right away
+	store.EXPECT().
+		TouchSession(gomock.Any(), gomock.Eq(db.TouchSessionParams{ID: sessionID, ClientIp: "10.0.0.1"})).
+		Times(1)
+	activity.Touch(context.Background(), sessionID, "10.0.0.1")
+
+	// a failed write is tried again on the next request
+	store.EXPECT().
+		TouchSession(gomock.Any(), gomock.Eq(db.TouchSessionParams{ID: failingID, ClientIp: "203.0.113.7"})).
+		Times(2).
+		Return(sql.ErrConnDone)
+	activity.Touch(context.Background(), failingID, "203.0.113.7")
+	activity.Touch(context.Background(), failingID, "203.0.113.7")
+}
@@ -0,0 +1,305 @@
+package api
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/audit"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Ways a user can authenticate again for a step-up
+const (
+	stepUpMethodPassword = "password"
+	stepUpMethodTOTP     = "totp"
+	stepUpMethodPIN      = "pin"
+	stepUpMethodPasskey  = "passkey"
+)
+
+const defaultStepUpDuration = 5 * time.Minute
+
+var (
+	errStepUpRequired         = errors.New("this action requires you to authenticate again")
+	errInvalidStepUpToken     = errors.New("step-up token is invalid or was issued for another action")
+	errInvalidStepUpChallenge = errors.New("step-up challenge is invalid or has already been used")
+)
+
+// transferBinding identifies a transfer by its parameters, so that a step-up
+// token can only be used for the transfer it was issued for
+func transferBinding(fromAccountID int64, toAccountID int64, amount int64, currency string) string {
+	digest := sha256.Sum256([]byte(fmt.Sprintf("transfer:%d:%d:%d:%s", fromAccountID, toAccountID, amount, currency)))
+	return hex.EncodeToString(digest[:])
+}
+
+// accountActionBinding identifies a change to the credentials of the user, such as
+// registering a passkey, so that a step-up token can only be used for that change
+func accountActionBinding(action string) string {
+	digest := sha256.Sum256([]byte("account:" + action))
+	return hex.EncodeToString(digest[:])
+}
+
+// stepUpRequired returns true if the amount is above the step-up threshold of its currency
+func (server *Server) stepUpRequired(currency string, amount int64) bool {
+	threshold, ok := server.config.StepUpThresholds[currency]
+	return ok && amount > threshold
+}
+
+// checkStepUp uses up the step-up token if it was issued to the caller for the action,
+// or answers with a new step-up challenge
+func (server *Server) checkStepUp(ctx *gin.Context, stepUpToken string, binding string) bool {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	// api keys cannot step up, there is no one at the keyboard to prove who they are
+	if authPayload.Type == token.TokenTypeAPIKey {
+		err := errors.New("this action is not allowed with an api key")
+		ctx.JSON(http.StatusForbidden, errorResponse(err))
+		return false
+	}
+
+	if stepUpToken == "" {
+		server.issueStepUpChallenge(ctx, authPayload, binding, errStepUpRequired)
+		return false
+	}
+
+	payload, err := server.tokenMaker.VerifyToken(stepUpToken)
+	if err != nil ||
+		payload.Type != token.TokenTypeStepUp ||
+		payload.Username != authPayload.Username ||
+		payload.SessionID != authPayload.SessionID ||
+		payload.Binding != binding {
+		server.issueStepUpChallenge(ctx, authPayload, binding, errInvalidStepUpToken)
+		return false
+	}
+
+	consumed, err := server.revocations.Consume(ctx, payload.ID, payload.Username, payload.ExpiredAt)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return false
+	}
+	if !consumed {
+		server.issueStepUpChallenge(ctx, authPayload, binding, errInvalidStepUpToken)
+		return false
+	}
+	return true
+}
+
+type stepUpChallengeResponse struct {
+	Error                   string    `json:"error"`
+	StepUpRequired          bool      `json:"step_up_required"`
+	Methods                 []string  `json:"methods"`
+	ChallengeToken          string    `json:"challenge_token"`
+	ChallengeTokenExpiresAt time.Time `json:"challenge_token_expires_at"`
+}
+
+// issueStepUpChallenge answers unauthorized with a challenge token bound to the action,
+// along with the methods the user can authenticate with
+func (server *Server) issueStepUpChallenge(ctx *gin.Context, authPayload *token.Payload, binding string, reason error) {
+	methods, err := server.stepUpMethods(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	challengeToken, challengePayload, err := server.tokenMaker.CreateToken(
+		authPayload.Username,
+		server.config.StepUpDuration,
+		token.WithType(token.TokenTypeStepUpChallenge),
+		token.WithSessionID(authPayload.SessionID),
+		token.WithRole(authPayload.Role),
+		token.WithBinding(binding),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusUnauthorized, stepUpChallengeResponse{
+		Error:                   reason.Error(),
+		StepUpRequired:          true,
+		Methods:                 methods,
+		ChallengeToken:          challengeToken,
+		ChallengeTokenExpiresAt: challengePayload.ExpiredAt,
+	})
+}
+
+// stepUpMethods lists the methods the user has set up, the password always is
+func (server *Server) stepUpMethods(ctx *gin.Context, username string) ([]string, error) {
+	methods := []string{stepUpMethodPassword}
+
+	userTOTP, err := server.store.GetUserTOTP(ctx, username)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil && userTOTP.ConfirmedAt.Valid {
+		methods = append(methods, stepUpMethodTOTP)
+	}
+
+	authInfo, err := server.authInfo.Get(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if authInfo.HasTransactionPin {
+		methods = append(methods, stepUpMethodPIN)
+	}
+	if authInfo.HasPasskey {
+		methods = append(methods, stepUpMethodPasskey)
+	}
+
+	return methods, nil
+}
+
+type stepUpRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Method         string `json:"method" binding:"required,oneof=password totp pin passkey"`
+	// Password is the account password for the password method, Code the totp or
+	// recovery code for the totp method, and PIN the transaction pin for the pin method.
+	// The passkey method answers the ceremony started by beginPasskeyStepUp.
+	Password   string          `json:"password" binding:"required_if=Method password"`
+	Code       string          `json:"code" binding:"required_if=Method totp"`
+	PIN        string          `json:"pin" binding:"required_if=Method pin"`
+	CeremonyID string          `json:"ceremony_id" binding:"required_if=Method passkey,omitempty,uuid"`
+	Credential json.RawMessage `json:"credential" binding:"required_if=Method passkey"`
+}
+
+type stepUpResponse struct {
+	StepUpToken          string    `json:"step_up_token"`
+	StepUpTokenExpiresAt time.Time `json:"step_up_token_expires_at"`
+}
+
+// stepUp exchanges a step-up challenge and a fresh proof of identity for a step-up
+// token bound to the same action. The challenge is single-use, like the mfa challenge
+// of a login. Wrong passwords count towards the login lockout, and wrong codes
+// towards the same throttle as mfa logins.
+func (server *Server) stepUp(ctx *gin.Context) {
+	var req stepUpRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	challenge, ok := server.verifyStepUpChallenge(authPayload, req.ChallengeToken)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidStepUpChallenge))
+		return
+	}
+
+	consumed, err := server.revocations.Consume(ctx, challenge.ID, challenge.Username, challenge.ExpiredAt)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !consumed {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidStepUpChallenge))
+		return
+	}
+
+	var valid bool
+	switch req.Method {
+	case stepUpMethodPassword:
+		valid, err = server.checkAccountPassword(ctx, authPayload.Username, req.Password)
+	case stepUpMethodTOTP:
+		valid, err = server.checkMFACode(ctx, authPayload.Username, req.Code)
+	case stepUpMethodPIN:
+		valid, err = server.checkTransactionPIN(ctx, authPayload.Username, req.PIN)
+		if err == errTransactionPINNotSet {
+			err = nil
+		}
+	case stepUpMethodPasskey:
+		valid, err = server.checkPasskey(ctx, authPayload.Username, req.CeremonyID, req.Credential)
+	}
+	if err != nil {
+		if err == errTooManyLoginAttempts || err == errTooManyMFAAttempts || err == errTransactionPINLocked {
+			ctx.JSON(http.StatusTooManyRequests, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventStepUp,
+		Actor:   authPayload.Username,
+		Outcome: outcome(valid),
+		Details: req.Method,
+	})
+
+	if !valid {
+		err := errIncorrectCredentials
+		switch req.Method {
+		case stepUpMethodTOTP:
+			err = errInvalidMFACode
+		case stepUpMethodPIN:
+			err = errIncorrectTransactionPIN
+		case stepUpMethodPasskey:
+			err = errInvalidPasskey
+		}
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	stepUpToken, stepUpPayload, err := server.tokenMaker.CreateToken(
+		authPayload.Username,
+		server.config.StepUpDuration,
+		token.WithType(token.TokenTypeStepUp),
+		token.WithSessionID(authPayload.SessionID),
+		token.WithRole(authPayload.Role),
+		token.WithBinding(challenge.Binding),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, stepUpResponse{
+		StepUpToken:          stepUpToken,
+		StepUpTokenExpiresAt: stepUpPayload.ExpiredAt,
+	})
+}
+
+// verifyStepUpChallenge returns the payload of the challenge token, if it was issued
+// to the session of the caller
+func (server *Server) verifyStepUpChallenge(authPayload *token.Payload, challengeToken string) (*token.Payload, bool) {
+	challenge, err := server.tokenMaker.VerifyToken(challengeToken)
+	if err != nil ||
+		challenge.Type != token.TokenTypeStepUpChallenge ||
+		challenge.Username != authPayload.Username ||
+		challenge.SessionID != authPayload.SessionID {
+		return nil, false
+	}
+	return challenge, true
+}
+
+// checkAccountPassword checks the password of the user, under the same throttle as logins
+func (server *Server) checkAccountPassword(ctx *gin.Context, username string, password string) (bool, error) {
+	usernameKey := server.loginThrottle.usernameKey(username)
+
+	retryAfter, err := server.loginThrottle.Attempt(ctx, usernameKey)
+	if err != nil {
+		return false, err
+	}
+	if retryAfter > 0 {
+		return false, errTooManyLoginAttempts
+	}
+
+	user, err := server.store.GetUser(ctx, username)
+	if err != nil {
+		return false, err
+	}
+
+	if err := utils.CheckPassword(password, user.HashedPassword); err != nil {
+		return false, nil
+	}
+
+	err = server.loginThrottle.Succeed(ctx, usernameKey)
+	return err == nil, err
+}
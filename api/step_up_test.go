@@ -0,0 +1,526 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mockdb "github.com/andreanpradanaa/simple-bank-app/db/mock"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+// the test server asks for a step-up above 1000 USD, and never for EUR
+const testStepUpAmount = int64(5000)
+
+func createStepUpToken(t *testing.T, server *Server, username string, binding string) string {
+	stepUpToken, _, err := server.tokenMaker.CreateToken(
+		username,
+		time.Minute,
+		token.WithType(token.TokenTypeStepUp),
+		token.WithBinding(binding),
+	)
+	require.NoError(t, err)
+	return stepUpToken
+}
+
+func requireStepUpChallenge(t *testing.T, recorder *httptest.ResponseRecorder, methods []string) stepUpChallengeResponse {
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	var rsp stepUpChallengeResponse
+	err := json.NewDecoder(recorder.Body).Decode(&rsp)
+	require.NoError(t, err)
+	require.True(t, rsp.StepUpRequired)
+	require.Equal(t, methods, rsp.Methods)
+	require.NotEmpty(t, rsp.ChallengeToken)
+	return rsp
+}
+
+func TestTransferStepUpAPI(t *testing.T) {
+	user1, _ := randomUser(t)
+	user2, _ := randomUser(t)
+
+	account1 := randomAccount(user1.Username)
+	account2 := randomAccount(user2.Username)
+	account2.ID = account1.ID + 1
+
+	binding := func(currency string, amount int64) string {
+		return transferBinding(account1.ID, account2.ID, amount, currency)
+	}
+
+	testCases := []struct {
+		name          string
+		currency      string
+		amount        int64
+		stepUpToken   func(t *testing.T, server *Server) string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:     "BelowThreshold",
+			currency: utils.USD,
+			amount:   1000,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:     "NoThresholdForCurrency",
+			currency: utils.EUR,
+			amount:   testStepUpAmount,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:     "MissingStepUpToken",
+			currency: utils.USD,
+			amount:   testStepUpAmount,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserTOTP(gomock.Any(), gomock.Eq(user1.Username)).
+					Times(1).
+					Return(db.UserTotp{ConfirmedAt: sql.NullTime{Time: time.Now(), Valid: true}}, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireStepUpChallenge(t, recorder, []string{stepUpMethodPassword, stepUpMethodTOTP})
+			},
+		},
+		{
+			name:     "ValidStepUpToken",
+			currency: utils.USD,
+			amount:   testStepUpAmount,
+			stepUpToken: func(t *testing.T, server *Server) string {
+				return createStepUpToken(t, server, user1.Username, binding(utils.USD, testStepUpAmount))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:     "StepUpTokenForAnotherAmount",
+			currency: utils.USD,
+			amount:   testStepUpAmount,
+			stepUpToken: func(t *testing.T, server *Server) string {
+				return createStepUpToken(t, server, user1.Username, binding(utils.USD, testStepUpAmount-1))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Any()).Times(1).Return(db.UserTotp{}, sql.ErrNoRows)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireStepUpChallenge(t, recorder, []string{stepUpMethodPassword})
+			},
+		},
+		{
+			name:     "StepUpTokenOfAnotherUser",
+			currency: utils.USD,
+			amount:   testStepUpAmount,
+			stepUpToken: func(t *testing.T, server *Server) string {
+				return createStepUpToken(t, server, user2.Username, binding(utils.USD, testStepUpAmount))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Any()).Times(1).Return(db.UserTotp{}, sql.ErrNoRows)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireStepUpChallenge(t, recorder, []string{stepUpMethodPassword})
+			},
+		},
+		{
+			name:     "AccessTokenAsStepUpToken",
+			currency: utils.USD,
+			amount:   testStepUpAmount,
+			stepUpToken: func(t *testing.T, server *Server) string {
+				accessToken, _, err := server.tokenMaker.CreateToken(user1.Username, time.Minute)
+				require.NoError(t, err)
+				return accessToken
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Any()).Times(1).Return(db.UserTotp{}, sql.ErrNoRows)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireStepUpChallenge(t, recorder, []string{stepUpMethodPassword})
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			from, to := account1, account2
+			from.Currency, to.Currency = tc.currency, tc.currency
+
+			store := mockdb.NewMockStore(ctrl)
+			store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(from.ID)).Times(1).Return(from, nil)
+			store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(to.ID)).Times(1).Return(to, nil)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+
+			body := gin.H{
+				"from_account_id": from.ID,
+				"to_account_id":   to.ID,
+				"amount":          tc.amount,
+				"currency":        tc.currency,
+			}
+			if tc.stepUpToken != nil {
+				body["step_up_token"] = tc.stepUpToken(t, server)
+			}
+
+			tc.checkResponse(t, postJSON(t, server, "/transfers", body, user1.Username))
+		})
+	}
+}
+
+func TestStepUpAPI(t *testing.T) {
+	user, password := randomUser(t)
+	pin, plainPIN := randomTransactionPIN(t, user.Username)
+	binding := transferBinding(1, 2, testStepUpAmount, utils.USD)
+
+	createChallenge := func(t *testing.T, server *Server, username string, tokenType string) string {
+		challengeToken, _, err := server.tokenMaker.CreateToken(
+			username,
+			time.Minute,
+			token.WithType(tokenType),
+			token.WithBinding(binding),
+		)
+		require.NoError(t, err)
+		return challengeToken
+	}
+
+	testCases := []struct {
+		name          string
+		body          func(t *testing.T, server *Server) gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OKWithPassword",
+			body: func(t *testing.T, server *Server) gin.H {
+				return gin.H{
+					"challenge_token": createChallenge(t, server, user.Username, token.TokenTypeStepUpChallenge),
+					"method":          stepUpMethodPassword,
+					"password":        password,
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(1).Return(db.LoginThrottle{FailedCount: 1}, nil)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+				store.EXPECT().DeleteLoginThrottle(gomock.Any(), gomock.Eq("username:"+user.Username)).Times(1)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp stepUpResponse
+				err := json.NewDecoder(recorder.Body).Decode(&rsp)
+				require.NoError(t, err)
+
+				// the step-up token is bound to the action the challenge was for
+				payload, err := server.tokenMaker.VerifyToken(rsp.StepUpToken)
+				require.NoError(t, err)
+				require.Equal(t, token.TokenTypeStepUp, payload.Type)
+				require.Equal(t, user.Username, payload.Username)
+				require.Equal(t, binding, payload.Binding)
+			},
+		},
+		{
+			name: "WrongPassword",
+			body: func(t *testing.T, server *Server) gin.H {
+				return gin.H{
+					"challenge_token": createChallenge(t, server, user.Username, token.TokenTypeStepUpChallenge),
+					"method":          stepUpMethodPassword,
+					"password":        "wrong password",
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(1).Return(db.LoginThrottle{FailedCount: 1}, nil)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+				store.EXPECT().DeleteLoginThrottle(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "OKWithPIN",
+			body: func(t *testing.T, server *Server) gin.H {
+				return gin.H{
+					"challenge_token": createChallenge(t, server, user.Username, token.TokenTypeStepUpChallenge),
+					"method":          stepUpMethodPIN,
+					"pin":             plainPIN,
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().RecordTransactionPINAttempt(gomock.Any(), gomock.Any()).Times(1).Return(pin, nil)
+				store.EXPECT().ResetTransactionPINFailures(gomock.Any(), gomock.Eq(user.Username)).Times(1)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "PINNotSet",
+			body: func(t *testing.T, server *Server) gin.H {
+				return gin.H{
+					"challenge_token": createChallenge(t, server, user.Username, token.TokenTypeStepUpChallenge),
+					"method":          stepUpMethodPIN,
+					"pin":             plainPIN,
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().RecordTransactionPINAttempt(gomock.Any(), gomock.Any()).Times(1).Return(db.TransactionPin{}, sql.ErrNoRows)
+				store.EXPECT().GetTransactionPIN(gomock.Any(), gomock.Any()).Times(1).Return(db.TransactionPin{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "LockedOut",
+			body: func(t *testing.T, server *Server) gin.H {
+				return gin.H{
+					"challenge_token": createChallenge(t, server, user.Username, token.TokenTypeStepUpChallenge),
+					"method":          stepUpMethodPassword,
+					"password":        password,
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().
+					RecordLoginAttempt(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.LoginThrottle{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetLoginThrottles(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return([]db.LoginThrottle{{
+						Key:         "username:" + user.Username,
+						LockedUntil: sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true},
+					}}, nil)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			},
+		},
+		{
+			name: "TOTPNotEnabled",
+			body: func(t *testing.T, server *Server) gin.H {
+				return gin.H{
+					"challenge_token": createChallenge(t, server, user.Username, token.TokenTypeStepUpChallenge),
+					"method":          stepUpMethodTOTP,
+					"code":            "123456",
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(1).Return(db.LoginThrottle{FailedCount: 1}, nil)
+				store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(db.UserTotp{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "TOTPThrottled",
+			body: func(t *testing.T, server *Server) gin.H {
+				return gin.H{
+					"challenge_token": createChallenge(t, server, user.Username, token.TokenTypeStepUpChallenge),
+					"method":          stepUpMethodTOTP,
+					"code":            "123456",
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				// wrong codes share the throttle of mfa logins
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().
+					RecordLoginAttempt(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.LoginThrottle{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetLoginThrottles(gomock.Any(), gomock.Eq([]string{"mfa:" + user.Username})).
+					Times(1).
+					Return([]db.LoginThrottle{{
+						Key:         "mfa:" + user.Username,
+						LockedUntil: sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true},
+					}}, nil)
+				store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			},
+		},
+		{
+			name: "ChallengeUsedConcurrently",
+			body: func(t *testing.T, server *Server) gin.H {
+				return gin.H{
+					"challenge_token": createChallenge(t, server, user.Username, token.TokenTypeStepUpChallenge),
+					"method":          stepUpMethodPassword,
+					"password":        password,
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(0), nil)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "ChallengeOfAnotherUser",
+			body: func(t *testing.T, server *Server) gin.H {
+				return gin.H{
+					"challenge_token": createChallenge(t, server, utils.RandomOwner(), token.TokenTypeStepUpChallenge),
+					"method":          stepUpMethodPassword,
+					"password":        password,
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "StepUpTokenAsChallenge",
+			body: func(t *testing.T, server *Server) gin.H {
+				return gin.H{
+					"challenge_token": createChallenge(t, server, user.Username, token.TokenTypeStepUp),
+					"method":          stepUpMethodPassword,
+					"password":        password,
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "MissingPassword",
+			body: func(t *testing.T, server *Server) gin.H {
+				return gin.H{
+					"challenge_token": createChallenge(t, server, user.Username, token.TokenTypeStepUpChallenge),
+					"method":          stepUpMethodPassword,
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+
+			recorder := postJSON(t, server, "/users/me/step-up", tc.body(t, server), user.Username)
+			tc.checkResponse(t, server, recorder)
+		})
+	}
+}
+
+func TestTransferStepUpFlow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user1, password := randomUser(t)
+	user2, _ := randomUser(t)
+
+	account1 := randomAccount(user1.Username)
+	account2 := randomAccount(user2.Username)
+	account2.ID = account1.ID + 1
+	account1.Currency = utils.USD
+	account2.Currency = utils.USD
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).AnyTimes().Return(account1, nil)
+	store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).AnyTimes().Return(account2, nil)
+	store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Any()).AnyTimes().Return(db.UserTotp{}, sql.ErrNoRows)
+	store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(1).Return(db.LoginThrottle{FailedCount: 1}, nil)
+	store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user1.Username)).Times(1).Return(user1, nil)
+	store.EXPECT().DeleteLoginThrottle(gomock.Any(), gomock.Any()).Times(1)
+	// the challenge, then the step-up token, are used up
+	store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(2).Return(int64(1), nil)
+	store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1)
+	stubAuthInfo(store)
+
+	server := newTestServer(t, store)
+
+	transfer := gin.H{
+		"from_account_id": account1.ID,
+		"to_account_id":   account2.ID,
+		"amount":          testStepUpAmount,
+		"currency":        utils.USD,
+	}
+
+	challenge := requireStepUpChallenge(t, postJSON(t, server, "/transfers", transfer, user1.Username), []string{stepUpMethodPassword})
+
+	stepUp := gin.H{
+		"challenge_token": challenge.ChallengeToken,
+		"method":          stepUpMethodPassword,
+		"password":        password,
+	}
+	recorder := postJSON(t, server, "/users/me/step-up", stepUp, user1.Username)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var rsp stepUpResponse
+	err := json.NewDecoder(recorder.Body).Decode(&rsp)
+	require.NoError(t, err)
+
+	transfer["step_up_token"] = rsp.StepUpToken
+	recorder = postJSON(t, server, "/transfers", transfer, user1.Username)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// neither the step-up token nor the challenge can be used twice
+	requireStepUpChallenge(t, postJSON(t, server, "/transfers", transfer, user1.Username), []string{stepUpMethodPassword})
+
+	recorder = postJSON(t, server, "/users/me/step-up", stepUp, user1.Username)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/audit"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/gin-gonic/gin"
+)
+
+// renewAccessTokenRequest may leave out the refresh token of a cookie login,
+// it is then taken from the refresh token cookie
+type renewAccessTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type renewAccessTokenResponse struct {
+	AccessToken          string    `json:"access_token,omitempty"`
+	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
+}
+
+func (server *Server) renewAccessToken(ctx *gin.Context) {
+	var req renewAccessTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	useCookies := false
+	if req.RefreshToken == "" {
+		refreshToken, err := ctx.Cookie(refreshTokenCookie)
+		if err != nil || refreshToken == "" {
+			err := errors.New("refresh token is not provided")
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+
+		if !checkCSRF(ctx) {
+			ctx.JSON(http.StatusForbidden, errorResponse(errInvalidCSRFToken))
+			return
+		}
+
+		req.RefreshToken = refreshToken
+		useCookies = true
+	}
+
+	refreshPayload, err := server.tokenMaker.VerifyToken(req.RefreshToken)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	if refreshPayload.Type != token.TokenTypeRefresh {
+		err := errors.New("token is not a refresh token")
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	session, err := server.store.GetSession(ctx, refreshPayload.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if session.IsBlocked {
+		err := errors.New("blocked session")
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	if session.Username != refreshPayload.Username {
+		err := errors.New("incorrect session user")
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		err := errors.New("expired session")
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	if server.config.SessionBindClient {
+		if session.UserAgent != ctx.Request.UserAgent() || session.ClientIp != ctx.ClientIP() {
+			err := errors.New("session was not created from this client")
+			ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+	}
+
+	// the role may have changed since login, so it is looked up again
+	user, err := server.store.GetUser(ctx, session.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if refreshPayload.IssuedAt.Before(user.PasswordChangedAt) {
+		err := errors.New("token was issued before the last password change")
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	// checked against the stored list rather than the auth cache, so a refresh
+	// token cannot mint access tokens outside the ranges on an instance whose
+	// cache is not up to date yet
+	if !ipAllowed(user.AllowedIps, ctx.ClientIP()) {
+		server.forbidAuth(ctx, user.Username, errClientIPNotAllowed)
+		return
+	}
+
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
+		user.Username,
+		server.config.AccessTokenDuration,
+		token.WithSessionID(session.ID),
+		token.WithRole(user.Role),
+		token.WithScopes(refreshPayload.Scopes),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventTokenIssued,
+		Actor:   user.Username,
+		Target:  session.ID.String(),
+		Outcome: audit.OutcomeSuccess,
+		Details: "renewed access token",
+	})
+
+	rsp := renewAccessTokenResponse{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: accessPayload.ExpiredAt,
+	}
+	if useCookies {
+		err = server.setCSRFCookie(ctx, refreshPayload.ExpiredAt)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		server.setCookie(ctx, accessTokenCookie, accessToken, "/", accessPayload.ExpiredAt, true)
+		rsp.AccessToken = ""
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
@@ -0,0 +1,376 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/audit"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/andreanpradanaa/simple-bank-app/totp"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	errInvalidMFACode     = errors.New("invalid two-factor authentication code, please log in again")
+	errTooManyMFAAttempts = errors.New("too many invalid two-factor authentication codes, please try again later")
+)
+
+type enrollTOTPRequest struct {
+	// StepUpToken proves the user authenticated again to turn on two-factor authentication
+	StepUpToken string `json:"step_up_token"`
+}
+
+// totpEnrollmentBinding is the step-up binding of enrolling a totp authenticator
+var totpEnrollmentBinding = accountActionBinding("totp_enrollment")
+
+type enrollTOTPResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// enrollTOTP generates a new totp secret for the user. It is not asked for at
+// login until the user confirms it with a code from their authenticator app.
+func (server *Server) enrollTOTP(ctx *gin.Context) {
+	// the body is optional, the step-up challenge tells the client what to send
+	var req enrollTOTPRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	// a second factor set up by a stolen session would lock the owner out
+	if !server.checkStepUp(ctx, req.StepUpToken, totpEnrollmentBinding) {
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	secretEncrypted, err := utils.Encrypt([]byte(server.config.TOTPEncryptionKey), []byte(secret))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	_, err = server.store.UpsertUserTOTP(ctx, db.UpsertUserTOTPParams{
+		Username:        authPayload.Username,
+		SecretEncrypted: secretEncrypted,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errTOTPAlreadyEnabled))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, enrollTOTPResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(server.config.TOTPIssuer, authPayload.Username, secret),
+	})
+}
+
+type confirmTOTPRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+type confirmTOTPResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// confirmTOTP turns on two-factor authentication once the user proves their
+// authenticator app is set up. The recovery codes are only ever shown here.
+func (server *Server) confirmTOTP(ctx *gin.Context) {
+	var req confirmTOTPRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	userTOTP, err := server.store.GetUserTOTP(ctx, authPayload.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = errors.New("two-factor authentication must be enrolled first")
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if userTOTP.ConfirmedAt.Valid {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errTOTPAlreadyEnabled))
+		return
+	}
+
+	secret, err := utils.Decrypt([]byte(server.config.TOTPEncryptionKey), userTOTP.SecretEncrypted)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// wrong codes count towards the mfa throttle, like the codes of logins and step-ups
+	mfaKey := server.loginThrottle.mfaKey(authPayload.Username)
+	retryAfter, err := server.loginThrottle.Attempt(ctx, mfaKey)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if retryAfter > 0 {
+		ctx.JSON(http.StatusTooManyRequests, errorResponse(errTooManyMFAAttempts))
+		return
+	}
+
+	step, ok := totp.Validate(string(secret), req.Code, time.Now())
+	if !ok {
+		server.audit(ctx, audit.Event{
+			Type:    audit.EventTOTPEnabled,
+			Actor:   authPayload.Username,
+			Target:  authPayload.Username,
+			Outcome: audit.OutcomeFailure,
+			Details: "invalid code",
+		})
+		err := errors.New("invalid two-factor authentication code")
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	err = server.loginThrottle.Succeed(ctx, mfaKey)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	recoveryCodes, err := totp.GenerateRecoveryCodes(totp.RecoveryCodeCount)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	recoveryCodeHashes := make([]string, len(recoveryCodes))
+	for i, code := range recoveryCodes {
+		recoveryCodeHashes[i] = utils.HashSecretToken(totp.NormalizeRecoveryCode(code))
+	}
+
+	_, err = server.store.EnableTOTPTx(ctx, db.EnableTOTPTxParams{
+		Username:           authPayload.Username,
+		Step:               step,
+		RecoveryCodeHashes: recoveryCodeHashes,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errTOTPAlreadyEnabled))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventTOTPEnabled,
+		Actor:   authPayload.Username,
+		Target:  authPayload.Username,
+		Outcome: audit.OutcomeSuccess,
+	})
+
+	ctx.JSON(http.StatusOK, confirmTOTPResponse{RecoveryCodes: recoveryCodes})
+}
+
+type mfaChallengeResponse struct {
+	MFARequired       bool      `json:"mfa_required"`
+	MFAToken          string    `json:"mfa_token"`
+	MFATokenExpiresAt time.Time `json:"mfa_token_expires_at"`
+}
+
+// issueMFAChallenge answers a correct password with a short-lived token, which
+// is exchanged for the session tokens together with a second factor by loginMFA.
+// The token carries the scopes asked for at login.
+func (server *Server) issueMFAChallenge(ctx *gin.Context, user db.User, scopes []string) {
+	opts := []token.PayloadOption{
+		token.WithType(token.TokenTypeMFA),
+		token.WithRole(user.Role),
+	}
+	if len(scopes) > 0 {
+		opts = append(opts, token.WithScopes(scopes))
+	}
+
+	mfaToken, mfaPayload, err := server.tokenMaker.CreateToken(
+		user.Username,
+		server.config.MFAChallengeDuration,
+		opts...,
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, mfaChallengeResponse{
+		MFARequired:       true,
+		MFAToken:          mfaToken,
+		MFATokenExpiresAt: mfaPayload.ExpiredAt,
+	})
+}
+
+type loginMFARequest struct {
+	MFAToken   string `json:"mfa_token" binding:"required"`
+	Code       string `json:"code" binding:"required"`
+	DeviceName string `json:"device_name" binding:"omitempty,max=64"`
+	UseCookies bool   `json:"use_cookies"`
+}
+
+// loginMFA completes a login with either a totp code or a recovery code. The
+// challenge is single-use: it is revoked once used and after a wrong code, so
+// every guess costs the caller a correct password.
+func (server *Server) loginMFA(ctx *gin.Context) {
+	var req loginMFARequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	mfaPayload, err := server.tokenMaker.VerifyToken(req.MFAToken)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	if mfaPayload.Type != token.TokenTypeMFA {
+		err := errors.New("token is not an mfa challenge token")
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	consumed, err := server.revocations.Consume(ctx, mfaPayload.ID, mfaPayload.Username, mfaPayload.ExpiredAt)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !consumed {
+		err := errors.New("mfa challenge has already been used")
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	valid, err := server.checkMFACode(ctx, mfaPayload.Username, req.Code)
+	if err != nil {
+		if err == errTooManyMFAAttempts {
+			server.audit(ctx, audit.Event{
+				Type:    audit.EventLoginMFA,
+				Actor:   mfaPayload.Username,
+				Outcome: audit.OutcomeFailure,
+				Details: err.Error(),
+			})
+			ctx.JSON(http.StatusTooManyRequests, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventLoginMFA,
+		Actor:   mfaPayload.Username,
+		Outcome: outcome(valid),
+	})
+
+	if !valid {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidMFACode))
+		return
+	}
+
+	user, err := server.store.GetUser(ctx, mfaPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp, err := server.createLoginSession(ctx, user, mfaPayload.Scopes, req.DeviceName)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.respondWithSession(ctx, rsp, req.UseCookies)
+}
+
+// checkMFACode uses up the totp or recovery code if it is valid for the user.
+// Wrong codes count towards a throttle of their own, shared by mfa logins and
+// step-ups, so that logging in with the password again does not reset it.
+func (server *Server) checkMFACode(ctx *gin.Context, username string, code string) (bool, error) {
+	mfaKey := server.loginThrottle.mfaKey(username)
+
+	retryAfter, err := server.loginThrottle.Attempt(ctx, mfaKey)
+	if err != nil {
+		return false, err
+	}
+	if retryAfter > 0 {
+		return false, errTooManyMFAAttempts
+	}
+
+	valid, err := server.verifyMFACode(ctx, username, code)
+	if err != nil || !valid {
+		return false, err
+	}
+
+	err = server.loginThrottle.Succeed(ctx, mfaKey)
+	return err == nil, err
+}
+
+// verifyMFACode uses up the totp or recovery code if it is valid for the user
+func (server *Server) verifyMFACode(ctx *gin.Context, username string, code string) (bool, error) {
+	if totp.IsRecoveryCode(code) {
+		_, err := server.store.UseRecoveryCode(ctx, db.UseRecoveryCodeParams{
+			Username: username,
+			CodeHash: utils.HashSecretToken(totp.NormalizeRecoveryCode(code)),
+		})
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	userTOTP, err := server.store.GetUserTOTP(ctx, username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if !userTOTP.ConfirmedAt.Valid {
+		return false, nil
+	}
+
+	secret, err := utils.Decrypt([]byte(server.config.TOTPEncryptionKey), userTOTP.SecretEncrypted)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := totp.Validate(string(secret), code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	// a code seen before is rejected, even within its validity window
+	_, err = server.store.UseTOTPStep(ctx, db.UseTOTPStepParams{
+		Step:     step,
+		Username: username,
+	})
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
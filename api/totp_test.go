@@ -0,0 +1,601 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	mockdb "github.com/andreanpradanaa/simple-bank-app/db/mock"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/andreanpradanaa/simple-bank-app/totp"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnrollTOTPAPI(t *testing.T) {
+	username := utils.RandomOwner()
+
+	validStepUp := func(t *testing.T, server *Server) string {
+		return createStepUpToken(t, server, username, totpEnrollmentBinding)
+	}
+
+	testCases := []struct {
+		name          string
+		stepUpToken   func(t *testing.T, server *Server) string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder, server *Server)
+	}{
+		{
+			name:        "OK",
+			stepUpToken: validStepUp,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().
+					UpsertUserTOTP(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.UpsertUserTOTPParams) (db.UserTotp, error) {
+						require.Equal(t, username, arg.Username)
+						require.NotEmpty(t, arg.SecretEncrypted)
+						return db.UserTotp{Username: arg.Username, SecretEncrypted: arg.SecretEncrypted}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp enrollTOTPResponse
+				err := json.NewDecoder(recorder.Body).Decode(&rsp)
+				require.NoError(t, err)
+				require.NotEmpty(t, rsp.Secret)
+
+				uri, err := url.Parse(rsp.ProvisioningURI)
+				require.NoError(t, err)
+				require.Equal(t, "otpauth", uri.Scheme)
+				require.Equal(t, rsp.Secret, uri.Query().Get("secret"))
+			},
+		},
+		{
+			name: "NoStepUpToken",
+			stepUpToken: func(t *testing.T, server *Server) string {
+				return ""
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Eq(username)).Times(1).Return(db.UserTotp{}, sql.ErrNoRows)
+				store.EXPECT().UpsertUserTOTP(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, server *Server) {
+				requireStepUpChallenge(t, recorder, []string{stepUpMethodPassword})
+			},
+		},
+		{
+			name: "TokenForAnotherAction",
+			stepUpToken: func(t *testing.T, server *Server) string {
+				return createStepUpToken(t, server, username, passkeyRegistrationBinding)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Eq(username)).Times(1).Return(db.UserTotp{}, sql.ErrNoRows)
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().UpsertUserTOTP(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, server *Server) {
+				requireStepUpChallenge(t, recorder, []string{stepUpMethodPassword})
+			},
+		},
+		{
+			name:        "AlreadyEnabled",
+			stepUpToken: validStepUp,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().
+					UpsertUserTOTP(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UserTotp{}, sql.ErrNoRows)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+
+			recorder := postJSON(t, server, "/users/me/totp", gin.H{
+				"step_up_token": tc.stepUpToken(t, server),
+			}, username)
+			tc.checkResponse(recorder, server)
+		})
+	}
+}
+
+func TestConfirmTOTPAPI(t *testing.T) {
+	username := utils.RandomOwner()
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+
+	validCode := func(t *testing.T) string {
+		code, err := totp.GenerateCode(secret, totp.Step(time.Now()))
+		require.NoError(t, err)
+		return code
+	}
+
+	testCases := []struct {
+		name          string
+		code          func(t *testing.T) string
+		buildStubs    func(store *mockdb.MockStore, userTOTP db.UserTotp)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			code: validCode,
+			buildStubs: func(store *mockdb.MockStore, userTOTP db.UserTotp) {
+				store.EXPECT().
+					GetUserTOTP(gomock.Any(), gomock.Eq(username)).
+					Times(1).
+					Return(userTOTP, nil)
+				store.EXPECT().
+					RecordLoginAttempt(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.LoginThrottle{FailedCount: 1}, nil)
+				store.EXPECT().
+					DeleteLoginThrottle(gomock.Any(), gomock.Eq("mfa:"+username)).
+					Times(1)
+				store.EXPECT().
+					EnableTOTPTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.EnableTOTPTxParams) (db.UserTotp, error) {
+						require.Equal(t, username, arg.Username)
+						require.InDelta(t, totp.Step(time.Now()), arg.Step, 1)
+						require.Len(t, arg.RecoveryCodeHashes, totp.RecoveryCodeCount)
+						return userTOTP, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp confirmTOTPResponse
+				err := json.NewDecoder(recorder.Body).Decode(&rsp)
+				require.NoError(t, err)
+				require.Len(t, rsp.RecoveryCodes, totp.RecoveryCodeCount)
+			},
+		},
+		{
+			name: "WrongCode",
+			code: func(t *testing.T) string {
+				code := []byte(validCode(t))
+				code[0] = '0' + (code[0]-'0'+1)%10
+				return string(code)
+			},
+			buildStubs: func(store *mockdb.MockStore, userTOTP db.UserTotp) {
+				store.EXPECT().
+					GetUserTOTP(gomock.Any(), gomock.Eq(username)).
+					Times(1).
+					Return(userTOTP, nil)
+				store.EXPECT().
+					RecordLoginAttempt(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.LoginThrottle{FailedCount: 1}, nil)
+				store.EXPECT().
+					EnableTOTPTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "TooManyAttempts",
+			code: validCode,
+			buildStubs: func(store *mockdb.MockStore, userTOTP db.UserTotp) {
+				store.EXPECT().
+					GetUserTOTP(gomock.Any(), gomock.Eq(username)).
+					Times(1).
+					Return(userTOTP, nil)
+				store.EXPECT().
+					RecordLoginAttempt(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.LoginThrottle{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetLoginThrottles(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return([]db.LoginThrottle{{
+						Key:         "mfa:" + username,
+						LockedUntil: sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true},
+					}}, nil)
+				store.EXPECT().
+					EnableTOTPTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			},
+		},
+		{
+			name: "NotEnrolled",
+			code: validCode,
+			buildStubs: func(store *mockdb.MockStore, userTOTP db.UserTotp) {
+				store.EXPECT().
+					GetUserTOTP(gomock.Any(), gomock.Eq(username)).
+					Times(1).
+					Return(db.UserTotp{}, sql.ErrNoRows)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "AlreadyEnabled",
+			code: validCode,
+			buildStubs: func(store *mockdb.MockStore, userTOTP db.UserTotp) {
+				userTOTP.ConfirmedAt = sql.NullTime{Time: time.Now(), Valid: true}
+				store.EXPECT().
+					GetUserTOTP(gomock.Any(), gomock.Eq(username)).
+					Times(1).
+					Return(userTOTP, nil)
+				store.EXPECT().
+					EnableTOTPTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidCodeFormat",
+			code: func(t *testing.T) string {
+				return "12ab56"
+			},
+			buildStubs: func(store *mockdb.MockStore, userTOTP db.UserTotp) {
+				store.EXPECT().
+					GetUserTOTP(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			secretEncrypted, err := utils.Encrypt([]byte(server.config.TOTPEncryptionKey), []byte(secret))
+			require.NoError(t, err)
+
+			tc.buildStubs(store, db.UserTotp{Username: username, SecretEncrypted: secretEncrypted})
+			stubAuthInfo(store)
+
+			data, err := json.Marshal(gin.H{"code": tc.code(t)})
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodPost, "/users/me/totp/confirm", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, username, utils.DepositorRole, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestLoginMFAAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+
+	recoveryCodes, err := totp.GenerateRecoveryCodes(1)
+	require.NoError(t, err)
+
+	validCode := func(t *testing.T) string {
+		code, err := totp.GenerateCode(secret, totp.Step(time.Now()))
+		require.NoError(t, err)
+		return code
+	}
+
+	testCases := []struct {
+		name          string
+		tokenType     string
+		code          func(t *testing.T) string
+		buildStubs    func(store *mockdb.MockStore, userTOTP db.UserTotp)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name:      "OK",
+			tokenType: token.TokenTypeMFA,
+			code:      validCode,
+			buildStubs: func(store *mockdb.MockStore, userTOTP db.UserTotp) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(1).Return(db.LoginThrottle{FailedCount: 1}, nil)
+				store.EXPECT().DeleteLoginThrottle(gomock.Any(), gomock.Eq("mfa:"+user.Username)).Times(1)
+				store.EXPECT().
+					GetUserTOTP(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(userTOTP, nil)
+				store.EXPECT().
+					UseTOTPStep(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.UseTOTPStepParams) (db.UserTotp, error) {
+						require.Equal(t, user.Username, arg.Username)
+						require.InDelta(t, totp.Step(time.Now()), arg.Step, 1)
+						return userTOTP, nil
+					})
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					TouchKnownDevice(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(1), nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateSessionParams) (db.Session, error) {
+						return db.Session{ID: arg.ID, Username: arg.Username, ExpiresAt: arg.ExpiresAt}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp loginUserResponse
+				err := json.NewDecoder(recorder.Body).Decode(&rsp)
+				require.NoError(t, err)
+				require.NotEmpty(t, rsp.AccessToken)
+				require.NotEmpty(t, rsp.RefreshToken)
+			},
+		},
+		{
+			name:      "RecoveryCode",
+			tokenType: token.TokenTypeMFA,
+			code: func(t *testing.T) string {
+				return recoveryCodes[0]
+			},
+			buildStubs: func(store *mockdb.MockStore, userTOTP db.UserTotp) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(1).Return(db.LoginThrottle{FailedCount: 1}, nil)
+				store.EXPECT().DeleteLoginThrottle(gomock.Any(), gomock.Eq("mfa:"+user.Username)).Times(1)
+				store.EXPECT().
+					UseRecoveryCode(gomock.Any(), gomock.Eq(db.UseRecoveryCodeParams{
+						Username: user.Username,
+						CodeHash: utils.HashSecretToken(totp.NormalizeRecoveryCode(recoveryCodes[0])),
+					})).
+					Times(1)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					TouchKnownDevice(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(1), nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:      "UsedRecoveryCode",
+			tokenType: token.TokenTypeMFA,
+			code: func(t *testing.T) string {
+				return recoveryCodes[0]
+			},
+			buildStubs: func(store *mockdb.MockStore, userTOTP db.UserTotp) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(1).Return(db.LoginThrottle{FailedCount: 1}, nil)
+				store.EXPECT().
+					UseRecoveryCode(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.RecoveryCode{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:      "ReplayedCode",
+			tokenType: token.TokenTypeMFA,
+			code:      validCode,
+			buildStubs: func(store *mockdb.MockStore, userTOTP db.UserTotp) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(1).Return(db.LoginThrottle{FailedCount: 1}, nil)
+				store.EXPECT().
+					GetUserTOTP(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(userTOTP, nil)
+				store.EXPECT().
+					UseTOTPStep(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UserTotp{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:      "WrongCode",
+			tokenType: token.TokenTypeMFA,
+			code: func(t *testing.T) string {
+				code := []byte(validCode(t))
+				code[0] = '0' + (code[0]-'0'+1)%10
+				return string(code)
+			},
+			buildStubs: func(store *mockdb.MockStore, userTOTP db.UserTotp) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(1).Return(db.LoginThrottle{FailedCount: 1}, nil)
+				store.EXPECT().
+					GetUserTOTP(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(userTOTP, nil)
+				store.EXPECT().
+					UseTOTPStep(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:      "TooManyWrongCodes",
+			tokenType: token.TokenTypeMFA,
+			code:      validCode,
+			buildStubs: func(store *mockdb.MockStore, userTOTP db.UserTotp) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().
+					RecordLoginAttempt(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.RecordLoginAttemptParams) (db.LoginThrottle, error) {
+						require.Equal(t, "mfa:"+user.Username, arg.Key)
+						return db.LoginThrottle{}, sql.ErrNoRows
+					})
+				store.EXPECT().
+					GetLoginThrottles(gomock.Any(), gomock.Eq([]string{"mfa:" + user.Username})).
+					Times(1).
+					Return([]db.LoginThrottle{{
+						Key:          "mfa:" + user.Username,
+						FailedCount:  5,
+						LastFailedAt: time.Now(),
+						LockedUntil:  sql.NullTime{Time: time.Now().Add(10 * time.Minute), Valid: true},
+					}}, nil)
+				store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			},
+		},
+		{
+			name:      "ChallengeUsedConcurrently",
+			tokenType: token.TokenTypeMFA,
+			code:      validCode,
+			buildStubs: func(store *mockdb.MockStore, userTOTP db.UserTotp) {
+				// another request inserted the challenge id first
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(0), nil)
+				store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:      "AccessTokenInsteadOfChallenge",
+			tokenType: token.TokenTypeAccess,
+			code:      validCode,
+			buildStubs: func(store *mockdb.MockStore, userTOTP db.UserTotp) {
+				store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			secretEncrypted, err := utils.Encrypt([]byte(server.config.TOTPEncryptionKey), []byte(secret))
+			require.NoError(t, err)
+
+			tc.buildStubs(store, db.UserTotp{
+				Username:        user.Username,
+				SecretEncrypted: secretEncrypted,
+				ConfirmedAt:     sql.NullTime{Time: time.Now(), Valid: true},
+			})
+
+			mfaToken, _, err := server.tokenMaker.CreateToken(user.Username, time.Minute, token.WithType(tc.tokenType))
+			require.NoError(t, err)
+
+			data, err := json.Marshal(gin.H{"mfa_token": mfaToken, "code": tc.code(t)})
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodPost, "/users/login/mfa", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestLoginMFAChallengeSingleUse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	server := newTestServer(t, store)
+
+	username := utils.RandomOwner()
+	mfaToken, _, err := server.tokenMaker.CreateToken(username, time.Minute, token.WithType(token.TokenTypeMFA))
+	require.NoError(t, err)
+
+	// the first wrong guess burns the challenge, the second request never reaches the store
+	store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+	store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(1).Return(db.LoginThrottle{FailedCount: 1}, nil)
+	store.EXPECT().
+		GetUserTOTP(gomock.Any(), gomock.Eq(username)).
+		Times(1).
+		Return(db.UserTotp{}, sql.ErrNoRows)
+
+	for _, expectedCode := range []int{http.StatusUnauthorized, http.StatusUnauthorized} {
+		data, err := json.Marshal(gin.H{"mfa_token": mfaToken, "code": "123456"})
+		require.NoError(t, err)
+
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodPost, "/users/login/mfa", bytes.NewReader(data))
+		require.NoError(t, err)
+
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, expectedCode, recorder.Code)
+	}
+}
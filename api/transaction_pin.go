@@ -0,0 +1,343 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/audit"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultTransactionPINMaxAttempts     = 5
+	defaultTransactionPINLockoutDuration = 30 * time.Minute
+)
+
+var (
+	errTransactionPINNotSet    = errors.New("transaction pin is not set")
+	errTransactionPINRequired  = errors.New("transaction pin is required to confirm transfers")
+	errIncorrectTransactionPIN = errors.New("incorrect transaction pin")
+	errTransactionPINLocked    = errors.New("transaction pin is locked after too many wrong attempts, try again later")
+)
+
+type transactionPINResponse struct {
+	RequireForTransfers bool       `json:"require_for_transfers"`
+	LockedUntil         *time.Time `json:"locked_until"`
+	ChangedAt           time.Time  `json:"changed_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+func newTransactionPINResponse(pin db.TransactionPin) transactionPINResponse {
+	rsp := transactionPINResponse{
+		RequireForTransfers: pin.RequireForTransfers,
+		ChangedAt:           pin.ChangedAt,
+		CreatedAt:           pin.CreatedAt,
+	}
+	if pin.LockedUntil.Valid && pin.LockedUntil.Time.After(time.Now()) {
+		rsp.LockedUntil = &pin.LockedUntil.Time
+	}
+	return rsp
+}
+
+func (server *Server) getTransactionPIN(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	pin, err := server.store.GetTransactionPIN(ctx, authPayload.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(errTransactionPINNotSet))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newTransactionPINResponse(pin))
+}
+
+type setTransactionPINRequest struct {
+	Password string `json:"password" binding:"required"`
+	PIN      string `json:"pin" binding:"required,len=6,numeric"`
+}
+
+// setTransactionPIN sets the first pin of the user. The password is asked for, so
+// that a stolen access token is not enough to choose the pin.
+func (server *Server) setTransactionPIN(ctx *gin.Context) {
+	var req setTransactionPINRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	valid, err := server.checkAccountPassword(ctx, authPayload.Username, req.Password)
+	if err != nil {
+		if err == errTooManyLoginAttempts {
+			ctx.JSON(http.StatusTooManyRequests, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !valid {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errIncorrectCredentials))
+		return
+	}
+
+	hashedPIN, err := server.passwordHasher.HashPassword(req.PIN)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	pin, err := server.store.CreateTransactionPIN(ctx, db.CreateTransactionPINParams{
+		Username:  authPayload.Username,
+		HashedPin: hashedPIN,
+	})
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code.Name() {
+			case "unique_violation":
+				err := errors.New("transaction pin is already set, change it instead")
+				ctx.JSON(http.StatusForbidden, errorResponse(err))
+				return
+			}
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.authInfo.Forget(authPayload.Username)
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventTransactionPINChanged,
+		Actor:   authPayload.Username,
+		Outcome: audit.OutcomeSuccess,
+		Details: "pin set",
+	})
+
+	ctx.JSON(http.StatusOK, newTransactionPINResponse(pin))
+}
+
+type changeTransactionPINRequest struct {
+	CurrentPIN string `json:"current_pin" binding:"required"`
+	NewPIN     string `json:"new_pin" binding:"required,len=6,numeric"`
+}
+
+func (server *Server) changeTransactionPIN(ctx *gin.Context) {
+	var req changeTransactionPINRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if !server.requireTransactionPIN(ctx, authPayload.Username, req.CurrentPIN) {
+		return
+	}
+
+	hashedPIN, err := server.passwordHasher.HashPassword(req.NewPIN)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	pin, err := server.store.UpdateTransactionPIN(ctx, db.UpdateTransactionPINParams{
+		HashedPin: hashedPIN,
+		Username:  authPayload.Username,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventTransactionPINChanged,
+		Actor:   authPayload.Username,
+		Outcome: audit.OutcomeSuccess,
+		Details: "pin changed",
+	})
+
+	ctx.JSON(http.StatusOK, newTransactionPINResponse(pin))
+}
+
+type resetTransactionPINRequest struct {
+	Password string `json:"password" binding:"required"`
+	NewPIN   string `json:"new_pin" binding:"required,len=6,numeric"`
+}
+
+// resetTransactionPIN replaces a forgotten or locked pin after checking the password
+// again, under the same throttle as logins. It also lifts the lockout of the pin.
+func (server *Server) resetTransactionPIN(ctx *gin.Context) {
+	var req resetTransactionPINRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	valid, err := server.checkAccountPassword(ctx, authPayload.Username, req.Password)
+	if err != nil {
+		if err == errTooManyLoginAttempts {
+			ctx.JSON(http.StatusTooManyRequests, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !valid {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errIncorrectCredentials))
+		return
+	}
+
+	hashedPIN, err := server.passwordHasher.HashPassword(req.NewPIN)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	pin, err := server.store.UpdateTransactionPIN(ctx, db.UpdateTransactionPINParams{
+		HashedPin: hashedPIN,
+		Username:  authPayload.Username,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(errTransactionPINNotSet))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventTransactionPINChanged,
+		Actor:   authPayload.Username,
+		Outcome: audit.OutcomeSuccess,
+		Details: "pin reset with the password",
+	})
+
+	ctx.JSON(http.StatusOK, newTransactionPINResponse(pin))
+}
+
+type updateTransactionPINSettingsRequest struct {
+	PIN                 string `json:"pin" binding:"required"`
+	RequireForTransfers *bool  `json:"require_for_transfers" binding:"required"`
+}
+
+// updateTransactionPINSettings turns on or off asking for the pin on every transfer.
+// The pin is asked for either way, so that a stolen access token cannot turn it off.
+func (server *Server) updateTransactionPINSettings(ctx *gin.Context) {
+	var req updateTransactionPINSettingsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if !server.requireTransactionPIN(ctx, authPayload.Username, req.PIN) {
+		return
+	}
+
+	pin, err := server.store.SetTransactionPINRequired(ctx, db.SetTransactionPINRequiredParams{
+		RequireForTransfers: *req.RequireForTransfers,
+		Username:            authPayload.Username,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.authInfo.Forget(authPayload.Username)
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventTransactionPINChanged,
+		Actor:   authPayload.Username,
+		Outcome: audit.OutcomeSuccess,
+		Details: fmt.Sprintf("require for transfers %t", pin.RequireForTransfers),
+	})
+
+	ctx.JSON(http.StatusOK, newTransactionPINResponse(pin))
+}
+
+// requireTransactionPIN checks the pin of the user, and answers the request when it is not correct
+func (server *Server) requireTransactionPIN(ctx *gin.Context, username string, candidate string) bool {
+	valid, err := server.checkTransactionPIN(ctx, username, candidate)
+	if err != nil {
+		switch err {
+		case errTransactionPINNotSet:
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+		case errTransactionPINLocked:
+			ctx.JSON(http.StatusTooManyRequests, errorResponse(err))
+		default:
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		}
+		return false
+	}
+
+	if !valid {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errIncorrectTransactionPIN))
+		return false
+	}
+	return true
+}
+
+// checkTransactionPIN compares the pin with the one of the user. The attempt is counted
+// first, in the same update that checks the lock, and taken back if the pin is correct.
+// Too many wrong pins in a row lock the pin; it then returns errTransactionPINLocked,
+// even for the correct pin, until the lockout is over.
+func (server *Server) checkTransactionPIN(ctx *gin.Context, username string, candidate string) (bool, error) {
+	pin, err := server.store.RecordTransactionPINAttempt(ctx, db.RecordTransactionPINAttemptParams{
+		MaxAttempts: int32(server.config.TransactionPINMaxAttempts),
+		LockedUntil: time.Now().Add(server.config.TransactionPINLockoutDuration),
+		Username:    username,
+	})
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return false, err
+		}
+
+		// the pin is either locked or not set at all
+		_, err = server.store.GetTransactionPIN(ctx, username)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return false, errTransactionPINNotSet
+			}
+			return false, err
+		}
+		return false, errTransactionPINLocked
+	}
+
+	if err := utils.CheckPassword(candidate, pin.HashedPin); err != nil {
+		locked := pin.LockedUntil.Valid && time.Now().Before(pin.LockedUntil.Time)
+		details := fmt.Sprintf("%d wrong attempts in a row", pin.FailedAttempts)
+		if locked {
+			details = "pin locked"
+		}
+		server.audit(ctx, audit.Event{
+			Type:    audit.EventTransactionPINRejected,
+			Actor:   username,
+			Outcome: audit.OutcomeFailure,
+			Details: details,
+		})
+
+		if locked {
+			return false, errTransactionPINLocked
+		}
+		return false, nil
+	}
+
+	err = server.store.ResetTransactionPINFailures(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
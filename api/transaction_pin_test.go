@@ -0,0 +1,549 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mockdb "github.com/andreanpradanaa/simple-bank-app/db/mock"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func randomTransactionPIN(t *testing.T, username string) (db.TransactionPin, string) {
+	pin := fmt.Sprintf("%06d", utils.RandomInt(0, 999999))
+	hashedPIN, err := utils.HashPassword(pin)
+	require.NoError(t, err)
+
+	return db.TransactionPin{
+		Username:  username,
+		HashedPin: hashedPIN,
+		ChangedAt: time.Now(),
+		CreatedAt: time.Now(),
+	}, pin
+}
+
+// wrongPIN returns a valid pin that is not the given one
+func wrongPIN(pin string) string {
+	if pin == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+func TestSetTransactionPINAPI(t *testing.T) {
+	user, password := randomUser(t)
+	pin := "482913"
+
+	stubPassword := func(store *mockdb.MockStore) {
+		store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(1).Return(db.LoginThrottle{FailedCount: 1}, nil)
+		store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"password": password, "pin": pin},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubPassword(store)
+				store.EXPECT().DeleteLoginThrottle(gomock.Any(), gomock.Any()).Times(1)
+				store.EXPECT().
+					CreateTransactionPIN(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateTransactionPINParams) (db.TransactionPin, error) {
+						require.Equal(t, user.Username, arg.Username)
+						require.NotEqual(t, pin, arg.HashedPin)
+						require.NoError(t, utils.CheckPassword(pin, arg.HashedPin))
+						return db.TransactionPin{Username: arg.Username, HashedPin: arg.HashedPin, ChangedAt: time.Now()}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp transactionPINResponse
+				err := json.NewDecoder(recorder.Body).Decode(&rsp)
+				require.NoError(t, err)
+				require.False(t, rsp.RequireForTransfers)
+				require.Nil(t, rsp.LockedUntil)
+			},
+		},
+		{
+			name: "WrongPassword",
+			body: gin.H{"password": "wrong password", "pin": pin},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubPassword(store)
+				store.EXPECT().CreateTransactionPIN(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "AlreadySet",
+			body: gin.H{"password": password, "pin": pin},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubPassword(store)
+				store.EXPECT().DeleteLoginThrottle(gomock.Any(), gomock.Any()).Times(1)
+				store.EXPECT().
+					CreateTransactionPIN(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.TransactionPin{}, &pq.Error{Code: "23505"})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "PINNotDigits",
+			body: gin.H{"password": password, "pin": "12ab56"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateTransactionPIN(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "PINTooShort",
+			body: gin.H{"password": password, "pin": "1234"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateTransactionPIN(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+
+			tc.checkResponse(t, postJSON(t, server, "/users/me/pin", tc.body, user.Username))
+		})
+	}
+}
+
+func TestChangeTransactionPINAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	pin, plainPIN := randomTransactionPIN(t, user.Username)
+	newPIN := "739104"
+
+	counted := pin
+	counted.FailedAttempts = 1
+
+	locked := pin
+	locked.LockedUntil = sql.NullTime{Time: time.Now().Add(defaultTransactionPINLockoutDuration), Valid: true}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"current_pin": plainPIN, "new_pin": newPIN},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					RecordTransactionPINAttempt(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.RecordTransactionPINAttemptParams) (db.TransactionPin, error) {
+						require.Equal(t, user.Username, arg.Username)
+						require.Equal(t, int32(defaultTransactionPINMaxAttempts), arg.MaxAttempts)
+						require.WithinDuration(t, time.Now().Add(defaultTransactionPINLockoutDuration), arg.LockedUntil, time.Second)
+						return counted, nil
+					})
+				// the attempt counted for the correct pin is taken back
+				store.EXPECT().ResetTransactionPINFailures(gomock.Any(), gomock.Eq(user.Username)).Times(1)
+				store.EXPECT().
+					UpdateTransactionPIN(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.UpdateTransactionPINParams) (db.TransactionPin, error) {
+						require.Equal(t, user.Username, arg.Username)
+						require.NoError(t, utils.CheckPassword(newPIN, arg.HashedPin))
+						return db.TransactionPin{Username: arg.Username, HashedPin: arg.HashedPin}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "CorrectPINOnLastAttempt",
+			body: gin.H{"current_pin": plainPIN, "new_pin": newPIN},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RecordTransactionPINAttempt(gomock.Any(), gomock.Any()).Times(1).Return(locked, nil)
+				store.EXPECT().ResetTransactionPINFailures(gomock.Any(), gomock.Eq(user.Username)).Times(1)
+				store.EXPECT().UpdateTransactionPIN(gomock.Any(), gomock.Any()).Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "WrongPIN",
+			body: gin.H{"current_pin": wrongPIN(plainPIN), "new_pin": newPIN},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RecordTransactionPINAttempt(gomock.Any(), gomock.Any()).Times(1).Return(counted, nil)
+				store.EXPECT().ResetTransactionPINFailures(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().UpdateTransactionPIN(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "WrongPINLocks",
+			body: gin.H{"current_pin": wrongPIN(plainPIN), "new_pin": newPIN},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RecordTransactionPINAttempt(gomock.Any(), gomock.Any()).Times(1).Return(locked, nil)
+				store.EXPECT().UpdateTransactionPIN(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			},
+		},
+		{
+			name: "Locked",
+			body: gin.H{"current_pin": plainPIN, "new_pin": newPIN},
+			buildStubs: func(store *mockdb.MockStore) {
+				// even the correct pin is rejected until the lockout is over
+				store.EXPECT().RecordTransactionPINAttempt(gomock.Any(), gomock.Any()).Times(1).Return(db.TransactionPin{}, sql.ErrNoRows)
+				store.EXPECT().GetTransactionPIN(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(locked, nil)
+				store.EXPECT().ResetTransactionPINFailures(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().UpdateTransactionPIN(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			},
+		},
+		{
+			name: "NotSet",
+			body: gin.H{"current_pin": plainPIN, "new_pin": newPIN},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RecordTransactionPINAttempt(gomock.Any(), gomock.Any()).Times(1).Return(db.TransactionPin{}, sql.ErrNoRows)
+				store.EXPECT().GetTransactionPIN(gomock.Any(), gomock.Any()).Times(1).Return(db.TransactionPin{}, sql.ErrNoRows)
+				store.EXPECT().UpdateTransactionPIN(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+
+			tc.checkResponse(t, sendJSON(t, server, http.MethodPut, "/users/me/pin", tc.body, user.Username))
+		})
+	}
+}
+
+func TestResetTransactionPINAPI(t *testing.T) {
+	user, password := randomUser(t)
+	newPIN := "739104"
+
+	stubPassword := func(store *mockdb.MockStore) {
+		store.EXPECT().RecordLoginAttempt(gomock.Any(), gomock.Any()).Times(1).Return(db.LoginThrottle{FailedCount: 1}, nil)
+		store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"password": password, "new_pin": newPIN},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubPassword(store)
+				store.EXPECT().DeleteLoginThrottle(gomock.Any(), gomock.Any()).Times(1)
+				// a locked pin can be reset, the current pin is not asked for
+				store.EXPECT().RecordTransactionPINAttempt(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().
+					UpdateTransactionPIN(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.UpdateTransactionPINParams) (db.TransactionPin, error) {
+						require.Equal(t, user.Username, arg.Username)
+						require.NoError(t, utils.CheckPassword(newPIN, arg.HashedPin))
+						return db.TransactionPin{Username: arg.Username, HashedPin: arg.HashedPin}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp transactionPINResponse
+				err := json.NewDecoder(recorder.Body).Decode(&rsp)
+				require.NoError(t, err)
+				require.Nil(t, rsp.LockedUntil)
+			},
+		},
+		{
+			name: "WrongPassword",
+			body: gin.H{"password": "wrong password", "new_pin": newPIN},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubPassword(store)
+				store.EXPECT().UpdateTransactionPIN(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "NotSet",
+			body: gin.H{"password": password, "new_pin": newPIN},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubPassword(store)
+				store.EXPECT().DeleteLoginThrottle(gomock.Any(), gomock.Any()).Times(1)
+				store.EXPECT().
+					UpdateTransactionPIN(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.TransactionPin{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "PINTooShort",
+			body: gin.H{"password": password, "new_pin": "1234"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().UpdateTransactionPIN(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+
+			tc.checkResponse(t, postJSON(t, server, "/users/me/pin/reset", tc.body, user.Username))
+		})
+	}
+}
+
+func TestUpdateTransactionPINSettingsAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	pin, plainPIN := randomTransactionPIN(t, user.Username)
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "RequireForTransfers",
+			body: gin.H{"pin": plainPIN, "require_for_transfers": true},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RecordTransactionPINAttempt(gomock.Any(), gomock.Any()).Times(1).Return(pin, nil)
+				store.EXPECT().ResetTransactionPINFailures(gomock.Any(), gomock.Eq(user.Username)).Times(1)
+				store.EXPECT().
+					SetTransactionPINRequired(gomock.Any(), gomock.Eq(db.SetTransactionPINRequiredParams{
+						RequireForTransfers: true,
+						Username:            user.Username,
+					})).
+					Times(1).
+					Return(db.TransactionPin{Username: user.Username, RequireForTransfers: true}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp transactionPINResponse
+				err := json.NewDecoder(recorder.Body).Decode(&rsp)
+				require.NoError(t, err)
+				require.True(t, rsp.RequireForTransfers)
+			},
+		},
+		{
+			name: "TurnOffWithWrongPIN",
+			body: gin.H{"pin": wrongPIN(plainPIN), "require_for_transfers": false},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RecordTransactionPINAttempt(gomock.Any(), gomock.Any()).Times(1).Return(pin, nil)
+				store.EXPECT().SetTransactionPINRequired(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "MissingSetting",
+			body: gin.H{"pin": plainPIN},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RecordTransactionPINAttempt(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+
+			tc.checkResponse(t, sendJSON(t, server, http.MethodPut, "/users/me/pin/settings", tc.body, user.Username))
+		})
+	}
+}
+
+func TestTransferTransactionPINAPI(t *testing.T) {
+	user1, _ := randomUser(t)
+	user2, _ := randomUser(t)
+	pin, plainPIN := randomTransactionPIN(t, user1.Username)
+
+	account1 := randomAccount(user1.Username)
+	account2 := randomAccount(user2.Username)
+	account2.ID = account1.ID + 1
+	account1.Currency = utils.EUR
+	account2.Currency = utils.EUR
+
+	testCases := []struct {
+		name          string
+		pinRequired   bool
+		pin           string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:        "OK",
+			pinRequired: true,
+			pin:         plainPIN,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RecordTransactionPINAttempt(gomock.Any(), gomock.Any()).Times(1).Return(pin, nil)
+				store.EXPECT().ResetTransactionPINFailures(gomock.Any(), gomock.Eq(user1.Username)).Times(1)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:        "NotRequired",
+			pinRequired: false,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RecordTransactionPINAttempt(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:        "MissingPIN",
+			pinRequired: true,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RecordTransactionPINAttempt(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:        "WrongPIN",
+			pinRequired: true,
+			pin:         wrongPIN(plainPIN),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().RecordTransactionPINAttempt(gomock.Any(), gomock.Any()).Times(1).Return(pin, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+			store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+			store.EXPECT().
+				GetUserAuthInfo(gomock.Any(), gomock.Eq(user1.Username)).
+				AnyTimes().
+				Return(db.GetUserAuthInfoRow{
+					Username:               user1.Username,
+					HasTransactionPin:      true,
+					TransactionPinRequired: tc.pinRequired,
+				}, nil)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+
+			body := gin.H{
+				"from_account_id": account1.ID,
+				"to_account_id":   account2.ID,
+				"amount":          10,
+				"currency":        utils.EUR,
+			}
+			if tc.pin != "" {
+				body["pin"] = tc.pin
+			}
+
+			tc.checkResponse(t, postJSON(t, server, "/transfers", body, user1.Username))
+		})
+	}
+}
@@ -12,10 +12,17 @@ import (
 )
 
 type TransferRequest struct {
-	FromAccountID int64  `json:"from_account_id" binding:"required,min=1"`
-	ToAccountID   int64  `json:"to_account_id" binding:"required,min=1"`
-	Amount        int64  `json:"amount" binding:"required,gt=0"`
-	Currency      string `json:"currency" binding:"required,currency"`
+	FromAccountID     int64  `json:"from_account_id" binding:"required_without=FromAccountNumber,excluded_with=FromAccountNumber,omitempty,min=1"`
+	FromAccountNumber string `json:"from_account_number" binding:"required_without=FromAccountID,omitempty,account_number"`
+	ToAccountID       int64  `json:"to_account_id" binding:"required_without=ToAccountNumber,excluded_with=ToAccountNumber,omitempty,min=1"`
+	ToAccountNumber   string `json:"to_account_number" binding:"required_without=ToAccountID,omitempty,account_number"`
+	Amount            int64  `json:"amount" binding:"required,gt=0"`
+	Currency          string `json:"currency" binding:"required,currency"`
+	// StepUpToken proves the user authenticated again for this transfer,
+	// it is only needed above the step-up threshold of the currency
+	StepUpToken string `json:"step_up_token"`
+	// PIN confirms the transfer, for users who turned on asking for their transaction pin
+	PIN string `json:"pin" binding:"omitempty,len=6,numeric"`
 }
 
 func (server *Server) createTransfer(ctx *gin.Context) {
@@ -25,7 +32,7 @@ func (server *Server) createTransfer(ctx *gin.Context) {
 		return
 	}
 
-	fromAccount, valid := server.validAccount(ctx, req.FromAccountID, req.Currency)
+	fromAccount, valid := server.validAccount(ctx, req.FromAccountID, req.FromAccountNumber, req.Currency)
 	if !valid {
 		return
 	}
@@ -37,19 +44,46 @@ func (server *Server) createTransfer(ctx *gin.Context) {
 		return
 	}
 
-	_, valid = server.validAccount(ctx, req.FromAccountID, req.Currency)
+	toAccount, valid := server.validAccount(ctx, req.ToAccountID, req.ToAccountNumber, req.Currency)
 	if !valid {
 		return
 	}
 
+	authInfo, err := server.authInfo.Get(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if authInfo.TransactionPinRequired {
+		if req.PIN == "" {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errTransactionPINRequired))
+			return
+		}
+		if !server.requireTransactionPIN(ctx, authPayload.Username, req.PIN) {
+			return
+		}
+	}
+
+	if server.stepUpRequired(req.Currency, req.Amount) {
+		binding := transferBinding(fromAccount.ID, toAccount.ID, req.Amount, req.Currency)
+		if !server.checkStepUp(ctx, req.StepUpToken, binding) {
+			return
+		}
+	}
+
 	arg := db.TransferTxParams{
-		FromAccountID: req.FromAccountID,
-		ToAccountID:   req.ToAccountID,
+		FromAccountID: fromAccount.ID,
+		ToAccountID:   toAccount.ID,
 		Amount:        req.Amount,
 	}
 
 	result, err := server.store.TransferTx(ctx, arg)
 	if err != nil {
+		if errors.Is(err, db.ErrInsufficientFunds) || errors.Is(err, db.ErrAccountClosed) {
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
@@ -57,8 +91,8 @@ func (server *Server) createTransfer(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, result)
 }
 
-func (server *Server) validAccount(ctx *gin.Context, accountID int64, currency string) (db.Account, bool) {
-	account, err := server.store.GetAccount(ctx, accountID)
+func (server *Server) validAccount(ctx *gin.Context, accountID int64, accountNumber string, currency string) (db.Account, bool) {
+	account, err := server.getAccountByRef(ctx, accountID, accountNumber)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			ctx.JSON(http.StatusNotFound, errorResponse(err))
@@ -69,6 +103,12 @@ func (server *Server) validAccount(ctx *gin.Context, accountID int64, currency s
 		return account, false
 	}
 
+	if !account.ClosedAt.IsZero() {
+		err := fmt.Errorf("account [%d] is closed", account.ID)
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return account, false
+	}
+
 	if account.Currency != currency {
 		err := fmt.Errorf("account [%d] currency mismatch: %s vs %s", account.ID, account.Currency, currency)
 		ctx.JSON(http.StatusBadRequest, errorResponse(err))
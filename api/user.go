@@ -1,27 +1,39 @@
 package api
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/andreanpradanaa/simple-bank-app/audit"
 	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/token"
 	"github.com/andreanpradanaa/simple-bank-app/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/lib/pq"
 )
 
 type CreateUserRequest struct {
 	Username string `json:"username" binding:"required,alphanum"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"`
 	FullName string `json:"full_name" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
 }
 
 type userResponse struct {
 	Username          string    `json:"username"`
+	Role              string    `json:"role"`
 	FullName          string    `json:"full_name"`
 	Email             string    `json:"email"`
+	IsEmailVerified   bool      `json:"is_email_verified"`
+	PhoneNumber       string    `json:"phone_number"`
+	AllowedIPs        []string  `json:"allowed_ips"`
 	PasswordChangedAt time.Time `json:"password_changed_at"`
 	CreatedAt         time.Time `json:"created_at"`
 }
@@ -29,8 +41,12 @@ type userResponse struct {
 func newUserResponse(user db.User) userResponse {
 	return userResponse{
 		Username:          user.Username,
+		Role:              user.Role,
 		FullName:          user.FullName,
 		Email:             user.Email,
+		IsEmailVerified:   user.IsEmailVerified,
+		PhoneNumber:       user.PhoneNumber,
+		AllowedIPs:        user.AllowedIps,
 		PasswordChangedAt: user.PasswordChangedAt,
 		CreatedAt:         user.CreatedAt,
 	}
@@ -43,7 +59,12 @@ func (server *Server) createUser(ctx *gin.Context) {
 		return
 	}
 
-	hashedPassword, err := utils.HashPassword(request.Password)
+	if err := server.passwordPolicy.Validate(request.Password); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	hashedPassword, err := server.passwordHasher.HashPassword(request.Password)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
@@ -60,6 +81,12 @@ func (server *Server) createUser(ctx *gin.Context) {
 		if pqErr, ok := err.(*pq.Error); ok {
 			switch pqErr.Code.Name() {
 			case "unique_violation":
+				server.audit(ctx, audit.Event{
+					Type:    audit.EventUserCreated,
+					Actor:   request.Username,
+					Outcome: audit.OutcomeFailure,
+					Details: pqErr.Constraint,
+				})
 				ctx.JSON(http.StatusForbidden, errorResponse(err))
 				return
 			}
@@ -68,18 +95,47 @@ func (server *Server) createUser(ctx *gin.Context) {
 		return
 	}
 
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventUserCreated,
+		Actor:   user.Username,
+		Outcome: audit.OutcomeSuccess,
+	})
+
+	// the user can ask for another email if this one does not get through
+	err = server.sendVerificationEmail(ctx, user)
+	if err != nil {
+		log.Println("cannot send verification email:", err)
+	}
+
 	rsp := newUserResponse(user)
 	ctx.JSON(http.StatusOK, rsp)
 }
 
+var (
+	errIncorrectCredentials = errors.New("incorrect username or password")
+	errTooManyLoginAttempts = errors.New("too many failed login attempts, please try again later")
+)
+
+// loginUserRequest may ask for fewer scopes than the user has, for a session
+// that can only do part of what the user can
 type loginUserRequest struct {
-	Username string `json:"username" binding:"required,alphanum"`
-	Password string `json:"password" binding:"required,min=6"`
+	Username string   `json:"username" binding:"required,alphanum"`
+	Password string   `json:"password" binding:"required,min=6"`
+	Scopes   []string `json:"scopes" binding:"omitempty,min=1,dive,scope"`
+	// DeviceName is shown in the list of sessions, to help the user tell them apart
+	DeviceName string `json:"device_name" binding:"omitempty,max=64"`
+	// UseCookies sets the tokens as HttpOnly cookies instead of returning them, for browser clients
+	UseCookies bool `json:"use_cookies"`
 }
 
+// loginUserResponse leaves out the tokens of cookie logins, they are in the cookies
 type loginUserResponse struct {
-	AccessToken string       `json:"access_token"`
-	User        userResponse `json:"user"`
+	SessionID             uuid.UUID    `json:"session_id"`
+	AccessToken           string       `json:"access_token,omitempty"`
+	AccessTokenExpiresAt  time.Time    `json:"access_token_expires_at"`
+	RefreshToken          string       `json:"refresh_token,omitempty"`
+	RefreshTokenExpiresAt time.Time    `json:"refresh_token_expires_at"`
+	User                  userResponse `json:"user"`
 }
 
 func (server *Server) loginUser(ctx *gin.Context) {
@@ -89,34 +145,420 @@ func (server *Server) loginUser(ctx *gin.Context) {
 		return
 	}
 
+	usernameKey := server.loginThrottle.usernameKey(req.Username)
+	ipKey := server.loginThrottle.ipKey(ctx.ClientIP())
+
+	retryAfter, err := server.loginThrottle.Attempt(ctx, usernameKey, ipKey)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if retryAfter > 0 {
+		server.audit(ctx, audit.Event{
+			Type:    audit.EventLogin,
+			Actor:   req.Username,
+			Outcome: audit.OutcomeFailure,
+			Details: errTooManyLoginAttempts.Error(),
+		})
+		ctx.Header("Retry-After", fmt.Sprint(int(retryAfter.Seconds())+1))
+		ctx.JSON(http.StatusTooManyRequests, errorResponse(errTooManyLoginAttempts))
+		return
+	}
+
 	user, err := server.store.GetUser(ctx, req.Username)
+	if err != nil && err != sql.ErrNoRows {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	userExists := err == nil
+	if !userExists {
+		// unknown users take as long to reject as wrong passwords
+		user.HashedPassword = server.dummyPasswordHash
+	}
+
+	// the attempt is already counted, a failure only has to be reported
+	passwordErr := utils.CheckPassword(req.Password, user.HashedPassword)
+	if !userExists || passwordErr != nil {
+		server.audit(ctx, audit.Event{
+			Type:    audit.EventLogin,
+			Actor:   req.Username,
+			Outcome: audit.OutcomeFailure,
+			Details: errIncorrectCredentials.Error(),
+		})
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errIncorrectCredentials))
+		return
+	}
+
+	err = server.loginThrottle.Succeed(ctx, usernameKey, ipKey)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusNotFound, errorResponse(err))
-			return
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// the plain password is only known now, so this is when an outdated hash gets upgraded
+	if server.passwordHasher.NeedsRehash(user.HashedPassword) {
+		err = server.rehashPassword(ctx, user, req.Password)
+		if err != nil {
+			log.Println("cannot rehash password:", err)
 		}
+	}
+
+	server.finishLogin(ctx, user, req.Scopes, req.DeviceName, "", req.UseCookies)
+}
+
+// finishLogin issues the session once the user has proven who they are, or an mfa
+// challenge first when they have totp enabled. The method is noted in the audit log.
+func (server *Server) finishLogin(ctx *gin.Context, user db.User, scopes []string, deviceName string, method string, useCookies bool) {
+	userTOTP, err := server.store.GetUserTOTP(ctx, user.Username)
+	if err != nil && err != sql.ErrNoRows {
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
-	err = utils.CheckPassword(req.Password, user.HashedPassword)
+	mfaRequired := err == nil && userTOTP.ConfirmedAt.Valid
+
+	var details []string
+	if method != "" {
+		details = append(details, method)
+	}
+	if mfaRequired {
+		details = append(details, "mfa required")
+	}
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventLogin,
+		Actor:   user.Username,
+		Outcome: audit.OutcomeSuccess,
+		Details: strings.Join(details, ", "),
+	})
+
+	if mfaRequired {
+		server.issueMFAChallenge(ctx, user, scopes)
+		return
+	}
+
+	rsp, err := server.createLoginSession(ctx, user, scopes, deviceName)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
+	server.respondWithSession(ctx, rsp, useCookies)
+}
+
+// rehashPassword stores the password hashed with the current hasher settings
+func (server *Server) rehashPassword(ctx context.Context, user db.User, password string) error {
+	hashedPassword, err := server.passwordHasher.HashPassword(password)
+	if err != nil {
+		return err
+	}
 
-	accessToken, err := server.tokenMaker.CreateToken(
+	return server.store.RehashUserPassword(ctx, db.RehashUserPasswordParams{
+		Username:          user.Username,
+		OldHashedPassword: user.HashedPassword,
+		NewHashedPassword: hashedPassword,
+	})
+}
+
+// createLoginSession issues the refresh and access tokens of a new session,
+// once the user has fully authenticated. The session gets every scope if none are given.
+func (server *Server) createLoginSession(ctx *gin.Context, user db.User, scopes []string, deviceName string) (loginUserResponse, error) {
+	if len(scopes) == 0 {
+		scopes = utils.AllScopes()
+	}
+
+	refreshToken, refreshPayload, err := server.tokenMaker.CreateToken(
+		user.Username,
+		server.config.RefreshTokenDuration,
+		token.WithType(token.TokenTypeRefresh),
+		token.WithRole(user.Role),
+		token.WithScopes(scopes),
+	)
+	if err != nil {
+		return loginUserResponse{}, err
+	}
+
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
 		user.Username,
 		server.config.AccessTokenDuration,
+		token.WithSessionID(refreshPayload.ID),
+		token.WithRole(user.Role),
+		token.WithScopes(scopes),
 	)
+	if err != nil {
+		return loginUserResponse{}, err
+	}
+
+	session, err := server.store.CreateSession(ctx, db.CreateSessionParams{
+		ID:         refreshPayload.ID,
+		Username:   user.Username,
+		UserAgent:  ctx.Request.UserAgent(),
+		ClientIp:   ctx.ClientIP(),
+		IsBlocked:  false,
+		ExpiresAt:  refreshPayload.ExpiredAt,
+		DeviceName: deviceName,
+	})
+	if err != nil {
+		return loginUserResponse{}, err
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventTokenIssued,
+		Actor:   user.Username,
+		Target:  session.ID.String(),
+		Outcome: audit.OutcomeSuccess,
+		Details: "new session, scopes " + strings.Join(scopes, " "),
+	})
+
+	err = server.checkLoginDevice(ctx, user, session)
+	if err != nil {
+		return loginUserResponse{}, err
+	}
+
+	return loginUserResponse{
+		SessionID:             session.ID,
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessPayload.ExpiredAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshPayload.ExpiredAt,
+		User:                  newUserResponse(user),
+	}, nil
+}
+
+func (server *Server) logoutUser(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	// the browser forgets the cookie login even if the revocation below fails
+	server.clearAuthCookies(ctx)
+
+	if authPayload.SessionID != uuid.Nil {
+		session, err := server.store.BlockSession(ctx, authPayload.SessionID)
+		if err != nil && err != sql.ErrNoRows {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		if err == nil {
+			err = server.revocations.Revoke(ctx, session.ID, session.Username, session.ExpiresAt)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+				return
+			}
+		}
+	}
+
+	err := server.revocations.Revoke(ctx, authPayload.ID, authPayload.Username, authPayload.ExpiredAt)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
-	rsp := loginUserResponse{
-		AccessToken: accessToken,
-		User:        newUserResponse(user),
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventLogout,
+		Actor:   authPayload.Username,
+		Target:  authPayload.Username,
+		Outcome: audit.OutcomeSuccess,
+	})
+
+	ctx.Status(http.StatusNoContent)
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// changePassword replaces the password of the logged in user. Every token issued
+// before the change is rejected from now on, and all the sessions are blocked,
+// so the user has to log in again everywhere, including on this client.
+func (server *Server) changePassword(ctx *gin.Context) {
+	var req changePasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
 	}
-	ctx.JSON(http.StatusOK, rsp)
+
+	if err := server.passwordPolicy.Validate(req.NewPassword); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	// the current password is checked under the login throttle, so that a stolen
+	// access token does not give unlimited guesses at it
+	valid, err := server.checkAccountPassword(ctx, authPayload.Username, req.CurrentPassword)
+	if err != nil {
+		if err == errTooManyLoginAttempts {
+			ctx.JSON(http.StatusTooManyRequests, errorResponse(err))
+			return
+		}
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !valid {
+		server.audit(ctx, audit.Event{
+			Type:    audit.EventPasswordChanged,
+			Actor:   authPayload.Username,
+			Target:  authPayload.Username,
+			Outcome: audit.OutcomeFailure,
+			Details: "incorrect current password",
+		})
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errIncorrectCredentials))
+		return
+	}
+
+	hashedPassword, err := server.passwordHasher.HashPassword(req.NewPassword)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// postgres keeps microseconds, truncating here keeps tokens issued right
+	// after the change from looking older than it
+	user, err := server.store.UpdateUserPassword(ctx, db.UpdateUserPasswordParams{
+		HashedPassword:    hashedPassword,
+		PasswordChangedAt: time.Now().Truncate(time.Microsecond),
+		Username:          authPayload.Username,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.authInfo.Forget(user.Username)
+
+	_, err = server.revokeSessions(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	// the current session was revoked along with the others
+	server.clearAuthCookies(ctx)
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventPasswordChanged,
+		Actor:   user.Username,
+		Target:  user.Username,
+		Outcome: audit.OutcomeSuccess,
+	})
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+func (server *Server) getMe(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// updateMeRequest only changes the fields that are present, an empty phone
+// number removes it
+type updateMeRequest struct {
+	FullName    *string `json:"full_name" binding:"omitempty,min=1"`
+	Email       *string `json:"email" binding:"omitempty,email"`
+	PhoneNumber *string `json:"phone_number" binding:"omitempty,e164|len=0"`
+}
+
+// updateMe changes the profile of the logged in user. A new email is no longer
+// verified, and a verification link is sent to it.
+func (server *Server) updateMe(ctx *gin.Context) {
+	var req updateMeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	if req.FullName == nil && req.Email == nil && req.PhoneNumber == nil {
+		err := errors.New("nothing to update")
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	oldEmail := user.Email
+	emailChanged := req.Email != nil && *req.Email != oldEmail
+	if emailChanged {
+		// changing the email sends a verification email, so it is throttled the same way
+		retryAfter, err := server.verificationEmailRetryAfter(ctx, user.Username)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		if retryAfter > 0 {
+			ctx.Header("Retry-After", fmt.Sprint(int(retryAfter.Seconds())+1))
+			ctx.JSON(http.StatusTooManyRequests, errorResponse(errVerificationEmailSentRecently))
+			return
+		}
+	}
+
+	user, err = server.store.UpdateUser(ctx, db.UpdateUserParams{
+		FullName:    nullString(req.FullName),
+		Email:       nullString(req.Email),
+		PhoneNumber: nullString(req.PhoneNumber),
+		Username:    user.Username,
+	})
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code.Name() {
+			case "unique_violation":
+				ctx.JSON(http.StatusForbidden, errorResponse(err))
+				return
+			}
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if emailChanged {
+		server.authInfo.Forget(user.Username)
+
+		// the addresses stay out of the audit log, which is never rewritten
+		// and so could not honour an erasure request
+		server.audit(ctx, audit.Event{
+			Type:    audit.EventEmailChanged,
+			Actor:   user.Username,
+			Target:  user.Username,
+			Outcome: audit.OutcomeSuccess,
+		})
+
+		err = server.sendVerificationEmail(ctx, user)
+		if err != nil {
+			log.Println("cannot send verification email:", err)
+		}
+	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
 }
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"strconv"
+
 	"github.com/andreanpradanaa/simple-bank-app/utils"
 	"github.com/go-playground/validator/v10"
 )
@@ -11,3 +13,28 @@ var validCurrency validator.Func = func(fieldLevel validator.FieldLevel) bool {
 	}
 	return false
 }
+
+var validAccountNumber validator.Func = func(fieldLevel validator.FieldLevel) bool {
+	if accountNumber, ok := fieldLevel.Field().Interface().(string); ok {
+		return utils.IsValidAccountNumber(accountNumber)
+	}
+	return false
+}
+
+// validAccountID accepts either a positive numeric account ID or a valid account number
+var validAccountID validator.Func = func(fieldLevel validator.FieldLevel) bool {
+	if accountID, ok := fieldLevel.Field().Interface().(string); ok {
+		if id, err := strconv.ParseInt(accountID, 10, 64); err == nil {
+			return id > 0
+		}
+		return utils.IsValidAccountNumber(accountID)
+	}
+	return false
+}
+
+var validScope validator.Func = func(fieldLevel validator.FieldLevel) bool {
+	if scope, ok := fieldLevel.Field().Interface().(string); ok {
+		return utils.IsSupportedScope(scope)
+	}
+	return false
+}
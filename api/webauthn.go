@@ -0,0 +1,624 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/audit"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	webAuthnCeremonyRegistration = "registration"
+	webAuthnCeremonyLogin        = "login"
+	webAuthnCeremonyStepUp       = "step_up"
+	defaultWebAuthnTimeout       = 5 * time.Minute
+	webAuthnUserHandleBytes      = 32
+)
+
+var (
+	errInvalidWebAuthnCeremony = errors.New("passkey ceremony is invalid or has expired")
+	errInvalidPasskey          = errors.New("passkey is invalid")
+)
+
+// webAuthnUser is the user as go-webauthn sees them: a random handle instead of the
+// username, and the passkeys they have registered
+type webAuthnUser struct {
+	user        db.User
+	handle      []byte
+	credentials []webauthn.Credential
+}
+
+func (user *webAuthnUser) WebAuthnID() []byte                         { return user.handle }
+func (user *webAuthnUser) WebAuthnName() string                       { return user.user.Username }
+func (user *webAuthnUser) WebAuthnDisplayName() string                { return user.user.FullName }
+func (user *webAuthnUser) WebAuthnCredentials() []webauthn.Credential { return user.credentials }
+func (user *webAuthnUser) WebAuthnIcon() string                       { return "" }
+
+type passkeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func newPasskeyResponse(credential db.WebauthnCredential) passkeyResponse {
+	rsp := passkeyResponse{
+		ID:        base64.RawURLEncoding.EncodeToString(credential.ID),
+		Name:      credential.Name,
+		CreatedAt: credential.CreatedAt,
+	}
+	if credential.LastUsedAt.Valid {
+		rsp.LastUsedAt = &credential.LastUsedAt.Time
+	}
+	return rsp
+}
+
+type beginPasskeyRegistrationRequest struct {
+	Name string `json:"name" binding:"required,max=64"`
+	// StepUpToken proves the user authenticated again to add a passkey
+	StepUpToken string `json:"step_up_token"`
+}
+
+// passkeyRegistrationBinding is the step-up binding of adding a passkey
+var passkeyRegistrationBinding = accountActionBinding("passkey_registration")
+
+type beginPasskeyRegistrationResponse struct {
+	CeremonyID uuid.UUID                    `json:"ceremony_id"`
+	Options    *protocol.CredentialCreation `json:"options"`
+}
+
+// beginPasskeyRegistration returns the options to pass to navigator.credentials.create.
+// Passkeys must be discoverable and verify the user, so that they can be used alone to log in.
+func (server *Server) beginPasskeyRegistration(ctx *gin.Context) {
+	var req beginPasskeyRegistrationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	// a passkey logs in without the password, so a stolen session must not be able to add one
+	if !server.checkStepUp(ctx, req.StepUpToken, passkeyRegistrationBinding) {
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	registered, err := server.store.ListWebAuthnCredentials(ctx, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	waUser, err := newWebAuthnUser(user, registered)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, len(waUser.credentials))
+	for i, credential := range waUser.credentials {
+		exclusions[i] = credential.Descriptor()
+	}
+
+	options, session, err := server.webAuthn.BeginRegistration(waUser,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		}),
+		webauthn.WithExclusions(exclusions),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ceremonyID, err := server.createWebAuthnCeremony(ctx, webAuthnCeremonyRegistration, user.Username, req.Name, session)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, beginPasskeyRegistrationResponse{
+		CeremonyID: ceremonyID,
+		Options:    options,
+	})
+}
+
+// newWebAuthnUser keeps the handle of the passkeys the user already has, or picks a new random one
+func newWebAuthnUser(user db.User, registered []db.WebauthnCredential) (*webAuthnUser, error) {
+	waUser := &webAuthnUser{user: user}
+
+	for _, row := range registered {
+		var credential webauthn.Credential
+		err := json.Unmarshal(row.Credential, &credential)
+		if err != nil {
+			return nil, err
+		}
+		waUser.credentials = append(waUser.credentials, credential)
+		waUser.handle = row.UserHandle
+	}
+
+	if waUser.handle == nil {
+		waUser.handle = make([]byte, webAuthnUserHandleBytes)
+		if _, err := rand.Read(waUser.handle); err != nil {
+			return nil, err
+		}
+	}
+
+	return waUser, nil
+}
+
+// finishPasskeyRequest carries the ceremony id along with the PublicKeyCredential
+// returned by the browser, serialized as JSON
+type finishPasskeyRequest struct {
+	CeremonyID string          `json:"ceremony_id" binding:"required,uuid"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+	DeviceName string          `json:"device_name" binding:"omitempty,max=64"`
+}
+
+type finishPasskeyLoginRequest struct {
+	finishPasskeyRequest
+	UseCookies bool `json:"use_cookies"`
+}
+
+// finishPasskeyRegistration checks the new credential against the challenge and stores it
+func (server *Server) finishPasskeyRegistration(ctx *gin.Context) {
+	var req finishPasskeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	ceremony, session, err := server.useWebAuthnCeremony(ctx, req.CeremonyID, webAuthnCeremonyRegistration)
+	if err != nil {
+		if err == errInvalidWebAuthnCeremony {
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if ceremony.Username != authPayload.Username {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidWebAuthnCeremony))
+		return
+	}
+
+	user, err := server.store.GetUser(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(req.Credential))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	credential, err := server.webAuthn.CreateCredential(&webAuthnUser{user: user, handle: session.UserID}, session, parsed)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	stored, err := server.store.CreateWebAuthnCredential(ctx, db.CreateWebAuthnCredentialParams{
+		ID:         credential.ID,
+		Username:   user.Username,
+		UserHandle: session.UserID,
+		Name:       ceremony.CredentialName,
+		Credential: data,
+	})
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code.Name() {
+			case "unique_violation":
+				err := errors.New("passkey is already registered")
+				ctx.JSON(http.StatusForbidden, errorResponse(err))
+				return
+			}
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.authInfo.Forget(user.Username)
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventPasskeyAdded,
+		Actor:   user.Username,
+		Target:  base64.RawURLEncoding.EncodeToString(stored.ID),
+		Outcome: audit.OutcomeSuccess,
+	})
+
+	ctx.JSON(http.StatusOK, newPasskeyResponse(stored))
+}
+
+func (server *Server) listPasskeys(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	credentials, err := server.store.ListWebAuthnCredentials(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := make([]passkeyResponse, len(credentials))
+	for i, credential := range credentials {
+		rsp[i] = newPasskeyResponse(credential)
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type deletePasskeyRequest struct {
+	ID string `uri:"id" binding:"required,base64rawurl"`
+}
+
+func (server *Server) deletePasskey(ctx *gin.Context) {
+	var req deletePasskeyRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	id, _ := base64.RawURLEncoding.DecodeString(req.ID)
+	deleted, err := server.store.DeleteWebAuthnCredential(ctx, db.DeleteWebAuthnCredentialParams{
+		ID:       id,
+		Username: authPayload.Username,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if deleted == 0 {
+		err := errors.New("passkey not found")
+		ctx.JSON(http.StatusNotFound, errorResponse(err))
+		return
+	}
+	server.authInfo.Forget(authPayload.Username)
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventPasskeyRemoved,
+		Actor:   authPayload.Username,
+		Target:  req.ID,
+		Outcome: audit.OutcomeSuccess,
+	})
+
+	ctx.Status(http.StatusNoContent)
+}
+
+type beginPasskeyLoginResponse struct {
+	CeremonyID uuid.UUID                     `json:"ceremony_id"`
+	Options    *protocol.CredentialAssertion `json:"options"`
+}
+
+// beginPasskeyLogin returns the options to pass to navigator.credentials.get. No
+// username is asked for: the authenticator offers the passkeys it has for the bank,
+// so the response does not tell whether a user exists or has passkeys.
+func (server *Server) beginPasskeyLogin(ctx *gin.Context) {
+	options, session, err := server.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ceremonyID, err := server.createWebAuthnCeremony(ctx, webAuthnCeremonyLogin, "", "", session)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, beginPasskeyLoginResponse{
+		CeremonyID: ceremonyID,
+		Options:    options,
+	})
+}
+
+// finishPasskeyLogin checks the assertion and issues the session of the user the
+// passkey belongs to. The passkey verified the user itself, with a PIN or biometrics,
+// so no totp code is asked for on top of it.
+func (server *Server) finishPasskeyLogin(ctx *gin.Context) {
+	var req finishPasskeyLoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	_, session, err := server.useWebAuthnCeremony(ctx, req.CeremonyID, webAuthnCeremonyLogin)
+	if err != nil {
+		if err == errInvalidWebAuthnCeremony {
+			server.rejectPasskeyLogin(ctx, "", err)
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(req.Credential))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var stored db.WebauthnCredential
+	var lookupErr error
+	findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+		stored, lookupErr = server.store.GetWebAuthnCredential(ctx, rawID)
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+
+		if !bytes.Equal(stored.UserHandle, userHandle) {
+			return nil, errInvalidPasskey
+		}
+
+		var credential webauthn.Credential
+		lookupErr = json.Unmarshal(stored.Credential, &credential)
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+
+		return &webAuthnUser{handle: stored.UserHandle, credentials: []webauthn.Credential{credential}}, nil
+	}
+
+	credential, err := server.webAuthn.ValidateDiscoverableLogin(findUser, session, parsed)
+	if lookupErr != nil && lookupErr != sql.ErrNoRows {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(lookupErr))
+		return
+	}
+	if err != nil {
+		server.rejectPasskeyLogin(ctx, stored.Username, errInvalidPasskey)
+		return
+	}
+
+	// a signature counter that went backwards means the passkey may have been cloned
+	if credential.Authenticator.CloneWarning {
+		err := errors.New("passkey signature counter went backwards")
+		server.rejectPasskeyLogin(ctx, stored.Username, err)
+		return
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = server.store.UseWebAuthnCredential(ctx, db.UseWebAuthnCredentialParams{
+		ID:         credential.ID,
+		Credential: data,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	user, err := server.store.GetUser(ctx, stored.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if !user.DeletedAt.IsZero() {
+		server.rejectPasskeyLogin(ctx, user.Username, errInvalidPasskey)
+		return
+	}
+
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventLogin,
+		Actor:   user.Username,
+		Outcome: audit.OutcomeSuccess,
+		Details: "passkey",
+	})
+
+	rsp, err := server.createLoginSession(ctx, user, nil, req.DeviceName)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.respondWithSession(ctx, rsp, req.UseCookies)
+}
+
+type beginPasskeyStepUpRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+type beginPasskeyStepUpResponse struct {
+	CeremonyID uuid.UUID                     `json:"ceremony_id"`
+	Options    *protocol.CredentialAssertion `json:"options"`
+}
+
+// beginPasskeyStepUp returns the options to pass to navigator.credentials.get to step
+// up with a passkey. The challenge token is only checked here, stepUp uses it up along
+// with the assertion.
+func (server *Server) beginPasskeyStepUp(ctx *gin.Context) {
+	var req beginPasskeyStepUpRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	if _, ok := server.verifyStepUpChallenge(authPayload, req.ChallengeToken); !ok {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidStepUpChallenge))
+		return
+	}
+
+	waUser, err := server.loadWebAuthnUser(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if len(waUser.credentials) == 0 {
+		err := errors.New("no passkey is registered")
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	options, session, err := server.webAuthn.BeginLogin(waUser,
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ceremonyID, err := server.createWebAuthnCeremony(ctx, webAuthnCeremonyStepUp, authPayload.Username, "", session)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, beginPasskeyStepUpResponse{
+		CeremonyID: ceremonyID,
+		Options:    options,
+	})
+}
+
+// checkPasskey checks the assertion of a step-up ceremony of the user. A used up or
+// expired ceremony, or an assertion that does not verify, is not an error, just invalid.
+func (server *Server) checkPasskey(ctx *gin.Context, username string, ceremonyID string, response json.RawMessage) (bool, error) {
+	ceremony, session, err := server.useWebAuthnCeremony(ctx, ceremonyID, webAuthnCeremonyStepUp)
+	if err != nil {
+		if err == errInvalidWebAuthnCeremony {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if ceremony.Username != username {
+		return false, nil
+	}
+
+	waUser, err := server.loadWebAuthnUser(ctx, username)
+	if err != nil {
+		return false, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		return false, nil
+	}
+
+	credential, err := server.webAuthn.ValidateLogin(waUser, session, parsed)
+	if err != nil || credential.Authenticator.CloneWarning {
+		return false, nil
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return false, err
+	}
+
+	err = server.store.UseWebAuthnCredential(ctx, db.UseWebAuthnCredentialParams{
+		ID:         credential.ID,
+		Credential: data,
+	})
+	return err == nil, err
+}
+
+// loadWebAuthnUser returns the user along with the passkeys they have registered
+func (server *Server) loadWebAuthnUser(ctx *gin.Context, username string) (*webAuthnUser, error) {
+	user, err := server.store.GetUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	registered, err := server.store.ListWebAuthnCredentials(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	return newWebAuthnUser(user, registered)
+}
+
+// rejectPasskeyLogin records the failed login and answers with unauthorized
+func (server *Server) rejectPasskeyLogin(ctx *gin.Context, username string, err error) {
+	server.audit(ctx, audit.Event{
+		Type:    audit.EventLogin,
+		Actor:   username,
+		Outcome: audit.OutcomeFailure,
+		Details: "passkey: " + err.Error(),
+	})
+	ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+}
+
+// createWebAuthnCeremony keeps the challenge of the ceremony until it is finished, and returns its id
+func (server *Server) createWebAuthnCeremony(ctx *gin.Context, ceremony string, username string, credentialName string, session *webauthn.SessionData) (uuid.UUID, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	_, err = server.store.CreateWebAuthnCeremony(ctx, db.CreateWebAuthnCeremonyParams{
+		ID:             id,
+		Ceremony:       ceremony,
+		Username:       username,
+		CredentialName: credentialName,
+		SessionData:    data,
+		ExpiresAt:      time.Now().Add(server.config.WebAuthnTimeout),
+	})
+	return id, err
+}
+
+// useWebAuthnCeremony uses up the ceremony, so that its challenge cannot be answered twice
+func (server *Server) useWebAuthnCeremony(ctx *gin.Context, id string, ceremony string) (db.WebauthnCeremony, webauthn.SessionData, error) {
+	var session webauthn.SessionData
+
+	row, err := server.store.UseWebAuthnCeremony(ctx, db.UseWebAuthnCeremonyParams{
+		ID:       uuid.MustParse(id),
+		Ceremony: ceremony,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return row, session, errInvalidWebAuthnCeremony
+		}
+		return row, session, err
+	}
+
+	err = json.Unmarshal(row.SessionData, &session)
+	return row, session, err
+}
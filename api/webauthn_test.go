@@ -0,0 +1,817 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mockdb "github.com/andreanpradanaa/simple-bank-app/db/mock"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/token"
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/golang/mock/gomock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+const testWebAuthnOrigin = "http://localhost:8080"
+
+// softAuthenticator is a passkey kept in memory: it answers the registration and
+// login ceremonies the way a browser and a platform authenticator would together
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	origin       string
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	credentialID := make([]byte, 16)
+	_, err = rand.Read(credentialID)
+	require.NoError(t, err)
+
+	return &softAuthenticator{
+		key:          key,
+		credentialID: credentialID,
+		userHandle:   []byte(utils.RandomString(32)),
+		origin:       testWebAuthnOrigin,
+	}
+}
+
+// publicKey is the COSE encoding of the public key of the passkey
+func (authenticator *softAuthenticator) publicKey(t *testing.T) []byte {
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: authenticator.key.X.FillBytes(make([]byte, 32)),
+		YCoord: authenticator.key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+	return publicKey
+}
+
+// credential is the passkey as the bank stores it once registered
+func (authenticator *softAuthenticator) credential(t *testing.T, signCount uint32) db.WebauthnCredential {
+	data, err := json.Marshal(webauthn.Credential{
+		ID:              authenticator.credentialID,
+		PublicKey:       authenticator.publicKey(t),
+		AttestationType: "none",
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    make([]byte, 16),
+			SignCount: signCount,
+		},
+	})
+	require.NoError(t, err)
+
+	return db.WebauthnCredential{
+		ID:         authenticator.credentialID,
+		UserHandle: authenticator.userHandle,
+		Credential: data,
+		CreatedAt:  time.Now(),
+	}
+}
+
+func (authenticator *softAuthenticator) clientData(t *testing.T, ceremonyType string, challenge []byte) []byte {
+	clientData, err := json.Marshal(map[string]any{
+		"type":      ceremonyType,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    authenticator.origin,
+	})
+	require.NoError(t, err)
+	return clientData
+}
+
+func (authenticator *softAuthenticator) authenticatorData(rpID string, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+
+	authData := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(authData, authenticator.signCount)
+}
+
+// create answers navigator.credentials.create with a user present and verified
+func (authenticator *softAuthenticator) create(t *testing.T, options *protocol.CredentialCreation) json.RawMessage {
+	userHandle, err := base64.RawURLEncoding.DecodeString(options.Response.User.ID.(string))
+	require.NoError(t, err)
+	authenticator.userHandle = userHandle
+
+	authData := authenticator.authenticatorData(options.Response.RelyingParty.ID, 0x45) // UP, UV and AT
+	authData = append(authData, make([]byte, 16)...)                                    // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(authenticator.credentialID)))
+	authData = append(authData, authenticator.credentialID...)
+	authData = append(authData, authenticator.publicKey(t)...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	require.NoError(t, err)
+
+	return authenticator.publicKeyCredential(t, map[string]string{
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(authenticator.clientData(t, "webauthn.create", options.Response.Challenge)),
+		"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+	})
+}
+
+// get answers navigator.credentials.get with a user present and verified
+func (authenticator *softAuthenticator) get(t *testing.T, options *protocol.CredentialAssertion) json.RawMessage {
+	authenticator.signCount++
+	authData := authenticator.authenticatorData(options.Response.RelyingPartyID, 0x05) // UP and UV
+	clientData := authenticator.clientData(t, "webauthn.get", options.Response.Challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, authenticator.key, digest[:])
+	require.NoError(t, err)
+
+	return authenticator.publicKeyCredential(t, map[string]string{
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+		"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+		"signature":         base64.RawURLEncoding.EncodeToString(signature),
+		"userHandle":        base64.RawURLEncoding.EncodeToString(authenticator.userHandle),
+	})
+}
+
+func (authenticator *softAuthenticator) publicKeyCredential(t *testing.T, response map[string]string) json.RawMessage {
+	credential, err := json.Marshal(map[string]any{
+		"id":       base64.RawURLEncoding.EncodeToString(authenticator.credentialID),
+		"rawId":    base64.RawURLEncoding.EncodeToString(authenticator.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	require.NoError(t, err)
+	return credential
+}
+
+// stubWebAuthnCeremonies keeps the ceremony the bank records, and hands it back
+// when the finish step uses it up
+func stubWebAuthnCeremonies(t *testing.T, store *mockdb.MockStore, ceremonyType string, tamper func(*db.WebauthnCeremony)) {
+	var ceremony db.WebauthnCeremony
+
+	store.EXPECT().
+		CreateWebAuthnCeremony(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, arg db.CreateWebAuthnCeremonyParams) (db.WebauthnCeremony, error) {
+			require.Equal(t, ceremonyType, arg.Ceremony)
+			require.NotEmpty(t, arg.SessionData)
+
+			ceremony = db.WebauthnCeremony{
+				ID:             arg.ID,
+				Ceremony:       arg.Ceremony,
+				Username:       arg.Username,
+				CredentialName: arg.CredentialName,
+				SessionData:    arg.SessionData,
+				ExpiresAt:      arg.ExpiresAt,
+			}
+			return ceremony, nil
+		})
+	store.EXPECT().
+		UseWebAuthnCeremony(gomock.Any(), gomock.Any()).
+		MaxTimes(1).
+		DoAndReturn(func(_ context.Context, arg db.UseWebAuthnCeremonyParams) (db.WebauthnCeremony, error) {
+			if tamper != nil {
+				tamper(&ceremony)
+			}
+			if arg.ID != ceremony.ID || arg.Ceremony != ceremony.Ceremony || time.Now().After(ceremony.ExpiresAt) {
+				return db.WebauthnCeremony{}, sql.ErrNoRows
+			}
+			return ceremony, nil
+		})
+}
+
+func postJSON(t *testing.T, server *Server, url string, body any, username string) *httptest.ResponseRecorder {
+	return sendJSON(t, server, http.MethodPost, url, body, username)
+}
+
+// sendJSON sends the body as JSON, authorized as the user unless the username is empty
+func sendJSON(t *testing.T, server *Server, method string, url string, body any, username string) *httptest.ResponseRecorder {
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	request, err := http.NewRequest(method, url, bytes.NewReader(data))
+	require.NoError(t, err)
+	if username != "" {
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, username, utils.DepositorRole, time.Minute)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestPasskeyRegistrationAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	name := "laptop"
+
+	testCases := []struct {
+		name          string
+		origin        string
+		tamper        func(ceremony *db.WebauthnCeremony)
+		buildStubs    func(store *mockdb.MockStore, authenticator *softAuthenticator)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, authenticator *softAuthenticator)
+	}{
+		{
+			name:   "OK",
+			origin: testWebAuthnOrigin,
+			buildStubs: func(store *mockdb.MockStore, authenticator *softAuthenticator) {
+				store.EXPECT().
+					CreateWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateWebAuthnCredentialParams) (db.WebauthnCredential, error) {
+						require.Equal(t, authenticator.credentialID, arg.ID)
+						require.Equal(t, user.Username, arg.Username)
+						require.Equal(t, authenticator.userHandle, arg.UserHandle)
+						require.Equal(t, name, arg.Name)
+
+						var credential webauthn.Credential
+						require.NoError(t, json.Unmarshal(arg.Credential, &credential))
+						require.Equal(t, authenticator.publicKey(t), credential.PublicKey)
+						require.True(t, credential.Flags.UserVerified)
+
+						return db.WebauthnCredential{
+							ID:         arg.ID,
+							Username:   arg.Username,
+							UserHandle: arg.UserHandle,
+							Name:       arg.Name,
+							Credential: arg.Credential,
+							CreatedAt:  time.Now(),
+						}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, authenticator *softAuthenticator) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp passkeyResponse
+				err := json.NewDecoder(recorder.Body).Decode(&rsp)
+				require.NoError(t, err)
+				require.Equal(t, base64.RawURLEncoding.EncodeToString(authenticator.credentialID), rsp.ID)
+				require.Equal(t, name, rsp.Name)
+				require.Nil(t, rsp.LastUsedAt)
+			},
+		},
+		{
+			name:   "WrongOrigin",
+			origin: "http://phishing.example",
+			buildStubs: func(store *mockdb.MockStore, authenticator *softAuthenticator) {
+				store.EXPECT().
+					CreateWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, authenticator *softAuthenticator) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:   "CeremonyOfAnotherUser",
+			origin: testWebAuthnOrigin,
+			tamper: func(ceremony *db.WebauthnCeremony) {
+				ceremony.Username = utils.RandomOwner()
+			},
+			buildStubs: func(store *mockdb.MockStore, authenticator *softAuthenticator) {
+				store.EXPECT().
+					CreateWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, authenticator *softAuthenticator) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:   "ExpiredCeremony",
+			origin: testWebAuthnOrigin,
+			tamper: func(ceremony *db.WebauthnCeremony) {
+				ceremony.ExpiresAt = time.Now().Add(-time.Second)
+			},
+			buildStubs: func(store *mockdb.MockStore, authenticator *softAuthenticator) {
+				store.EXPECT().
+					CreateWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, authenticator *softAuthenticator) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:   "AlreadyRegistered",
+			origin: testWebAuthnOrigin,
+			buildStubs: func(store *mockdb.MockStore, authenticator *softAuthenticator) {
+				store.EXPECT().
+					CreateWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.WebauthnCredential{}, &pq.Error{Code: "23505"})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, authenticator *softAuthenticator) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			authenticator := newSoftAuthenticator(t)
+			authenticator.origin = tc.origin
+
+			store := mockdb.NewMockStore(ctrl)
+			store.EXPECT().
+				GetUser(gomock.Any(), gomock.Eq(user.Username)).
+				AnyTimes().
+				Return(user, nil)
+			store.EXPECT().
+				ListWebAuthnCredentials(gomock.Any(), gomock.Eq(user.Username)).
+				Times(1).
+				Return([]db.WebauthnCredential{}, nil)
+			store.EXPECT().
+				ConsumeToken(gomock.Any(), gomock.Any()).
+				Times(1).
+				Return(int64(1), nil)
+			stubWebAuthnCeremonies(t, store, webAuthnCeremonyRegistration, tc.tamper)
+			tc.buildStubs(store, authenticator)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+
+			recorder := postJSON(t, server, "/users/me/passkeys/register/begin", gin.H{
+				"name":          name,
+				"step_up_token": createStepUpToken(t, server, user.Username, passkeyRegistrationBinding),
+			}, user.Username)
+			require.Equal(t, http.StatusOK, recorder.Code)
+
+			var begin beginPasskeyRegistrationResponse
+			err := json.NewDecoder(recorder.Body).Decode(&begin)
+			require.NoError(t, err)
+			require.Equal(t, protocol.ResidentKeyRequirementRequired, begin.Options.Response.AuthenticatorSelection.ResidentKey)
+			require.Equal(t, protocol.VerificationRequired, begin.Options.Response.AuthenticatorSelection.UserVerification)
+
+			recorder = postJSON(t, server, "/users/me/passkeys/register/finish", gin.H{
+				"ceremony_id": begin.CeremonyID,
+				"credential":  authenticator.create(t, begin.Options),
+			}, user.Username)
+			tc.checkResponse(t, recorder, authenticator)
+		})
+	}
+}
+
+func TestPasskeyRegistrationRequiresStepUp(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name        string
+		stepUpToken func(t *testing.T, server *Server) string
+	}{
+		{
+			name: "NoStepUpToken",
+			stepUpToken: func(t *testing.T, server *Server) string {
+				return ""
+			},
+		},
+		{
+			name: "TokenForAnotherAction",
+			stepUpToken: func(t *testing.T, server *Server) string {
+				return createStepUpToken(t, server, user.Username, identityLinkBinding("corp"))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(db.UserTotp{}, sql.ErrNoRows)
+			store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(0)
+			store.EXPECT().CreateWebAuthnCeremony(gomock.Any(), gomock.Any()).Times(0)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+
+			recorder := postJSON(t, server, "/users/me/passkeys/register/begin", gin.H{
+				"name":          "laptop",
+				"step_up_token": tc.stepUpToken(t, server),
+			}, user.Username)
+			requireStepUpChallenge(t, recorder, []string{stepUpMethodPassword})
+		})
+	}
+}
+
+func TestDeleteMePasskeyStepUpFlow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user, _ := randomUser(t)
+	authenticator := newSoftAuthenticator(t)
+	credential := authenticator.credential(t, 0)
+	credential.Username = user.Username
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetUserAuthInfo(gomock.Any(), gomock.Eq(user.Username)).
+		AnyTimes().
+		Return(db.GetUserAuthInfoRow{Username: user.Username, HasPasskey: true}, nil)
+	store.EXPECT().GetUserTOTP(gomock.Any(), gomock.Any()).Times(1).Return(db.UserTotp{}, sql.ErrNoRows)
+	// the passkeys are loaded to begin the ceremony, then to check the assertion
+	store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(2).Return(user, nil)
+	store.EXPECT().
+		ListWebAuthnCredentials(gomock.Any(), gomock.Eq(user.Username)).
+		Times(2).
+		Return([]db.WebauthnCredential{credential}, nil)
+	stubWebAuthnCeremonies(t, store, webAuthnCeremonyStepUp, nil)
+	store.EXPECT().UseWebAuthnCredential(gomock.Any(), gomock.Any()).Times(1)
+	// the challenge, then the step-up token, are used up
+	store.EXPECT().ConsumeToken(gomock.Any(), gomock.Any()).Times(2).Return(int64(1), nil)
+	store.EXPECT().DeleteUserTx(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+	store.EXPECT().DeleteLoginThrottle(gomock.Any(), gomock.Any()).Times(1)
+
+	server := newTestServer(t, store)
+
+	recorder := sendJSON(t, server, http.MethodDelete, "/users/me", gin.H{}, user.Username)
+	challenge := requireStepUpChallenge(t, recorder, []string{stepUpMethodPassword, stepUpMethodPasskey})
+
+	recorder = postJSON(t, server, "/users/me/step-up/passkey/begin", gin.H{
+		"challenge_token": challenge.ChallengeToken,
+	}, user.Username)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var begin beginPasskeyStepUpResponse
+	err := json.NewDecoder(recorder.Body).Decode(&begin)
+	require.NoError(t, err)
+
+	recorder = postJSON(t, server, "/users/me/step-up", gin.H{
+		"challenge_token": challenge.ChallengeToken,
+		"method":          stepUpMethodPasskey,
+		"ceremony_id":     begin.CeremonyID,
+		"credential":      authenticator.get(t, begin.Options),
+	}, user.Username)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var stepUp stepUpResponse
+	err = json.NewDecoder(recorder.Body).Decode(&stepUp)
+	require.NoError(t, err)
+
+	recorder = sendJSON(t, server, http.MethodDelete, "/users/me", gin.H{
+		"step_up_token": stepUp.StepUpToken,
+	}, user.Username)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+}
+
+func TestBeginPasskeyStepUpWithoutPasskey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user, _ := randomUser(t)
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+	store.EXPECT().ListWebAuthnCredentials(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(nil, nil)
+	store.EXPECT().CreateWebAuthnCeremony(gomock.Any(), gomock.Any()).Times(0)
+	stubAuthInfo(store)
+
+	server := newTestServer(t, store)
+
+	challengeToken, _, err := server.tokenMaker.CreateToken(
+		user.Username,
+		time.Minute,
+		token.WithType(token.TokenTypeStepUpChallenge),
+		token.WithBinding(deleteAccountBinding),
+	)
+	require.NoError(t, err)
+
+	recorder := postJSON(t, server, "/users/me/step-up/passkey/begin", gin.H{
+		"challenge_token": challengeToken,
+	}, user.Username)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestPasskeyLoginAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		tamper        func(ceremony *db.WebauthnCeremony)
+		buildStubs    func(store *mockdb.MockStore, authenticator *softAuthenticator)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(store *mockdb.MockStore, authenticator *softAuthenticator) {
+				credential := authenticator.credential(t, 0)
+				credential.Username = user.Username
+
+				store.EXPECT().
+					GetWebAuthnCredential(gomock.Any(), gomock.Eq(authenticator.credentialID)).
+					Times(1).
+					Return(credential, nil)
+				store.EXPECT().
+					UseWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.UseWebAuthnCredentialParams) error {
+						require.Equal(t, authenticator.credentialID, arg.ID)
+
+						var used webauthn.Credential
+						require.NoError(t, json.Unmarshal(arg.Credential, &used))
+						require.Equal(t, uint32(1), used.Authenticator.SignCount)
+						return nil
+					})
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(user, nil)
+				// the passkey verified the user, so no totp code is asked for
+				store.EXPECT().
+					GetUserTOTP(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					TouchKnownDevice(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(1), nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateSessionParams) (db.Session, error) {
+						require.Equal(t, user.Username, arg.Username)
+						require.Equal(t, "phone", arg.DeviceName)
+						return db.Session{ID: arg.ID, Username: arg.Username, ExpiresAt: arg.ExpiresAt}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var rsp loginUserResponse
+				err := json.NewDecoder(recorder.Body).Decode(&rsp)
+				require.NoError(t, err)
+				require.NotEmpty(t, rsp.AccessToken)
+				require.NotEmpty(t, rsp.RefreshToken)
+				require.Equal(t, user.Username, rsp.User.Username)
+			},
+		},
+		{
+			name: "UnknownPasskey",
+			buildStubs: func(store *mockdb.MockStore, authenticator *softAuthenticator) {
+				store.EXPECT().
+					GetWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.WebauthnCredential{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "UserHandleMismatch",
+			buildStubs: func(store *mockdb.MockStore, authenticator *softAuthenticator) {
+				credential := authenticator.credential(t, 0)
+				credential.Username = user.Username
+				credential.UserHandle = []byte(utils.RandomString(32))
+
+				store.EXPECT().
+					GetWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(credential, nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "WrongKey",
+			buildStubs: func(store *mockdb.MockStore, authenticator *softAuthenticator) {
+				// the stored public key belongs to another authenticator
+				other := newSoftAuthenticator(t)
+				other.credentialID = authenticator.credentialID
+				other.userHandle = authenticator.userHandle
+				credential := other.credential(t, 0)
+				credential.Username = user.Username
+
+				store.EXPECT().
+					GetWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(credential, nil)
+				store.EXPECT().
+					UseWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "ClonedAuthenticator",
+			buildStubs: func(store *mockdb.MockStore, authenticator *softAuthenticator) {
+				// the bank has already seen a higher signature counter for this passkey
+				credential := authenticator.credential(t, 10)
+				credential.Username = user.Username
+
+				store.EXPECT().
+					GetWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(credential, nil)
+				store.EXPECT().
+					UseWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "DeletedUser",
+			buildStubs: func(store *mockdb.MockStore, authenticator *softAuthenticator) {
+				credential := authenticator.credential(t, 0)
+				credential.Username = user.Username
+
+				store.EXPECT().
+					GetWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(credential, nil)
+				store.EXPECT().
+					UseWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Username)).
+					Times(1).
+					Return(db.User{Username: user.Username, DeletedAt: time.Now()}, nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "ExpiredCeremony",
+			tamper: func(ceremony *db.WebauthnCeremony) {
+				ceremony.ExpiresAt = time.Now().Add(-time.Second)
+			},
+			buildStubs: func(store *mockdb.MockStore, authenticator *softAuthenticator) {
+				store.EXPECT().
+					GetWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "InternalError",
+			buildStubs: func(store *mockdb.MockStore, authenticator *softAuthenticator) {
+				store.EXPECT().
+					GetWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.WebauthnCredential{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			authenticator := newSoftAuthenticator(t)
+
+			store := mockdb.NewMockStore(ctrl)
+			stubWebAuthnCeremonies(t, store, webAuthnCeremonyLogin, tc.tamper)
+			tc.buildStubs(store, authenticator)
+
+			server := newTestServer(t, store)
+
+			recorder := postJSON(t, server, "/users/login/passkey/begin", nil, "")
+			require.Equal(t, http.StatusOK, recorder.Code)
+
+			var begin beginPasskeyLoginResponse
+			err := json.NewDecoder(recorder.Body).Decode(&begin)
+			require.NoError(t, err)
+			require.Empty(t, begin.Options.Response.AllowedCredentials)
+			require.Equal(t, protocol.VerificationRequired, begin.Options.Response.UserVerification)
+
+			recorder = postJSON(t, server, "/users/login/passkey/finish", gin.H{
+				"ceremony_id": begin.CeremonyID,
+				"credential":  authenticator.get(t, begin.Options),
+				"device_name": "phone",
+			}, "")
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestDeletePasskeyAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	id := []byte(utils.RandomString(16))
+
+	testCases := []struct {
+		name          string
+		id            string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			id:   base64.RawURLEncoding.EncodeToString(id),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DeleteWebAuthnCredential(gomock.Any(), gomock.Eq(db.DeleteWebAuthnCredentialParams{ID: id, Username: user.Username})).
+					Times(1).
+					Return(int64(1), nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name: "NotFound",
+			id:   base64.RawURLEncoding.EncodeToString(id),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DeleteWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(int64(0), nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidID",
+			id:   "not+base64",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DeleteWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubAuthInfo(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodDelete, "/users/me/passkeys/"+tc.id, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.Username, utils.DepositorRole, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
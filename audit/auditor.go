@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"context"
+
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+)
+
+// Outcomes of an audited action
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Types of the audited events
+const (
+	EventUserCreated            = "user.created"
+	EventLogin                  = "user.login"
+	EventLoginMFA               = "user.login_mfa"
+	EventStepUp                 = "user.step_up"
+	EventTokenIssued            = "token.issued"
+	EventAuthRejected           = "auth.rejected"
+	EventPasswordChanged        = "user.password_changed"
+	EventPasswordReset          = "user.password_reset"
+	EventLogout                 = "user.logout"
+	EventTOTPEnabled            = "user.totp_enabled"
+	EventEmailChanged           = "user.email_changed"
+	EventUserDeleted            = "user.deleted"
+	EventAPIKeyCreated          = "api_key.created"
+	EventAPIKeyRevoked          = "api_key.revoked"
+	EventIdentityLinked         = "user.identity_linked"
+	EventSessionRevoked         = "user.session_revoked"
+	EventNewDeviceLogin         = "user.new_device_login"
+	EventAllowedIPsChanged      = "user.allowed_ips_changed"
+	EventPasskeyAdded           = "user.passkey_added"
+	EventPasskeyRemoved         = "user.passkey_removed"
+	EventTransactionPINChanged  = "user.transaction_pin_changed"
+	EventTransactionPINRejected = "user.transaction_pin_rejected"
+	EventSessionsRevoked        = "admin.sessions_revoked"
+	EventUserUnlocked           = "admin.user_unlocked"
+	EventHoldPlaced             = "admin.hold_placed"
+	EventHoldReleased           = "admin.hold_released"
+)
+
+// Event is a security relevant action: who did what, from where, and whether it succeeded
+type Event struct {
+	Type      string
+	Actor     string
+	Target    string
+	ClientIP  string
+	UserAgent string
+	RequestID string
+	Outcome   string
+	Details   string
+}
+
+// Auditor keeps a permanent record of security relevant events
+type Auditor interface {
+	Record(ctx context.Context, event Event) error
+}
+
+type eventStore interface {
+	CreateAuditEvent(ctx context.Context, arg db.CreateAuditEventParams) (db.AuditEvent, error)
+}
+
+type storeAuditor struct {
+	store eventStore
+}
+
+// NewStoreAuditor creates an auditor that appends the events to the audit_events table
+func NewStoreAuditor(store db.Store) Auditor {
+	return &storeAuditor{store: store}
+}
+
+func (auditor *storeAuditor) Record(ctx context.Context, event Event) error {
+	_, err := auditor.store.CreateAuditEvent(ctx, db.CreateAuditEventParams{
+		EventType: event.Type,
+		Actor:     event.Actor,
+		Target:    event.Target,
+		ClientIp:  event.ClientIP,
+		UserAgent: event.UserAgent,
+		RequestID: event.RequestID,
+		Outcome:   event.Outcome,
+		Details:   event.Details,
+	})
+	return err
+}
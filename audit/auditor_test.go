@@ -0,0 +1,51 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	mockdb "github.com/andreanpradanaa/simple-bank-app/db/mock"
+	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreAuditor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	event := Event{
+		Type:      EventLogin,
+		Actor:     "alice",
+		Target:    "",
+		ClientIP:  "203.0.113.7",
+		UserAgent: "curl/8.0",
+		RequestID: "req-1",
+		Outcome:   OutcomeFailure,
+		Details:   "incorrect username or password",
+	}
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		CreateAuditEvent(gomock.Any(), gomock.Eq(db.CreateAuditEventParams{
+			EventType: event.Type,
+			Actor:     event.Actor,
+			Target:    event.Target,
+			ClientIp:  event.ClientIP,
+			UserAgent: event.UserAgent,
+			RequestID: event.RequestID,
+			Outcome:   event.Outcome,
+			Details:   event.Details,
+		})).
+		Times(1).
+		Return(db.AuditEvent{ID: 1}, nil)
+	store.EXPECT().
+		CreateAuditEvent(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(db.AuditEvent{}, sql.ErrConnDone)
+
+	auditor := NewStoreAuditor(store)
+	require.NoError(t, auditor.Record(context.Background(), event))
+	require.ErrorIs(t, auditor.Record(context.Background(), event), sql.ErrConnDone)
+}
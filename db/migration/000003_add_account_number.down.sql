@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS "accounts" DROP COLUMN IF EXISTS "account_number";
+DROP SEQUENCE IF EXISTS "account_number_seq";
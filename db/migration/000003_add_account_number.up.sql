@@ -0,0 +1,24 @@
+CREATE SEQUENCE "account_number_seq";
+
+ALTER TABLE "accounts" ADD COLUMN "account_number" varchar UNIQUE;
+
+-- backfill existing accounts on branch 0001, using the same mod-97 check digits as utils.NewAccountNumber
+WITH "numbered" AS (
+  SELECT
+    "id",
+    "currency",
+    '0001' || lpad(nextval('account_number_seq')::text, 10, '0') AS "bban"
+  FROM "accounts"
+  ORDER BY "id"
+)
+UPDATE "accounts" SET "account_number" = "numbered"."currency" || lpad((98 - (
+    "numbered"."bban" ||
+    (ascii(substr("numbered"."currency", 1, 1)) - 55)::text ||
+    (ascii(substr("numbered"."currency", 2, 1)) - 55)::text ||
+    (ascii(substr("numbered"."currency", 3, 1)) - 55)::text ||
+    '00'
+  )::numeric % 97)::text, 2, '0') || "numbered"."bban"
+FROM "numbered"
+WHERE "accounts"."id" = "numbered"."id";
+
+ALTER TABLE "accounts" ALTER COLUMN "account_number" SET NOT NULL;
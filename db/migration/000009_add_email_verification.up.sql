@@ -0,0 +1,19 @@
+ALTER TABLE "users" ADD COLUMN "is_email_verified" bool NOT NULL DEFAULT false;
+
+CREATE TABLE "email_verification_tokens" (
+  "id" bigserial PRIMARY KEY,
+  "username" varchar NOT NULL,
+  "email" varchar NOT NULL,
+  "token_hash" varchar UNIQUE NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "used_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "email_verification_tokens" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+CREATE INDEX ON "email_verification_tokens" ("username", "created_at");
+
+COMMENT ON COLUMN "email_verification_tokens"."email" IS 'the address the token was sent to, it no longer verifies anything once the user changes email';
+
+COMMENT ON COLUMN "email_verification_tokens"."token_hash" IS 'sha256 of the emailed token, the token itself is never stored';
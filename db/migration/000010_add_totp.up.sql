@@ -0,0 +1,27 @@
+CREATE TABLE "user_totps" (
+  "username" varchar PRIMARY KEY,
+  "secret_encrypted" bytea NOT NULL,
+  "last_used_step" bigint NOT NULL DEFAULT 0,
+  "confirmed_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "recovery_codes" (
+  "id" bigserial PRIMARY KEY,
+  "username" varchar NOT NULL,
+  "code_hash" varchar NOT NULL,
+  "used_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "user_totps" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+ALTER TABLE "recovery_codes" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+CREATE UNIQUE INDEX ON "recovery_codes" ("username", "code_hash");
+
+COMMENT ON COLUMN "user_totps"."secret_encrypted" IS 'AES-256-GCM encrypted with TOTP_ENCRYPTION_KEY';
+
+COMMENT ON COLUMN "user_totps"."last_used_step" IS 'time step of the last accepted code, so a code cannot be used twice';
+
+COMMENT ON COLUMN "user_totps"."confirmed_at" IS 'null until the user proves the authenticator app is set up, login does not ask for a code before';
@@ -0,0 +1,8 @@
+CREATE TABLE "login_throttles" (
+  "key" varchar PRIMARY KEY,
+  "failed_count" int NOT NULL,
+  "last_failed_at" timestamptz NOT NULL,
+  "locked_until" timestamptz
+);
+
+COMMENT ON COLUMN "login_throttles"."key" IS 'username:<username> or ip:<client ip>, unknown usernames are tracked as well';
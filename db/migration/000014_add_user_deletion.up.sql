@@ -0,0 +1,7 @@
+ALTER TABLE "users" ADD COLUMN "deleted_at" timestamptz NOT NULL DEFAULT '0001-01-01 00:00:00Z';
+
+ALTER TABLE "accounts" ADD COLUMN "closed_at" timestamptz NOT NULL DEFAULT '0001-01-01 00:00:00Z';
+
+COMMENT ON COLUMN "users"."deleted_at" IS 'set when the personal data of the user is erased, the row stays so the ledger keeps its owner';
+
+COMMENT ON COLUMN "accounts"."closed_at" IS 'closed accounts keep their entries and transfers but cannot move money anymore';
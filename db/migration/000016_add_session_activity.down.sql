@@ -0,0 +1,5 @@
+ALTER TABLE IF EXISTS "sessions" DROP COLUMN IF EXISTS "last_seen_at";
+
+ALTER TABLE IF EXISTS "sessions" DROP COLUMN IF EXISTS "last_seen_ip";
+
+ALTER TABLE IF EXISTS "sessions" DROP COLUMN IF EXISTS "device_name";
@@ -0,0 +1,11 @@
+ALTER TABLE "sessions" ADD COLUMN "device_name" varchar NOT NULL DEFAULT '';
+
+ALTER TABLE "sessions" ADD COLUMN "last_seen_ip" varchar NOT NULL DEFAULT '';
+
+ALTER TABLE "sessions" ADD COLUMN "last_seen_at" timestamptz NOT NULL DEFAULT (now());
+
+UPDATE "sessions" SET "last_seen_ip" = "client_ip", "last_seen_at" = "created_at";
+
+COMMENT ON COLUMN "sessions"."device_name" IS 'name the user gave the device at login, to tell their sessions apart';
+
+COMMENT ON COLUMN "sessions"."last_seen_at" IS 'last time an access token of the session was used, updated at most once a minute';
@@ -0,0 +1,29 @@
+CREATE TABLE "user_identities" (
+  "provider" varchar NOT NULL,
+  "subject" varchar NOT NULL,
+  "username" varchar NOT NULL,
+  "email" varchar NOT NULL,
+  "last_login_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("provider", "subject")
+);
+
+CREATE TABLE "oidc_auth_requests" (
+  "state_hash" varchar PRIMARY KEY,
+  "provider" varchar NOT NULL,
+  "nonce" varchar NOT NULL,
+  "code_verifier" varchar NOT NULL,
+  "link_username" varchar NOT NULL DEFAULT '',
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "user_identities" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+CREATE UNIQUE INDEX ON "user_identities" ("username", "provider");
+
+COMMENT ON COLUMN "user_identities"."subject" IS 'sub claim of the id token, stable for the user at the provider';
+
+COMMENT ON COLUMN "oidc_auth_requests"."state_hash" IS 'sha256 of the state sent to the provider, the state itself is never stored';
+
+COMMENT ON COLUMN "oidc_auth_requests"."link_username" IS 'user the identity gets linked to when the flow was started while logged in, empty for a login';
@@ -0,0 +1,29 @@
+CREATE TABLE "webauthn_credentials" (
+  "id" bytea PRIMARY KEY,
+  "username" varchar NOT NULL,
+  "user_handle" bytea NOT NULL,
+  "name" varchar NOT NULL,
+  "credential" jsonb NOT NULL,
+  "last_used_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "webauthn_ceremonies" (
+  "id" uuid PRIMARY KEY,
+  "ceremony" varchar NOT NULL,
+  "username" varchar NOT NULL DEFAULT '',
+  "credential_name" varchar NOT NULL DEFAULT '',
+  "session_data" jsonb NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "webauthn_credentials" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+CREATE INDEX ON "webauthn_credentials" ("username");
+
+COMMENT ON COLUMN "webauthn_credentials"."user_handle" IS 'random id the authenticator stores for the user, the same for all the passkeys of a user';
+
+COMMENT ON COLUMN "webauthn_credentials"."credential" IS 'public key, sign count and flags of the credential as kept by go-webauthn';
+
+COMMENT ON COLUMN "webauthn_ceremonies"."session_data" IS 'challenge of a registration or login in progress, used up when it completes';
@@ -0,0 +1,15 @@
+CREATE TABLE "transaction_pins" (
+  "username" varchar PRIMARY KEY,
+  "hashed_pin" varchar NOT NULL,
+  "require_for_transfers" boolean NOT NULL DEFAULT false,
+  "failed_attempts" int NOT NULL DEFAULT 0,
+  "locked_until" timestamptz,
+  "changed_at" timestamptz NOT NULL DEFAULT (now()),
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "transaction_pins" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+COMMENT ON COLUMN "transaction_pins"."hashed_pin" IS 'hashed like passwords, with the configured password hasher';
+
+COMMENT ON COLUMN "transaction_pins"."failed_attempts" IS 'wrong pins entered in a row, reset when the pin gets locked or is entered correctly';
@@ -0,0 +1,13 @@
+CREATE TABLE "known_devices" (
+  "username" varchar NOT NULL,
+  "fingerprint" varchar NOT NULL,
+  "user_agent" varchar NOT NULL,
+  "ip_range" varchar NOT NULL,
+  "first_seen_at" timestamptz NOT NULL DEFAULT (now()),
+  "last_seen_at" timestamptz NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("username", "fingerprint")
+);
+
+ALTER TABLE "known_devices" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+COMMENT ON COLUMN "known_devices"."fingerprint" IS 'sha256 of the user agent and the ip range the user logged in from';
@@ -0,0 +1,7 @@
+ALTER TABLE "users" ADD COLUMN "allowed_ips" varchar[] NOT NULL DEFAULT '{}';
+
+ALTER TABLE "api_keys" ADD COLUMN "allowed_ips" varchar[] NOT NULL DEFAULT '{}';
+
+COMMENT ON COLUMN "users"."allowed_ips" IS 'CIDR ranges the user may call the api from, any address when empty';
+
+COMMENT ON COLUMN "api_keys"."allowed_ips" IS 'CIDR ranges the key may be used from, on top of the ones of the user';
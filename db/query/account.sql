@@ -2,16 +2,24 @@
 INSERT INTO accounts (
   owner, 
   balance,
-  currency
+  currency,
+  account_number
 ) VALUES (
-  $1, $2, $3
+  $1, $2, $3, $4
 )
 RETURNING *;
 
+-- name: NextAccountNumberSerial :one
+SELECT nextval('account_number_seq')::bigint AS serial;
+
 -- name: GetAccount :one
 SELECT * FROM accounts
 WHERE id = $1;
 
+-- name: GetAccountByNumber :one
+SELECT * FROM accounts
+WHERE account_number = $1 LIMIT 1;
+
 -- name: GetAccountForUpdate :one
 SELECT * FROM accounts
 WHERE id = $1 LIMIT 1
@@ -33,8 +41,24 @@ RETURNING *;
 -- name: AddAccountBalance :one
 UPDATE accounts
 SET balance = balance + sqlc.arg(amount)
-WHERE id = sqlc.arg(id)
+WHERE id = sqlc.arg(id) AND closed_at = '0001-01-01 00:00:00Z'
 RETURNING *;
 
 -- name: DeleteAccount :exec
-DELETE FROM accounts WHERE id = $1;
\ No newline at end of file
+DELETE FROM accounts WHERE id = $1;
+
+-- name: ListOwnerAccountsForUpdate :many
+SELECT * FROM accounts
+WHERE owner = $1
+ORDER BY id
+FOR NO KEY UPDATE;
+
+-- name: CloseOwnerAccounts :exec
+UPDATE accounts
+SET closed_at = now()
+WHERE owner = $1 AND closed_at = '0001-01-01 00:00:00Z';
+
+-- name: ListOwnerAccounts :many
+SELECT * FROM accounts
+WHERE owner = $1
+ORDER BY id;
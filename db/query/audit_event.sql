@@ -0,0 +1,28 @@
+-- name: CreateAuditEvent :one
+INSERT INTO audit_events (
+  event_type,
+  actor,
+  target,
+  client_ip,
+  user_agent,
+  request_id,
+  outcome,
+  details
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8
+) RETURNING *;
+
+-- name: ListAuditEvents :many
+-- every filter left null matches all events, the newest come first
+SELECT * FROM audit_events
+WHERE
+  (sqlc.narg(actor)::varchar IS NULL OR actor = sqlc.narg(actor)) AND
+  (sqlc.narg(event_type)::varchar IS NULL OR event_type = sqlc.narg(event_type)) AND
+  (sqlc.narg(outcome)::varchar IS NULL OR outcome = sqlc.narg(outcome)) AND
+  (sqlc.narg(client_ip)::varchar IS NULL OR client_ip = sqlc.narg(client_ip)) AND
+  (sqlc.narg(request_id)::varchar IS NULL OR request_id = sqlc.narg(request_id)) AND
+  (sqlc.narg(since)::timestamptz IS NULL OR created_at >= sqlc.narg(since)) AND
+  (sqlc.narg(until)::timestamptz IS NULL OR created_at < sqlc.narg(until))
+ORDER BY id DESC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
@@ -0,0 +1,42 @@
+-- name: CreateHold :one
+INSERT INTO holds (
+  account_id,
+  amount,
+  reason,
+  placed_by,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4, $5
+) RETURNING *;
+
+-- name: GetHold :one
+SELECT * FROM holds
+WHERE id = $1 LIMIT 1;
+
+-- name: ListHolds :many
+SELECT * FROM holds
+WHERE account_id = $1
+ORDER BY id
+LIMIT $2
+OFFSET $3;
+
+-- name: ListActiveHolds :many
+SELECT * FROM holds
+WHERE account_id = $1
+  AND released_at IS NULL
+  AND (expires_at IS NULL OR expires_at > now())
+ORDER BY id;
+
+-- name: GetActiveHoldsAmount :one
+SELECT COALESCE(SUM(amount), 0)::bigint AS amount FROM holds
+WHERE account_id = $1
+  AND released_at IS NULL
+  AND (expires_at IS NULL OR expires_at > now());
+
+-- name: ReleaseHold :one
+UPDATE holds
+SET
+  released_at = now(),
+  released_by = $2
+WHERE id = $1 AND released_at IS NULL
+RETURNING *;
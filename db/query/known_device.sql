@@ -0,0 +1,23 @@
+-- name: CreateKnownDevice :one
+INSERT INTO known_devices (
+  username,
+  fingerprint,
+  user_agent,
+  ip_range
+) VALUES (
+  $1, $2, $3, $4
+) ON CONFLICT (username, fingerprint) DO NOTHING
+RETURNING *;
+
+-- name: TouchKnownDevice :execrows
+UPDATE known_devices
+SET last_seen_at = now()
+WHERE username = $1 AND fingerprint = $2;
+
+-- name: CountKnownDevices :one
+SELECT count(*) FROM known_devices
+WHERE username = $1;
+
+-- name: DeleteUserKnownDevices :exec
+DELETE FROM known_devices
+WHERE username = $1;
@@ -0,0 +1,55 @@
+-- name: GetLoginThrottles :many
+SELECT * FROM login_throttles
+WHERE key = ANY(sqlc.arg(keys)::varchar[]);
+
+-- name: RecordLoginAttempt :one
+-- counts the attempt before the password is checked, only if the key is neither
+-- locked nor inside its backoff, so concurrent attempts cannot all get through.
+-- No row is returned when the attempt is throttled.
+INSERT INTO login_throttles (
+  key,
+  failed_count,
+  last_failed_at,
+  locked_until
+) VALUES (
+  sqlc.arg(key), 1, now(),
+  CASE WHEN sqlc.arg(threshold)::int = 1 THEN sqlc.arg(locked_until)::timestamptz END
+)
+ON CONFLICT (key) DO UPDATE
+SET
+  failed_count = CASE
+    WHEN login_throttles.last_failed_at < sqlc.arg(reset_before) THEN 1
+    ELSE login_throttles.failed_count + 1
+  END,
+  last_failed_at = now(),
+  locked_until = CASE
+    WHEN sqlc.arg(threshold)::int > 0
+      AND (CASE
+        WHEN login_throttles.last_failed_at < sqlc.arg(reset_before) THEN 1
+        ELSE login_throttles.failed_count + 1
+      END) >= sqlc.arg(threshold)::int
+    THEN sqlc.arg(locked_until)::timestamptz
+  END
+WHERE
+  (login_throttles.locked_until IS NULL OR login_throttles.locked_until <= now())
+  AND (
+    login_throttles.failed_count = 0
+    OR login_throttles.last_failed_at < sqlc.arg(reset_before)
+    OR login_throttles.last_failed_at + make_interval(secs => LEAST(
+      sqlc.arg(backoff_base)::float8 * power(2, LEAST(login_throttles.failed_count - 1, 30)),
+      sqlc.arg(max_backoff)::float8
+    )) <= now()
+  )
+RETURNING *;
+
+-- name: RefundLoginAttempt :exec
+-- takes back an attempt that turned out to be a successful login
+UPDATE login_throttles
+SET
+  failed_count = failed_count - 1,
+  locked_until = CASE WHEN failed_count - 1 < sqlc.arg(threshold)::int THEN NULL ELSE locked_until END
+WHERE key = sqlc.arg(key) AND failed_count > 0;
+
+-- name: DeleteLoginThrottle :execrows
+DELETE FROM login_throttles
+WHERE key = $1;
@@ -0,0 +1,20 @@
+-- name: CreateOIDCAuthRequest :one
+INSERT INTO oidc_auth_requests (
+  state_hash,
+  provider,
+  nonce,
+  code_verifier,
+  link_username,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+) RETURNING *;
+
+-- name: UseOIDCAuthRequest :one
+DELETE FROM oidc_auth_requests
+WHERE state_hash = $1 AND provider = $2 AND expires_at > now()
+RETURNING *;
+
+-- name: DeleteExpiredOIDCAuthRequests :exec
+DELETE FROM oidc_auth_requests
+WHERE expires_at <= now();
@@ -0,0 +1,49 @@
+-- name: CreateSession :one
+INSERT INTO sessions (
+  id,
+  username,
+  user_agent,
+  client_ip,
+  is_blocked,
+  expires_at,
+  device_name,
+  last_seen_ip
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $4
+) RETURNING *;
+
+-- name: GetSession :one
+SELECT * FROM sessions
+WHERE id = $1 LIMIT 1;
+
+-- name: BlockSession :one
+UPDATE sessions
+SET is_blocked = true
+WHERE id = $1
+RETURNING *;
+
+-- name: BlockUserSession :one
+UPDATE sessions
+SET is_blocked = true
+WHERE id = $1 AND username = $2 AND is_blocked = false AND expires_at > now()
+RETURNING *;
+
+-- name: BlockUserSessions :many
+UPDATE sessions
+SET is_blocked = true
+WHERE username = $1 AND is_blocked = false AND expires_at > now()
+RETURNING *;
+
+-- name: DeleteUserSessions :exec
+DELETE FROM sessions
+WHERE username = $1;
+
+-- name: ListActiveUserSessions :many
+SELECT * FROM sessions
+WHERE username = $1 AND is_blocked = false AND expires_at > now()
+ORDER BY last_seen_at DESC;
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET last_seen_at = now(), last_seen_ip = sqlc.arg(client_ip)
+WHERE id = sqlc.arg(id) AND (last_seen_at < now() - interval '1 minute' OR last_seen_ip <> sqlc.arg(client_ip));
@@ -0,0 +1,54 @@
+-- name: CreateTransactionPIN :one
+INSERT INTO transaction_pins (
+  username,
+  hashed_pin
+) VALUES (
+  $1, $2
+) RETURNING *;
+
+-- name: GetTransactionPIN :one
+SELECT * FROM transaction_pins
+WHERE username = $1 LIMIT 1;
+
+-- name: UpdateTransactionPIN :one
+UPDATE transaction_pins
+SET
+  hashed_pin = sqlc.arg(hashed_pin),
+  failed_attempts = 0,
+  locked_until = NULL,
+  changed_at = now()
+WHERE username = sqlc.arg(username)
+RETURNING *;
+
+-- name: SetTransactionPINRequired :one
+UPDATE transaction_pins
+SET require_for_transfers = sqlc.arg(require_for_transfers)
+WHERE username = sqlc.arg(username)
+RETURNING *;
+
+-- name: RecordTransactionPINAttempt :one
+-- counts an attempt before the pin is compared, so that concurrent guesses cannot
+-- get past max_attempts. The attempt that reaches max_attempts locks the pin, and
+-- while it is locked no row is returned.
+UPDATE transaction_pins
+SET
+  failed_attempts = CASE
+    WHEN failed_attempts + 1 >= sqlc.arg(max_attempts)::int THEN 0
+    ELSE failed_attempts + 1
+  END,
+  locked_until = CASE
+    WHEN failed_attempts + 1 >= sqlc.arg(max_attempts)::int THEN sqlc.arg(locked_until)::timestamptz
+    ELSE NULL
+  END
+WHERE username = sqlc.arg(username) AND (locked_until IS NULL OR locked_until <= now())
+RETURNING *;
+
+-- name: ResetTransactionPINFailures :exec
+-- takes back the attempts counted before a correct pin
+UPDATE transaction_pins
+SET failed_attempts = 0, locked_until = NULL
+WHERE username = $1;
+
+-- name: DeleteUserTransactionPIN :exec
+DELETE FROM transaction_pins
+WHERE username = $1;
@@ -18,4 +18,11 @@ WHERE
     to_account_id = $2
 ORDER BY id
 LIMIT $3
-OFFSET $4;
\ No newline at end of file
+OFFSET $4;
+
+-- name: ListOwnerTransfers :many
+SELECT * FROM transfers
+WHERE
+    from_account_id IN (SELECT accounts.id FROM accounts WHERE accounts.owner = sqlc.arg(owner)) OR
+    to_account_id IN (SELECT accounts.id FROM accounts WHERE accounts.owner = sqlc.arg(owner))
+ORDER BY id;
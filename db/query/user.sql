@@ -10,4 +10,75 @@ INSERT INTO users (
 
 -- name: GetUser :one
 SELECT * FROM users
-WHERE username = $1 LIMIT 1;
\ No newline at end of file
+WHERE username = $1 LIMIT 1;
+
+-- name: GetUserByEmail :one
+SELECT * FROM users
+WHERE email = $1 LIMIT 1;
+
+-- name: GetUserAuthInfo :one
+SELECT
+  u.username,
+  u.password_changed_at,
+  u.is_email_verified,
+  u.allowed_ips,
+  (p.username IS NOT NULL)::bool AS has_transaction_pin,
+  COALESCE(p.require_for_transfers, false)::bool AS transaction_pin_required,
+  EXISTS (SELECT 1 FROM webauthn_credentials c WHERE c.username = u.username) AS has_passkey
+FROM users u
+LEFT JOIN transaction_pins p ON p.username = u.username
+WHERE u.username = $1 LIMIT 1;
+
+-- name: UpdateUserPassword :one
+UPDATE users
+SET
+  hashed_password = sqlc.arg(hashed_password),
+  password_changed_at = sqlc.arg(password_changed_at)
+WHERE username = sqlc.arg(username)
+RETURNING *;
+
+-- name: VerifyUserEmail :one
+UPDATE users
+SET is_email_verified = true
+WHERE username = $1 AND email = $2
+RETURNING *;
+
+-- name: UpdateUser :one
+UPDATE users
+SET
+  full_name = COALESCE(sqlc.narg(full_name), full_name),
+  email = COALESCE(sqlc.narg(email), email),
+  phone_number = COALESCE(sqlc.narg(phone_number), phone_number),
+  -- a new email has to be verified again
+  is_email_verified = is_email_verified AND COALESCE(sqlc.narg(email), email) = email
+WHERE username = sqlc.arg(username)
+RETURNING *;
+
+-- name: UpdateUserAllowedIPs :one
+UPDATE users
+SET allowed_ips = sqlc.arg(allowed_ips)
+WHERE username = sqlc.arg(username)
+RETURNING *;
+
+-- name: RehashUserPassword :exec
+-- replaces the hash of the same password, so password_changed_at stays as it is,
+-- unless the password was changed since the old hash was read
+UPDATE users
+SET hashed_password = sqlc.arg(new_hashed_password)
+WHERE username = sqlc.arg(username) AND hashed_password = sqlc.arg(old_hashed_password);
+
+-- name: AnonymizeUser :one
+-- erases the personal data of the user, the username stays as the pseudonymous
+-- owner of the ledger. Bumping password_changed_at rejects all issued tokens.
+UPDATE users
+SET
+  hashed_password = '',
+  full_name = '',
+  email = 'deleted+' || username || '@invalid',
+  phone_number = '',
+  is_email_verified = false,
+  allowed_ips = '{}',
+  password_changed_at = now(),
+  deleted_at = now()
+WHERE username = $1 AND deleted_at = '0001-01-01 00:00:00Z'
+RETURNING *;
@@ -0,0 +1,27 @@
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (
+  provider,
+  subject,
+  username,
+  email
+) VALUES (
+  $1, $2, $3, $4
+) RETURNING *;
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE provider = $1 AND subject = $2 LIMIT 1;
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identities
+SET last_login_at = now(), email = $3
+WHERE provider = $1 AND subject = $2;
+
+-- name: ListUserIdentities :many
+SELECT * FROM user_identities
+WHERE username = $1
+ORDER BY provider;
+
+-- name: DeleteUserIdentities :exec
+DELETE FROM user_identities
+WHERE username = $1;
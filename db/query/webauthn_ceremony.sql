@@ -0,0 +1,20 @@
+-- name: CreateWebAuthnCeremony :one
+INSERT INTO webauthn_ceremonies (
+  id,
+  ceremony,
+  username,
+  credential_name,
+  session_data,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+) RETURNING *;
+
+-- name: UseWebAuthnCeremony :one
+DELETE FROM webauthn_ceremonies
+WHERE id = $1 AND ceremony = $2 AND expires_at > now()
+RETURNING *;
+
+-- name: DeleteExpiredWebAuthnCeremonies :exec
+DELETE FROM webauthn_ceremonies
+WHERE expires_at <= now();
@@ -0,0 +1,32 @@
+-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (
+  id,
+  username,
+  user_handle,
+  name,
+  credential
+) VALUES (
+  $1, $2, $3, $4, $5
+) RETURNING *;
+
+-- name: GetWebAuthnCredential :one
+SELECT * FROM webauthn_credentials
+WHERE id = $1 LIMIT 1;
+
+-- name: ListWebAuthnCredentials :many
+SELECT * FROM webauthn_credentials
+WHERE username = $1
+ORDER BY created_at;
+
+-- name: UseWebAuthnCredential :exec
+UPDATE webauthn_credentials
+SET credential = $2, last_used_at = now()
+WHERE id = $1;
+
+-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials
+WHERE id = $1 AND username = $2;
+
+-- name: DeleteUserWebAuthnCredentials :exec
+DELETE FROM webauthn_credentials
+WHERE username = $1;
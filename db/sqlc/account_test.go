@@ -12,10 +12,18 @@ import (
 func createRandomAccount(t *testing.T) Account {
 	user := createRandomUser(t)
 
+	serial, err := testQueries.NextAccountNumberSerial(context.Background())
+	require.NoError(t, err)
+
+	currency := utils.RandomCurrency()
+	accountNumber, err := utils.NewAccountNumber(currency, "0001", serial)
+	require.NoError(t, err)
+
 	args := CreateAccountParams{
-		Owner:    user.Username,
-		Balance:  utils.RandomMoney(),
-		Currency: utils.RandomCurrency(),
+		Owner:         user.Username,
+		Balance:       utils.RandomInt(100, 1000),
+		Currency:      currency,
+		AccountNumber: accountNumber,
 	}
 
 	account, err := testQueries.CreateAccount(context.Background(), args)
@@ -28,6 +36,7 @@ func createRandomAccount(t *testing.T) Account {
 	require.Equal(t, args.Owner, account.Owner)
 	require.Equal(t, args.Balance, account.Balance)
 	require.Equal(t, args.Currency, account.Currency)
+	require.Equal(t, args.AccountNumber, account.AccountNumber)
 
 	return account
 }
@@ -63,6 +72,14 @@ func TestGetAccount(t *testing.T) {
 	// require.WithinDuration(t, account.CreatedAt, actualAccount.CreatedAt, time.Second)
 }
 
+func TestGetAccountByNumber(t *testing.T) {
+	account := createRandomAccount(t)
+	testGetAccount, err := testQueries.GetAccountByNumber(context.Background(), account.AccountNumber)
+
+	require.NoError(t, err)
+	require.Equal(t, account, testGetAccount)
+}
+
 func TestUpdateAccount(t *testing.T) {
 	account := createRandomAccount(t)
 
@@ -0,0 +1,136 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: audit_event.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+const createAuditEvent = `-- name: CreateAuditEvent :one
+INSERT INTO audit_events (
+  event_type,
+  actor,
+  target,
+  client_ip,
+  user_agent,
+  request_id,
+  outcome,
+  details
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8
+) RETURNING id, event_type, actor, target, client_ip, user_agent, request_id, outcome, details, created_at
+`
+
+type CreateAuditEventParams struct {
+	EventType string `json:"event_type"`
+	Actor     string `json:"actor"`
+	Target    string `json:"target"`
+	ClientIp  string `json:"client_ip"`
+	UserAgent string `json:"user_agent"`
+	RequestID string `json:"request_id"`
+	Outcome   string `json:"outcome"`
+	Details   string `json:"details"`
+}
+
+func (q *Queries) CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) (AuditEvent, error) {
+	row := q.db.QueryRowContext(ctx, createAuditEvent,
+		arg.EventType,
+		arg.Actor,
+		arg.Target,
+		arg.ClientIp,
+		arg.UserAgent,
+		arg.RequestID,
+		arg.Outcome,
+		arg.Details,
+	)
+	var i AuditEvent
+	err := row.Scan(
+		&i.ID,
+		&i.EventType,
+		&i.Actor,
+		&i.Target,
+		&i.ClientIp,
+		&i.UserAgent,
+		&i.RequestID,
+		&i.Outcome,
+		&i.Details,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listAuditEvents = `-- name: ListAuditEvents :many
+SELECT id, event_type, actor, target, client_ip, user_agent, request_id, outcome, details, created_at FROM audit_events
+WHERE
+  ($1::varchar IS NULL OR actor = $1) AND
+  ($2::varchar IS NULL OR event_type = $2) AND
+  ($3::varchar IS NULL OR outcome = $3) AND
+  ($4::varchar IS NULL OR client_ip = $4) AND
+  ($5::varchar IS NULL OR request_id = $5) AND
+  ($6::timestamptz IS NULL OR created_at >= $6) AND
+  ($7::timestamptz IS NULL OR created_at < $7)
+ORDER BY id DESC
+LIMIT $9
+OFFSET $8
+`
+
+type ListAuditEventsParams struct {
+	Actor     sql.NullString `json:"actor"`
+	EventType sql.NullString `json:"event_type"`
+	Outcome   sql.NullString `json:"outcome"`
+	ClientIp  sql.NullString `json:"client_ip"`
+	RequestID sql.NullString `json:"request_id"`
+	Since     sql.NullTime   `json:"since"`
+	Until     sql.NullTime   `json:"until"`
+	Offset    int32          `json:"offset"`
+	Limit     int32          `json:"limit"`
+}
+
+// every filter left null matches all events, the newest come first
+func (q *Queries) ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]AuditEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listAuditEvents,
+		arg.Actor,
+		arg.EventType,
+		arg.Outcome,
+		arg.ClientIp,
+		arg.RequestID,
+		arg.Since,
+		arg.Until,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AuditEvent{}
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.EventType,
+			&i.Actor,
+			&i.Target,
+			&i.ClientIp,
+			&i.UserAgent,
+			&i.RequestID,
+			&i.Outcome,
+			&i.Details,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomAuditEvent(t *testing.T, actor string, outcome string) AuditEvent {
+	arg := CreateAuditEventParams{
+		EventType: "user.login",
+		Actor:     actor,
+		ClientIp:  "203.0.113.7",
+		UserAgent: "Go-http-client/1.1",
+		RequestID: utils.RandomString(16),
+		Outcome:   outcome,
+		Details:   utils.RandomString(10),
+	}
+
+	event, err := testQueries.CreateAuditEvent(context.Background(), arg)
+	require.NoError(t, err)
+	require.NotZero(t, event.ID)
+	require.Equal(t, arg.EventType, event.EventType)
+	require.Equal(t, arg.Actor, event.Actor)
+	require.Equal(t, arg.ClientIp, event.ClientIp)
+	require.Equal(t, arg.UserAgent, event.UserAgent)
+	require.Equal(t, arg.RequestID, event.RequestID)
+	require.Equal(t, arg.Outcome, event.Outcome)
+	require.Equal(t, arg.Details, event.Details)
+	require.WithinDuration(t, time.Now(), event.CreatedAt, time.Second)
+
+	return event
+}
+
+func TestCreateAuditEvent(t *testing.T) {
+	createRandomAuditEvent(t, utils.RandomOwner(), "success")
+}
+
+func TestListAuditEvents(t *testing.T) {
+	actor := utils.RandomOwner()
+	success := createRandomAuditEvent(t, actor, "success")
+	failure := createRandomAuditEvent(t, actor, "failure")
+	createRandomAuditEvent(t, utils.RandomOwner(), "failure")
+
+	events, err := testQueries.ListAuditEvents(context.Background(), ListAuditEventsParams{
+		Actor: sql.NullString{String: actor, Valid: true},
+		Limit: 10,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	// newest first
+	require.Equal(t, failure.ID, events[0].ID)
+	require.Equal(t, success.ID, events[1].ID)
+
+	events, err = testQueries.ListAuditEvents(context.Background(), ListAuditEventsParams{
+		Actor:     sql.NullString{String: actor, Valid: true},
+		Outcome:   sql.NullString{String: "success", Valid: true},
+		RequestID: sql.NullString{String: success.RequestID, Valid: true},
+		Since:     sql.NullTime{Time: success.CreatedAt.Add(-time.Second), Valid: true},
+		Limit:     10,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, success.ID, events[0].ID)
+
+	events, err = testQueries.ListAuditEvents(context.Background(), ListAuditEventsParams{
+		Actor: sql.NullString{String: actor, Valid: true},
+		Until: sql.NullTime{Time: success.CreatedAt.Add(-time.Second), Valid: true},
+		Limit: 10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
+
+func TestAuditEventsAreAppendOnly(t *testing.T) {
+	event := createRandomAuditEvent(t, utils.RandomOwner(), "success")
+
+	_, err := testDB.Exec("UPDATE audit_events SET outcome = 'failure' WHERE id = $1", event.ID)
+	require.Error(t, err)
+
+	_, err = testDB.Exec("DELETE FROM audit_events WHERE id = $1", event.ID)
+	require.Error(t, err)
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomEmailVerificationToken(t *testing.T, user User, expiresAt time.Time) EmailVerificationToken {
+	_, tokenHash, err := utils.NewSecretToken()
+	require.NoError(t, err)
+
+	arg := CreateEmailVerificationTokenParams{
+		Username:  user.Username,
+		Email:     user.Email,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	}
+
+	verificationToken, err := testQueries.CreateEmailVerificationToken(context.Background(), arg)
+	require.NoError(t, err)
+	require.NotZero(t, verificationToken.ID)
+	require.Equal(t, arg.Username, verificationToken.Username)
+	require.Equal(t, arg.Email, verificationToken.Email)
+	require.Equal(t, arg.TokenHash, verificationToken.TokenHash)
+	require.WithinDuration(t, arg.ExpiresAt, verificationToken.ExpiresAt, time.Second)
+	require.False(t, verificationToken.UsedAt.Valid)
+	require.NotZero(t, verificationToken.CreatedAt)
+
+	return verificationToken
+}
+
+func TestGetLatestEmailVerificationToken(t *testing.T) {
+	user := createRandomUser(t)
+
+	_, err := testQueries.GetLatestEmailVerificationToken(context.Background(), user.Username)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	createRandomEmailVerificationToken(t, user, time.Now().Add(time.Hour))
+	latest := createRandomEmailVerificationToken(t, user, time.Now().Add(time.Hour))
+
+	got, err := testQueries.GetLatestEmailVerificationToken(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Equal(t, latest.ID, got.ID)
+}
+
+func TestUseEmailVerificationToken(t *testing.T) {
+	user := createRandomUser(t)
+	verificationToken := createRandomEmailVerificationToken(t, user, time.Now().Add(time.Hour))
+	expiredToken := createRandomEmailVerificationToken(t, user, time.Now().Add(-time.Minute))
+
+	usedToken, err := testQueries.UseEmailVerificationToken(context.Background(), verificationToken.TokenHash)
+	require.NoError(t, err)
+	require.Equal(t, verificationToken.ID, usedToken.ID)
+	require.True(t, usedToken.UsedAt.Valid)
+
+	_, err = testQueries.UseEmailVerificationToken(context.Background(), verificationToken.TokenHash)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = testQueries.UseEmailVerificationToken(context.Background(), expiredToken.TokenHash)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -66,3 +66,16 @@ func TestListEntries(t *testing.T) {
 		require.Equal(t, arg.AccountID, account.ID)
 	}
 }
+
+func TestListOwnerEntries(t *testing.T) {
+	account := createRandomAccount(t)
+	entry1 := createRandomEntry(t, account)
+	entry2 := createRandomEntry(t, account)
+	createRandomEntry(t, createRandomAccount(t))
+
+	entries, err := testQueries.ListOwnerEntries(context.Background(), account.Owner)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, entry1.ID, entries[0].ID)
+	require.Equal(t, entry2.ID, entries[1].ID)
+}
@@ -0,0 +1,209 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: hold.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+const createHold = `-- name: CreateHold :one
+INSERT INTO holds (
+  account_id,
+  amount,
+  reason,
+  placed_by,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4, $5
+) RETURNING id, account_id, amount, reason, placed_by, expires_at, released_at, released_by, created_at
+`
+
+type CreateHoldParams struct {
+	AccountID int64        `json:"account_id"`
+	Amount    int64        `json:"amount"`
+	Reason    string       `json:"reason"`
+	PlacedBy  string       `json:"placed_by"`
+	ExpiresAt sql.NullTime `json:"expires_at"`
+}
+
+func (q *Queries) CreateHold(ctx context.Context, arg CreateHoldParams) (Hold, error) {
+	row := q.db.QueryRowContext(ctx, createHold,
+		arg.AccountID,
+		arg.Amount,
+		arg.Reason,
+		arg.PlacedBy,
+		arg.ExpiresAt,
+	)
+	var i Hold
+	err := row.Scan(
+		&i.ID,
+		&i.AccountID,
+		&i.Amount,
+		&i.Reason,
+		&i.PlacedBy,
+		&i.ExpiresAt,
+		&i.ReleasedAt,
+		&i.ReleasedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getActiveHoldsAmount = `-- name: GetActiveHoldsAmount :one
+SELECT COALESCE(SUM(amount), 0)::bigint AS amount FROM holds
+WHERE account_id = $1
+  AND released_at IS NULL
+  AND (expires_at IS NULL OR expires_at > now())
+`
+
+func (q *Queries) GetActiveHoldsAmount(ctx context.Context, accountID int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getActiveHoldsAmount, accountID)
+	var amount int64
+	err := row.Scan(&amount)
+	return amount, err
+}
+
+const getHold = `-- name: GetHold :one
+SELECT id, account_id, amount, reason, placed_by, expires_at, released_at, released_by, created_at FROM holds
+WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetHold(ctx context.Context, id int64) (Hold, error) {
+	row := q.db.QueryRowContext(ctx, getHold, id)
+	var i Hold
+	err := row.Scan(
+		&i.ID,
+		&i.AccountID,
+		&i.Amount,
+		&i.Reason,
+		&i.PlacedBy,
+		&i.ExpiresAt,
+		&i.ReleasedAt,
+		&i.ReleasedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listActiveHolds = `-- name: ListActiveHolds :many
+SELECT id, account_id, amount, reason, placed_by, expires_at, released_at, released_by, created_at FROM holds
+WHERE account_id = $1
+  AND released_at IS NULL
+  AND (expires_at IS NULL OR expires_at > now())
+ORDER BY id
+`
+
+func (q *Queries) ListActiveHolds(ctx context.Context, accountID int64) ([]Hold, error) {
+	rows, err := q.db.QueryContext(ctx, listActiveHolds, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Hold{}
+	for rows.Next() {
+		var i Hold
+		if err := rows.Scan(
+			&i.ID,
+			&i.AccountID,
+			&i.Amount,
+			&i.Reason,
+			&i.PlacedBy,
+			&i.ExpiresAt,
+			&i.ReleasedAt,
+			&i.ReleasedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listHolds = `-- name: ListHolds :many
+SELECT id, account_id, amount, reason, placed_by, expires_at, released_at, released_by, created_at FROM holds
+WHERE account_id = $1
+ORDER BY id
+LIMIT $2
+OFFSET $3
+`
+
+type ListHoldsParams struct {
+	AccountID int64 `json:"account_id"`
+	Limit     int32 `json:"limit"`
+	Offset    int32 `json:"offset"`
+}
+
+func (q *Queries) ListHolds(ctx context.Context, arg ListHoldsParams) ([]Hold, error) {
+	rows, err := q.db.QueryContext(ctx, listHolds, arg.AccountID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Hold{}
+	for rows.Next() {
+		var i Hold
+		if err := rows.Scan(
+			&i.ID,
+			&i.AccountID,
+			&i.Amount,
+			&i.Reason,
+			&i.PlacedBy,
+			&i.ExpiresAt,
+			&i.ReleasedAt,
+			&i.ReleasedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const releaseHold = `-- name: ReleaseHold :one
+UPDATE holds
+SET
+  released_at = now(),
+  released_by = $2
+WHERE id = $1 AND released_at IS NULL
+RETURNING id, account_id, amount, reason, placed_by, expires_at, released_at, released_by, created_at
+`
+
+type ReleaseHoldParams struct {
+	ID         int64          `json:"id"`
+	ReleasedBy sql.NullString `json:"released_by"`
+}
+
+func (q *Queries) ReleaseHold(ctx context.Context, arg ReleaseHoldParams) (Hold, error) {
+	row := q.db.QueryRowContext(ctx, releaseHold, arg.ID, arg.ReleasedBy)
+	var i Hold
+	err := row.Scan(
+		&i.ID,
+		&i.AccountID,
+		&i.Amount,
+		&i.Reason,
+		&i.PlacedBy,
+		&i.ExpiresAt,
+		&i.ReleasedAt,
+		&i.ReleasedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
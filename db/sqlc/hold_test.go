@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomHold(t *testing.T, account Account, expiresAt sql.NullTime) Hold {
+	placedBy := createRandomUser(t)
+
+	arg := CreateHoldParams{
+		AccountID: account.ID,
+		Amount:    utils.RandomInt(1, 50),
+		Reason:    utils.RandomString(10),
+		PlacedBy:  placedBy.Username,
+		ExpiresAt: expiresAt,
+	}
+
+	hold, err := testQueries.CreateHold(context.Background(), arg)
+	require.NoError(t, err)
+	require.NotEmpty(t, hold)
+
+	require.NotZero(t, hold.ID)
+	require.Equal(t, arg.AccountID, hold.AccountID)
+	require.Equal(t, arg.Amount, hold.Amount)
+	require.Equal(t, arg.Reason, hold.Reason)
+	require.Equal(t, arg.PlacedBy, hold.PlacedBy)
+	require.False(t, hold.ReleasedAt.Valid)
+	require.NotZero(t, hold.CreatedAt)
+
+	return hold
+}
+
+func TestActiveHolds(t *testing.T) {
+	account := createRandomAccount(t)
+
+	hold1 := createRandomHold(t, account, sql.NullTime{})
+	hold2 := createRandomHold(t, account, sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true})
+	createRandomHold(t, account, sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true})
+
+	holds, err := testQueries.ListActiveHolds(context.Background(), account.ID)
+	require.NoError(t, err)
+	require.Len(t, holds, 2)
+
+	amount, err := testQueries.GetActiveHoldsAmount(context.Background(), account.ID)
+	require.NoError(t, err)
+	require.Equal(t, hold1.Amount+hold2.Amount, amount)
+}
+
+func TestReleaseHold(t *testing.T) {
+	account := createRandomAccount(t)
+	hold := createRandomHold(t, account, sql.NullTime{})
+
+	arg := ReleaseHoldParams{
+		ID:         hold.ID,
+		ReleasedBy: sql.NullString{String: hold.PlacedBy, Valid: true},
+	}
+
+	released, err := testQueries.ReleaseHold(context.Background(), arg)
+	require.NoError(t, err)
+	require.True(t, released.ReleasedAt.Valid)
+	require.Equal(t, arg.ReleasedBy, released.ReleasedBy)
+
+	_, err = testQueries.ReleaseHold(context.Background(), arg)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+
+	amount, err := testQueries.GetActiveHoldsAmount(context.Background(), account.ID)
+	require.NoError(t, err)
+	require.Zero(t, amount)
+}
@@ -0,0 +1,89 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: known_device.sql
+
+package db
+
+import (
+	"context"
+)
+
+const countKnownDevices = `-- name: CountKnownDevices :one
+SELECT count(*) FROM known_devices
+WHERE username = $1
+`
+
+func (q *Queries) CountKnownDevices(ctx context.Context, username string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countKnownDevices, username)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createKnownDevice = `-- name: CreateKnownDevice :one
+INSERT INTO known_devices (
+  username,
+  fingerprint,
+  user_agent,
+  ip_range
+) VALUES (
+  $1, $2, $3, $4
+) ON CONFLICT (username, fingerprint) DO NOTHING
+RETURNING username, fingerprint, user_agent, ip_range, first_seen_at, last_seen_at
+`
+
+type CreateKnownDeviceParams struct {
+	Username    string `json:"username"`
+	Fingerprint string `json:"fingerprint"`
+	UserAgent   string `json:"user_agent"`
+	IpRange     string `json:"ip_range"`
+}
+
+func (q *Queries) CreateKnownDevice(ctx context.Context, arg CreateKnownDeviceParams) (KnownDevice, error) {
+	row := q.db.QueryRowContext(ctx, createKnownDevice,
+		arg.Username,
+		arg.Fingerprint,
+		arg.UserAgent,
+		arg.IpRange,
+	)
+	var i KnownDevice
+	err := row.Scan(
+		&i.Username,
+		&i.Fingerprint,
+		&i.UserAgent,
+		&i.IpRange,
+		&i.FirstSeenAt,
+		&i.LastSeenAt,
+	)
+	return i, err
+}
+
+const deleteUserKnownDevices = `-- name: DeleteUserKnownDevices :exec
+DELETE FROM known_devices
+WHERE username = $1
+`
+
+func (q *Queries) DeleteUserKnownDevices(ctx context.Context, username string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserKnownDevices, username)
+	return err
+}
+
+const touchKnownDevice = `-- name: TouchKnownDevice :execrows
+UPDATE known_devices
+SET last_seen_at = now()
+WHERE username = $1 AND fingerprint = $2
+`
+
+type TouchKnownDeviceParams struct {
+	Username    string `json:"username"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+func (q *Queries) TouchKnownDevice(ctx context.Context, arg TouchKnownDeviceParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, touchKnownDevice, arg.Username, arg.Fingerprint)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomKnownDevice(t *testing.T, user User) KnownDevice {
+	arg := CreateKnownDeviceParams{
+		Username:    user.Username,
+		Fingerprint: utils.RandomString(64),
+		UserAgent:   utils.RandomString(20),
+		IpRange:     "203.0.113.0/24",
+	}
+
+	device, err := testQueries.CreateKnownDevice(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Username, device.Username)
+	require.Equal(t, arg.Fingerprint, device.Fingerprint)
+	require.Equal(t, arg.UserAgent, device.UserAgent)
+	require.Equal(t, arg.IpRange, device.IpRange)
+	require.NotZero(t, device.FirstSeenAt)
+	require.NotZero(t, device.LastSeenAt)
+
+	return device
+}
+
+func TestCreateKnownDevice(t *testing.T) {
+	device := createRandomKnownDevice(t, createRandomUser(t))
+
+	// a device that is already known is left as it is
+	_, err := testQueries.CreateKnownDevice(context.Background(), CreateKnownDeviceParams{
+		Username:    device.Username,
+		Fingerprint: device.Fingerprint,
+		UserAgent:   device.UserAgent,
+		IpRange:     device.IpRange,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestTouchKnownDevice(t *testing.T) {
+	user := createRandomUser(t)
+
+	touched, err := testQueries.TouchKnownDevice(context.Background(), TouchKnownDeviceParams{
+		Username:    user.Username,
+		Fingerprint: utils.RandomString(64),
+	})
+	require.NoError(t, err)
+	require.Zero(t, touched)
+
+	device := createRandomKnownDevice(t, user)
+
+	touched, err = testQueries.TouchKnownDevice(context.Background(), TouchKnownDeviceParams{
+		Username:    user.Username,
+		Fingerprint: device.Fingerprint,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), touched)
+}
+
+func TestCountKnownDevices(t *testing.T) {
+	user := createRandomUser(t)
+
+	count, err := testQueries.CountKnownDevices(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	createRandomKnownDevice(t, user)
+	createRandomKnownDevice(t, user)
+
+	count, err = testQueries.CountKnownDevices(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+
+	err = testQueries.DeleteUserKnownDevices(context.Background(), user.Username)
+	require.NoError(t, err)
+
+	count, err = testQueries.CountKnownDevices(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
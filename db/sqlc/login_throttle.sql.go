@@ -0,0 +1,147 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: login_throttle.sql
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const deleteLoginThrottle = `-- name: DeleteLoginThrottle :execrows
+DELETE FROM login_throttles
+WHERE key = $1
+`
+
+func (q *Queries) DeleteLoginThrottle(ctx context.Context, key string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteLoginThrottle, key)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getLoginThrottles = `-- name: GetLoginThrottles :many
+SELECT key, failed_count, last_failed_at, locked_until FROM login_throttles
+WHERE key = ANY($1::varchar[])
+`
+
+func (q *Queries) GetLoginThrottles(ctx context.Context, keys []string) ([]LoginThrottle, error) {
+	rows, err := q.db.QueryContext(ctx, getLoginThrottles, pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []LoginThrottle{}
+	for rows.Next() {
+		var i LoginThrottle
+		if err := rows.Scan(
+			&i.Key,
+			&i.FailedCount,
+			&i.LastFailedAt,
+			&i.LockedUntil,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordLoginAttempt = `-- name: RecordLoginAttempt :one
+INSERT INTO login_throttles (
+  key,
+  failed_count,
+  last_failed_at,
+  locked_until
+) VALUES (
+  $1, 1, now(),
+  CASE WHEN $2::int = 1 THEN $3::timestamptz END
+)
+ON CONFLICT (key) DO UPDATE
+SET
+  failed_count = CASE
+    WHEN login_throttles.last_failed_at < $4 THEN 1
+    ELSE login_throttles.failed_count + 1
+  END,
+  last_failed_at = now(),
+  locked_until = CASE
+    WHEN $2::int > 0
+      AND (CASE
+        WHEN login_throttles.last_failed_at < $4 THEN 1
+        ELSE login_throttles.failed_count + 1
+      END) >= $2::int
+    THEN $3::timestamptz
+  END
+WHERE
+  (login_throttles.locked_until IS NULL OR login_throttles.locked_until <= now())
+  AND (
+    login_throttles.failed_count = 0
+    OR login_throttles.last_failed_at < $4
+    OR login_throttles.last_failed_at + make_interval(secs => LEAST(
+      $5::float8 * power(2, LEAST(login_throttles.failed_count - 1, 30)),
+      $6::float8
+    )) <= now()
+  )
+RETURNING key, failed_count, last_failed_at, locked_until
+`
+
+type RecordLoginAttemptParams struct {
+	Key         string    `json:"key"`
+	Threshold   int32     `json:"threshold"`
+	LockedUntil time.Time `json:"locked_until"`
+	ResetBefore time.Time `json:"reset_before"`
+	BackoffBase float64   `json:"backoff_base"`
+	MaxBackoff  float64   `json:"max_backoff"`
+}
+
+// counts the attempt before the password is checked, only if the key is neither
+// locked nor inside its backoff, so concurrent attempts cannot all get through.
+// No row is returned when the attempt is throttled.
+func (q *Queries) RecordLoginAttempt(ctx context.Context, arg RecordLoginAttemptParams) (LoginThrottle, error) {
+	row := q.db.QueryRowContext(ctx, recordLoginAttempt,
+		arg.Key,
+		arg.Threshold,
+		arg.LockedUntil,
+		arg.ResetBefore,
+		arg.BackoffBase,
+		arg.MaxBackoff,
+	)
+	var i LoginThrottle
+	err := row.Scan(
+		&i.Key,
+		&i.FailedCount,
+		&i.LastFailedAt,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const refundLoginAttempt = `-- name: RefundLoginAttempt :exec
+UPDATE login_throttles
+SET
+  failed_count = failed_count - 1,
+  locked_until = CASE WHEN failed_count - 1 < $1::int THEN NULL ELSE locked_until END
+WHERE key = $2 AND failed_count > 0
+`
+
+type RefundLoginAttemptParams struct {
+	Threshold int32  `json:"threshold"`
+	Key       string `json:"key"`
+}
+
+// takes back an attempt that turned out to be a successful login
+func (q *Queries) RefundLoginAttempt(ctx context.Context, arg RefundLoginAttemptParams) error {
+	_, err := q.db.ExecContext(ctx, refundLoginAttempt, arg.Threshold, arg.Key)
+	return err
+}
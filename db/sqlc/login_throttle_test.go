@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordLoginAttempt(t *testing.T) {
+	key := "username:" + utils.RandomOwner()
+	arg := RecordLoginAttemptParams{
+		Key:         key,
+		Threshold:   3,
+		LockedUntil: time.Now().Add(15 * time.Minute),
+		ResetBefore: time.Now().Add(-time.Hour),
+		BackoffBase: 0,
+		MaxBackoff:  (15 * time.Minute).Seconds(),
+	}
+
+	throttle, err := testQueries.RecordLoginAttempt(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, key, throttle.Key)
+	require.Equal(t, int32(1), throttle.FailedCount)
+	require.WithinDuration(t, time.Now(), throttle.LastFailedAt, time.Second)
+	require.False(t, throttle.LockedUntil.Valid)
+
+	// the next attempt has to wait for the backoff
+	arg.BackoffBase = 60
+	_, err = testQueries.RecordLoginAttempt(context.Background(), arg)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	arg.BackoffBase = 0
+	throttle, err = testQueries.RecordLoginAttempt(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), throttle.FailedCount)
+
+	// the attempt reaching the threshold locks the key
+	throttle, err = testQueries.RecordLoginAttempt(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), throttle.FailedCount)
+	require.True(t, throttle.LockedUntil.Valid)
+
+	_, err = testQueries.RecordLoginAttempt(context.Background(), arg)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// taking the attempt back lifts the lock again
+	err = testQueries.RefundLoginAttempt(context.Background(), RefundLoginAttemptParams{Key: key, Threshold: arg.Threshold})
+	require.NoError(t, err)
+
+	throttles, err := testQueries.GetLoginThrottles(context.Background(), []string{key})
+	require.NoError(t, err)
+	require.Len(t, throttles, 1)
+	require.Equal(t, int32(2), throttles[0].FailedCount)
+	require.False(t, throttles[0].LockedUntil.Valid)
+
+	// failures before reset_before no longer count
+	arg.ResetBefore = time.Now().Add(time.Minute)
+	throttle, err = testQueries.RecordLoginAttempt(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), throttle.FailedCount)
+}
+
+func TestGetAndDeleteLoginThrottle(t *testing.T) {
+	userKey := "username:" + utils.RandomOwner()
+	ipKey := "ip:" + utils.RandomString(12)
+
+	for _, key := range []string{userKey, ipKey} {
+		_, err := testQueries.RecordLoginAttempt(context.Background(), RecordLoginAttemptParams{
+			Key:         key,
+			Threshold:   1,
+			LockedUntil: time.Now().Add(15 * time.Minute),
+			ResetBefore: time.Now().Add(-time.Hour),
+			MaxBackoff:  (15 * time.Minute).Seconds(),
+		})
+		require.NoError(t, err)
+	}
+
+	throttles, err := testQueries.GetLoginThrottles(context.Background(), []string{userKey, ipKey, "ip:unknown"})
+	require.NoError(t, err)
+	require.Len(t, throttles, 2)
+	for _, throttle := range throttles {
+		require.True(t, throttle.LockedUntil.Valid)
+		require.WithinDuration(t, time.Now().Add(15*time.Minute), throttle.LockedUntil.Time, time.Second)
+	}
+
+	deleted, err := testQueries.DeleteLoginThrottle(context.Background(), userKey)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), deleted)
+
+	deleted, err = testQueries.DeleteLoginThrottle(context.Background(), userKey)
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+}
@@ -5,17 +5,68 @@
 package db
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 type Account struct {
-	ID        int64     `json:"id"`
-	Owner     string    `json:"owner"`
-	Balance   int64     `json:"balance"`
-	Currency  string    `json:"currency"`
+	ID            int64     `json:"id"`
+	Owner         string    `json:"owner"`
+	Balance       int64     `json:"balance"`
+	Currency      string    `json:"currency"`
+	CreatedAt     time.Time `json:"created_at"`
+	AccountNumber string    `json:"account_number"`
+	// closed accounts keep their entries and transfers but cannot move money anymore
+	ClosedAt time.Time `json:"closed_at"`
+}
+
+type ApiKey struct {
+	ID       uuid.UUID `json:"id"`
+	Username string    `json:"username"`
+	Name     string    `json:"name"`
+	// public part of the key, used to look it up
+	Prefix string `json:"prefix"`
+	// sha256 of the secret part of the key, the key itself is never stored
+	SecretHash string       `json:"secret_hash"`
+	Scopes     []string     `json:"scopes"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+	// CIDR ranges the key may be used from, on top of the ones of the user
+	AllowedIps []string `json:"allowed_ips"`
+}
+
+type AuditEvent struct {
+	ID        int64  `json:"id"`
+	EventType string `json:"event_type"`
+	// username the event was done as, not necessarily an existing user for failed logins
+	Actor string `json:"actor"`
+	// what the action was taken on, e.g. the user an admin acted on
+	Target    string    `json:"target"`
+	ClientIp  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent"`
+	RequestID string    `json:"request_id"`
+	Outcome   string    `json:"outcome"`
+	Details   string    `json:"details"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+type EmailVerificationToken struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	// the address the token was sent to, it no longer verifies anything once the user changes email
+	Email string `json:"email"`
+	// sha256 of the emailed token, the token itself is never stored
+	TokenHash string       `json:"token_hash"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
 type Entry struct {
 	ID        int64 `json:"id"`
 	AccountID int64 `json:"account_id"`
@@ -24,6 +75,105 @@ type Entry struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+type Hold struct {
+	ID        int64 `json:"id"`
+	AccountID int64 `json:"account_id"`
+	// must be positive
+	Amount   int64  `json:"amount"`
+	Reason   string `json:"reason"`
+	PlacedBy string `json:"placed_by"`
+	// null means the hold stays until released
+	ExpiresAt  sql.NullTime   `json:"expires_at"`
+	ReleasedAt sql.NullTime   `json:"released_at"`
+	ReleasedBy sql.NullString `json:"released_by"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+type KnownDevice struct {
+	Username string `json:"username"`
+	// sha256 of the user agent and the ip range the user logged in from
+	Fingerprint string    `json:"fingerprint"`
+	UserAgent   string    `json:"user_agent"`
+	IpRange     string    `json:"ip_range"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+type LoginThrottle struct {
+	// username:<username> or ip:<client ip>, unknown usernames are tracked as well
+	Key          string       `json:"key"`
+	FailedCount  int32        `json:"failed_count"`
+	LastFailedAt time.Time    `json:"last_failed_at"`
+	LockedUntil  sql.NullTime `json:"locked_until"`
+}
+
+type OidcAuthRequest struct {
+	// sha256 of the state sent to the provider, the state itself is never stored
+	StateHash    string `json:"state_hash"`
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	// user the identity gets linked to when the flow was started while logged in, empty for a login
+	LinkUsername string    `json:"link_username"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type PasswordResetToken struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	// sha256 of the emailed token, the token itself is never stored
+	TokenHash string       `json:"token_hash"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type RecoveryCode struct {
+	ID        int64        `json:"id"`
+	Username  string       `json:"username"`
+	CodeHash  string       `json:"code_hash"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type RevokedToken struct {
+	// id of a revoked token or session
+	ID       uuid.UUID `json:"id"`
+	Username string    `json:"username"`
+	// the row can be pruned once the token would have expired anyway
+	ExpiresAt time.Time `json:"expires_at"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+type Session struct {
+	// id of the refresh token issued for the session
+	ID        uuid.UUID `json:"id"`
+	Username  string    `json:"username"`
+	UserAgent string    `json:"user_agent"`
+	ClientIp  string    `json:"client_ip"`
+	IsBlocked bool      `json:"is_blocked"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	// name the user gave the device at login, to tell their sessions apart
+	DeviceName string `json:"device_name"`
+	LastSeenIp string `json:"last_seen_ip"`
+	// last time an access token of the session was used, updated at most once a minute
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+type TransactionPin struct {
+	Username string `json:"username"`
+	// hashed like passwords, with the configured password hasher
+	HashedPin           string `json:"hashed_pin"`
+	RequireForTransfers bool   `json:"require_for_transfers"`
+	// wrong pins entered in a row, reset when the pin gets locked or is entered correctly
+	FailedAttempts int32        `json:"failed_attempts"`
+	LockedUntil    sql.NullTime `json:"locked_until"`
+	ChangedAt      time.Time    `json:"changed_at"`
+	CreatedAt      time.Time    `json:"created_at"`
+}
+
 type Transfer struct {
 	ID            int64 `json:"id"`
 	FromAccountID int64 `json:"from_account_id"`
@@ -40,4 +190,56 @@ type User struct {
 	Email             string    `json:"email"`
 	PasswordChangedAt time.Time `json:"password_changed_at"`
 	CreatedAt         time.Time `json:"created_at"`
+	Role              string    `json:"role"`
+	IsEmailVerified   bool      `json:"is_email_verified"`
+	// E.164 format, empty if the user has not set one
+	PhoneNumber string `json:"phone_number"`
+	// set when the personal data of the user is erased, the row stays so the ledger keeps its owner
+	DeletedAt time.Time `json:"deleted_at"`
+	// CIDR ranges the user may call the api from, any address when empty
+	AllowedIps []string `json:"allowed_ips"`
+}
+
+type UserIdentity struct {
+	Provider string `json:"provider"`
+	// sub claim of the id token, stable for the user at the provider
+	Subject     string       `json:"subject"`
+	Username    string       `json:"username"`
+	Email       string       `json:"email"`
+	LastLoginAt sql.NullTime `json:"last_login_at"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+type UserTotp struct {
+	Username string `json:"username"`
+	// AES-256-GCM encrypted with TOTP_ENCRYPTION_KEY
+	SecretEncrypted []byte `json:"secret_encrypted"`
+	// time step of the last accepted code, so a code cannot be used twice
+	LastUsedStep int64 `json:"last_used_step"`
+	// null until the user proves the authenticator app is set up, login does not ask for a code before
+	ConfirmedAt sql.NullTime `json:"confirmed_at"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+type WebauthnCeremony struct {
+	ID             uuid.UUID `json:"id"`
+	Ceremony       string    `json:"ceremony"`
+	Username       string    `json:"username"`
+	CredentialName string    `json:"credential_name"`
+	// challenge of a registration or login in progress, used up when it completes
+	SessionData json.RawMessage `json:"session_data"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type WebauthnCredential struct {
+	ID       []byte `json:"id"`
+	Username string `json:"username"`
+	// random id the authenticator stores for the user, the same for all the passkeys of a user
+	UserHandle []byte `json:"user_handle"`
+	Name       string `json:"name"`
+	// public key, sign count and flags of the credential as kept by go-webauthn
+	Credential json.RawMessage `json:"credential"`
+	LastUsedAt sql.NullTime    `json:"last_used_at"`
+	CreatedAt  time.Time       `json:"created_at"`
 }
@@ -0,0 +1,91 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: oidc_auth_request.sql
+
+package db
+
+import (
+	"context"
+	"time"
+)
+
+const createOIDCAuthRequest = `-- name: CreateOIDCAuthRequest :one
+INSERT INTO oidc_auth_requests (
+  state_hash,
+  provider,
+  nonce,
+  code_verifier,
+  link_username,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+) RETURNING state_hash, provider, nonce, code_verifier, link_username, expires_at, created_at
+`
+
+type CreateOIDCAuthRequestParams struct {
+	StateHash    string    `json:"state_hash"`
+	Provider     string    `json:"provider"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"code_verifier"`
+	LinkUsername string    `json:"link_username"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreateOIDCAuthRequest(ctx context.Context, arg CreateOIDCAuthRequestParams) (OidcAuthRequest, error) {
+	row := q.db.QueryRowContext(ctx, createOIDCAuthRequest,
+		arg.StateHash,
+		arg.Provider,
+		arg.Nonce,
+		arg.CodeVerifier,
+		arg.LinkUsername,
+		arg.ExpiresAt,
+	)
+	var i OidcAuthRequest
+	err := row.Scan(
+		&i.StateHash,
+		&i.Provider,
+		&i.Nonce,
+		&i.CodeVerifier,
+		&i.LinkUsername,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteExpiredOIDCAuthRequests = `-- name: DeleteExpiredOIDCAuthRequests :exec
+DELETE FROM oidc_auth_requests
+WHERE expires_at <= now()
+`
+
+func (q *Queries) DeleteExpiredOIDCAuthRequests(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredOIDCAuthRequests)
+	return err
+}
+
+const useOIDCAuthRequest = `-- name: UseOIDCAuthRequest :one
+DELETE FROM oidc_auth_requests
+WHERE state_hash = $1 AND provider = $2 AND expires_at > now()
+RETURNING state_hash, provider, nonce, code_verifier, link_username, expires_at, created_at
+`
+
+type UseOIDCAuthRequestParams struct {
+	StateHash string `json:"state_hash"`
+	Provider  string `json:"provider"`
+}
+
+func (q *Queries) UseOIDCAuthRequest(ctx context.Context, arg UseOIDCAuthRequestParams) (OidcAuthRequest, error) {
+	row := q.db.QueryRowContext(ctx, useOIDCAuthRequest, arg.StateHash, arg.Provider)
+	var i OidcAuthRequest
+	err := row.Scan(
+		&i.StateHash,
+		&i.Provider,
+		&i.Nonce,
+		&i.CodeVerifier,
+		&i.LinkUsername,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomPasswordResetToken(t *testing.T, user User, expiresAt time.Time) PasswordResetToken {
+	_, tokenHash, err := utils.NewSecretToken()
+	require.NoError(t, err)
+
+	arg := CreatePasswordResetTokenParams{
+		Username:  user.Username,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	}
+
+	resetToken, err := testQueries.CreatePasswordResetToken(context.Background(), arg)
+	require.NoError(t, err)
+	require.NotZero(t, resetToken.ID)
+	require.Equal(t, arg.Username, resetToken.Username)
+	require.Equal(t, arg.TokenHash, resetToken.TokenHash)
+	require.WithinDuration(t, arg.ExpiresAt, resetToken.ExpiresAt, time.Second)
+	require.False(t, resetToken.UsedAt.Valid)
+
+	return resetToken
+}
+
+func TestUsePasswordResetToken(t *testing.T) {
+	user := createRandomUser(t)
+	resetToken := createRandomPasswordResetToken(t, user, time.Now().Add(time.Hour))
+
+	usedToken, err := testQueries.UsePasswordResetToken(context.Background(), resetToken.TokenHash)
+	require.NoError(t, err)
+	require.Equal(t, resetToken.ID, usedToken.ID)
+	require.True(t, usedToken.UsedAt.Valid)
+
+	// a token can only be used once
+	_, err = testQueries.UsePasswordResetToken(context.Background(), resetToken.TokenHash)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestUseExpiredPasswordResetToken(t *testing.T) {
+	user := createRandomUser(t)
+	resetToken := createRandomPasswordResetToken(t, user, time.Now().Add(-time.Minute))
+
+	_, err := testQueries.UsePasswordResetToken(context.Background(), resetToken.TokenHash)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -6,24 +6,129 @@ package db
 
 import (
 	"context"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type Querier interface {
 	AddAccountBalance(ctx context.Context, arg AddAccountBalanceParams) (Account, error)
+	// erases the personal data of the user, the username stays as the pseudonymous
+	// owner of the ledger. Bumping password_changed_at rejects all issued tokens.
+	AnonymizeUser(ctx context.Context, username string) (User, error)
+	BlockSession(ctx context.Context, id uuid.UUID) (Session, error)
+	BlockUserSession(ctx context.Context, arg BlockUserSessionParams) (Session, error)
+	BlockUserSessions(ctx context.Context, username string) ([]Session, error)
+	CloseOwnerAccounts(ctx context.Context, owner string) error
+	ConfirmUserTOTP(ctx context.Context, arg ConfirmUserTOTPParams) (UserTotp, error)
+	// records a single-use token as used, no row is inserted if it already was
+	ConsumeToken(ctx context.Context, arg ConsumeTokenParams) (int64, error)
+	CountKnownDevices(ctx context.Context, username string) (int64, error)
+	CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error)
 	CreateAccount(ctx context.Context, arg CreateAccountParams) (Account, error)
+	CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) (AuditEvent, error)
+	CreateEmailVerificationToken(ctx context.Context, arg CreateEmailVerificationTokenParams) (EmailVerificationToken, error)
 	CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry, error)
+	CreateHold(ctx context.Context, arg CreateHoldParams) (Hold, error)
+	CreateKnownDevice(ctx context.Context, arg CreateKnownDeviceParams) (KnownDevice, error)
+	CreateOIDCAuthRequest(ctx context.Context, arg CreateOIDCAuthRequestParams) (OidcAuthRequest, error)
+	CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) (PasswordResetToken, error)
+	CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) (RecoveryCode, error)
+	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
+	CreateTransactionPIN(ctx context.Context, arg CreateTransactionPINParams) (TransactionPin, error)
 	CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) (UserIdentity, error)
+	CreateWebAuthnCeremony(ctx context.Context, arg CreateWebAuthnCeremonyParams) (WebauthnCeremony, error)
+	CreateWebAuthnCredential(ctx context.Context, arg CreateWebAuthnCredentialParams) (WebauthnCredential, error)
 	DeleteAccount(ctx context.Context, id int64) error
+	DeleteExpiredOIDCAuthRequests(ctx context.Context) error
+	DeleteExpiredRevokedTokens(ctx context.Context) error
+	DeleteExpiredWebAuthnCeremonies(ctx context.Context) error
+	DeleteLoginThrottle(ctx context.Context, key string) (int64, error)
+	DeleteRecoveryCodes(ctx context.Context, username string) error
+	DeleteUserAPIKeys(ctx context.Context, username string) error
+	DeleteUserEmailVerificationTokens(ctx context.Context, username string) error
+	DeleteUserIdentities(ctx context.Context, username string) error
+	DeleteUserKnownDevices(ctx context.Context, username string) error
+	DeleteUserPasswordResetTokens(ctx context.Context, username string) error
+	DeleteUserSessions(ctx context.Context, username string) error
+	DeleteUserTOTP(ctx context.Context, username string) error
+	DeleteUserTransactionPIN(ctx context.Context, username string) error
+	DeleteUserWebAuthnCredentials(ctx context.Context, username string) error
+	DeleteWebAuthnCredential(ctx context.Context, arg DeleteWebAuthnCredentialParams) (int64, error)
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (GetAPIKeyByPrefixRow, error)
 	GetAccount(ctx context.Context, id int64) (Account, error)
+	GetAccountByNumber(ctx context.Context, accountNumber string) (Account, error)
 	GetAccountForUpdate(ctx context.Context, id int64) (Account, error)
+	GetActiveHoldsAmount(ctx context.Context, accountID int64) (int64, error)
 	GetEntry(ctx context.Context, id int64) (Entry, error)
+	GetHold(ctx context.Context, id int64) (Hold, error)
+	GetLatestEmailVerificationToken(ctx context.Context, username string) (EmailVerificationToken, error)
+	GetLoginThrottles(ctx context.Context, keys []string) ([]LoginThrottle, error)
+	GetSession(ctx context.Context, id uuid.UUID) (Session, error)
+	GetTransactionPIN(ctx context.Context, username string) (TransactionPin, error)
 	GetTransfer(ctx context.Context, id int64) (Transfer, error)
 	GetUser(ctx context.Context, username string) (User, error)
+	GetUserAuthInfo(ctx context.Context, username string) (GetUserAuthInfoRow, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (UserIdentity, error)
+	GetUserTOTP(ctx context.Context, username string) (UserTotp, error)
+	GetWebAuthnCredential(ctx context.Context, id []byte) (WebauthnCredential, error)
+	ListAPIKeys(ctx context.Context, username string) ([]ApiKey, error)
 	ListAccounts(ctx context.Context, arg ListAccountsParams) ([]Account, error)
+	ListActiveHolds(ctx context.Context, accountID int64) ([]Hold, error)
+	ListActiveUserSessions(ctx context.Context, username string) ([]Session, error)
+	// every filter left null matches all events, the newest come first
+	ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]AuditEvent, error)
 	ListEntries(ctx context.Context, arg ListEntriesParams) ([]Entry, error)
+	ListHolds(ctx context.Context, arg ListHoldsParams) ([]Hold, error)
+	ListOwnerAccounts(ctx context.Context, owner string) ([]Account, error)
+	ListOwnerAccountsForUpdate(ctx context.Context, owner string) ([]Account, error)
+	ListOwnerEntries(ctx context.Context, owner string) ([]Entry, error)
+	ListOwnerTransfers(ctx context.Context, owner string) ([]Transfer, error)
+	ListRevokedTokens(ctx context.Context, revokedSince time.Time) ([]RevokedToken, error)
 	ListTransfers(ctx context.Context, arg ListTransfersParams) ([]Transfer, error)
+	ListUserIdentities(ctx context.Context, username string) ([]UserIdentity, error)
+	ListWebAuthnCredentials(ctx context.Context, username string) ([]WebauthnCredential, error)
+	NextAccountNumberSerial(ctx context.Context) (int64, error)
+	// counts the attempt before the password is checked, only if the key is neither
+	// locked nor inside its backoff, so concurrent attempts cannot all get through.
+	// No row is returned when the attempt is throttled.
+	RecordLoginAttempt(ctx context.Context, arg RecordLoginAttemptParams) (LoginThrottle, error)
+	// counts an attempt before the pin is compared, so that concurrent guesses cannot
+	// get past max_attempts. The attempt that reaches max_attempts locks the pin, and
+	// while it is locked no row is returned.
+	RecordTransactionPINAttempt(ctx context.Context, arg RecordTransactionPINAttemptParams) (TransactionPin, error)
+	// takes back an attempt that turned out to be a successful login
+	RefundLoginAttempt(ctx context.Context, arg RefundLoginAttemptParams) error
+	// replaces the hash of the same password, so password_changed_at stays as it is,
+	// unless the password was changed since the old hash was read
+	RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) error
+	ReleaseHold(ctx context.Context, arg ReleaseHoldParams) (Hold, error)
+	// takes back the attempts counted before a correct pin
+	ResetTransactionPINFailures(ctx context.Context, username string) error
+	RevokeAPIKey(ctx context.Context, arg RevokeAPIKeyParams) (ApiKey, error)
+	RevokeToken(ctx context.Context, arg RevokeTokenParams) error
+	SetTransactionPINRequired(ctx context.Context, arg SetTransactionPINRequiredParams) (TransactionPin, error)
+	TouchAPIKey(ctx context.Context, id uuid.UUID) error
+	TouchKnownDevice(ctx context.Context, arg TouchKnownDeviceParams) (int64, error)
+	TouchSession(ctx context.Context, arg TouchSessionParams) error
+	TouchUserIdentity(ctx context.Context, arg TouchUserIdentityParams) error
 	UpdateAccount(ctx context.Context, arg UpdateAccountParams) (Account, error)
+	UpdateTransactionPIN(ctx context.Context, arg UpdateTransactionPINParams) (TransactionPin, error)
+	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
+	UpdateUserAllowedIPs(ctx context.Context, arg UpdateUserAllowedIPsParams) (User, error)
+	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error)
+	UpsertUserTOTP(ctx context.Context, arg UpsertUserTOTPParams) (UserTotp, error)
+	UseEmailVerificationToken(ctx context.Context, tokenHash string) (EmailVerificationToken, error)
+	UseOIDCAuthRequest(ctx context.Context, arg UseOIDCAuthRequestParams) (OidcAuthRequest, error)
+	UsePasswordResetToken(ctx context.Context, tokenHash string) (PasswordResetToken, error)
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (RecoveryCode, error)
+	UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (UserTotp, error)
+	UseWebAuthnCeremony(ctx context.Context, arg UseWebAuthnCeremonyParams) (WebauthnCeremony, error)
+	UseWebAuthnCredential(ctx context.Context, arg UseWebAuthnCredentialParams) error
+	VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error)
 }
 
 var _ Querier = (*Queries)(nil)
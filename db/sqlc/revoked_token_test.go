@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevokeToken(t *testing.T) {
+	user := createRandomUser(t)
+	since := time.Now().Add(-time.Minute)
+
+	arg := RevokeTokenParams{
+		ID:        uuid.New(),
+		Username:  user.Username,
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+
+	err := testQueries.RevokeToken(context.Background(), arg)
+	require.NoError(t, err)
+
+	// revoking the same token twice is a no-op
+	err = testQueries.RevokeToken(context.Background(), arg)
+	require.NoError(t, err)
+
+	revokedTokens, err := testQueries.ListRevokedTokens(context.Background(), since)
+	require.NoError(t, err)
+
+	found := false
+	for _, revokedToken := range revokedTokens {
+		if revokedToken.ID == arg.ID {
+			found = true
+			require.Equal(t, arg.Username, revokedToken.Username)
+		}
+	}
+	require.True(t, found)
+}
+
+func TestDeleteExpiredRevokedTokens(t *testing.T) {
+	user := createRandomUser(t)
+	since := time.Now().Add(-time.Minute)
+
+	arg := RevokeTokenParams{
+		ID:        uuid.New(),
+		Username:  user.Username,
+		ExpiresAt: time.Now().Add(-time.Second),
+	}
+
+	err := testQueries.RevokeToken(context.Background(), arg)
+	require.NoError(t, err)
+
+	err = testQueries.DeleteExpiredRevokedTokens(context.Background())
+	require.NoError(t, err)
+
+	revokedTokens, err := testQueries.ListRevokedTokens(context.Background(), since)
+	require.NoError(t, err)
+	for _, revokedToken := range revokedTokens {
+		require.NotEqual(t, arg.ID, revokedToken.ID)
+	}
+}
+
+func TestConsumeToken(t *testing.T) {
+	user := createRandomUser(t)
+
+	arg := ConsumeTokenParams{
+		ID:        uuid.New(),
+		Username:  user.Username,
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+
+	inserted, err := testQueries.ConsumeToken(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), inserted)
+
+	// the second use finds the token already there
+	inserted, err = testQueries.ConsumeToken(context.Background(), arg)
+	require.NoError(t, err)
+	require.Zero(t, inserted)
+}
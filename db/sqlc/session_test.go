@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomSession(t *testing.T, user User) Session {
+	arg := CreateSessionParams{
+		ID:         uuid.New(),
+		Username:   user.Username,
+		UserAgent:  "Go-http-client/1.1",
+		ClientIp:   "127.0.0.1",
+		IsBlocked:  false,
+		ExpiresAt:  time.Now().Add(time.Hour),
+		DeviceName: utils.RandomString(6),
+	}
+
+	session, err := testQueries.CreateSession(context.Background(), arg)
+	require.NoError(t, err)
+	require.NotEmpty(t, session)
+
+	require.Equal(t, arg.ID, session.ID)
+	require.Equal(t, arg.Username, session.Username)
+	require.Equal(t, arg.UserAgent, session.UserAgent)
+	require.Equal(t, arg.ClientIp, session.ClientIp)
+	require.False(t, session.IsBlocked)
+	require.Equal(t, arg.DeviceName, session.DeviceName)
+	require.Equal(t, arg.ClientIp, session.LastSeenIp)
+	require.NotZero(t, session.LastSeenAt)
+	require.WithinDuration(t, arg.ExpiresAt, session.ExpiresAt, time.Second)
+	require.NotZero(t, session.CreatedAt)
+
+	return session
+}
+
+func TestCreateSession(t *testing.T) {
+	createRandomSession(t, createRandomUser(t))
+}
+
+func TestGetSession(t *testing.T) {
+	session1 := createRandomSession(t, createRandomUser(t))
+
+	session2, err := testQueries.GetSession(context.Background(), session1.ID)
+	require.NoError(t, err)
+	require.Equal(t, session1.ID, session2.ID)
+	require.Equal(t, session1.Username, session2.Username)
+	require.WithinDuration(t, session1.ExpiresAt, session2.ExpiresAt, time.Second)
+}
+
+func TestBlockUserSessions(t *testing.T) {
+	user := createRandomUser(t)
+	session1 := createRandomSession(t, user)
+	session2 := createRandomSession(t, user)
+
+	blocked, err := testQueries.BlockSession(context.Background(), session1.ID)
+	require.NoError(t, err)
+	require.True(t, blocked.IsBlocked)
+
+	// only the sessions that were still active are returned
+	sessions, err := testQueries.BlockUserSessions(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Equal(t, session2.ID, sessions[0].ID)
+	require.True(t, sessions[0].IsBlocked)
+}
+
+func TestBlockUserSession(t *testing.T) {
+	user := createRandomUser(t)
+	session := createRandomSession(t, user)
+
+	// another user cannot block the session
+	_, err := testQueries.BlockUserSession(context.Background(), BlockUserSessionParams{
+		ID:       session.ID,
+		Username: createRandomUser(t).Username,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	blocked, err := testQueries.BlockUserSession(context.Background(), BlockUserSessionParams{
+		ID:       session.ID,
+		Username: user.Username,
+	})
+	require.NoError(t, err)
+	require.True(t, blocked.IsBlocked)
+
+	_, err = testQueries.BlockUserSession(context.Background(), BlockUserSessionParams{
+		ID:       session.ID,
+		Username: user.Username,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestListActiveUserSessions(t *testing.T) {
+	user := createRandomUser(t)
+	session1 := createRandomSession(t, user)
+	session2 := createRandomSession(t, user)
+	session3 := createRandomSession(t, user)
+
+	_, err := testQueries.BlockSession(context.Background(), session3.ID)
+	require.NoError(t, err)
+
+	sessions, err := testQueries.ListActiveUserSessions(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+
+	ids := []uuid.UUID{sessions[0].ID, sessions[1].ID}
+	require.ElementsMatch(t, []uuid.UUID{session1.ID, session2.ID}, ids)
+}
+
+func TestTouchSession(t *testing.T) {
+	session1 := createRandomSession(t, createRandomUser(t))
+
+	// the same client within a minute does not update the session
+	err := testQueries.TouchSession(context.Background(), TouchSessionParams{
+		ID:       session1.ID,
+		ClientIp: session1.ClientIp,
+	})
+	require.NoError(t, err)
+
+	session2, err := testQueries.GetSession(context.Background(), session1.ID)
+	require.NoError(t, err)
+	require.Equal(t, session1.LastSeenAt, session2.LastSeenAt)
+
+	// a new address is recorded right away
+	err = testQueries.TouchSession(context.Background(), TouchSessionParams{
+		ID:       session1.ID,
+		ClientIp: "10.0.0.1",
+	})
+	require.NoError(t, err)
+
+	session3, err := testQueries.GetSession(context.Background(), session1.ID)
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.1", session3.LastSeenIp)
+	require.False(t, session3.LastSeenAt.Before(session2.LastSeenAt))
+}
@@ -3,12 +3,27 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
+)
+
+var (
+	// ErrInsufficientFunds is returned by TransferTx when the amount exceeds the available balance
+	ErrInsufficientFunds = errors.New("insufficient available balance")
+	// ErrAccountClosed is returned by TransferTx when one of the accounts was closed
+	ErrAccountClosed = errors.New("account is closed")
+	// ErrAccountNotEmpty is returned by DeleteUserTx when an account of the user still has a balance
+	ErrAccountNotEmpty = errors.New("account balance must be zero before it can be closed")
 )
 
 type Store interface {
 	Querier
 	TransferTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error)
+	ResetPasswordTx(ctx context.Context, arg ResetPasswordTxParams) (User, error)
+	VerifyEmailTx(ctx context.Context, tokenHash string) (User, error)
+	EnableTOTPTx(ctx context.Context, arg EnableTOTPTxParams) (UserTotp, error)
+	DeleteUserTx(ctx context.Context, username string) (User, error)
 }
 type SQLStore struct {
 	*Queries
@@ -96,7 +111,22 @@ func (store *SQLStore) TransferTx(ctx context.Context, arg TransferTxParams) (Tr
 			result.ToAccount, result.FromAccount, err = addMoney(ctx, q, arg.ToAccountID, arg.Amount, arg.FromAccountID, -arg.Amount)
 		}
 
-		return err
+		if err != nil {
+			return err
+		}
+
+		// the from account row is locked by now, so the balance left after the
+		// transfer can be safely compared against the active holds on it
+		heldAmount, err := q.GetActiveHoldsAmount(ctx, arg.FromAccountID)
+		if err != nil {
+			return err
+		}
+
+		if result.FromAccount.Balance < heldAmount {
+			return ErrInsufficientFunds
+		}
+
+		return nil
 	})
 
 	return result, err
@@ -115,12 +145,180 @@ func addMoney(
 		Amount: amount1,
 	})
 	if err != nil {
-		return
+		return account1, account2, closedAccountErr(err)
 	}
 
 	account2, err = q.AddAccountBalance(ctx, AddAccountBalanceParams{
 		ID:     accountID2,
 		Amount: amount2,
 	})
-	return
+	return account1, account2, closedAccountErr(err)
+}
+
+// closedAccountErr turns the no rows error of AddAccountBalance, which skips closed accounts, into ErrAccountClosed
+func closedAccountErr(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrAccountClosed
+	}
+	return err
+}
+
+type ResetPasswordTxParams struct {
+	TokenHash         string    `json:"token_hash"`
+	HashedPassword    string    `json:"hashed_password"`
+	PasswordChangedAt time.Time `json:"password_changed_at"`
+}
+
+// ResetPasswordTx uses up the reset token and sets the new password of its user.
+// The passkeys and linked identities log in without the password, and a second
+// factor would keep the owner out, so they are deleted too, along with the
+// recovery codes, in case they were added by whoever the reset locks out.
+// It returns sql.ErrNoRows if the token is unknown, expired or already used.
+func (store *SQLStore) ResetPasswordTx(ctx context.Context, arg ResetPasswordTxParams) (User, error) {
+	var user User
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		resetToken, err := q.UsePasswordResetToken(ctx, arg.TokenHash)
+		if err != nil {
+			return err
+		}
+
+		user, err = q.UpdateUserPassword(ctx, UpdateUserPasswordParams{
+			HashedPassword:    arg.HashedPassword,
+			PasswordChangedAt: arg.PasswordChangedAt,
+			Username:          resetToken.Username,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, deleteCredentials := range []func(context.Context, string) error{
+			q.DeleteUserWebAuthnCredentials,
+			q.DeleteUserIdentities,
+			q.DeleteUserTOTP,
+			q.DeleteRecoveryCodes,
+		} {
+			err = deleteCredentials(ctx, user.Username)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return user, err
+}
+
+// VerifyEmailTx uses up the verification token and marks the email of its user as verified.
+// It returns sql.ErrNoRows if the token is unknown, expired or already used,
+// or if the user has changed email since the token was sent.
+func (store *SQLStore) VerifyEmailTx(ctx context.Context, tokenHash string) (User, error) {
+	var user User
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		verificationToken, err := q.UseEmailVerificationToken(ctx, tokenHash)
+		if err != nil {
+			return err
+		}
+
+		user, err = q.VerifyUserEmail(ctx, VerifyUserEmailParams{
+			Username: verificationToken.Username,
+			Email:    verificationToken.Email,
+		})
+		return err
+	})
+
+	return user, err
+}
+
+type EnableTOTPTxParams struct {
+	Username           string   `json:"username"`
+	Step               int64    `json:"step"`
+	RecoveryCodeHashes []string `json:"recovery_code_hashes"`
+}
+
+// EnableTOTPTx confirms the pending totp secret of the user and replaces their recovery codes.
+// It returns sql.ErrNoRows if there is no pending secret.
+func (store *SQLStore) EnableTOTPTx(ctx context.Context, arg EnableTOTPTxParams) (UserTotp, error) {
+	var userTOTP UserTotp
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		userTOTP, err = q.ConfirmUserTOTP(ctx, ConfirmUserTOTPParams{
+			Step:     arg.Step,
+			Username: arg.Username,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = q.DeleteRecoveryCodes(ctx, arg.Username)
+		if err != nil {
+			return err
+		}
+
+		for _, codeHash := range arg.RecoveryCodeHashes {
+			_, err = q.CreateRecoveryCode(ctx, CreateRecoveryCodeParams{
+				Username: arg.Username,
+				CodeHash: codeHash,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return userTOTP, err
+}
+
+// DeleteUserTx closes all the accounts of the user, deletes their credentials and
+// sessions, and erases their personal data. Entries and transfers are kept.
+// It returns ErrAccountNotEmpty if an account still has a balance, and
+// sql.ErrNoRows if the user does not exist or was already deleted.
+func (store *SQLStore) DeleteUserTx(ctx context.Context, username string) (User, error) {
+	var user User
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		// locking the accounts keeps transfers from changing the balances checked here
+		accounts, err := q.ListOwnerAccountsForUpdate(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		for _, account := range accounts {
+			if account.Balance != 0 {
+				return fmt.Errorf("account %s: %w", account.AccountNumber, ErrAccountNotEmpty)
+			}
+		}
+
+		err = q.CloseOwnerAccounts(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		for _, deleteUserRows := range []func(context.Context, string) error{
+			q.DeleteUserSessions,
+			q.DeleteUserAPIKeys,
+			q.DeleteUserIdentities,
+			q.DeleteUserWebAuthnCredentials,
+			q.DeleteUserTOTP,
+			q.DeleteUserTransactionPIN,
+			q.DeleteUserKnownDevices,
+			q.DeleteRecoveryCodes,
+			q.DeleteUserPasswordResetTokens,
+			q.DeleteUserEmailVerificationTokens,
+		} {
+			err = deleteUserRows(ctx, username)
+			if err != nil {
+				return err
+			}
+		}
+
+		user, err = q.AnonymizeUser(ctx, username)
+		return err
+	})
+
+	return user, err
 }
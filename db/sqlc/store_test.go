@@ -2,8 +2,11 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"testing"
+	"time"
 
+	"github.com/andreanpradanaa/simple-bank-app/utils"
 	"github.com/stretchr/testify/require"
 )
 
@@ -143,3 +146,185 @@ func TestTransferTxDeadlock(t *testing.T) {
 	require.Equal(t, updatedAccount1.Balance, account1.Balance)
 	require.Equal(t, updatedAccount2.Balance, account2.Balance)
 }
+
+func TestTransferTxHeldFunds(t *testing.T) {
+	store := NewStore(testDB)
+
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccount(t)
+	hold := createRandomHold(t, account1, sql.NullTime{})
+
+	available := account1.Balance - hold.Amount
+
+	_, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        available + 1,
+	})
+	require.ErrorIs(t, err, ErrInsufficientFunds)
+
+	result, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        available,
+	})
+	require.NoError(t, err)
+	require.Equal(t, hold.Amount, result.FromAccount.Balance)
+}
+
+func TestResetPasswordTx(t *testing.T) {
+	store := NewStore(testDB)
+
+	user := createRandomUser(t)
+	resetToken := createRandomPasswordResetToken(t, user, time.Now().Add(time.Hour))
+	createRandomWebAuthnCredential(t, user)
+	createRandomUserIdentity(t, user, "corp")
+	createRandomUserTOTP(t, user)
+	_, err := testQueries.CreateRecoveryCode(context.Background(), CreateRecoveryCodeParams{
+		Username: user.Username,
+		CodeHash: utils.HashSecretToken(utils.RandomString(10)),
+	})
+	require.NoError(t, err)
+
+	hashedPassword, err := utils.HashPassword(utils.RandomString(6))
+	require.NoError(t, err)
+
+	arg := ResetPasswordTxParams{
+		TokenHash:         resetToken.TokenHash,
+		HashedPassword:    hashedPassword,
+		PasswordChangedAt: time.Now(),
+	}
+
+	updatedUser, err := store.ResetPasswordTx(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, user.Username, updatedUser.Username)
+	require.Equal(t, hashedPassword, updatedUser.HashedPassword)
+	require.WithinDuration(t, arg.PasswordChangedAt, updatedUser.PasswordChangedAt, time.Second)
+
+	// the credentials that skip the password are gone with the old password
+	credentials, err := testQueries.ListWebAuthnCredentials(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Empty(t, credentials)
+
+	identities, err := testQueries.ListUserIdentities(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Empty(t, identities)
+
+	_, err = testQueries.GetUserTOTP(context.Background(), user.Username)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = testQueries.UseRecoveryCode(context.Background(), UseRecoveryCodeParams{Username: user.Username})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = store.ResetPasswordTx(context.Background(), arg)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestVerifyEmailTx(t *testing.T) {
+	store := NewStore(testDB)
+
+	user := createRandomUser(t)
+	require.False(t, user.IsEmailVerified)
+	verificationToken := createRandomEmailVerificationToken(t, user, time.Now().Add(time.Hour))
+
+	verifiedUser, err := store.VerifyEmailTx(context.Background(), verificationToken.TokenHash)
+	require.NoError(t, err)
+	require.Equal(t, user.Username, verifiedUser.Username)
+	require.True(t, verifiedUser.IsEmailVerified)
+
+	_, err = store.VerifyEmailTx(context.Background(), verificationToken.TokenHash)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestEnableTOTPTx(t *testing.T) {
+	store := NewStore(testDB)
+
+	user := createRandomUser(t)
+	createRandomUserTOTP(t, user)
+
+	oldCodeHash := utils.HashSecretToken(utils.RandomString(10))
+	_, err := testQueries.CreateRecoveryCode(context.Background(), CreateRecoveryCodeParams{
+		Username: user.Username,
+		CodeHash: oldCodeHash,
+	})
+	require.NoError(t, err)
+
+	arg := EnableTOTPTxParams{
+		Username: user.Username,
+		Step:     100,
+		RecoveryCodeHashes: []string{
+			utils.HashSecretToken(utils.RandomString(10)),
+			utils.HashSecretToken(utils.RandomString(10)),
+		},
+	}
+
+	userTOTP, err := store.EnableTOTPTx(context.Background(), arg)
+	require.NoError(t, err)
+	require.True(t, userTOTP.ConfirmedAt.Valid)
+	require.Equal(t, arg.Step, userTOTP.LastUsedStep)
+
+	// the recovery codes issued before are replaced
+	_, err = testQueries.UseRecoveryCode(context.Background(), UseRecoveryCodeParams{Username: user.Username, CodeHash: oldCodeHash})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = testQueries.UseRecoveryCode(context.Background(), UseRecoveryCodeParams{Username: user.Username, CodeHash: arg.RecoveryCodeHashes[0]})
+	require.NoError(t, err)
+
+	_, err = store.EnableTOTPTx(context.Background(), arg)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestDeleteUserTx(t *testing.T) {
+	store := NewStore(testDB)
+
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccount(t)
+	user, err := testQueries.GetUser(context.Background(), account1.Owner)
+	require.NoError(t, err)
+
+	transfer := createRandomTransfer(t, account1, account2)
+	session := createRandomSession(t, user)
+	createRandomAPIKey(t, user)
+
+	// money left on the account blocks the deletion
+	_, err = store.DeleteUserTx(context.Background(), user.Username)
+	require.ErrorIs(t, err, ErrAccountNotEmpty)
+
+	_, err = testQueries.UpdateAccount(context.Background(), UpdateAccountParams{ID: account1.ID, Balance: 0})
+	require.NoError(t, err)
+
+	deletedUser, err := store.DeleteUserTx(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Equal(t, user.Username, deletedUser.Username)
+	require.Empty(t, deletedUser.FullName)
+	require.Empty(t, deletedUser.HashedPassword)
+	require.Empty(t, deletedUser.PhoneNumber)
+	require.NotEqual(t, user.Email, deletedUser.Email)
+	require.False(t, deletedUser.DeletedAt.IsZero())
+	require.True(t, deletedUser.PasswordChangedAt.After(user.PasswordChangedAt))
+
+	closedAccount, err := testQueries.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.False(t, closedAccount.ClosedAt.IsZero())
+
+	// the ledger is kept
+	_, err = testQueries.GetTransfer(context.Background(), transfer.ID)
+	require.NoError(t, err)
+
+	_, err = testQueries.GetSession(context.Background(), session.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	apiKeys, err := testQueries.ListAPIKeys(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Empty(t, apiKeys)
+
+	_, err = store.DeleteUserTx(context.Background(), user.Username)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// closed accounts cannot receive money anymore
+	_, err = store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account2.ID,
+		ToAccountID:   account1.ID,
+		Amount:        1,
+	})
+	require.ErrorIs(t, err, ErrAccountClosed)
+}
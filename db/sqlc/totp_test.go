@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomUserTOTP(t *testing.T, user User) UserTotp {
+	arg := UpsertUserTOTPParams{
+		Username:        user.Username,
+		SecretEncrypted: []byte(utils.RandomString(32)),
+	}
+
+	userTOTP, err := testQueries.UpsertUserTOTP(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Username, userTOTP.Username)
+	require.Equal(t, arg.SecretEncrypted, userTOTP.SecretEncrypted)
+	require.Zero(t, userTOTP.LastUsedStep)
+	require.False(t, userTOTP.ConfirmedAt.Valid)
+
+	return userTOTP
+}
+
+func TestUpsertUserTOTP(t *testing.T) {
+	user := createRandomUser(t)
+	createRandomUserTOTP(t, user)
+
+	// enrolling again before confirming replaces the pending secret
+	userTOTP := createRandomUserTOTP(t, user)
+
+	_, err := testQueries.ConfirmUserTOTP(context.Background(), ConfirmUserTOTPParams{Step: 100, Username: user.Username})
+	require.NoError(t, err)
+
+	// once confirmed, the secret cannot be replaced
+	_, err = testQueries.UpsertUserTOTP(context.Background(), UpsertUserTOTPParams{
+		Username:        user.Username,
+		SecretEncrypted: []byte(utils.RandomString(32)),
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	got, err := testQueries.GetUserTOTP(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Equal(t, userTOTP.SecretEncrypted, got.SecretEncrypted)
+	require.True(t, got.ConfirmedAt.Valid)
+}
+
+func TestUseTOTPStep(t *testing.T) {
+	user := createRandomUser(t)
+	createRandomUserTOTP(t, user)
+
+	userTOTP, err := testQueries.UseTOTPStep(context.Background(), UseTOTPStepParams{Step: 100, Username: user.Username})
+	require.NoError(t, err)
+	require.Equal(t, int64(100), userTOTP.LastUsedStep)
+
+	// the same or an older step is a replay
+	_, err = testQueries.UseTOTPStep(context.Background(), UseTOTPStepParams{Step: 100, Username: user.Username})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = testQueries.UseTOTPStep(context.Background(), UseTOTPStepParams{Step: 99, Username: user.Username})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = testQueries.UseTOTPStep(context.Background(), UseTOTPStepParams{Step: 101, Username: user.Username})
+	require.NoError(t, err)
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	user := createRandomUser(t)
+	codeHash := utils.HashSecretToken(utils.RandomString(10))
+
+	recoveryCode, err := testQueries.CreateRecoveryCode(context.Background(), CreateRecoveryCodeParams{
+		Username: user.Username,
+		CodeHash: codeHash,
+	})
+	require.NoError(t, err)
+	require.False(t, recoveryCode.UsedAt.Valid)
+
+	arg := UseRecoveryCodeParams{Username: user.Username, CodeHash: codeHash}
+	usedCode, err := testQueries.UseRecoveryCode(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, recoveryCode.ID, usedCode.ID)
+	require.True(t, usedCode.UsedAt.Valid)
+
+	_, err = testQueries.UseRecoveryCode(context.Background(), arg)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
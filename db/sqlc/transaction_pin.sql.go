@@ -0,0 +1,179 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: transaction_pin.sql
+
+package db
+
+import (
+	"context"
+	"time"
+)
+
+const createTransactionPIN = `-- name: CreateTransactionPIN :one
+INSERT INTO transaction_pins (
+  username,
+  hashed_pin
+) VALUES (
+  $1, $2
+) RETURNING username, hashed_pin, require_for_transfers, failed_attempts, locked_until, changed_at, created_at
+`
+
+type CreateTransactionPINParams struct {
+	Username  string `json:"username"`
+	HashedPin string `json:"hashed_pin"`
+}
+
+func (q *Queries) CreateTransactionPIN(ctx context.Context, arg CreateTransactionPINParams) (TransactionPin, error) {
+	row := q.db.QueryRowContext(ctx, createTransactionPIN, arg.Username, arg.HashedPin)
+	var i TransactionPin
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPin,
+		&i.RequireForTransfers,
+		&i.FailedAttempts,
+		&i.LockedUntil,
+		&i.ChangedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteUserTransactionPIN = `-- name: DeleteUserTransactionPIN :exec
+DELETE FROM transaction_pins
+WHERE username = $1
+`
+
+func (q *Queries) DeleteUserTransactionPIN(ctx context.Context, username string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserTransactionPIN, username)
+	return err
+}
+
+const getTransactionPIN = `-- name: GetTransactionPIN :one
+SELECT username, hashed_pin, require_for_transfers, failed_attempts, locked_until, changed_at, created_at FROM transaction_pins
+WHERE username = $1 LIMIT 1
+`
+
+func (q *Queries) GetTransactionPIN(ctx context.Context, username string) (TransactionPin, error) {
+	row := q.db.QueryRowContext(ctx, getTransactionPIN, username)
+	var i TransactionPin
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPin,
+		&i.RequireForTransfers,
+		&i.FailedAttempts,
+		&i.LockedUntil,
+		&i.ChangedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const recordTransactionPINAttempt = `-- name: RecordTransactionPINAttempt :one
+UPDATE transaction_pins
+SET
+  failed_attempts = CASE
+    WHEN failed_attempts + 1 >= $1::int THEN 0
+    ELSE failed_attempts + 1
+  END,
+  locked_until = CASE
+    WHEN failed_attempts + 1 >= $1::int THEN $2::timestamptz
+    ELSE NULL
+  END
+WHERE username = $3 AND (locked_until IS NULL OR locked_until <= now())
+RETURNING username, hashed_pin, require_for_transfers, failed_attempts, locked_until, changed_at, created_at
+`
+
+type RecordTransactionPINAttemptParams struct {
+	MaxAttempts int32     `json:"max_attempts"`
+	LockedUntil time.Time `json:"locked_until"`
+	Username    string    `json:"username"`
+}
+
+// counts an attempt before the pin is compared, so that concurrent guesses cannot
+// get past max_attempts. The attempt that reaches max_attempts locks the pin, and
+// while it is locked no row is returned.
+func (q *Queries) RecordTransactionPINAttempt(ctx context.Context, arg RecordTransactionPINAttemptParams) (TransactionPin, error) {
+	row := q.db.QueryRowContext(ctx, recordTransactionPINAttempt, arg.MaxAttempts, arg.LockedUntil, arg.Username)
+	var i TransactionPin
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPin,
+		&i.RequireForTransfers,
+		&i.FailedAttempts,
+		&i.LockedUntil,
+		&i.ChangedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const resetTransactionPINFailures = `-- name: ResetTransactionPINFailures :exec
+UPDATE transaction_pins
+SET failed_attempts = 0, locked_until = NULL
+WHERE username = $1
+`
+
+// takes back the attempts counted before a correct pin
+func (q *Queries) ResetTransactionPINFailures(ctx context.Context, username string) error {
+	_, err := q.db.ExecContext(ctx, resetTransactionPINFailures, username)
+	return err
+}
+
+const setTransactionPINRequired = `-- name: SetTransactionPINRequired :one
+UPDATE transaction_pins
+SET require_for_transfers = $1
+WHERE username = $2
+RETURNING username, hashed_pin, require_for_transfers, failed_attempts, locked_until, changed_at, created_at
+`
+
+type SetTransactionPINRequiredParams struct {
+	RequireForTransfers bool   `json:"require_for_transfers"`
+	Username            string `json:"username"`
+}
+
+func (q *Queries) SetTransactionPINRequired(ctx context.Context, arg SetTransactionPINRequiredParams) (TransactionPin, error) {
+	row := q.db.QueryRowContext(ctx, setTransactionPINRequired, arg.RequireForTransfers, arg.Username)
+	var i TransactionPin
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPin,
+		&i.RequireForTransfers,
+		&i.FailedAttempts,
+		&i.LockedUntil,
+		&i.ChangedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const updateTransactionPIN = `-- name: UpdateTransactionPIN :one
+UPDATE transaction_pins
+SET
+  hashed_pin = $1,
+  failed_attempts = 0,
+  locked_until = NULL,
+  changed_at = now()
+WHERE username = $2
+RETURNING username, hashed_pin, require_for_transfers, failed_attempts, locked_until, changed_at, created_at
+`
+
+type UpdateTransactionPINParams struct {
+	HashedPin string `json:"hashed_pin"`
+	Username  string `json:"username"`
+}
+
+func (q *Queries) UpdateTransactionPIN(ctx context.Context, arg UpdateTransactionPINParams) (TransactionPin, error) {
+	row := q.db.QueryRowContext(ctx, updateTransactionPIN, arg.HashedPin, arg.Username)
+	var i TransactionPin
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPin,
+		&i.RequireForTransfers,
+		&i.FailedAttempts,
+		&i.LockedUntil,
+		&i.ChangedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
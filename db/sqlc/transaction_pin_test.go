@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomTransactionPIN(t *testing.T, user User) TransactionPin {
+	arg := CreateTransactionPINParams{
+		Username:  user.Username,
+		HashedPin: utils.RandomString(32),
+	}
+
+	pin, err := testQueries.CreateTransactionPIN(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Username, pin.Username)
+	require.Equal(t, arg.HashedPin, pin.HashedPin)
+	require.False(t, pin.RequireForTransfers)
+	require.Zero(t, pin.FailedAttempts)
+	require.False(t, pin.LockedUntil.Valid)
+	require.NotZero(t, pin.ChangedAt)
+	require.NotZero(t, pin.CreatedAt)
+
+	return pin
+}
+
+func TestCreateTransactionPIN(t *testing.T) {
+	user := createRandomUser(t)
+	createRandomTransactionPIN(t, user)
+
+	// a user has one pin, it is changed rather than set again
+	_, err := testQueries.CreateTransactionPIN(context.Background(), CreateTransactionPINParams{
+		Username:  user.Username,
+		HashedPin: utils.RandomString(32),
+	})
+	require.Error(t, err)
+	require.Equal(t, "unique_violation", err.(*pq.Error).Code.Name())
+}
+
+func TestRecordTransactionPINAttempt(t *testing.T) {
+	pin := createRandomTransactionPIN(t, createRandomUser(t))
+	lockedUntil := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	arg := RecordTransactionPINAttemptParams{
+		MaxAttempts: 3,
+		LockedUntil: lockedUntil,
+		Username:    pin.Username,
+	}
+
+	for i := 1; i < 3; i++ {
+		counted, err := testQueries.RecordTransactionPINAttempt(context.Background(), arg)
+		require.NoError(t, err)
+		require.Equal(t, int32(i), counted.FailedAttempts)
+		require.False(t, counted.LockedUntil.Valid)
+	}
+
+	// the last attempt locks the pin and starts counting again
+	locked, err := testQueries.RecordTransactionPINAttempt(context.Background(), arg)
+	require.NoError(t, err)
+	require.Zero(t, locked.FailedAttempts)
+	require.True(t, locked.LockedUntil.Valid)
+	require.WithinDuration(t, lockedUntil, locked.LockedUntil.Time, time.Second)
+
+	// no attempt is counted while the pin is locked
+	_, err = testQueries.RecordTransactionPINAttempt(context.Background(), arg)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// changing the pin lifts the lock
+	updated, err := testQueries.UpdateTransactionPIN(context.Background(), UpdateTransactionPINParams{
+		HashedPin: utils.RandomString(32),
+		Username:  pin.Username,
+	})
+	require.NoError(t, err)
+	require.Zero(t, updated.FailedAttempts)
+	require.False(t, updated.LockedUntil.Valid)
+	require.True(t, updated.ChangedAt.After(pin.ChangedAt))
+
+	_, err = testQueries.RecordTransactionPINAttempt(context.Background(), arg)
+	require.NoError(t, err)
+}
+
+func TestResetTransactionPINFailures(t *testing.T) {
+	pin := createRandomTransactionPIN(t, createRandomUser(t))
+
+	_, err := testQueries.RecordTransactionPINAttempt(context.Background(), RecordTransactionPINAttemptParams{
+		MaxAttempts: 1,
+		LockedUntil: time.Now().Add(time.Hour),
+		Username:    pin.Username,
+	})
+	require.NoError(t, err)
+
+	err = testQueries.ResetTransactionPINFailures(context.Background(), pin.Username)
+	require.NoError(t, err)
+
+	reset, err := testQueries.GetTransactionPIN(context.Background(), pin.Username)
+	require.NoError(t, err)
+	require.Zero(t, reset.FailedAttempts)
+	require.False(t, reset.LockedUntil.Valid)
+}
+
+func TestTransactionPINInAuthInfo(t *testing.T) {
+	user := createRandomUser(t)
+
+	authInfo, err := testQueries.GetUserAuthInfo(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.False(t, authInfo.HasTransactionPin)
+	require.False(t, authInfo.TransactionPinRequired)
+
+	createRandomTransactionPIN(t, user)
+	_, err = testQueries.SetTransactionPINRequired(context.Background(), SetTransactionPINRequiredParams{
+		RequireForTransfers: true,
+		Username:            user.Username,
+	})
+	require.NoError(t, err)
+
+	authInfo, err = testQueries.GetUserAuthInfo(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.True(t, authInfo.HasTransactionPin)
+	require.True(t, authInfo.TransactionPinRequired)
+}
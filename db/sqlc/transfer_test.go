@@ -76,3 +76,17 @@ func TestListTransfers(t *testing.T) {
 		require.True(t, transfer.FromAccountID == account1.ID || transfer.ToAccountID == account2.ID)
 	}
 }
+
+func TestListOwnerTransfers(t *testing.T) {
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccount(t)
+	account3 := createRandomAccount(t)
+
+	sent := createRandomTransfer(t, account1, account2)
+	received := createRandomTransfer(t, account3, account1)
+	createRandomTransfer(t, account2, account3)
+
+	transfers, err := testQueries.ListOwnerTransfers(context.Background(), account1.Owner)
+	require.NoError(t, err)
+	require.Equal(t, []Transfer{sent, received}, transfers)
+}
@@ -7,8 +7,48 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+const anonymizeUser = `-- name: AnonymizeUser :one
+UPDATE users
+SET
+  hashed_password = '',
+  full_name = '',
+  email = 'deleted+' || username || '@invalid',
+  phone_number = '',
+  is_email_verified = false,
+  allowed_ips = '{}',
+  password_changed_at = now(),
+  deleted_at = now()
+WHERE username = $1 AND deleted_at = '0001-01-01 00:00:00Z'
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, is_email_verified, phone_number, deleted_at, allowed_ips
+`
+
+// erases the personal data of the user, the username stays as the pseudonymous
+// owner of the ledger. Bumping password_changed_at rejects all issued tokens.
+func (q *Queries) AnonymizeUser(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRowContext(ctx, anonymizeUser, username)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.IsEmailVerified,
+		&i.PhoneNumber,
+		&i.DeletedAt,
+		pq.Array(&i.AllowedIps),
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
   username,
@@ -17,7 +57,7 @@ INSERT INTO users (
   email
 ) VALUES (
   $1, $2, $3, $4
-) RETURNING username, hashed_password, full_name, email, password_changed_at, created_at
+) RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, is_email_verified, phone_number, deleted_at, allowed_ips
 `
 
 type CreateUserParams struct {
@@ -42,12 +82,17 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.PasswordChangedAt,
 		&i.CreatedAt,
+		&i.Role,
+		&i.IsEmailVerified,
+		&i.PhoneNumber,
+		&i.DeletedAt,
+		pq.Array(&i.AllowedIps),
 	)
 	return i, err
 }
 
 const getUser = `-- name: GetUser :one
-SELECT username, hashed_password, full_name, email, password_changed_at, created_at FROM users
+SELECT username, hashed_password, full_name, email, password_changed_at, created_at, role, is_email_verified, phone_number, deleted_at, allowed_ips FROM users
 WHERE username = $1 LIMIT 1
 `
 
@@ -61,6 +106,232 @@ func (q *Queries) GetUser(ctx context.Context, username string) (User, error) {
 		&i.Email,
 		&i.PasswordChangedAt,
 		&i.CreatedAt,
+		&i.Role,
+		&i.IsEmailVerified,
+		&i.PhoneNumber,
+		&i.DeletedAt,
+		pq.Array(&i.AllowedIps),
+	)
+	return i, err
+}
+
+const getUserAuthInfo = `-- name: GetUserAuthInfo :one
+SELECT
+  u.username,
+  u.password_changed_at,
+  u.is_email_verified,
+  u.allowed_ips,
+  (p.username IS NOT NULL)::bool AS has_transaction_pin,
+  COALESCE(p.require_for_transfers, false)::bool AS transaction_pin_required,
+  EXISTS (SELECT 1 FROM webauthn_credentials c WHERE c.username = u.username) AS has_passkey
+FROM users u
+LEFT JOIN transaction_pins p ON p.username = u.username
+WHERE u.username = $1 LIMIT 1
+`
+
+type GetUserAuthInfoRow struct {
+	Username               string    `json:"username"`
+	PasswordChangedAt      time.Time `json:"password_changed_at"`
+	IsEmailVerified        bool      `json:"is_email_verified"`
+	AllowedIps             []string  `json:"allowed_ips"`
+	HasTransactionPin      bool      `json:"has_transaction_pin"`
+	TransactionPinRequired bool      `json:"transaction_pin_required"`
+	HasPasskey             bool      `json:"has_passkey"`
+}
+
+func (q *Queries) GetUserAuthInfo(ctx context.Context, username string) (GetUserAuthInfoRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserAuthInfo, username)
+	var i GetUserAuthInfoRow
+	err := row.Scan(
+		&i.Username,
+		&i.PasswordChangedAt,
+		&i.IsEmailVerified,
+		pq.Array(&i.AllowedIps),
+		&i.HasTransactionPin,
+		&i.TransactionPinRequired,
+		&i.HasPasskey,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT username, hashed_password, full_name, email, password_changed_at, created_at, role, is_email_verified, phone_number, deleted_at, allowed_ips FROM users
+WHERE email = $1 LIMIT 1
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.IsEmailVerified,
+		&i.PhoneNumber,
+		&i.DeletedAt,
+		pq.Array(&i.AllowedIps),
+	)
+	return i, err
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :exec
+UPDATE users
+SET hashed_password = $1
+WHERE username = $2 AND hashed_password = $3
+`
+
+type RehashUserPasswordParams struct {
+	NewHashedPassword string `json:"new_hashed_password"`
+	Username          string `json:"username"`
+	OldHashedPassword string `json:"old_hashed_password"`
+}
+
+// replaces the hash of the same password, so password_changed_at stays as it is,
+// unless the password was changed since the old hash was read
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, rehashUserPassword, arg.NewHashedPassword, arg.Username, arg.OldHashedPassword)
+	return err
+}
+
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+SET
+  full_name = COALESCE($1, full_name),
+  email = COALESCE($2, email),
+  phone_number = COALESCE($3, phone_number),
+  -- a new email has to be verified again
+  is_email_verified = is_email_verified AND COALESCE($2, email) = email
+WHERE username = $4
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, is_email_verified, phone_number, deleted_at, allowed_ips
+`
+
+type UpdateUserParams struct {
+	FullName    sql.NullString `json:"full_name"`
+	Email       sql.NullString `json:"email"`
+	PhoneNumber sql.NullString `json:"phone_number"`
+	Username    string         `json:"username"`
+}
+
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUser,
+		arg.FullName,
+		arg.Email,
+		arg.PhoneNumber,
+		arg.Username,
+	)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.IsEmailVerified,
+		&i.PhoneNumber,
+		&i.DeletedAt,
+		pq.Array(&i.AllowedIps),
+	)
+	return i, err
+}
+
+const updateUserAllowedIPs = `-- name: UpdateUserAllowedIPs :one
+UPDATE users
+SET allowed_ips = $1
+WHERE username = $2
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, is_email_verified, phone_number, deleted_at, allowed_ips
+`
+
+type UpdateUserAllowedIPsParams struct {
+	AllowedIps []string `json:"allowed_ips"`
+	Username   string   `json:"username"`
+}
+
+func (q *Queries) UpdateUserAllowedIPs(ctx context.Context, arg UpdateUserAllowedIPsParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserAllowedIPs, pq.Array(arg.AllowedIps), arg.Username)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.IsEmailVerified,
+		&i.PhoneNumber,
+		&i.DeletedAt,
+		pq.Array(&i.AllowedIps),
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :one
+UPDATE users
+SET
+  hashed_password = $1,
+  password_changed_at = $2
+WHERE username = $3
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, is_email_verified, phone_number, deleted_at, allowed_ips
+`
+
+type UpdateUserPasswordParams struct {
+	HashedPassword    string    `json:"hashed_password"`
+	PasswordChangedAt time.Time `json:"password_changed_at"`
+	Username          string    `json:"username"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserPassword, arg.HashedPassword, arg.PasswordChangedAt, arg.Username)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.IsEmailVerified,
+		&i.PhoneNumber,
+		&i.DeletedAt,
+		pq.Array(&i.AllowedIps),
+	)
+	return i, err
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users
+SET is_email_verified = true
+WHERE username = $1 AND email = $2
+RETURNING username, hashed_password, full_name, email, password_changed_at, created_at, role, is_email_verified, phone_number, deleted_at, allowed_ips
+`
+
+type VerifyUserEmailParams struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, arg.Username, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.FullName,
+		&i.Email,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.Role,
+		&i.IsEmailVerified,
+		&i.PhoneNumber,
+		&i.DeletedAt,
+		pq.Array(&i.AllowedIps),
 	)
 	return i, err
 }
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomUserIdentity(t *testing.T, user User, provider string) UserIdentity {
+	arg := CreateUserIdentityParams{
+		Provider: provider,
+		Subject:  utils.RandomString(16),
+		Username: user.Username,
+		Email:    user.Email,
+	}
+
+	identity, err := testQueries.CreateUserIdentity(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Provider, identity.Provider)
+	require.Equal(t, arg.Subject, identity.Subject)
+	require.Equal(t, arg.Username, identity.Username)
+	require.Equal(t, arg.Email, identity.Email)
+	require.False(t, identity.LastLoginAt.Valid)
+	require.NotZero(t, identity.CreatedAt)
+
+	return identity
+}
+
+func TestCreateUserIdentity(t *testing.T) {
+	user := createRandomUser(t)
+	identity := createRandomUserIdentity(t, user, "corp")
+
+	// a user has at most one identity per provider
+	_, err := testQueries.CreateUserIdentity(context.Background(), CreateUserIdentityParams{
+		Provider: "corp",
+		Subject:  utils.RandomString(16),
+		Username: user.Username,
+		Email:    user.Email,
+	})
+	require.Error(t, err)
+	require.Equal(t, "unique_violation", err.(*pq.Error).Code.Name())
+
+	// and an identity belongs to one user
+	_, err = testQueries.CreateUserIdentity(context.Background(), CreateUserIdentityParams{
+		Provider: "corp",
+		Subject:  identity.Subject,
+		Username: createRandomUser(t).Username,
+		Email:    user.Email,
+	})
+	require.Error(t, err)
+	require.Equal(t, "unique_violation", err.(*pq.Error).Code.Name())
+}
+
+func TestTouchUserIdentity(t *testing.T) {
+	identity1 := createRandomUserIdentity(t, createRandomUser(t), "corp")
+	email := utils.RandomEmail()
+
+	err := testQueries.TouchUserIdentity(context.Background(), TouchUserIdentityParams{
+		Provider: identity1.Provider,
+		Subject:  identity1.Subject,
+		Email:    email,
+	})
+	require.NoError(t, err)
+
+	identity2, err := testQueries.GetUserIdentity(context.Background(), GetUserIdentityParams{
+		Provider: identity1.Provider,
+		Subject:  identity1.Subject,
+	})
+	require.NoError(t, err)
+	require.Equal(t, identity1.Username, identity2.Username)
+	require.Equal(t, email, identity2.Email)
+	require.True(t, identity2.LastLoginAt.Valid)
+	require.WithinDuration(t, time.Now(), identity2.LastLoginAt.Time, time.Second)
+}
+
+func TestListAndDeleteUserIdentities(t *testing.T) {
+	user := createRandomUser(t)
+	createRandomUserIdentity(t, user, "corp")
+	createRandomUserIdentity(t, user, "google")
+
+	identities, err := testQueries.ListUserIdentities(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Len(t, identities, 2)
+	require.Equal(t, "corp", identities[0].Provider)
+	require.Equal(t, "google", identities[1].Provider)
+
+	err = testQueries.DeleteUserIdentities(context.Background(), user.Username)
+	require.NoError(t, err)
+
+	identities, err = testQueries.ListUserIdentities(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Empty(t, identities)
+}
+
+func TestUseOIDCAuthRequest(t *testing.T) {
+	_, stateHash, err := utils.NewSecretToken()
+	require.NoError(t, err)
+
+	authRequest1, err := testQueries.CreateOIDCAuthRequest(context.Background(), CreateOIDCAuthRequestParams{
+		StateHash:    stateHash,
+		Provider:     "corp",
+		Nonce:        utils.RandomString(32),
+		CodeVerifier: utils.RandomString(43),
+		ExpiresAt:    time.Now().Add(time.Minute),
+	})
+	require.NoError(t, err)
+	require.Empty(t, authRequest1.LinkUsername)
+
+	// the state only works with the provider it was sent to
+	_, err = testQueries.UseOIDCAuthRequest(context.Background(), UseOIDCAuthRequestParams{
+		StateHash: stateHash,
+		Provider:  "google",
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	authRequest2, err := testQueries.UseOIDCAuthRequest(context.Background(), UseOIDCAuthRequestParams{
+		StateHash: stateHash,
+		Provider:  "corp",
+	})
+	require.NoError(t, err)
+	require.Equal(t, authRequest1.Nonce, authRequest2.Nonce)
+	require.Equal(t, authRequest1.CodeVerifier, authRequest2.CodeVerifier)
+
+	// and only once
+	_, err = testQueries.UseOIDCAuthRequest(context.Background(), UseOIDCAuthRequestParams{
+		StateHash: stateHash,
+		Provider:  "corp",
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestUseExpiredOIDCAuthRequest(t *testing.T) {
+	_, stateHash, err := utils.NewSecretToken()
+	require.NoError(t, err)
+
+	_, err = testQueries.CreateOIDCAuthRequest(context.Background(), CreateOIDCAuthRequestParams{
+		StateHash:    stateHash,
+		Provider:     "corp",
+		Nonce:        utils.RandomString(32),
+		CodeVerifier: utils.RandomString(43),
+		ExpiresAt:    time.Now().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+
+	_, err = testQueries.UseOIDCAuthRequest(context.Background(), UseOIDCAuthRequestParams{
+		StateHash: stateHash,
+		Provider:  "corp",
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	err = testQueries.DeleteExpiredOIDCAuthRequests(context.Background())
+	require.NoError(t, err)
+}
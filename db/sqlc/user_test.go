@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"testing"
 	"time"
 
@@ -28,8 +29,11 @@ func createRandomUser(t *testing.T) User {
 	require.Equal(t, arg.HashedPassword, user.HashedPassword)
 	require.Equal(t, arg.FullName, user.FullName)
 	require.Equal(t, arg.Email, user.Email)
+	require.Equal(t, utils.DepositorRole, user.Role)
+	require.False(t, user.IsEmailVerified)
 	require.NotZero(t, user.CreatedAt)
 	require.True(t, user.PasswordChangedAt.IsZero())
+	require.Empty(t, user.AllowedIps)
 
 	return user
 }
@@ -51,3 +55,144 @@ func TestGetUser(t *testing.T) {
 	require.WithinDuration(t, user1.PasswordChangedAt, user2.PasswordChangedAt, time.Second)
 	require.WithinDuration(t, user1.CreatedAt, user2.CreatedAt, time.Second)
 }
+
+func TestUpdateUserPassword(t *testing.T) {
+	user1 := createRandomUser(t)
+
+	hashedPassword, err := utils.HashPassword(utils.RandomString(6))
+	require.NoError(t, err)
+
+	arg := UpdateUserPasswordParams{
+		HashedPassword:    hashedPassword,
+		PasswordChangedAt: time.Now(),
+		Username:          user1.Username,
+	}
+
+	user2, err := testQueries.UpdateUserPassword(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, user1.Username, user2.Username)
+	require.Equal(t, hashedPassword, user2.HashedPassword)
+	require.WithinDuration(t, arg.PasswordChangedAt, user2.PasswordChangedAt, time.Second)
+
+	authInfo, err := testQueries.GetUserAuthInfo(context.Background(), user1.Username)
+	require.NoError(t, err)
+	require.Equal(t, user1.Username, authInfo.Username)
+	require.WithinDuration(t, arg.PasswordChangedAt, authInfo.PasswordChangedAt, time.Second)
+}
+
+func TestUpdateUserOnlyFullName(t *testing.T) {
+	oldUser := createRandomUser(t)
+
+	newFullName := utils.RandomOwner()
+	updatedUser, err := testQueries.UpdateUser(context.Background(), UpdateUserParams{
+		Username: oldUser.Username,
+		FullName: sql.NullString{String: newFullName, Valid: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, newFullName, updatedUser.FullName)
+	require.Equal(t, oldUser.Email, updatedUser.Email)
+	require.Equal(t, oldUser.PhoneNumber, updatedUser.PhoneNumber)
+	require.Equal(t, oldUser.HashedPassword, updatedUser.HashedPassword)
+}
+
+func TestUpdateUserPhoneNumber(t *testing.T) {
+	oldUser := createRandomUser(t)
+	require.Empty(t, oldUser.PhoneNumber)
+
+	updatedUser, err := testQueries.UpdateUser(context.Background(), UpdateUserParams{
+		Username:    oldUser.Username,
+		PhoneNumber: sql.NullString{String: "+14155552671", Valid: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "+14155552671", updatedUser.PhoneNumber)
+	require.Equal(t, oldUser.FullName, updatedUser.FullName)
+
+	updatedUser, err = testQueries.UpdateUser(context.Background(), UpdateUserParams{
+		Username:    oldUser.Username,
+		PhoneNumber: sql.NullString{String: "", Valid: true},
+	})
+	require.NoError(t, err)
+	require.Empty(t, updatedUser.PhoneNumber)
+}
+
+func TestUpdateUserEmailResetsVerification(t *testing.T) {
+	oldUser := createRandomUser(t)
+
+	verifiedUser, err := testQueries.VerifyUserEmail(context.Background(), VerifyUserEmailParams{
+		Username: oldUser.Username,
+		Email:    oldUser.Email,
+	})
+	require.NoError(t, err)
+	require.True(t, verifiedUser.IsEmailVerified)
+
+	// setting the same email keeps it verified
+	updatedUser, err := testQueries.UpdateUser(context.Background(), UpdateUserParams{
+		Username: oldUser.Username,
+		Email:    sql.NullString{String: oldUser.Email, Valid: true},
+	})
+	require.NoError(t, err)
+	require.True(t, updatedUser.IsEmailVerified)
+
+	newEmail := utils.RandomEmail()
+	updatedUser, err = testQueries.UpdateUser(context.Background(), UpdateUserParams{
+		Username: oldUser.Username,
+		Email:    sql.NullString{String: newEmail, Valid: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, newEmail, updatedUser.Email)
+	require.False(t, updatedUser.IsEmailVerified)
+}
+
+func TestRehashUserPassword(t *testing.T) {
+	user1 := createRandomUser(t)
+
+	newHashedPassword, err := utils.HashPassword(utils.RandomString(6))
+	require.NoError(t, err)
+
+	// a stale old hash means the password was changed in between, so nothing is updated
+	err = testQueries.RehashUserPassword(context.Background(), RehashUserPasswordParams{
+		Username:          user1.Username,
+		OldHashedPassword: "stale",
+		NewHashedPassword: newHashedPassword,
+	})
+	require.NoError(t, err)
+
+	user2, err := testQueries.GetUser(context.Background(), user1.Username)
+	require.NoError(t, err)
+	require.Equal(t, user1.HashedPassword, user2.HashedPassword)
+
+	err = testQueries.RehashUserPassword(context.Background(), RehashUserPasswordParams{
+		Username:          user1.Username,
+		OldHashedPassword: user1.HashedPassword,
+		NewHashedPassword: newHashedPassword,
+	})
+	require.NoError(t, err)
+
+	user2, err = testQueries.GetUser(context.Background(), user1.Username)
+	require.NoError(t, err)
+	require.Equal(t, newHashedPassword, user2.HashedPassword)
+	require.Equal(t, user1.PasswordChangedAt, user2.PasswordChangedAt)
+}
+
+func TestUpdateUserAllowedIPs(t *testing.T) {
+	user := createRandomUser(t)
+	allowedIPs := []string{"203.0.113.0/24", "2001:db8::/32"}
+
+	updated, err := testQueries.UpdateUserAllowedIPs(context.Background(), UpdateUserAllowedIPsParams{
+		AllowedIps: allowedIPs,
+		Username:   user.Username,
+	})
+	require.NoError(t, err)
+	require.Equal(t, allowedIPs, updated.AllowedIps)
+
+	authInfo, err := testQueries.GetUserAuthInfo(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Equal(t, allowedIPs, authInfo.AllowedIps)
+
+	updated, err = testQueries.UpdateUserAllowedIPs(context.Background(), UpdateUserAllowedIPsParams{
+		AllowedIps: []string{},
+		Username:   user.Username,
+	})
+	require.NoError(t, err)
+	require.Empty(t, updated.AllowedIps)
+}
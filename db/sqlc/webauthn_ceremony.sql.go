@@ -0,0 +1,94 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: webauthn_ceremony.sql
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createWebAuthnCeremony = `-- name: CreateWebAuthnCeremony :one
+INSERT INTO webauthn_ceremonies (
+  id,
+  ceremony,
+  username,
+  credential_name,
+  session_data,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+) RETURNING id, ceremony, username, credential_name, session_data, expires_at, created_at
+`
+
+type CreateWebAuthnCeremonyParams struct {
+	ID             uuid.UUID       `json:"id"`
+	Ceremony       string          `json:"ceremony"`
+	Username       string          `json:"username"`
+	CredentialName string          `json:"credential_name"`
+	SessionData    json.RawMessage `json:"session_data"`
+	ExpiresAt      time.Time       `json:"expires_at"`
+}
+
+func (q *Queries) CreateWebAuthnCeremony(ctx context.Context, arg CreateWebAuthnCeremonyParams) (WebauthnCeremony, error) {
+	row := q.db.QueryRowContext(ctx, createWebAuthnCeremony,
+		arg.ID,
+		arg.Ceremony,
+		arg.Username,
+		arg.CredentialName,
+		arg.SessionData,
+		arg.ExpiresAt,
+	)
+	var i WebauthnCeremony
+	err := row.Scan(
+		&i.ID,
+		&i.Ceremony,
+		&i.Username,
+		&i.CredentialName,
+		&i.SessionData,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteExpiredWebAuthnCeremonies = `-- name: DeleteExpiredWebAuthnCeremonies :exec
+DELETE FROM webauthn_ceremonies
+WHERE expires_at <= now()
+`
+
+func (q *Queries) DeleteExpiredWebAuthnCeremonies(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredWebAuthnCeremonies)
+	return err
+}
+
+const useWebAuthnCeremony = `-- name: UseWebAuthnCeremony :one
+DELETE FROM webauthn_ceremonies
+WHERE id = $1 AND ceremony = $2 AND expires_at > now()
+RETURNING id, ceremony, username, credential_name, session_data, expires_at, created_at
+`
+
+type UseWebAuthnCeremonyParams struct {
+	ID       uuid.UUID `json:"id"`
+	Ceremony string    `json:"ceremony"`
+}
+
+func (q *Queries) UseWebAuthnCeremony(ctx context.Context, arg UseWebAuthnCeremonyParams) (WebauthnCeremony, error) {
+	row := q.db.QueryRowContext(ctx, useWebAuthnCeremony, arg.ID, arg.Ceremony)
+	var i WebauthnCeremony
+	err := row.Scan(
+		&i.ID,
+		&i.Ceremony,
+		&i.Username,
+		&i.CredentialName,
+		&i.SessionData,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
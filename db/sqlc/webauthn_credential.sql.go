@@ -0,0 +1,153 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: webauthn_credential.sql
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+)
+
+const createWebAuthnCredential = `-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (
+  id,
+  username,
+  user_handle,
+  name,
+  credential
+) VALUES (
+  $1, $2, $3, $4, $5
+) RETURNING id, username, user_handle, name, credential, last_used_at, created_at
+`
+
+type CreateWebAuthnCredentialParams struct {
+	ID         []byte          `json:"id"`
+	Username   string          `json:"username"`
+	UserHandle []byte          `json:"user_handle"`
+	Name       string          `json:"name"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+func (q *Queries) CreateWebAuthnCredential(ctx context.Context, arg CreateWebAuthnCredentialParams) (WebauthnCredential, error) {
+	row := q.db.QueryRowContext(ctx, createWebAuthnCredential,
+		arg.ID,
+		arg.Username,
+		arg.UserHandle,
+		arg.Name,
+		arg.Credential,
+	)
+	var i WebauthnCredential
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.UserHandle,
+		&i.Name,
+		&i.Credential,
+		&i.LastUsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteUserWebAuthnCredentials = `-- name: DeleteUserWebAuthnCredentials :exec
+DELETE FROM webauthn_credentials
+WHERE username = $1
+`
+
+func (q *Queries) DeleteUserWebAuthnCredentials(ctx context.Context, username string) error {
+	_, err := q.db.ExecContext(ctx, deleteUserWebAuthnCredentials, username)
+	return err
+}
+
+const deleteWebAuthnCredential = `-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials
+WHERE id = $1 AND username = $2
+`
+
+type DeleteWebAuthnCredentialParams struct {
+	ID       []byte `json:"id"`
+	Username string `json:"username"`
+}
+
+func (q *Queries) DeleteWebAuthnCredential(ctx context.Context, arg DeleteWebAuthnCredentialParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteWebAuthnCredential, arg.ID, arg.Username)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getWebAuthnCredential = `-- name: GetWebAuthnCredential :one
+SELECT id, username, user_handle, name, credential, last_used_at, created_at FROM webauthn_credentials
+WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetWebAuthnCredential(ctx context.Context, id []byte) (WebauthnCredential, error) {
+	row := q.db.QueryRowContext(ctx, getWebAuthnCredential, id)
+	var i WebauthnCredential
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.UserHandle,
+		&i.Name,
+		&i.Credential,
+		&i.LastUsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listWebAuthnCredentials = `-- name: ListWebAuthnCredentials :many
+SELECT id, username, user_handle, name, credential, last_used_at, created_at FROM webauthn_credentials
+WHERE username = $1
+ORDER BY created_at
+`
+
+func (q *Queries) ListWebAuthnCredentials(ctx context.Context, username string) ([]WebauthnCredential, error) {
+	rows, err := q.db.QueryContext(ctx, listWebAuthnCredentials, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []WebauthnCredential{}
+	for rows.Next() {
+		var i WebauthnCredential
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.UserHandle,
+			&i.Name,
+			&i.Credential,
+			&i.LastUsedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const useWebAuthnCredential = `-- name: UseWebAuthnCredential :exec
+UPDATE webauthn_credentials
+SET credential = $2, last_used_at = now()
+WHERE id = $1
+`
+
+type UseWebAuthnCredentialParams struct {
+	ID         []byte          `json:"id"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+func (q *Queries) UseWebAuthnCredential(ctx context.Context, arg UseWebAuthnCredentialParams) error {
+	_, err := q.db.ExecContext(ctx, useWebAuthnCredential, arg.ID, arg.Credential)
+	return err
+}
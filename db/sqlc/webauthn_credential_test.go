@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomWebAuthnCredential(t *testing.T, user User) WebauthnCredential {
+	arg := CreateWebAuthnCredentialParams{
+		ID:         []byte(utils.RandomString(32)),
+		Username:   user.Username,
+		UserHandle: []byte(utils.RandomString(32)),
+		Name:       utils.RandomString(8),
+		Credential: json.RawMessage(`{"signCount":0}`),
+	}
+
+	credential, err := testQueries.CreateWebAuthnCredential(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.ID, credential.ID)
+	require.Equal(t, arg.Username, credential.Username)
+	require.Equal(t, arg.UserHandle, credential.UserHandle)
+	require.Equal(t, arg.Name, credential.Name)
+	require.JSONEq(t, string(arg.Credential), string(credential.Credential))
+	require.False(t, credential.LastUsedAt.Valid)
+	require.NotZero(t, credential.CreatedAt)
+
+	return credential
+}
+
+func TestCreateWebAuthnCredential(t *testing.T) {
+	user := createRandomUser(t)
+	credential := createRandomWebAuthnCredential(t, user)
+
+	// a credential id is registered once, whoever tries it
+	_, err := testQueries.CreateWebAuthnCredential(context.Background(), CreateWebAuthnCredentialParams{
+		ID:         credential.ID,
+		Username:   createRandomUser(t).Username,
+		UserHandle: []byte(utils.RandomString(32)),
+		Name:       utils.RandomString(8),
+		Credential: json.RawMessage(`{}`),
+	})
+	require.Error(t, err)
+	require.Equal(t, "unique_violation", err.(*pq.Error).Code.Name())
+}
+
+func TestUseWebAuthnCredential(t *testing.T) {
+	credential1 := createRandomWebAuthnCredential(t, createRandomUser(t))
+
+	err := testQueries.UseWebAuthnCredential(context.Background(), UseWebAuthnCredentialParams{
+		ID:         credential1.ID,
+		Credential: json.RawMessage(`{"signCount":1}`),
+	})
+	require.NoError(t, err)
+
+	credential2, err := testQueries.GetWebAuthnCredential(context.Background(), credential1.ID)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"signCount":1}`, string(credential2.Credential))
+	require.True(t, credential2.LastUsedAt.Valid)
+	require.WithinDuration(t, time.Now(), credential2.LastUsedAt.Time, time.Second)
+}
+
+func TestListWebAuthnCredentials(t *testing.T) {
+	user := createRandomUser(t)
+	for i := 0; i < 3; i++ {
+		createRandomWebAuthnCredential(t, user)
+	}
+	createRandomWebAuthnCredential(t, createRandomUser(t))
+
+	credentials, err := testQueries.ListWebAuthnCredentials(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Len(t, credentials, 3)
+	for _, credential := range credentials {
+		require.Equal(t, user.Username, credential.Username)
+	}
+}
+
+func TestDeleteWebAuthnCredential(t *testing.T) {
+	credential := createRandomWebAuthnCredential(t, createRandomUser(t))
+
+	// only the owner can delete the credential
+	deleted, err := testQueries.DeleteWebAuthnCredential(context.Background(), DeleteWebAuthnCredentialParams{
+		ID:       credential.ID,
+		Username: createRandomUser(t).Username,
+	})
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+
+	deleted, err = testQueries.DeleteWebAuthnCredential(context.Background(), DeleteWebAuthnCredentialParams{
+		ID:       credential.ID,
+		Username: credential.Username,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), deleted)
+
+	_, err = testQueries.GetWebAuthnCredential(context.Background(), credential.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestPasskeyInAuthInfo(t *testing.T) {
+	user := createRandomUser(t)
+
+	authInfo, err := testQueries.GetUserAuthInfo(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.False(t, authInfo.HasPasskey)
+
+	createRandomWebAuthnCredential(t, user)
+
+	authInfo, err = testQueries.GetUserAuthInfo(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.True(t, authInfo.HasPasskey)
+}
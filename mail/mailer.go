@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+)
+
+const (
+	SMTPMailer   = "smtp"
+	OutboxMailer = "outbox"
+)
+
+// Mailer sends plain text emails
+type Mailer interface {
+	SendEmail(to []string, subject string, content string) error
+}
+
+// NewMailer creates the mailer selected by config.MailerType
+func NewMailer(config utils.Config) (Mailer, error) {
+	switch config.MailerType {
+	case SMTPMailer:
+		return NewSMTPMailer(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.EmailSenderAddress), nil
+	case OutboxMailer, "":
+		return NewOutboxMailer(config.MailOutboxDir, config.EmailSenderAddress)
+	default:
+		return nil, fmt.Errorf("unsupported mailer type %q", config.MailerType)
+	}
+}
+
+// buildMessage formats the email as an RFC 5322 message
+func buildMessage(from string, to []string, subject string, content string, date time.Time) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(content, "\n", "\r\n"))
+	return msg.Bytes()
+}
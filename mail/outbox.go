@@ -0,0 +1,36 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type outboxMailer struct {
+	dir  string
+	from string
+}
+
+// NewOutboxMailer creates a mailer that writes every email as an .eml file
+// into dir instead of sending it, for local development and tests
+func NewOutboxMailer(dir string, from string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("cannot create outbox directory: %w", err)
+	}
+	return &outboxMailer{dir: dir, from: from}, nil
+}
+
+func (mailer *outboxMailer) SendEmail(to []string, subject string, content string) error {
+	now := time.Now()
+	msg := buildMessage(mailer.from, to, subject, content, now)
+
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405"), uuid.New())
+	err := os.WriteFile(filepath.Join(mailer.dir, name), msg, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write email to outbox: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package mail
+
+import (
+	"net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	mailer, err := NewOutboxMailer(dir, "no-reply@simplebank.local")
+	require.NoError(t, err)
+
+	to := utils.RandomEmail()
+	content := "Hello,\nthis is a test email."
+	err = mailer.SendEmail([]string{to}, "Test email", content)
+	require.NoError(t, err)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	file, err := os.Open(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	defer file.Close()
+
+	msg, err := mail.ReadMessage(file)
+	require.NoError(t, err)
+	require.Equal(t, "no-reply@simplebank.local", msg.Header.Get("From"))
+	require.Equal(t, to, msg.Header.Get("To"))
+	require.Equal(t, "Test email", msg.Header.Get("Subject"))
+}
+
+func TestNewMailer(t *testing.T) {
+	mailer, err := NewMailer(utils.Config{MailerType: SMTPMailer, SMTPHost: "localhost", SMTPPort: "25"})
+	require.NoError(t, err)
+	require.IsType(t, &smtpMailer{}, mailer)
+
+	mailer, err = NewMailer(utils.Config{MailerType: OutboxMailer, MailOutboxDir: t.TempDir()})
+	require.NoError(t, err)
+	require.IsType(t, &outboxMailer{}, mailer)
+
+	_, err = NewMailer(utils.Config{MailerType: "pigeon"})
+	require.Error(t, err)
+}
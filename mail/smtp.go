@@ -0,0 +1,37 @@
+package mail
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer creates a mailer that relays the emails through an SMTP server.
+// No authentication is done if username is empty.
+func NewSMTPMailer(host string, port string, username string, password string, from string) Mailer {
+	mailer := &smtpMailer{
+		addr: net.JoinHostPort(host, port),
+		from: from,
+	}
+	if username != "" {
+		mailer.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return mailer
+}
+
+func (mailer *smtpMailer) SendEmail(to []string, subject string, content string) error {
+	msg := buildMessage(mailer.from, to, subject, content, time.Now())
+
+	err := smtp.SendMail(mailer.addr, mailer.auth, mailer.from, to, msg)
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/andreanpradanaa/simple-bank-app/api"
+	"github.com/andreanpradanaa/simple-bank-app/audit"
 	db "github.com/andreanpradanaa/simple-bank-app/db/sqlc"
+	"github.com/andreanpradanaa/simple-bank-app/mail"
+	"github.com/andreanpradanaa/simple-bank-app/notify"
 	"github.com/andreanpradanaa/simple-bank-app/utils"
 	_ "github.com/lib/pq"
 )
@@ -22,12 +29,21 @@ func main() {
 	}
 
 	store := db.NewStore(conn)
-	server, err := api.NewServer(config, store)
+	mailer, err := mail.NewMailer(config)
+	if err != nil {
+		log.Fatal("cannot create mailer:", err)
+	}
+
+	server, err := api.NewServer(config, store, mailer, audit.NewStoreAuditor(store), notify.NewMailNotifier(mailer))
 	if err != nil {
 		log.Fatal("cannot create server:", err)
 	}
 
-	err = server.Start(config.HTTPServerAddress)
+	// on interrupt the server finishes the requests and background tasks in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = server.Start(ctx, config.HTTPServerAddress)
 	if err != nil {
 		log.Fatal("cannot start server:", err)
 	}
@@ -0,0 +1,50 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/andreanpradanaa/simple-bank-app/notify (interfaces: Notifier)
+
+// Package mocknotify is a generated GoMock package.
+package mocknotify
+
+import (
+	context "context"
+	reflect "reflect"
+
+	notify "github.com/andreanpradanaa/simple-bank-app/notify"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockNotifier is a mock of Notifier interface.
+type MockNotifier struct {
+	ctrl     *gomock.Controller
+	recorder *MockNotifierMockRecorder
+}
+
+// MockNotifierMockRecorder is the mock recorder for MockNotifier.
+type MockNotifierMockRecorder struct {
+	mock *MockNotifier
+}
+
+// NewMockNotifier creates a new mock instance.
+func NewMockNotifier(ctrl *gomock.Controller) *MockNotifier {
+	mock := &MockNotifier{ctrl: ctrl}
+	mock.recorder = &MockNotifierMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockNotifier) EXPECT() *MockNotifierMockRecorder {
+	return m.recorder
+}
+
+// NotifyNewDeviceLogin mocks base method.
+func (m *MockNotifier) NotifyNewDeviceLogin(arg0 context.Context, arg1 notify.NewDeviceLogin) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NotifyNewDeviceLogin", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// NotifyNewDeviceLogin indicates an expected call of NotifyNewDeviceLogin.
+func (mr *MockNotifierMockRecorder) NotifyNewDeviceLogin(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NotifyNewDeviceLogin", reflect.TypeOf((*MockNotifier)(nil).NotifyNewDeviceLogin), arg0, arg1)
+}
@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/mail"
+)
+
+// NewDeviceLogin is a login to the account of the user from a device it was not used from before
+type NewDeviceLogin struct {
+	Username   string
+	FullName   string
+	Email      string
+	UserAgent  string
+	ClientIP   string
+	LoggedInAt time.Time
+	// RevokeURL signs the new device out when opened
+	RevokeURL string
+}
+
+// Notifier tells users about security relevant activity on their account
+type Notifier interface {
+	NotifyNewDeviceLogin(ctx context.Context, login NewDeviceLogin) error
+}
+
+type mailNotifier struct {
+	mailer mail.Mailer
+}
+
+// NewMailNotifier creates a notifier that emails the user
+func NewMailNotifier(mailer mail.Mailer) Notifier {
+	return &mailNotifier{mailer: mailer}
+}
+
+func (notifier *mailNotifier) NotifyNewDeviceLogin(ctx context.Context, login NewDeviceLogin) error {
+	return notifier.mailer.SendEmail([]string{login.Email}, "New sign-in to your Simple Bank account", newDeviceLoginEmail(login))
+}
+
+func newDeviceLoginEmail(login NewDeviceLogin) string {
+	return fmt.Sprintf(`Hello %s,
+
+Your Simple Bank account was just signed in to from a new device:
+
+Device: %s
+IP address: %s
+Time: %s
+
+If this was you, there is nothing to do.
+
+If it was not, sign that device out with the link below, and change your password:
+
+%s
+`, login.FullName, login.UserAgent, login.ClientIP, login.LoggedInAt.UTC().Format(time.RFC1123), login.RevokeURL)
+}
@@ -0,0 +1,47 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mockmail "github.com/andreanpradanaa/simple-bank-app/mail/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMailNotifier(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	login := NewDeviceLogin{
+		Username:   "alice",
+		FullName:   "Alice Smith",
+		Email:      "alice@example.com",
+		UserAgent:  "curl/8.0",
+		ClientIP:   "203.0.113.7",
+		LoggedInAt: time.Now(),
+		RevokeURL:  "http://localhost:8080/users/sessions/revoke?token=abc",
+	}
+
+	mailer := mockmail.NewMockMailer(ctrl)
+	mailer.EXPECT().
+		SendEmail(gomock.Eq([]string{login.Email}), gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ []string, _ string, content string) error {
+			require.Contains(t, content, login.FullName)
+			require.Contains(t, content, login.UserAgent)
+			require.Contains(t, content, login.ClientIP)
+			require.Contains(t, content, login.RevokeURL)
+			return nil
+		})
+	mailer.EXPECT().
+		SendEmail(gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(errors.New("connection refused"))
+
+	notifier := NewMailNotifier(mailer)
+	require.NoError(t, notifier.NotifyNewDeviceLogin(context.Background(), login))
+	require.Error(t, notifier.NotifyNewDeviceLogin(context.Background(), login))
+}
@@ -0,0 +1,53 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+// JSONWebKey is the public part of a signing key, as in RFC 7517
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JSONWebKeySet publishes every public key of the keyring, so that other
+// services can verify our tokens. PASETO v2.public tokens are verified with
+// the same Ed25519 keys.
+func (keyring *Keyring) JSONWebKeySet() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, keyID := range keyring.KeyIDs() {
+		jwk := JSONWebKey{
+			KeyID: keyID,
+			Use:   "sig",
+		}
+
+		switch key := keyring.publicKeys[keyID].(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Algorithm = AlgorithmEdDSA
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(key)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.Algorithm = AlgorithmRS256
+			jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
@@ -0,0 +1,86 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// JWTPublicMaker signs JWTs with the EdDSA or RS256 key of the keyring. Tokens
+// signed by any key of the keyring are accepted, with that key's algorithm only.
+type JWTPublicMaker struct {
+	keyring *Keyring
+	method  jwt.SigningMethod
+}
+
+func NewJWTPublicMaker(keyring *Keyring, algorithm string) (Maker, error) {
+	_, signingKey := keyring.SigningKey()
+	keyAlg, err := keyAlgorithm(signingKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	if keyAlg != algorithm {
+		return nil, fmt.Errorf("invalid signing key: %s needs a %s key", algorithm, algorithm)
+	}
+
+	maker := &JWTPublicMaker{
+		keyring: keyring,
+		method:  jwt.GetSigningMethod(algorithm),
+	}
+
+	return maker, nil
+}
+
+func (maker *JWTPublicMaker) CreateToken(username string, duration time.Duration, opts ...PayloadOption) (string, *Payload, error) {
+	payload, err := NewPayload(username, duration, opts...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	keyID, signingKey := maker.keyring.SigningKey()
+	jwtToken := jwt.NewWithClaims(maker.method, payload)
+	jwtToken.Header["kid"] = keyID
+
+	token, err := jwtToken.SignedString(signingKey)
+	return token, payload, err
+}
+
+func (maker *JWTPublicMaker) VerifyToken(token string) (*Payload, error) {
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		keyID, _ := token.Header["kid"].(string)
+		publicKey, ok := maker.keyring.PublicKey(keyID)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+
+		// the algorithm is taken from the key, never from the token
+		keyAlg, err := keyAlgorithm(publicKey)
+		if err != nil || token.Method.Alg() != keyAlg {
+			return nil, ErrInvalidToken
+		}
+		return publicKey, nil
+	}
+
+	jwtToken, err := jwt.ParseWithClaims(token, &Payload{}, keyFunc)
+	if err != nil {
+		verr, ok := err.(*jwt.ValidationError)
+		if ok && errors.Is(verr.Inner, ErrExpiredToken) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	payload, ok := jwtToken.Claims.(*Payload)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	payload.applyDefaults()
+	return payload, nil
+}
+
+func (maker *JWTPublicMaker) Keyring() *Keyring {
+	return maker.keyring
+}
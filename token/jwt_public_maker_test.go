@@ -0,0 +1,154 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTPublicMaker(t *testing.T) {
+	testCases := []struct {
+		name      string
+		algorithm string
+		keyring   func(t *testing.T) *Keyring
+	}{
+		{
+			name:      "EdDSA",
+			algorithm: AlgorithmEdDSA,
+			keyring: func(t *testing.T) *Keyring {
+				keyring, err := NewKeyring("ed", randomEd25519Key(t))
+				require.NoError(t, err)
+				return keyring
+			},
+		},
+		{
+			name:      "RS256",
+			algorithm: AlgorithmRS256,
+			keyring: func(t *testing.T) *Keyring {
+				keyring, err := NewKeyring("rsa", randomRSAKey(t))
+				require.NoError(t, err)
+				return keyring
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			maker, err := NewJWTPublicMaker(tc.keyring(t), tc.algorithm)
+			require.NoError(t, err)
+
+			username := utils.RandomOwner()
+			issuedAt := time.Now()
+
+			token, _, err := maker.CreateToken(username, time.Minute)
+			require.NoError(t, err)
+
+			parsed, _, err := new(jwt.Parser).ParseUnverified(token, &Payload{})
+			require.NoError(t, err)
+			require.Equal(t, tc.algorithm, parsed.Method.Alg())
+			require.NotEmpty(t, parsed.Header["kid"])
+
+			payload, err := maker.VerifyToken(token)
+			require.NoError(t, err)
+			require.Equal(t, username, payload.Username)
+			require.Equal(t, TokenTypeAccess, payload.Type)
+			require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Second)
+
+			expiredToken, _, err := maker.CreateToken(username, -time.Minute)
+			require.NoError(t, err)
+
+			_, err = maker.VerifyToken(expiredToken)
+			require.EqualError(t, err, ErrExpiredToken.Error())
+		})
+	}
+}
+
+func TestJWTPublicMakerWrongKeyType(t *testing.T) {
+	keyring, err := NewKeyring("ed", randomEd25519Key(t))
+	require.NoError(t, err)
+
+	_, err = NewJWTPublicMaker(keyring, AlgorithmRS256)
+	require.Error(t, err)
+}
+
+func TestJWTPublicMakerRotationAcrossAlgorithms(t *testing.T) {
+	rsaKey := randomRSAKey(t)
+	rsaKeyring, err := NewKeyring("rsa", rsaKey)
+	require.NoError(t, err)
+
+	rsaMaker, err := NewJWTPublicMaker(rsaKeyring, AlgorithmRS256)
+	require.NoError(t, err)
+
+	token, _, err := rsaMaker.CreateToken(utils.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	edKeyring, err := NewKeyring("ed", randomEd25519Key(t))
+	require.NoError(t, err)
+	require.NoError(t, edKeyring.AddPublicKey("rsa", &rsaKey.PublicKey))
+
+	edMaker, err := NewJWTPublicMaker(edKeyring, AlgorithmEdDSA)
+	require.NoError(t, err)
+
+	_, err = edMaker.VerifyToken(token)
+	require.NoError(t, err)
+}
+
+func TestJWTPublicMakerUnknownKeyID(t *testing.T) {
+	keyring, err := NewKeyring("ed", randomEd25519Key(t))
+	require.NoError(t, err)
+
+	maker, err := NewJWTPublicMaker(keyring, AlgorithmEdDSA)
+	require.NoError(t, err)
+
+	payload, err := NewPayload(utils.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodEdDSA, payload)
+	jwtToken.Header["kid"] = "unknown"
+	token, err := jwtToken.SignedString(randomEd25519Key(t))
+	require.NoError(t, err)
+
+	_, err = maker.VerifyToken(token)
+	require.EqualError(t, err, ErrInvalidToken.Error())
+}
+
+func TestJWTPublicMakerAlgorithmConfusion(t *testing.T) {
+	signingKey := randomEd25519Key(t)
+	keyring, err := NewKeyring("ed", signingKey)
+	require.NoError(t, err)
+
+	maker, err := NewJWTPublicMaker(keyring, AlgorithmEdDSA)
+	require.NoError(t, err)
+
+	payload, err := NewPayload(utils.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	// HMAC keyed with the published public key must not be accepted
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(signingKey.Public().(ed25519.PublicKey))
+	require.NoError(t, err)
+
+	for _, secret := range [][]byte{publicKeyDER, signingKey.Public().(ed25519.PublicKey)} {
+		jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
+		jwtToken.Header["kid"] = "ed"
+		token, err := jwtToken.SignedString(secret)
+		require.NoError(t, err)
+
+		_, err = maker.VerifyToken(token)
+		require.EqualError(t, err, ErrInvalidToken.Error())
+	}
+
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodNone, payload)
+	jwtToken.Header["kid"] = "ed"
+	token, err := jwtToken.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	_, err = maker.VerifyToken(token)
+	require.EqualError(t, err, ErrInvalidToken.Error())
+}
@@ -0,0 +1,166 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const minRSAKeyBits = 2048
+
+// Keyring holds the private key new tokens are signed with, and the public key
+// of every key whose tokens are still accepted, by key id. Keys are rotated by
+// adding a new key, signing with it, and dropping the old one once the tokens
+// it signed have expired.
+type Keyring struct {
+	signingKeyID string
+	signingKey   crypto.Signer
+	publicKeys   map[string]crypto.PublicKey
+}
+
+// NewKeyring returns a keyring signing with the given Ed25519 or RSA key
+func NewKeyring(signingKeyID string, signingKey crypto.Signer) (*Keyring, error) {
+	keyring := &Keyring{
+		signingKeyID: signingKeyID,
+		signingKey:   signingKey,
+		publicKeys:   make(map[string]crypto.PublicKey),
+	}
+
+	err := keyring.AddPublicKey(signingKeyID, signingKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	return keyring, nil
+}
+
+// AddPublicKey accepts the tokens signed by another key from now on
+func (keyring *Keyring) AddPublicKey(keyID string, publicKey crypto.PublicKey) error {
+	if keyID == "" {
+		return fmt.Errorf("key id must not be empty")
+	}
+	if _, ok := keyring.publicKeys[keyID]; ok {
+		return fmt.Errorf("duplicate key id %q", keyID)
+	}
+	if _, err := keyAlgorithm(publicKey); err != nil {
+		return fmt.Errorf("key %q: %w", keyID, err)
+	}
+
+	keyring.publicKeys[keyID] = publicKey
+	return nil
+}
+
+// SigningKey returns the key new tokens are signed with, and its id
+func (keyring *Keyring) SigningKey() (string, crypto.Signer) {
+	return keyring.signingKeyID, keyring.signingKey
+}
+
+// PublicKey returns the public key with the given id, ok is false if there is none
+func (keyring *Keyring) PublicKey(keyID string) (publicKey crypto.PublicKey, ok bool) {
+	publicKey, ok = keyring.publicKeys[keyID]
+	return
+}
+
+// KeyIDs returns the ids of all the public keys, sorted
+func (keyring *Keyring) KeyIDs() []string {
+	keyIDs := make([]string, 0, len(keyring.publicKeys))
+	for keyID := range keyring.publicKeys {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+	return keyIDs
+}
+
+// LoadKeyring reads every <key id>.pem file in dir. Private keys are in PKCS #8
+// and public keys in PKIX form, the private key with signingKeyID signs the new
+// tokens and the others only verify them.
+func LoadKeyring(dir string, signingKeyID string) (*Keyring, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	var signingKey crypto.Signer
+	publicKeys := make(map[string]crypto.PublicKey)
+	for _, file := range files {
+		keyID := strings.TrimSuffix(filepath.Base(file), ".pem")
+
+		key, err := readPEMKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read key %q: %w", keyID, err)
+		}
+
+		if signer, ok := key.(crypto.Signer); ok {
+			if keyID == signingKeyID {
+				signingKey = signer
+				continue
+			}
+			key = signer.Public()
+		}
+		publicKeys[keyID] = key
+	}
+
+	if signingKey == nil {
+		return nil, fmt.Errorf("private key %q not found in %s", signingKeyID, dir)
+	}
+
+	keyring, err := NewKeyring(signingKeyID, signingKey)
+	if err != nil {
+		return nil, err
+	}
+	for keyID, publicKey := range publicKeys {
+		err = keyring.AddPublicKey(keyID, publicKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keyring, nil
+}
+
+func readPEMKey(file string) (any, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
+
+// Signature algorithms, named as in JWS
+const (
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmRS256 = "RS256"
+)
+
+// keyAlgorithm returns the algorithm the public key verifies signatures with
+func keyAlgorithm(publicKey crypto.PublicKey) (string, error) {
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		return AlgorithmEdDSA, nil
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return "", fmt.Errorf("rsa key must be at least %d bits", minRSAKeyBits)
+		}
+		return AlgorithmRS256, nil
+	default:
+		return "", fmt.Errorf("unsupported key type %T", publicKey)
+	}
+}
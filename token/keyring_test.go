@@ -0,0 +1,126 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func randomEd25519Key(t *testing.T) ed25519.PrivateKey {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return privateKey
+}
+
+func randomRSAKey(t *testing.T) *rsa.PrivateKey {
+	privateKey, err := rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+	require.NoError(t, err)
+	return privateKey
+}
+
+func writePrivateKey(t *testing.T, dir string, keyID string, privateKey crypto.Signer) {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	writePEM(t, filepath.Join(dir, keyID+".pem"), "PRIVATE KEY", der)
+}
+
+func writePublicKey(t *testing.T, dir string, keyID string, publicKey crypto.PublicKey) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.NoError(t, err)
+	writePEM(t, filepath.Join(dir, keyID+".pem"), "PUBLIC KEY", der)
+}
+
+func writePEM(t *testing.T, file string, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(file, data, 0600))
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir := t.TempDir()
+
+	signingKey := randomEd25519Key(t)
+	oldKey := randomRSAKey(t)
+	otherKey := randomEd25519Key(t)
+
+	writePrivateKey(t, dir, "2024-02", signingKey)
+	writePrivateKey(t, dir, "2024-01", oldKey)
+	writePublicKey(t, dir, "other", otherKey.Public())
+
+	keyring, err := LoadKeyring(dir, "2024-02")
+	require.NoError(t, err)
+
+	keyID, key := keyring.SigningKey()
+	require.Equal(t, "2024-02", keyID)
+	require.Equal(t, signingKey, key)
+	require.Equal(t, []string{"2024-01", "2024-02", "other"}, keyring.KeyIDs())
+
+	publicKey, ok := keyring.PublicKey("2024-01")
+	require.True(t, ok)
+	require.Equal(t, &oldKey.PublicKey, publicKey)
+
+	publicKey, ok = keyring.PublicKey("other")
+	require.True(t, ok)
+	require.Equal(t, otherKey.Public(), publicKey)
+
+	_, ok = keyring.PublicKey("unknown")
+	require.False(t, ok)
+}
+
+func TestLoadKeyringWithoutSigningKey(t *testing.T) {
+	dir := t.TempDir()
+	writePublicKey(t, dir, "2024-01", randomEd25519Key(t).Public())
+
+	_, err := LoadKeyring(dir, "2024-01")
+	require.Error(t, err)
+
+	_, err = LoadKeyring(dir, "missing")
+	require.Error(t, err)
+}
+
+func TestKeyringRejectsWeakRSAKey(t *testing.T) {
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	_, err = NewKeyring("weak", weakKey)
+	require.Error(t, err)
+
+	keyring, err := NewKeyring("strong", randomEd25519Key(t))
+	require.NoError(t, err)
+	require.Error(t, keyring.AddPublicKey("weak", &weakKey.PublicKey))
+	require.Error(t, keyring.AddPublicKey("strong", randomEd25519Key(t).Public()))
+}
+
+func TestJSONWebKeySet(t *testing.T) {
+	edKey := randomEd25519Key(t)
+	rsaKey := randomRSAKey(t)
+
+	keyring, err := NewKeyring("ed", edKey)
+	require.NoError(t, err)
+	require.NoError(t, keyring.AddPublicKey("rsa", &rsaKey.PublicKey))
+
+	set := keyring.JSONWebKeySet()
+	require.Len(t, set.Keys, 2)
+
+	edJWK := set.Keys[0]
+	require.Equal(t, "ed", edJWK.KeyID)
+	require.Equal(t, "OKP", edJWK.KeyType)
+	require.Equal(t, "Ed25519", edJWK.Curve)
+	require.Equal(t, AlgorithmEdDSA, edJWK.Algorithm)
+	require.Equal(t, "sig", edJWK.Use)
+	require.NotEmpty(t, edJWK.X)
+
+	rsaJWK := set.Keys[1]
+	require.Equal(t, "rsa", rsaJWK.KeyID)
+	require.Equal(t, "RSA", rsaJWK.KeyType)
+	require.Equal(t, AlgorithmRS256, rsaJWK.Algorithm)
+	require.Equal(t, "AQAB", rsaJWK.E)
+	require.NotEmpty(t, rsaJWK.N)
+}
@@ -1,8 +1,56 @@
 package token
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+)
+
+// Token makers that can be selected with TOKEN_MAKER
+const (
+	PasetoLocal  = "paseto_local"
+	PasetoPublic = "paseto_public"
+	JWTHS256     = "jwt_hs256"
+	JWTEdDSA     = "jwt_eddsa"
+	JWTRS256     = "jwt_rs256"
+)
 
 type Maker interface {
-	CreateToken(username string, duration time.Duration) (string, error)
+	CreateToken(username string, duration time.Duration, opts ...PayloadOption) (string, *Payload, error)
 	VerifyToken(token string) (*Payload, error)
 }
+
+// PublicKeyMaker is a maker whose tokens can be verified with public keys
+type PublicKeyMaker interface {
+	Maker
+	Keyring() *Keyring
+}
+
+// NewMaker creates the token maker selected by config.TokenMaker, the asymmetric
+// ones load their keys from config.TokenKeysDir
+func NewMaker(config utils.Config) (Maker, error) {
+	switch config.TokenMaker {
+	case PasetoLocal, "":
+		return NewPasetoMaker(config.TokenSymmetricKey)
+	case JWTHS256:
+		return NewJWTMaker(config.TokenSymmetricKey)
+	case PasetoPublic, JWTEdDSA, JWTRS256:
+	default:
+		return nil, fmt.Errorf("unsupported token maker %q", config.TokenMaker)
+	}
+
+	keyring, err := LoadKeyring(config.TokenKeysDir, config.TokenSigningKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.TokenMaker {
+	case PasetoPublic:
+		return NewPasetoPublicMaker(keyring)
+	case JWTEdDSA:
+		return NewJWTPublicMaker(keyring, AlgorithmEdDSA)
+	default:
+		return NewJWTPublicMaker(keyring, AlgorithmRS256)
+	}
+}
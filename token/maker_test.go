@@ -0,0 +1,54 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMaker(t *testing.T) {
+	dir := t.TempDir()
+	writePrivateKey(t, dir, "ed", randomEd25519Key(t))
+	writePrivateKey(t, dir, "rsa", randomRSAKey(t))
+
+	testCases := []struct {
+		name       string
+		config     utils.Config
+		publicKeys bool
+		ok         bool
+	}{
+		{name: "Default", config: utils.Config{TokenSymmetricKey: utils.RandomString(32)}, ok: true},
+		{name: "PasetoLocal", config: utils.Config{TokenMaker: PasetoLocal, TokenSymmetricKey: utils.RandomString(32)}, ok: true},
+		{name: "JWTHS256", config: utils.Config{TokenMaker: JWTHS256, TokenSymmetricKey: utils.RandomString(32)}, ok: true},
+		{name: "PasetoPublic", config: utils.Config{TokenMaker: PasetoPublic, TokenKeysDir: dir, TokenSigningKeyID: "ed"}, publicKeys: true, ok: true},
+		{name: "JWTEdDSA", config: utils.Config{TokenMaker: JWTEdDSA, TokenKeysDir: dir, TokenSigningKeyID: "ed"}, publicKeys: true, ok: true},
+		{name: "JWTRS256", config: utils.Config{TokenMaker: JWTRS256, TokenKeysDir: dir, TokenSigningKeyID: "rsa"}, publicKeys: true, ok: true},
+		{name: "JWTRS256WithEd25519Key", config: utils.Config{TokenMaker: JWTRS256, TokenKeysDir: dir, TokenSigningKeyID: "ed"}},
+		{name: "MissingSigningKey", config: utils.Config{TokenMaker: JWTEdDSA, TokenKeysDir: dir, TokenSigningKeyID: "missing"}},
+		{name: "Unsupported", config: utils.Config{TokenMaker: "unsupported", TokenSymmetricKey: utils.RandomString(32)}},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			maker, err := NewMaker(tc.config)
+			if !tc.ok {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			_, isPublicKeyMaker := maker.(PublicKeyMaker)
+			require.Equal(t, tc.publicKeys, isPublicKeyMaker)
+
+			token, _, err := maker.CreateToken(utils.RandomOwner(), time.Minute)
+			require.NoError(t, err)
+
+			_, err = maker.VerifyToken(token)
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"time"
+
+	"github.com/o1egl/paseto"
+)
+
+// PasetoPublicMaker signs PASETO v2.public tokens with Ed25519, so that they
+// can be verified with the public keys alone
+type PasetoPublicMaker struct {
+	paseto  *paseto.V2
+	keyring *Keyring
+}
+
+type pasetoFooter struct {
+	KeyID string `json:"kid"`
+}
+
+func NewPasetoPublicMaker(keyring *Keyring) (Maker, error) {
+	_, signingKey := keyring.SigningKey()
+	if _, ok := signingKey.(ed25519.PrivateKey); !ok {
+		return nil, fmt.Errorf("invalid signing key: paseto v2.public needs an Ed25519 key")
+	}
+
+	maker := &PasetoPublicMaker{
+		paseto:  paseto.NewV2(),
+		keyring: keyring,
+	}
+
+	return maker, nil
+}
+
+func (maker *PasetoPublicMaker) CreateToken(username string, duration time.Duration, opts ...PayloadOption) (string, *Payload, error) {
+	payload, err := NewPayload(username, duration, opts...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	keyID, signingKey := maker.keyring.SigningKey()
+	token, err := maker.paseto.Sign(signingKey, payload, pasetoFooter{KeyID: keyID})
+	return token, payload, err
+}
+
+func (maker *PasetoPublicMaker) VerifyToken(token string) (*Payload, error) {
+	var footer pasetoFooter
+	err := paseto.ParseFooter(token, &footer)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	publicKey, ok := maker.keyring.PublicKey(footer.KeyID)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	payload := &Payload{}
+	err = maker.paseto.Verify(token, publicKey, payload, nil)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	err = payload.Valid()
+	if err != nil {
+		return nil, err
+	}
+
+	payload.applyDefaults()
+	return payload, nil
+}
+
+func (maker *PasetoPublicMaker) Keyring() *Keyring {
+	return maker.keyring
+}
@@ -0,0 +1,132 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasetoPublicMaker(t *testing.T) {
+	keyring, err := NewKeyring("2024-01", randomEd25519Key(t))
+	require.NoError(t, err)
+
+	maker, err := NewPasetoPublicMaker(keyring)
+	require.NoError(t, err)
+
+	username := utils.RandomOwner()
+	duration := time.Minute
+
+	issuedAt := time.Now()
+	expiredAt := issuedAt.Add(duration)
+
+	token, payload, err := maker.CreateToken(username, duration, WithRole(utils.BankerRole))
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+	require.NotEmpty(t, payload)
+
+	payload, err = maker.VerifyToken(token)
+	require.NoError(t, err)
+
+	require.NotZero(t, payload.ID)
+	require.Equal(t, TokenTypeAccess, payload.Type)
+	require.Equal(t, username, payload.Username)
+	require.Equal(t, utils.BankerRole, payload.Role)
+	require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Second)
+	require.WithinDuration(t, expiredAt, payload.ExpiredAt, time.Second)
+}
+
+func TestPasetoPublicMakerKeyRotation(t *testing.T) {
+	oldKey := randomEd25519Key(t)
+	oldKeyring, err := NewKeyring("old", oldKey)
+	require.NoError(t, err)
+
+	oldMaker, err := NewPasetoPublicMaker(oldKeyring)
+	require.NoError(t, err)
+
+	token, _, err := oldMaker.CreateToken(utils.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	// tokens signed with the old key are still accepted after the rotation
+	newKeyring, err := NewKeyring("new", randomEd25519Key(t))
+	require.NoError(t, err)
+	require.NoError(t, newKeyring.AddPublicKey("old", oldKey.Public()))
+
+	newMaker, err := NewPasetoPublicMaker(newKeyring)
+	require.NoError(t, err)
+
+	_, err = newMaker.VerifyToken(token)
+	require.NoError(t, err)
+
+	// and rejected once the old key is dropped
+	droppedKeyring, err := NewKeyring("new", randomEd25519Key(t))
+	require.NoError(t, err)
+
+	droppedMaker, err := NewPasetoPublicMaker(droppedKeyring)
+	require.NoError(t, err)
+
+	_, err = droppedMaker.VerifyToken(token)
+	require.EqualError(t, err, ErrInvalidToken.Error())
+}
+
+func TestPasetoPublicMakerForgedKeyID(t *testing.T) {
+	keyring, err := NewKeyring("2024-01", randomEd25519Key(t))
+	require.NoError(t, err)
+
+	maker, err := NewPasetoPublicMaker(keyring)
+	require.NoError(t, err)
+
+	// a token signed by another key, claiming to be signed by ours
+	forgedKeyring, err := NewKeyring("2024-01", randomEd25519Key(t))
+	require.NoError(t, err)
+
+	forgedMaker, err := NewPasetoPublicMaker(forgedKeyring)
+	require.NoError(t, err)
+
+	token, _, err := forgedMaker.CreateToken(utils.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	_, err = maker.VerifyToken(token)
+	require.EqualError(t, err, ErrInvalidToken.Error())
+}
+
+func TestExpiredPasetoPublicToken(t *testing.T) {
+	keyring, err := NewKeyring("2024-01", randomEd25519Key(t))
+	require.NoError(t, err)
+
+	maker, err := NewPasetoPublicMaker(keyring)
+	require.NoError(t, err)
+
+	token, _, err := maker.CreateToken(utils.RandomOwner(), -time.Minute)
+	require.NoError(t, err)
+
+	payload, err := maker.VerifyToken(token)
+	require.EqualError(t, err, ErrExpiredToken.Error())
+	require.Nil(t, payload)
+}
+
+func TestPasetoPublicMakerRejectsLocalToken(t *testing.T) {
+	keyring, err := NewKeyring("2024-01", randomEd25519Key(t))
+	require.NoError(t, err)
+
+	maker, err := NewPasetoPublicMaker(keyring)
+	require.NoError(t, err)
+
+	localMaker, err := NewPasetoMaker(utils.RandomString(32))
+	require.NoError(t, err)
+
+	token, _, err := localMaker.CreateToken(utils.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+
+	_, err = maker.VerifyToken(token)
+	require.EqualError(t, err, ErrInvalidToken.Error())
+}
+
+func TestPasetoPublicMakerNeedsEd25519Key(t *testing.T) {
+	keyring, err := NewKeyring("rsa", randomRSAKey(t))
+	require.NoError(t, err)
+
+	_, err = NewPasetoPublicMaker(keyring)
+	require.Error(t, err)
+}
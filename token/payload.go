@@ -4,6 +4,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/andreanpradanaa/simple-bank-app/utils"
 	"github.com/google/uuid"
 )
 
@@ -12,14 +13,73 @@ var (
 	ErrExpiredToken = errors.New("token has expired")
 )
 
+// Token types, a token is only accepted where its type is expected.
+// No token is issued with the api key type, it marks the payloads built for api keys.
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+	TokenTypeMFA     = "mfa"
+	TokenTypeAPIKey  = "api_key"
+	// a step-up challenge is exchanged for a step-up token, which proves the user
+	// authenticated again for the one action it is bound to
+	TokenTypeStepUpChallenge = "step_up_challenge"
+	TokenTypeStepUp          = "step_up"
+	// a session revoke token signs out the session it is bound to, it is sent
+	// to the user when their account is logged in to from a new device
+	TokenTypeSessionRevoke = "session_revoke"
+)
+
 type Payload struct {
 	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	SessionID uuid.UUID `json:"session_id"`
 	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	Scopes    []string  `json:"scopes"`
+	Binding   string    `json:"binding,omitempty"`
 	IssuedAt  time.Time `json:"issued_at"`
 	ExpiredAt time.Time `json:"expired_at"`
 }
 
-func NewPayload(username string, duration time.Duration) (*Payload, error) {
+// PayloadOption customizes a payload before it is signed
+type PayloadOption func(payload *Payload)
+
+// WithType sets the token type, tokens are access tokens by default
+func WithType(tokenType string) PayloadOption {
+	return func(payload *Payload) {
+		payload.Type = tokenType
+	}
+}
+
+// WithSessionID ties the token to the login session it was issued for
+func WithSessionID(sessionID uuid.UUID) PayloadOption {
+	return func(payload *Payload) {
+		payload.SessionID = sessionID
+	}
+}
+
+// WithRole sets the role of the user the token is issued to, depositor by default
+func WithRole(role string) PayloadOption {
+	return func(payload *Payload) {
+		payload.Role = role
+	}
+}
+
+// WithScopes limits what the token can be used for, tokens get every scope by default
+func WithScopes(scopes []string) PayloadOption {
+	return func(payload *Payload) {
+		payload.Scopes = scopes
+	}
+}
+
+// WithBinding ties the token to a single action, identified by a digest of its parameters
+func WithBinding(binding string) PayloadOption {
+	return func(payload *Payload) {
+		payload.Binding = binding
+	}
+}
+
+func NewPayload(username string, duration time.Duration, opts ...PayloadOption) (*Payload, error) {
 	tokenID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
@@ -27,10 +87,16 @@ func NewPayload(username string, duration time.Duration) (*Payload, error) {
 
 	payload := &Payload{
 		ID:        tokenID,
+		Type:      TokenTypeAccess,
 		Username:  username,
+		Role:      utils.DepositorRole,
+		Scopes:    utils.AllScopes(),
 		IssuedAt:  time.Now(),
 		ExpiredAt: time.Now().Add(duration),
 	}
+	for _, opt := range opts {
+		opt(payload)
+	}
 	return payload, nil
 }
 
@@ -40,3 +106,26 @@ func (payload *Payload) Valid() error {
 	}
 	return nil
 }
+
+// applyDefaults fills in the claims that tokens issued by older versions did not carry
+func (payload *Payload) applyDefaults() {
+	if payload.Type == "" {
+		payload.Type = TokenTypeAccess
+	}
+	if payload.Role == "" {
+		payload.Role = utils.DepositorRole
+	}
+	if payload.Scopes == nil {
+		payload.Scopes = utils.AllScopes()
+	}
+}
+
+// HasScope returns true if the token was granted the scope
+func (payload *Payload) HasScope(scope string) bool {
+	for _, granted := range payload.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package token
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/andreanpradanaa/simple-bank-app/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadScopes(t *testing.T) {
+	payload, err := NewPayload(utils.RandomOwner(), time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, utils.AllScopes(), payload.Scopes)
+	require.True(t, payload.HasScope(utils.ScopeTransfersWrite))
+
+	payload, err = NewPayload(utils.RandomOwner(), time.Minute, WithScopes([]string{utils.ScopeAccountsRead}))
+	require.NoError(t, err)
+	require.True(t, payload.HasScope(utils.ScopeAccountsRead))
+	require.False(t, payload.HasScope(utils.ScopeAccountsWrite))
+	require.False(t, payload.HasScope(utils.ScopeTransfersWrite))
+}
+
+func TestScopedTokenRoundTrip(t *testing.T) {
+	maker, err := NewPasetoMaker(utils.RandomString(32))
+	require.NoError(t, err)
+
+	scopes := []string{utils.ScopeAccountsRead}
+	token, _, err := maker.CreateToken(utils.RandomOwner(), time.Minute, WithScopes(scopes))
+	require.NoError(t, err)
+
+	payload, err := maker.VerifyToken(token)
+	require.NoError(t, err)
+	require.Equal(t, scopes, payload.Scopes)
+}
+
+func TestLegacyPayloadGetsEveryScope(t *testing.T) {
+	// tokens issued before scopes existed could do everything
+	var payload Payload
+	err := json.Unmarshal([]byte(`{"username":"legacy"}`), &payload)
+	require.NoError(t, err)
+
+	payload.applyDefaults()
+	require.Equal(t, utils.AllScopes(), payload.Scopes)
+}
+
+func TestBoundTokenRoundTrip(t *testing.T) {
+	maker, err := NewPasetoMaker(utils.RandomString(32))
+	require.NoError(t, err)
+
+	binding := utils.RandomString(32)
+	token, _, err := maker.CreateToken(utils.RandomOwner(), time.Minute, WithType(TokenTypeStepUp), WithBinding(binding))
+	require.NoError(t, err)
+
+	payload, err := maker.VerifyToken(token)
+	require.NoError(t, err)
+	require.Equal(t, TokenTypeStepUp, payload.Type)
+	require.Equal(t, binding, payload.Binding)
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// An account number is laid out like an IBAN: the 3-letter currency code,
+// 2 mod-97 check digits, a 4-digit branch code and a 10-digit serial number,
+// e.g. USD4200010000000042.
+const (
+	accountNumberBranchLength = 4
+	accountNumberSerialLength = 10
+	accountNumberLength       = 3 + 2 + accountNumberBranchLength + accountNumberSerialLength
+)
+
+// NewAccountNumber returns the account number for the given currency, branch and serial
+func NewAccountNumber(currency string, branch string, serial int64) (string, error) {
+	if len(currency) != 3 || !isUpperAlpha(currency) {
+		return "", fmt.Errorf("invalid currency code %q", currency)
+	}
+	if err := ValidateBranchCode(branch); err != nil {
+		return "", err
+	}
+
+	bban := fmt.Sprintf("%s%0*d", branch, accountNumberSerialLength, serial)
+	if serial < 0 || len(bban) != accountNumberBranchLength+accountNumberSerialLength {
+		return "", fmt.Errorf("invalid serial number %d", serial)
+	}
+
+	checkDigits := 98 - mod97(bban+currency+"00")
+	return fmt.Sprintf("%s%02d%s", currency, checkDigits, bban), nil
+}
+
+// ValidateBranchCode returns an error unless the branch code is exactly 4 digits
+func ValidateBranchCode(branch string) error {
+	if len(branch) != accountNumberBranchLength || !isDigits(branch) {
+		return fmt.Errorf("invalid branch code %q: must be exactly %d digits", branch, accountNumberBranchLength)
+	}
+	return nil
+}
+
+// NormalizeAccountNumber strips spaces and upper-cases the account number
+func NormalizeAccountNumber(accountNumber string) string {
+	return strings.ToUpper(strings.ReplaceAll(accountNumber, " ", ""))
+}
+
+// IsValidAccountNumber returns true if the account number is well-formed and its check digits are correct
+func IsValidAccountNumber(accountNumber string) bool {
+	accountNumber = NormalizeAccountNumber(accountNumber)
+	if len(accountNumber) != accountNumberLength {
+		return false
+	}
+
+	currency, rest := accountNumber[:3], accountNumber[3:]
+	if !isUpperAlpha(currency) || !isDigits(rest) {
+		return false
+	}
+
+	// check digits are always in 02..98, so 00, 01 and 99 would only collide
+	// with 97, 98 and 02 respectively
+	checkDigits := rest[:2]
+	if checkDigits < "02" || checkDigits > "98" {
+		return false
+	}
+
+	return mod97(rest[2:]+currency+checkDigits) == 1
+}
+
+// mod97 computes the ISO 7064 mod 97-10 remainder, with letters expanded to A=10 ... Z=35
+func mod97(s string) int64 {
+	var digits strings.Builder
+	for _, c := range s {
+		if c >= 'A' && c <= 'Z' {
+			digits.WriteString(fmt.Sprint(c - 'A' + 10))
+			continue
+		}
+		digits.WriteRune(c)
+	}
+
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	if !ok {
+		return -1
+	}
+	return new(big.Int).Mod(n, big.NewInt(97)).Int64()
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isUpperAlpha(s string) bool {
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
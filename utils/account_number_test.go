@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountNumber(t *testing.T) {
+	serial := RandomInt(1, 9999999999)
+
+	accountNumber, err := NewAccountNumber(USD, "0001", serial)
+	require.NoError(t, err)
+	require.Len(t, accountNumber, accountNumberLength)
+	require.Equal(t, USD, accountNumber[:3])
+	require.True(t, IsValidAccountNumber(accountNumber))
+
+	// a single mistyped digit must be detected
+	mistyped := []byte(accountNumber)
+	mistyped[len(mistyped)-1] = '0' + (mistyped[len(mistyped)-1]-'0'+1)%10
+	require.False(t, IsValidAccountNumber(string(mistyped)))
+
+	require.True(t, IsValidAccountNumber("usd"+accountNumber[3:7]+" "+accountNumber[7:]))
+}
+
+func TestAccountNumberCheckDigitsRange(t *testing.T) {
+	// serial 44 gets check digits 97, which are congruent to 00
+	accountNumber, err := NewAccountNumber(USD, "0001", 44)
+	require.NoError(t, err)
+	require.Equal(t, "USD9700010000000044", accountNumber)
+	require.True(t, IsValidAccountNumber(accountNumber))
+	require.False(t, IsValidAccountNumber("USD0000010000000044"))
+}
+
+func TestKnownAccountNumber(t *testing.T) {
+	accountNumber, err := NewAccountNumber(EUR, "0001", 1)
+	require.NoError(t, err)
+	require.Equal(t, "EUR7200010000000001", accountNumber)
+}
+
+func TestInvalidAccountNumber(t *testing.T) {
+	_, err := NewAccountNumber("usd", "0001", 1)
+	require.Error(t, err)
+
+	_, err = NewAccountNumber(USD, "1", 1)
+	require.Error(t, err)
+
+	_, err = NewAccountNumber(USD, "0001", -1)
+	require.Error(t, err)
+
+	_, err = NewAccountNumber(USD, "0001", 10000000000)
+	require.Error(t, err)
+
+	require.False(t, IsValidAccountNumber(""))
+	require.False(t, IsValidAccountNumber("42"))
+	require.False(t, IsValidAccountNumber("1234567890123456789"))
+}
+
+func TestValidateBranchCode(t *testing.T) {
+	require.NoError(t, ValidateBranchCode("0001"))
+
+	for _, branch := range []string{"", "1", "00001", "00a1", " 001"} {
+		require.Error(t, ValidateBranchCode(branch), branch)
+	}
+}
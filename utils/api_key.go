@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// An api key looks like sbk_<prefix>_<secret>. The prefix is stored as is to
+// look the key up and to let users tell their keys apart, only the hash of the
+// secret is stored.
+const (
+	apiKeyTag         = "sbk_"
+	apiKeyPrefixBytes = 6
+	apiKeySecretBytes = 32
+)
+
+// NewAPIKey returns a random api key to hand out to the user, together with its
+// prefix and the hash of its secret that are kept in the database
+func NewAPIKey() (key string, prefix string, secretHash string, err error) {
+	buf := make([]byte, apiKeyPrefixBytes+apiKeySecretBytes)
+	if _, err = rand.Read(buf); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+
+	prefix = hex.EncodeToString(buf[:apiKeyPrefixBytes])
+	secret := hex.EncodeToString(buf[apiKeyPrefixBytes:])
+	return apiKeyTag + prefix + "_" + secret, prefix, HashSecretToken(secret), nil
+}
+
+// ParseAPIKey splits the api key into its prefix and secret, ok is false if it is malformed
+func ParseAPIKey(key string) (prefix string, secret string, ok bool) {
+	rest, found := strings.CutPrefix(key, apiKeyTag)
+	if !found {
+		return "", "", false
+	}
+
+	prefix, secret, found = strings.Cut(rest, "_")
+	if !found || len(prefix) != 2*apiKeyPrefixBytes || len(secret) != 2*apiKeySecretBytes {
+		return "", "", false
+	}
+	return prefix, secret, true
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKey(t *testing.T) {
+	key, prefix, secretHash, err := NewAPIKey()
+	require.NoError(t, err)
+	require.Contains(t, key, prefix)
+
+	gotPrefix, secret, ok := ParseAPIKey(key)
+	require.True(t, ok)
+	require.Equal(t, prefix, gotPrefix)
+	require.Equal(t, secretHash, HashSecretToken(secret))
+
+	key2, prefix2, _, err := NewAPIKey()
+	require.NoError(t, err)
+	require.NotEqual(t, key, key2)
+	require.NotEqual(t, prefix, prefix2)
+}
+
+func TestParseInvalidAPIKey(t *testing.T) {
+	key, _, _, err := NewAPIKey()
+	require.NoError(t, err)
+
+	for _, invalid := range []string{
+		"",
+		key[len(apiKeyTag):],
+		"xyz_" + key[len(apiKeyTag):],
+		key[:len(key)-1],
+		key[:len(apiKeyTag)+2*apiKeyPrefixBytes],
+	} {
+		_, _, ok := ParseAPIKey(invalid)
+		require.False(t, ok, invalid)
+	}
+}
@@ -1,17 +1,89 @@
 package utils
 
 import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	DBDriver            string        `mapstructure:"DB_DRIVER"`
-	DBSource            string        `mapstructure:"DB_SOURCE"`
-	HTTPServerAddress   string        `mapstructure:"HTTP_SERVER_ADDRESS"`
-	TokenSymmetricKey   string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`
-	AccessTokenDuration time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	DBDriver                        string        `mapstructure:"DB_DRIVER"`
+	DBSource                        string        `mapstructure:"DB_SOURCE"`
+	HTTPServerAddress               string        `mapstructure:"HTTP_SERVER_ADDRESS"`
+	TrustedProxies                  []string      `mapstructure:"TRUSTED_PROXIES"`
+	AuthCookieDomain                string        `mapstructure:"AUTH_COOKIE_DOMAIN"`
+	AuthCookieSameSite              string        `mapstructure:"AUTH_COOKIE_SAME_SITE"`
+	AuthCookieSecure                bool          `mapstructure:"AUTH_COOKIE_SECURE"`
+	TokenMaker                      string        `mapstructure:"TOKEN_MAKER"`
+	TokenSymmetricKey               string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`
+	TokenKeysDir                    string        `mapstructure:"TOKEN_KEYS_DIR"`
+	TokenSigningKeyID               string        `mapstructure:"TOKEN_SIGNING_KEY_ID"`
+	AccessTokenDuration             time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	RefreshTokenDuration            time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
+	SessionBindClient               bool          `mapstructure:"SESSION_BIND_CLIENT"`
+	RevocationSyncInterval          time.Duration `mapstructure:"REVOCATION_SYNC_INTERVAL"`
+	AuthCacheDuration               time.Duration `mapstructure:"AUTH_CACHE_DURATION"`
+	AccountBranchCode               string        `mapstructure:"ACCOUNT_BRANCH_CODE"`
+	MailerType                      string        `mapstructure:"MAILER_TYPE"`
+	MailOutboxDir                   string        `mapstructure:"MAIL_OUTBOX_DIR"`
+	EmailSenderAddress              string        `mapstructure:"EMAIL_SENDER_ADDRESS"`
+	SMTPHost                        string        `mapstructure:"SMTP_HOST"`
+	SMTPPort                        string        `mapstructure:"SMTP_PORT"`
+	SMTPUsername                    string        `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword                    string        `mapstructure:"SMTP_PASSWORD"`
+	PasswordResetDuration           time.Duration `mapstructure:"PASSWORD_RESET_DURATION"`
+	PasswordResetURL                string        `mapstructure:"PASSWORD_RESET_URL"`
+	EmailVerificationPolicy         string        `mapstructure:"EMAIL_VERIFICATION_POLICY"`
+	EmailVerificationDuration       time.Duration `mapstructure:"EMAIL_VERIFICATION_DURATION"`
+	EmailVerificationResendInterval time.Duration `mapstructure:"EMAIL_VERIFICATION_RESEND_INTERVAL"`
+	EmailVerificationURL            string        `mapstructure:"EMAIL_VERIFICATION_URL"`
+	SessionRevokeURL                string        `mapstructure:"SESSION_REVOKE_URL"`
+	TOTPIssuer                      string        `mapstructure:"TOTP_ISSUER"`
+	TOTPEncryptionKey               string        `mapstructure:"TOTP_ENCRYPTION_KEY"`
+	MFAChallengeDuration            time.Duration `mapstructure:"MFA_CHALLENGE_DURATION"`
+	LoginBackoffBase                time.Duration `mapstructure:"LOGIN_BACKOFF_BASE"`
+	LoginLockoutThreshold           int           `mapstructure:"LOGIN_LOCKOUT_THRESHOLD"`
+	LoginIPLockoutThreshold         int           `mapstructure:"LOGIN_IP_LOCKOUT_THRESHOLD"`
+	LoginLockoutDuration            time.Duration `mapstructure:"LOGIN_LOCKOUT_DURATION"`
+	PasswordHasher                  string        `mapstructure:"PASSWORD_HASHER"`
+	BcryptCost                      int           `mapstructure:"BCRYPT_COST"`
+	Argon2Time                      int           `mapstructure:"ARGON2_TIME"`
+	Argon2Memory                    int           `mapstructure:"ARGON2_MEMORY"`
+	Argon2Threads                   int           `mapstructure:"ARGON2_THREADS"`
+	PasswordMinLength               int           `mapstructure:"PASSWORD_MIN_LENGTH"`
+	// OIDCProviders is set as a JSON array in the environment
+	OIDCProviders           []OIDCProviderConfig `mapstructure:"OIDC_PROVIDERS"`
+	OIDCAuthRequestDuration time.Duration        `mapstructure:"OIDC_AUTH_REQUEST_DURATION"`
+	WebAuthnRPID            string               `mapstructure:"WEBAUTHN_RP_ID"`
+	WebAuthnRPDisplayName   string               `mapstructure:"WEBAUTHN_RP_DISPLAY_NAME"`
+	WebAuthnRPOrigins       []string             `mapstructure:"WEBAUTHN_RP_ORIGINS"`
+	WebAuthnTimeout         time.Duration        `mapstructure:"WEBAUTHN_TIMEOUT"`
+	// StepUpThresholds is set as a list of currency:amount pairs, transfers above
+	// the amount for their currency require the user to authenticate again
+	StepUpThresholds map[string]int64 `mapstructure:"STEP_UP_THRESHOLDS"`
+	StepUpDuration   time.Duration    `mapstructure:"STEP_UP_DURATION"`
+	// TransactionPINMaxAttempts wrong pins in a row lock the pin for TransactionPINLockoutDuration
+	TransactionPINMaxAttempts     int           `mapstructure:"TRANSACTION_PIN_MAX_ATTEMPTS"`
+	TransactionPINLockoutDuration time.Duration `mapstructure:"TRANSACTION_PIN_LOCKOUT_DURATION"`
+}
+
+// OIDCProviderConfig is a single sign-on provider users can log in with
+type OIDCProviderConfig struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+	// LinkByEmail links a new identity to the user with the same verified email. Only
+	// set it for providers trusted to vouch for the email addresses they assert.
+	LinkByEmail bool `json:"link_by_email"`
 }
 
 func LoadConfig(path string) (config Config, err error) {
@@ -20,12 +92,66 @@ func LoadConfig(path string) (config Config, err error) {
 	viper.SetConfigType("env")
 
 	viper.AutomaticEnv()
+	// the auth cookies are only sent over https unless it is turned off explicitly
+	viper.SetDefault("AUTH_COOKIE_SECURE", true)
 
 	err = viper.ReadInConfig()
 	if err != nil {
 		return
 	}
 
-	err = viper.Unmarshal(&config)
+	err = viper.Unmarshal(&config, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		stringToOIDCProvidersHookFunc(),
+		stringToAmountsHookFunc(),
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	)))
 	return
 }
+
+// stringToOIDCProvidersHookFunc decodes the JSON array of providers set in the environment
+func stringToOIDCProvidersHookFunc() mapstructure.DecodeHookFuncType {
+	return func(from reflect.Type, to reflect.Type, data any) (any, error) {
+		if from.Kind() != reflect.String || to != reflect.TypeOf([]OIDCProviderConfig{}) {
+			return data, nil
+		}
+
+		var providers []OIDCProviderConfig
+		if data.(string) == "" {
+			return providers, nil
+		}
+
+		err := json.Unmarshal([]byte(data.(string)), &providers)
+		return providers, err
+	}
+}
+
+// stringToAmountsHookFunc decodes a list of currency:amount pairs set in the environment,
+// such as USD:10000,EUR:10000
+func stringToAmountsHookFunc() mapstructure.DecodeHookFuncType {
+	return func(from reflect.Type, to reflect.Type, data any) (any, error) {
+		if from.Kind() != reflect.String || to != reflect.TypeOf(map[string]int64{}) {
+			return data, nil
+		}
+
+		amounts := make(map[string]int64)
+		for _, pair := range strings.Split(data.(string), ",") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+
+			currency, amount, found := strings.Cut(pair, ":")
+			if !found {
+				return nil, fmt.Errorf("invalid currency amount %q, expected currency:amount", pair)
+			}
+
+			value, err := strconv.ParseInt(amount, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid amount for currency %s: %w", currency, err)
+			}
+			amounts[currency] = value
+		}
+		return amounts, nil
+	}
+}
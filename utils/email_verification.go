@@ -0,0 +1,18 @@
+package utils
+
+// Constants for the supported email verification policies, each one
+// blocks more than the previous one until the user verifies their email
+const (
+	VerifyEmailOptional     = "none"
+	VerifyEmailForTransfers = "transfers"
+	VerifyEmailForAccounts  = "accounts"
+)
+
+// IsSupportedEmailVerificationPolicy returns true if the policy is supported
+func IsSupportedEmailVerificationPolicy(policy string) bool {
+	switch policy {
+	case VerifyEmailOptional, VerifyEmailForTransfers, VerifyEmailForAccounts:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryption(t *testing.T) {
+	key := []byte(RandomString(EncryptionKeySize))
+	plaintext := []byte(RandomString(20))
+
+	ciphertext1, err := Encrypt(key, plaintext)
+	require.NoError(t, err)
+	require.NotContains(t, string(ciphertext1), string(plaintext))
+
+	ciphertext2, err := Encrypt(key, plaintext)
+	require.NoError(t, err)
+	require.NotEqual(t, ciphertext1, ciphertext2)
+
+	decrypted, err := Decrypt(key, ciphertext1)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+
+	otherKey := []byte(RandomString(EncryptionKeySize))
+	_, err = Decrypt(otherKey, ciphertext1)
+	require.ErrorIs(t, err, ErrDecryption)
+
+	ciphertext1[len(ciphertext1)-1] ^= 1
+	_, err = Decrypt(key, ciphertext1)
+	require.ErrorIs(t, err, ErrDecryption)
+
+	_, err = Encrypt([]byte("short"), plaintext)
+	require.Error(t, err)
+}
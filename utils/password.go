@@ -1,12 +1,62 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword returns the bcrypt hash of the password
+// Password hashers that can be selected with PASSWORD_HASHER
+const (
+	PasswordHasherBcrypt   = "bcrypt"
+	PasswordHasherArgon2id = "argon2id"
+)
+
+// ErrMismatchedPassword is returned by CheckPassword for a wrong password, whatever the algorithm
+var ErrMismatchedPassword = bcrypt.ErrMismatchedHashAndPassword
+
+var errInvalidPasswordHash = errors.New("invalid password hash")
+
+// PasswordHasher hashes new passwords, and tells which stored hashes were made
+// with other settings and should be replaced at the next successful login
+type PasswordHasher interface {
+	HashPassword(password string) (string, error)
+	NeedsRehash(hashedPassword string) bool
+}
+
+// NewPasswordHasher creates the password hasher selected by config.PasswordHasher
+func NewPasswordHasher(config Config) (PasswordHasher, error) {
+	switch config.PasswordHasher {
+	case PasswordHasherBcrypt, "":
+		cost := config.BcryptCost
+		if cost == 0 {
+			cost = bcrypt.DefaultCost
+		}
+		return NewBcryptHasher(cost)
+	case PasswordHasherArgon2id:
+		params := DefaultArgon2idParams
+		if config.Argon2Time != 0 {
+			params.Time = uint32(config.Argon2Time)
+		}
+		if config.Argon2Memory != 0 {
+			params.Memory = uint32(config.Argon2Memory)
+		}
+		if config.Argon2Threads != 0 {
+			params.Threads = uint8(config.Argon2Threads)
+		}
+		return NewArgon2idHasher(params)
+	default:
+		return nil, fmt.Errorf("unsupported password hasher %q", config.PasswordHasher)
+	}
+}
+
+// HashPassword returns the bcrypt hash of the password, at the default cost
 func HashPassword(password string) (string, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -15,7 +65,146 @@ func HashPassword(password string) (string, error) {
 	return string(hashedPassword), nil
 }
 
-// CheckPassword checks if the provided password is correct or not
+// CheckPassword checks if the provided password is correct or not, against a
+// hash made by any of the supported algorithms
 func CheckPassword(password string, hashedPassword string) error {
+	if strings.HasPrefix(hashedPassword, argon2idPrefix) {
+		hash, err := parseArgon2idHash(hashedPassword)
+		if err != nil {
+			return err
+		}
+
+		key := hash.params.key(password, hash.salt, uint32(len(hash.key)))
+		if subtle.ConstantTimeCompare(key, hash.key) != 1 {
+			return ErrMismatchedPassword
+		}
+		return nil
+	}
+
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
+
+type bcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) (PasswordHasher, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("invalid bcrypt cost %d: must be between %d and %d", cost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return &bcryptHasher{cost: cost}, nil
+}
+
+func (hasher *bcryptHasher) HashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), hasher.cost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hashedPassword), nil
+}
+
+func (hasher *bcryptHasher) NeedsRehash(hashedPassword string) bool {
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	return err != nil || cost != hasher.cost
+}
+
+// Argon2idParams are the cost parameters of argon2id, memory is in KiB
+type Argon2idParams struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// DefaultArgon2idParams are the ones recommended by RFC 9106 for memory-constrained environments
+var DefaultArgon2idParams = Argon2idParams{
+	Time:    3,
+	Memory:  64 * 1024,
+	Threads: 4,
+}
+
+func (params Argon2idParams) key(password string, salt []byte, keyLen uint32) []byte {
+	return argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, keyLen)
+}
+
+const (
+	argon2idPrefix  = "$argon2id$"
+	argon2idSaltLen = 16
+	argon2idKeyLen  = 32
+)
+
+type argon2idHasher struct {
+	params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) (PasswordHasher, error) {
+	if params.Time < 1 || params.Threads < 1 || params.Memory < 8*uint32(params.Threads) {
+		return nil, fmt.Errorf("invalid argon2id parameters %+v", params)
+	}
+	return &argon2idHasher{params: params}, nil
+}
+
+// HashPassword returns the argon2id hash of the password in PHC string format,
+// e.g. $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+func (hasher *argon2idHasher) HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2idSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	key := hasher.params.key(password, salt, argon2idKeyLen)
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		hasher.params.Memory,
+		hasher.params.Time,
+		hasher.params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (hasher *argon2idHasher) NeedsRehash(hashedPassword string) bool {
+	hash, err := parseArgon2idHash(hashedPassword)
+	if err != nil {
+		return true
+	}
+	return hash.params != hasher.params || len(hash.salt) != argon2idSaltLen || len(hash.key) != argon2idKeyLen
+}
+
+type argon2idHash struct {
+	params Argon2idParams
+	salt   []byte
+	key    []byte
+}
+
+func parseArgon2idHash(hashedPassword string) (argon2idHash, error) {
+	var hash argon2idHash
+
+	fields := strings.Split(hashedPassword, "$")
+	if len(fields) != 6 || fields[1] != "argon2id" {
+		return hash, errInvalidPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(fields[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return hash, errInvalidPasswordHash
+	}
+
+	_, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &hash.params.Memory, &hash.params.Time, &hash.params.Threads)
+	if err != nil {
+		return hash, errInvalidPasswordHash
+	}
+
+	hash.salt, err = base64.RawStdEncoding.DecodeString(fields[4])
+	if err != nil {
+		return hash, errInvalidPasswordHash
+	}
+
+	hash.key, err = base64.RawStdEncoding.DecodeString(fields[5])
+	if err != nil || len(hash.key) == 0 {
+		return hash, errInvalidPasswordHash
+	}
+
+	return hash, nil
+}
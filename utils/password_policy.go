@@ -0,0 +1,68 @@
+package utils
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxPasswordLength is the longest password accepted, bcrypt ignores any byte past it
+const MaxPasswordLength = 72
+
+// DefaultPasswordMinLength is used when PASSWORD_MIN_LENGTH is not set
+const DefaultPasswordMinLength = 8
+
+var errCommonPassword = errors.New("password is too common, please choose another one")
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = parseCommonPasswords(commonPasswordList)
+
+func parseCommonPasswords(list string) map[string]struct{} {
+	passwords := make(map[string]struct{})
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = struct{}{}
+	}
+	return passwords
+}
+
+// PasswordPolicy decides which new passwords users are allowed to choose
+type PasswordPolicy struct {
+	MinLength int
+}
+
+// NewPasswordPolicy creates the password policy from config
+func NewPasswordPolicy(config Config) PasswordPolicy {
+	minLength := config.PasswordMinLength
+	if minLength == 0 {
+		minLength = DefaultPasswordMinLength
+	}
+	return PasswordPolicy{MinLength: minLength}
+}
+
+// Validate returns an error explaining why the password is not acceptable, or nil
+func (policy PasswordPolicy) Validate(password string) error {
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", policy.MinLength)
+	}
+	if len(password) > MaxPasswordLength {
+		return fmt.Errorf("password must be at most %d bytes long", MaxPasswordLength)
+	}
+	if IsCommonPassword(password) {
+		return errCommonPassword
+	}
+	return nil
+}
+
+// IsCommonPassword reports whether the password is on the embedded denylist, ignoring case
+func IsCommonPassword(password string) bool {
+	_, ok := commonPasswords[strings.ToLower(password)]
+	return ok
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := NewPasswordPolicy(Config{})
+	require.Equal(t, DefaultPasswordMinLength, policy.MinLength)
+
+	testCases := []struct {
+		name     string
+		password string
+		valid    bool
+	}{
+		{name: "OK", password: RandomString(12), valid: true},
+		{name: "TooShort", password: "abc12", valid: false},
+		{name: "MultibyteLongEnough", password: "päßwörtér", valid: true},
+		{name: "TooLong", password: strings.Repeat("a", MaxPasswordLength+1), valid: false},
+		{name: "Common", password: "password123", valid: false},
+		{name: "CommonDifferentCase", password: "PassWord123", valid: false},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.Validate(tc.password)
+			if tc.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestCommonPasswordList(t *testing.T) {
+	require.NotEmpty(t, commonPasswords)
+	require.True(t, IsCommonPassword("qwerty"))
+	require.False(t, IsCommonPassword("# one password per line."))
+	require.False(t, IsCommonPassword(""))
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -26,3 +27,90 @@ func TestPassword(t *testing.T) {
 	require.NotEmpty(t, hashedPassword2)
 	require.NotEqual(t, hashedPassword1, hashedPassword2)
 }
+
+func TestArgon2idHasher(t *testing.T) {
+	params := Argon2idParams{Time: 1, Memory: 8 * 1024, Threads: 1}
+	hasher, err := NewArgon2idHasher(params)
+	require.NoError(t, err)
+
+	password := RandomString(10)
+	hashedPassword, err := hasher.HashPassword(password)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hashedPassword, "$argon2id$v=19$m=8192,t=1,p=1$"))
+	require.False(t, hasher.NeedsRehash(hashedPassword))
+
+	require.NoError(t, CheckPassword(password, hashedPassword))
+	require.ErrorIs(t, CheckPassword(RandomString(10), hashedPassword), ErrMismatchedPassword)
+
+	// the hash keeps its own parameters, so it still checks after they change
+	stronger, err := NewArgon2idHasher(Argon2idParams{Time: 2, Memory: 8 * 1024, Threads: 1})
+	require.NoError(t, err)
+	require.True(t, stronger.NeedsRehash(hashedPassword))
+	require.NoError(t, CheckPassword(password, hashedPassword))
+
+	_, err = NewArgon2idHasher(Argon2idParams{})
+	require.Error(t, err)
+}
+
+func TestBcryptHasher(t *testing.T) {
+	hasher, err := NewBcryptHasher(bcrypt.MinCost)
+	require.NoError(t, err)
+
+	password := RandomString(10)
+	hashedPassword, err := hasher.HashPassword(password)
+	require.NoError(t, err)
+	require.False(t, hasher.NeedsRehash(hashedPassword))
+	require.NoError(t, CheckPassword(password, hashedPassword))
+
+	stronger, err := NewBcryptHasher(bcrypt.MinCost + 1)
+	require.NoError(t, err)
+	require.True(t, stronger.NeedsRehash(hashedPassword))
+
+	_, err = NewBcryptHasher(bcrypt.MaxCost + 1)
+	require.Error(t, err)
+}
+
+func TestPasswordHasherMigration(t *testing.T) {
+	password := RandomString(10)
+	bcryptHash, err := HashPassword(password)
+	require.NoError(t, err)
+
+	argon2idHasher, err := NewArgon2idHasher(Argon2idParams{Time: 1, Memory: 8 * 1024, Threads: 1})
+	require.NoError(t, err)
+	argon2idHash, err := argon2idHasher.HashPassword(password)
+	require.NoError(t, err)
+
+	bcryptHasher, err := NewBcryptHasher(bcrypt.DefaultCost)
+	require.NoError(t, err)
+
+	require.True(t, argon2idHasher.NeedsRehash(bcryptHash))
+	require.True(t, bcryptHasher.NeedsRehash(argon2idHash))
+}
+
+func TestCheckPasswordInvalidHash(t *testing.T) {
+	for _, hashedPassword := range []string{
+		"",
+		"$argon2id$v=19$m=8192,t=1,p=1$c2FsdA",
+		"$argon2id$v=18$m=8192,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=8192,t=1,p=1$!!!$a2V5",
+	} {
+		require.Error(t, CheckPassword("password", hashedPassword), hashedPassword)
+	}
+}
+
+func TestNewPasswordHasher(t *testing.T) {
+	hasher, err := NewPasswordHasher(Config{})
+	require.NoError(t, err)
+	require.IsType(t, &bcryptHasher{}, hasher)
+	require.Equal(t, bcrypt.DefaultCost, hasher.(*bcryptHasher).cost)
+
+	hasher, err = NewPasswordHasher(Config{PasswordHasher: PasswordHasherArgon2id, Argon2Time: 2})
+	require.NoError(t, err)
+	require.IsType(t, &argon2idHasher{}, hasher)
+	require.Equal(t, uint32(2), hasher.(*argon2idHasher).params.Time)
+	require.Equal(t, DefaultArgon2idParams.Memory, hasher.(*argon2idHasher).params.Memory)
+
+	_, err = NewPasswordHasher(Config{PasswordHasher: "md5"})
+	require.Error(t, err)
+}
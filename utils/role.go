@@ -0,0 +1,17 @@
+package utils
+
+// Constants for all user roles
+const (
+	DepositorRole = "depositor"
+	BankerRole    = "banker"
+	AdminRole     = "admin"
+)
+
+// IsStaffRole returns true if the role may access any customer's accounts
+func IsStaffRole(role string) bool {
+	switch role {
+	case BankerRole, AdminRole:
+		return true
+	}
+	return false
+}
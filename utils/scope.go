@@ -0,0 +1,22 @@
+package utils
+
+// Constants for all scopes a token or an api key can be limited to
+const (
+	ScopeAccountsRead   = "accounts:read"
+	ScopeAccountsWrite  = "accounts:write"
+	ScopeTransfersWrite = "transfers:write"
+)
+
+// IsSupportedScope returns true if the scope is supported
+func IsSupportedScope(scope string) bool {
+	switch scope {
+	case ScopeAccountsRead, ScopeAccountsWrite, ScopeTransfersWrite:
+		return true
+	}
+	return false
+}
+
+// AllScopes returns every supported scope, the ones granted when none are asked for
+func AllScopes() []string {
+	return []string{ScopeAccountsRead, ScopeAccountsWrite, ScopeTransfersWrite}
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+const secretTokenBytes = 32
+
+// NewSecretToken returns a random url-safe token to hand out to the user,
+// together with the hash of it that is kept in the database
+func NewSecretToken() (token string, tokenHash string, err error) {
+	buf := make([]byte, secretTokenBytes)
+	if _, err = rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate secret token: %w", err)
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashSecretToken(token), nil
+}
+
+// HashSecretToken returns the hex sha256 of the token. The tokens are random
+// enough that a fast unsalted hash is all that is needed to look them up.
+func HashSecretToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretToken(t *testing.T) {
+	token1, tokenHash1, err := NewSecretToken()
+	require.NoError(t, err)
+	require.NotEmpty(t, token1)
+	require.Equal(t, HashSecretToken(token1), tokenHash1)
+	require.NotContains(t, tokenHash1, token1)
+
+	token2, tokenHash2, err := NewSecretToken()
+	require.NoError(t, err)
+	require.NotEqual(t, token1, token2)
+	require.NotEqual(t, tokenHash1, tokenHash2)
+}